@@ -0,0 +1,256 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/thanos-io/objstore/internal/lru"
+)
+
+// CacheConfig configures a bucket returned by WrapWithCache.
+type CacheConfig struct {
+	// MaxSizeBytes is the maximum total size of the cached objects. The least recently used
+	// objects are evicted once it is exceeded.
+	MaxSizeBytes int64
+	// MaxObjectSizeBytes is the maximum size of a single object to be cached. Larger objects are
+	// always fetched from the wrapped bucket.
+	MaxObjectSizeBytes int64
+}
+
+func (c CacheConfig) validate() error {
+	if c.MaxSizeBytes <= 0 {
+		return errors.New("max size must be positive")
+	}
+	if c.MaxObjectSizeBytes <= 0 || c.MaxObjectSizeBytes > c.MaxSizeBytes {
+		return errors.New("max object size must be positive and not larger than max size")
+	}
+	return nil
+}
+
+// WrapWithCache returns a bucket which caches the content of small objects returned by Get in memory.
+// Get requests the attributes of cached objects to check that the cached content is still up to date:
+// entries are keyed by the object name and its ETag, or its modification time and size for providers
+// which don't support ETags. Objects which aren't cached are fetched together with their attributes, in a
+// single request for providers implementing AttributedGetter. GetRange and all other reads are passed
+// through to bkt. Writes and deletes through the returned bucket remove the object from the cache.
+// Concurrent Get calls for the same object share a single request to bkt. Cache hits and misses are
+// counted and registered with reg, if not nil.
+//
+// Unlike the wrappers in the providers/cache and providers/diskcache packages, which cache attributes and
+// listings in a shared cache and large objects on local disk respectively, the returned bucket needs no
+// configuration beyond its size and sees changes by other clients immediately.
+func WrapWithCache(bkt Bucket, cfg CacheConfig, reg prometheus.Registerer) (Bucket, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate cache config")
+	}
+	return &cachingBucket{
+		bkt:     bkt,
+		cfg:     cfg,
+		entries: lru.New[cacheEntry](cfg.MaxSizeBytes),
+		hits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "objstore_bucket_cache_hits_total",
+			Help:        "Total number of Get operations against a bucket served from the in-memory cache.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}),
+		misses: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "objstore_bucket_cache_misses_total",
+			Help:        "Total number of Get operations against a bucket for cacheable objects which were not cached.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}),
+	}, nil
+}
+
+type cachingBucket struct {
+	bkt Bucket
+	cfg CacheConfig
+
+	mtx     sync.Mutex
+	entries *lru.LRU[cacheEntry]
+
+	fetches singleflight.Group
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+type cacheEntry struct {
+	version string
+	data    []byte
+}
+
+// errNotCacheable is returned by fetch for objects larger than CacheConfig.MaxObjectSizeBytes.
+var errNotCacheable = errors.New("object too large to be cached")
+
+// objectVersion returns a string which changes whenever the object is overwritten.
+func objectVersion(attrs ObjectAttributes) string {
+	if attrs.ETag != "" {
+		return attrs.ETag
+	}
+	return strconv.FormatInt(attrs.LastModified.UnixNano(), 10) + "-" + strconv.FormatInt(attrs.Size, 10)
+}
+
+func (b *cachingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if entry, ok := b.get(name); ok {
+		attrs, err := b.bkt.Attributes(ctx, name)
+		if err == nil && objectVersion(attrs) == entry.version {
+			b.hits.Inc()
+			return NopCloserWithSize(bytes.NewReader(entry.data)), nil
+		}
+	}
+
+	// The fetch is shared by concurrent calls, so it must not be canceled with the context of the call which
+	// started it. Each call still returns once its own context is canceled.
+	res := b.fetches.DoChan(name, func() (interface{}, error) {
+		return b.fetch(detachedContext{ctx}, name)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-res:
+		if r.Err != nil {
+			// Let the wrapped bucket report errors and return objects which are too large to be cached, so that
+			// they are the same as without the cache.
+			return b.bkt.Get(ctx, name)
+		}
+		b.misses.Inc()
+		return NopCloserWithSize(bytes.NewReader(r.Val.([]byte))), nil
+	}
+}
+
+// fetch reads the object from the wrapped bucket and caches its content.
+func (b *cachingBucket) fetch(ctx context.Context, name string) ([]byte, error) {
+	rc, attrs, err := GetWithAttributes(ctx, b.bkt, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	if attrs.Size > b.cfg.MaxObjectSizeBytes {
+		return nil, errNotCacheable
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, b.cfg.MaxObjectSizeBytes+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", name)
+	}
+	if int64(len(data)) > b.cfg.MaxObjectSizeBytes {
+		return nil, errNotCacheable
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.entries.Add(name, cacheEntry{version: objectVersion(attrs), data: data}, int64(len(data)))
+	return data, nil
+}
+
+func (b *cachingBucket) get(name string) (cacheEntry, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.entries.Get(name)
+}
+
+func (b *cachingBucket) invalidate(name string) {
+	// Calls after the change must not join a fetch which started before it.
+	b.fetches.Forget(name)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.entries.Remove(name)
+}
+
+// detachedContext carries the values of a context, but not its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (b *cachingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *cachingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *cachingBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *cachingBucket) SupportedIterOptions() []IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *cachingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *cachingBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *cachingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	defer b.invalidate(name)
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *cachingBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	defer b.invalidate(name)
+	return UploadIfNotExists(ctx, b.bkt, name, r)
+}
+
+func (b *cachingBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	defer b.invalidate(name)
+	return UploadIfMatch(ctx, b.bkt, name, r, etag, opts...)
+}
+
+func (b *cachingBucket) Delete(ctx context.Context, name string) error {
+	defer b.invalidate(name)
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *cachingBucket) DeleteMany(ctx context.Context, names []string) error {
+	defer func() {
+		for _, name := range names {
+			b.invalidate(name)
+		}
+	}()
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *cachingBucket) Copy(ctx context.Context, src, dst string) error {
+	defer b.invalidate(dst)
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+func (b *cachingBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *cachingBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *cachingBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *cachingBucket) Name() string {
+	return b.bkt.Name()
+}
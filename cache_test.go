@@ -0,0 +1,159 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/atomic"
+)
+
+// getCountingBucket counts the calls to Get and delays them.
+type getCountingBucket struct {
+	Bucket
+	gets  atomic.Int64
+	delay time.Duration
+}
+
+func (b *getCountingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.gets.Inc()
+	time.Sleep(b.delay)
+	return b.Bucket.Get(ctx, name)
+}
+
+func readAll(t *testing.T, bkt Bucket, name string) string {
+	t.Helper()
+
+	rc, err := bkt.Get(context.Background(), name)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rc.Close()) }()
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	return string(content)
+}
+
+func TestCachingBucket_Acceptance(t *testing.T) {
+	bkt, err := WrapWithCache(NewInMemBucket(), CacheConfig{MaxSizeBytes: 1024, MaxObjectSizeBytes: 128}, nil)
+	testutil.Ok(t, err)
+	AcceptanceTest(t, bkt)
+}
+
+func TestCachingBucket(t *testing.T) {
+	ctx := context.Background()
+	inner := &getCountingBucket{Bucket: NewInMemBucket()}
+	wrapped, err := WrapWithCache(inner, CacheConfig{MaxSizeBytes: 10, MaxObjectSizeBytes: 5}, nil)
+	testutil.Ok(t, err)
+	bkt := wrapped.(*cachingBucket)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+	testutil.Equals(t, "aaaa", readAll(t, bkt, "a"))
+	testutil.Equals(t, "aaaa", readAll(t, bkt, "a"))
+	testutil.Equals(t, int64(1), inner.gets.Load())
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.hits))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.misses))
+
+	// Uploads invalidate the cached content.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("bbbb")))
+	testutil.Equals(t, "bbbb", readAll(t, bkt, "a"))
+	testutil.Equals(t, int64(2), inner.gets.Load())
+
+	// Objects larger than the max object size are not cached.
+	testutil.Ok(t, bkt.Upload(ctx, "large", strings.NewReader("llllll")))
+	testutil.Equals(t, "llllll", readAll(t, bkt, "large"))
+	testutil.Equals(t, "llllll", readAll(t, bkt, "large"))
+	testutil.Equals(t, int64(6), inner.gets.Load())
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.misses))
+
+	// GetRange bypasses the cache.
+	rc, err := bkt.GetRange(ctx, "a", 1, 2)
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "bb", string(content))
+
+	// Caching b and c evicts the least recently used entry a.
+	testutil.Ok(t, bkt.Upload(ctx, "b", strings.NewReader("bbbb")))
+	testutil.Ok(t, bkt.Upload(ctx, "c", strings.NewReader("cccc")))
+	readAll(t, bkt, "b")
+	readAll(t, bkt, "c")
+	testutil.Equals(t, int64(8), bkt.entries.Size())
+	testutil.Assert(t, !bkt.entries.Contains("a"), "expected a to be evicted")
+
+	// Deletes invalidate the cached content.
+	testutil.Ok(t, bkt.Delete(ctx, "b"))
+	testutil.Assert(t, !bkt.entries.Contains("b"), "expected b to be removed")
+	_, err = bkt.Get(ctx, "b")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+}
+
+func TestCachingBucket_ConcurrentGet(t *testing.T) {
+	ctx := context.Background()
+	inner := &getCountingBucket{Bucket: NewInMemBucket(), delay: 100 * time.Millisecond}
+	bkt, err := WrapWithCache(inner, CacheConfig{MaxSizeBytes: 10, MaxObjectSizeBytes: 5}, nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rc, err := bkt.Get(ctx, "a")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer rc.Close()
+			if content, err := io.ReadAll(rc); err != nil || string(content) != "aaaa" {
+				t.Errorf("unexpected content %q, err: %v", content, err)
+			}
+		}()
+	}
+	wg.Wait()
+	testutil.Equals(t, int64(1), inner.gets.Load())
+}
+
+func TestCachingBucket_CanceledGet(t *testing.T) {
+	inner := &getCountingBucket{Bucket: NewInMemBucket(), delay: 100 * time.Millisecond}
+	bkt, err := WrapWithCache(inner, CacheConfig{MaxSizeBytes: 10, MaxObjectSizeBytes: 5}, nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(context.Background(), "a", strings.NewReader("aaaa")))
+
+	// Canceling the call which started the fetch returns it, but doesn't fail the other calls sharing the fetch.
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := bkt.Get(ctx, "a")
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		_, err := bkt.Get(context.Background(), "a")
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	testutil.Equals(t, context.Canceled, <-errs)
+	testutil.Ok(t, <-errs)
+	testutil.Equals(t, int64(1), inner.gets.Load())
+}
+
+func TestWrapWithCache_InvalidConfig(t *testing.T) {
+	for _, cfg := range []CacheConfig{
+		{MaxSizeBytes: 0, MaxObjectSizeBytes: 0},
+		{MaxSizeBytes: 10, MaxObjectSizeBytes: 0},
+		{MaxSizeBytes: 10, MaxObjectSizeBytes: 11},
+	} {
+		_, err := WrapWithCache(NewInMemBucket(), cfg, nil)
+		testutil.NotOk(t, err)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/providers/azure"
+	"github.com/thanos-io/objstore/providers/b2"
 	"github.com/thanos-io/objstore/providers/bos"
 	"github.com/thanos-io/objstore/providers/cos"
 	"github.com/thanos-io/objstore/providers/filesystem"
@@ -17,6 +19,7 @@ import (
 	"github.com/thanos-io/objstore/providers/obs"
 	"github.com/thanos-io/objstore/providers/oci"
 	"github.com/thanos-io/objstore/providers/oss"
+	"github.com/thanos-io/objstore/providers/r2"
 	"github.com/thanos-io/objstore/providers/s3"
 	"github.com/thanos-io/objstore/providers/swift"
 
@@ -39,17 +42,39 @@ const (
 	BOS        ObjProvider = "BOS"
 	OCI        ObjProvider = "OCI"
 	OBS        ObjProvider = "OBS"
+	B2         ObjProvider = "B2"
+	R2         ObjProvider = "R2"
+	INMEM      ObjProvider = "INMEM"
 )
 
+// supportedProviders lists the provider types NewBucket can create, in the order they are reported in errors.
+var supportedProviders = []ObjProvider{FILESYSTEM, GCS, S3, AZURE, SWIFT, COS, ALIYUNOSS, BOS, OCI, OBS, B2, R2, INMEM}
+
 type BucketConfig struct {
 	Type   ObjProvider `yaml:"type"`
 	Config interface{} `yaml:"config"`
 	Prefix string      `yaml:"prefix" default:""`
+	// ValidateOnCreate makes NewBucket check that the bucket exists and can be accessed with the
+	// configured credentials before returning it, for providers which support health checks.
+	ValidateOnCreate bool `yaml:"validate_on_create"`
 }
 
+// validateTimeout is the maximum time NewBucket waits for the bucket to be validated.
+const validateTimeout = 30 * time.Second
+
 // NewBucket initializes and returns new object storage clients.
 // NOTE: confContentYaml can contain secrets.
 func NewBucket(logger log.Logger, confContentYaml []byte, component string) (objstore.Bucket, error) {
+	return NewBucketWithContext(context.Background(), logger, confContentYaml, component)
+}
+
+// NewBucketWithContext initializes and returns a new object storage client of the provider given by the type
+// field of the YAML configuration, configured with its config block. The context is used by providers which
+// send requests while being created, e.g. to look up credentials, and to validate the bucket if
+// validate_on_create is set. The returned bucket can be wrapped like any other, e.g. with
+// objstore.WrapWithMetrics or the tracing packages.
+// NOTE: confContentYaml can contain secrets.
+func NewBucketWithContext(ctx context.Context, logger log.Logger, confContentYaml []byte, component string) (objstore.Bucket, error) {
 	level.Info(logger).Log("msg", "loading bucket configuration")
 	bucketConf := &BucketConfig{}
 	if err := yaml.UnmarshalStrict(confContentYaml, bucketConf); err != nil {
@@ -64,7 +89,7 @@ func NewBucket(logger log.Logger, confContentYaml []byte, component string) (obj
 	var bucket objstore.Bucket
 	switch strings.ToUpper(string(bucketConf.Type)) {
 	case string(GCS):
-		bucket, err = gcs.NewBucket(context.Background(), logger, config, component)
+		bucket, err = gcs.NewBucket(ctx, logger, config, component)
 	case string(S3):
 		bucket, err = s3.NewBucket(logger, config, component)
 	case string(AZURE):
@@ -83,12 +108,62 @@ func NewBucket(logger log.Logger, confContentYaml []byte, component string) (obj
 		bucket, err = oci.NewBucket(logger, config)
 	case string(OBS):
 		bucket, err = obs.NewBucket(logger, config)
+	case string(B2):
+		bucket, err = b2.NewBucket(logger, config, component)
+	case string(R2):
+		bucket, err = r2.NewBucket(logger, config, component)
+	case string(INMEM):
+		if bucketConf.Config != nil {
+			return nil, errors.New("the INMEM bucket has no config")
+		}
+		bucket = objstore.NewInMemBucket()
 	default:
-		return nil, errors.Errorf("bucket with type %s is not supported", bucketConf.Type)
+		names := make([]string, 0, len(supportedProviders))
+		for _, p := range supportedProviders {
+			names = append(names, string(p))
+		}
+		return nil, errors.Errorf("bucket with type %s is not supported, supported types are: %s", bucketConf.Type, strings.Join(names, ", "))
 	}
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("create %s client", bucketConf.Type))
 	}
 
+	if bucketConf.ValidateOnCreate {
+		if err := validateBucket(ctx, logger, bucket, bucketConf.Type); err != nil {
+			_ = bucket.Close()
+			return nil, err
+		}
+	}
+
 	return objstore.NewPrefixedBucket(bucket, bucketConf.Prefix), nil
 }
+
+// writableChecker is implemented by buckets which don't check in Ping whether they can be written to, e.g. because
+// this requires writing a file, and check it separately when they are validated.
+type writableChecker interface {
+	CheckWritable(ctx context.Context) error
+}
+
+// validateBucket pings the bucket and returns an error describing the most common misconfigurations.
+func validateBucket(ctx context.Context, logger log.Logger, bkt objstore.Bucket, typ ObjProvider) error {
+	err := objstore.PingWithTimeout(ctx, bkt, validateTimeout)
+	if w, ok := bkt.(writableChecker); ok && err == nil {
+		ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+		defer cancel()
+		err = w.CheckWritable(ctx)
+	}
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, objstore.ErrHealthCheckNotSupported):
+		level.Warn(logger).Log("msg", "skipping bucket validation, not supported by provider", "type", typ)
+		return nil
+	case objstore.IsNotFoundErr(err):
+		return errors.Wrapf(err, "validate %s bucket %s: bucket does not exist", typ, bkt.Name())
+	case objstore.IsPermissionDeniedErr(err):
+		return errors.Wrapf(err, "validate %s bucket %s: permission denied, check the configured credentials", typ, bkt.Name())
+	case errors.Is(err, context.DeadlineExceeded):
+		return errors.Wrapf(err, "validate %s bucket %s: no response within %s, check the endpoint and network connectivity", typ, bkt.Name(), validateTimeout)
+	}
+	return errors.Wrapf(err, "validate %s bucket %s", typ, bkt.Name())
+}
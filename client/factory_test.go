@@ -7,7 +7,11 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
 
+	"github.com/efficientgo/core/testutil"
 	"github.com/go-kit/log"
 	"go.opentelemetry.io/otel/trace"
 
@@ -89,3 +93,34 @@ func ExampleTracingBucketUsingOpenTelemetry() { //nolint:govet
 	// Output:
 	// false
 }
+
+func TestNewBucket_ValidateOnCreate(t *testing.T) {
+	dir := t.TempDir()
+	conf := func(dir string) []byte {
+		return []byte("type: FILESYSTEM\nconfig:\n  directory: " + dir + "\nvalidate_on_create: true\n")
+	}
+
+	bkt, err := NewBucket(log.NewNopLogger(), conf(dir), "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Close())
+
+	_, err = NewBucket(log.NewNopLogger(), conf(filepath.Join(dir, "missing")), "test")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "bucket does not exist"), "unexpected error: %v", err)
+}
+
+func TestNewBucket_Types(t *testing.T) {
+	bkt, err := NewBucketWithContext(context.Background(), log.NewNopLogger(), []byte("type: inmem\nprefix: tenant\n"), "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(context.Background(), "obj", strings.NewReader("content")))
+	exists, err := bkt.Exists(context.Background(), "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists, "expected object to exist")
+
+	_, err = NewBucket(log.NewNopLogger(), []byte("type: INMEM\nconfig:\n  directory: dir\n"), "test")
+	testutil.NotOk(t, err)
+
+	_, err = NewBucket(log.NewNopLogger(), []byte("type: UNKNOWN\n"), "test")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "supported types are: FILESYSTEM, GCS, S3"), "unexpected error: %v", err)
+}
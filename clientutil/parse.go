@@ -6,6 +6,7 @@ package clientutil
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -63,3 +64,14 @@ func ParseLastModified(m http.Header, f string) (time.Time, error) {
 
 	return mod, nil
 }
+
+// ParseETag returns the entity tag parsed from the ETag HTTP header in input, without the surrounding quotes.
+// An empty string is returned if the header is not set.
+func ParseETag(m http.Header) string {
+	return TrimETag(m.Get("ETag"))
+}
+
+// TrimETag removes the surrounding quotes and the weak validator prefix from the given entity tag.
+func TrimETag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
@@ -108,3 +108,18 @@ func TestParseContentLength(t *testing.T) {
 		})
 	}
 }
+
+func TestParseETag(t *testing.T) {
+	for headerValue, expected := range map[string]string{
+		"":                                     "",
+		"d41d8cd98f00b204e9800998ecf8427e":     "d41d8cd98f00b204e9800998ecf8427e",
+		`"d41d8cd98f00b204e9800998ecf8427e"`:   "d41d8cd98f00b204e9800998ecf8427e",
+		`W/"d41d8cd98f00b204e9800998ecf8427e"`: "d41d8cd98f00b204e9800998ecf8427e",
+	} {
+		meta := http.Header{}
+		if headerValue != "" {
+			meta.Add("ETag", headerValue)
+		}
+		testutil.Equals(t, expected, ParseETag(meta))
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies the cause of a BucketError independently of the provider which returned it.
+type ErrorKind int
+
+const (
+	// ErrKindUnknown is used for errors which don't fall into any of the other kinds.
+	ErrKindUnknown ErrorKind = iota
+	// ErrKindNotFound is used if the object or bucket does not exist.
+	ErrKindNotFound
+	// ErrKindPermissionDenied is used if the credentials are missing or not allowed to perform the operation.
+	ErrKindPermissionDenied
+	// ErrKindRateLimit is used if the request was throttled by the provider and can be retried later.
+	ErrKindRateLimit
+	// ErrKindPreconditionFailed is used if a condition of the request, e.g. on the object generation, wasn't met.
+	ErrKindPreconditionFailed
+	// ErrKindQuotaExceeded is used if a storage or usage quota of the account was exceeded.
+	ErrKindQuotaExceeded
+	// ErrKindUnavailable is used if the provider failed to handle the request, e.g. with an HTTP 5xx status code,
+	// and it can be retried.
+	ErrKindUnavailable
+)
+
+// Sentinel errors matched by BucketErrors of the corresponding kind with errors.Is, so that callers, e.g. retry
+// and backoff logic, can handle errors the same way for every provider.
+var (
+	// ErrNotFound is matched by errors of the kind ErrKindNotFound.
+	ErrNotFound = errors.New("not found")
+	// ErrPermissionDenied is matched by errors of the kind ErrKindPermissionDenied.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrThrottled is matched by errors of the kind ErrKindRateLimit.
+	ErrThrottled = errors.New("throttled")
+	// ErrUnavailable is matched by errors of the kind ErrKindUnavailable.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrQuotaExceeded is matched by errors of the kind ErrKindQuotaExceeded.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// BucketError is returned by bucket operations and carries the operation, the object name and the
+// provider-specific error code next to the original error.
+type BucketError struct {
+	// Op is the operation which failed, e.g. OpGet.
+	Op string
+	// Name is the name of the object the operation failed for. It is empty for operations not bound to a single object.
+	Name string
+	// ProviderCode is the error code reported by the provider, e.g. "NoSuchKey" for S3 or "404" for providers
+	// which only report an HTTP status code. It is empty if the provider didn't report one.
+	ProviderCode string
+	// Kind classifies the error independently of the provider.
+	Kind ErrorKind
+	// Wrapped is the original error.
+	Wrapped error
+}
+
+func (e *BucketError) Error() string {
+	if e.Name == "" {
+		return e.Op + ": " + e.Wrapped.Error()
+	}
+	return e.Op + " " + e.Name + ": " + e.Wrapped.Error()
+}
+
+// Unwrap returns the original error so that errors.Is and errors.As can inspect it.
+func (e *BucketError) Unwrap() error {
+	return e.Wrapped
+}
+
+// Is returns true if target is the sentinel error of the kind of the error, e.g. ErrNotFound for ErrKindNotFound.
+func (e *BucketError) Is(target error) bool {
+	switch e.Kind {
+	case ErrKindNotFound:
+		return target == ErrNotFound
+	case ErrKindPermissionDenied:
+		return target == ErrPermissionDenied
+	case ErrKindRateLimit:
+		return target == ErrThrottled
+	case ErrKindPreconditionFailed:
+		return target == ErrPreconditionFailed
+	case ErrKindUnavailable:
+		return target == ErrUnavailable
+	case ErrKindQuotaExceeded:
+		return target == ErrQuotaExceeded
+	}
+	return false
+}
+
+// Cause returns the original error so that errors.Cause of github.com/pkg/errors can inspect it.
+func (e *BucketError) Cause() error {
+	return e.Wrapped
+}
+
+// NewBucketError wraps err in a BucketError. It returns nil if err is nil and returns err unchanged if it
+// already contains a BucketError, e.g. because an operation is implemented on top of another one.
+// Context errors are returned unchanged as well, as they are caused by the caller and not by the provider.
+func NewBucketError(op, name, providerCode string, kind ErrorKind, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var bErr *BucketError
+	if errors.As(err, &bErr) {
+		return err
+	}
+	return &BucketError{Op: op, Name: name, ProviderCode: providerCode, Kind: kind, Wrapped: err}
+}
+
+// ErrorKindFromHTTPStatus returns the ErrorKind for the given HTTP status code. Providers use it to
+// classify errors which don't come with a more specific error code.
+func ErrorKindFromHTTPStatus(status int) ErrorKind {
+	switch status {
+	case http.StatusNotFound:
+		return ErrKindNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrKindPermissionDenied
+	case http.StatusTooManyRequests:
+		return ErrKindRateLimit
+	case http.StatusPreconditionFailed:
+		return ErrKindPreconditionFailed
+	case http.StatusInsufficientStorage:
+		return ErrKindQuotaExceeded
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrKindUnavailable
+	}
+	return ErrKindUnknown
+}
+
+// IsNotFoundErr returns true if the error reports that the object or bucket does not exist, i.e. matches ErrNotFound.
+func IsNotFoundErr(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsPermissionDeniedErr returns true if the error reports missing permissions, i.e. matches ErrPermissionDenied.
+func IsPermissionDeniedErr(err error) bool {
+	return errors.Is(err, ErrPermissionDenied)
+}
+
+// IsRateLimitErr returns true if the error reports that the request was throttled, i.e. matches ErrThrottled.
+func IsRateLimitErr(err error) bool {
+	return errors.Is(err, ErrThrottled)
+}
+
+// ErrPreconditionFailed is matched by errors of the kind ErrKindPreconditionFailed, and wrapped by the errors
+// returned when a conditional write is rejected because the object was modified concurrently, e.g. by UpdateObject.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// IsPreconditionFailedErr returns true if the error reports that a condition of the request wasn't met, i.e.
+// matches ErrPreconditionFailed.
+func IsPreconditionFailedErr(err error) bool {
+	return errors.Is(err, ErrPreconditionFailed)
+}
+
+// IsQuotaExceededErr returns true if the error reports that a storage or usage quota was exceeded, i.e. matches
+// ErrQuotaExceeded.
+func IsQuotaExceededErr(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded)
+}
+
+// ErrChecksumMismatch is returned when reading an object if the checksum of the received content doesn't
+// match the checksum stored by the provider, i.e. the content was corrupted in transit.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumMismatchError is returned when the checksum of the content of an object doesn't match the expected one.
+// It matches ErrChecksumMismatch with errors.Is.
+type ChecksumMismatchError struct {
+	// Algorithm is the checksum algorithm, i.e. MD5 or CRC32C.
+	Algorithm string
+	// Expected is the checksum stored by the provider and Actual the one of the received content. CRC32C
+	// checksums are encoded in big-endian byte order.
+	Expected, Actual []byte
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s: got %s %x, want %x", ErrChecksumMismatch, e.Algorithm, e.Actual, e.Expected)
+}
+
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// IsChecksumMismatchErr returns true if the error reports that the checksum of the received content of an
+// object didn't match the checksum stored by the provider.
+func IsChecksumMismatchErr(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch)
+}
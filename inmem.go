@@ -4,8 +4,12 @@
 package objstore
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash/crc32"
 	"io"
 	"sort"
 	"strings"
@@ -15,7 +19,24 @@ import (
 	"github.com/pkg/errors"
 )
 
-var errNotFound = errors.New("inmem: object not found")
+var (
+	errNotFound        = errors.New("inmem: object not found")
+	errMaxSizeExceeded = errors.New("inmem: max size exceeded")
+)
+
+// wrapErr wraps err in a BucketError for the given operation and object name.
+func wrapErr(op, name string, err error) error {
+	kind := ErrKindUnknown
+	switch {
+	case errors.Is(err, errNotFound):
+		kind = ErrKindNotFound
+	case errors.Is(err, errMaxSizeExceeded):
+		kind = ErrKindQuotaExceeded
+	case errors.Is(err, ErrPreconditionFailed):
+		kind = ErrKindPreconditionFailed
+	}
+	return NewBucketError(op, name, "", kind, err)
+}
 
 // InMemBucket implements the objstore.Bucket interfaces against local memory.
 // Methods from Bucket interface are thread-safe. Objects are assumed to be immutable.
@@ -23,15 +44,110 @@ type InMemBucket struct {
 	mtx     sync.RWMutex
 	objects map[string][]byte
 	attrs   map[string]ObjectAttributes
+	tags    map[string]map[string]string
+	size    int64
+
+	maxSize     int64
+	evictOldest bool
+}
+
+// InMemBucketOption configures a bucket returned by NewInMemBucket.
+type InMemBucketOption func(b *InMemBucket)
+
+// WithInMemMaxSize caps the total size of the objects stored in the bucket. Uploads and copies which would
+// exceed it fail with an error for which IsQuotaExceededErr returns true, unless WithInMemEvictOldest is set.
+// The size is unbounded by default.
+func WithInMemMaxSize(maxBytes int64) InMemBucketOption {
+	return func(b *InMemBucket) {
+		b.maxSize = maxBytes
+	}
+}
+
+// WithInMemEvictOldest makes a bucket with a max size remove the objects with the oldest LastModified time
+// to make space for new objects, instead of failing. Objects larger than the max size are still rejected.
+func WithInMemEvictOldest() InMemBucketOption {
+	return func(b *InMemBucket) {
+		b.evictOldest = true
+	}
 }
 
 // NewInMemBucket returns a new in memory Bucket.
 // NOTE: Returned bucket is just a naive in memory bucket implementation. For test use cases only.
-func NewInMemBucket() *InMemBucket {
-	return &InMemBucket{
+func NewInMemBucket(opts ...InMemBucketOption) *InMemBucket {
+	b := &InMemBucket{
 		objects: map[string][]byte{},
 		attrs:   map[string]ObjectAttributes{},
+		tags:    map[string]map[string]string{},
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// readBody reads the content of an object to upload. With a max size, at most one byte more than it is read,
+// so that runaway uploads fail without reading them completely.
+func (b *InMemBucket) readBody(r io.Reader) ([]byte, error) {
+	if b.maxSize <= 0 {
+		return io.ReadAll(r)
+	}
+	return io.ReadAll(io.LimitReader(r, b.maxSize+1))
+}
+
+// storeLocked stores the object, enforcing the max size of the bucket. The mutex has to be held for writing.
+func (b *InMemBucket) storeLocked(op, name string, body []byte, attrs ObjectAttributes) error {
+	newSize := b.size - int64(len(b.objects[name])) + int64(len(body))
+	if b.maxSize > 0 && newSize > b.maxSize {
+		if !b.evictOldest || int64(len(body)) > b.maxSize {
+			return wrapErr(op, name, errors.Wrapf(errMaxSizeExceeded, "storing %d bytes would exceed the max size of %d bytes", len(body), b.maxSize))
+		}
+
+		oldest := make([]string, 0, len(b.objects))
+		for n := range b.objects {
+			if n != name {
+				oldest = append(oldest, n)
+			}
+		}
+		sort.Slice(oldest, func(i, j int) bool {
+			ti, tj := b.attrs[oldest[i]].LastModified, b.attrs[oldest[j]].LastModified
+			if ti.Equal(tj) {
+				return oldest[i] < oldest[j]
+			}
+			return ti.Before(tj)
+		})
+		for _, n := range oldest {
+			if newSize <= b.maxSize {
+				break
+			}
+			newSize -= int64(len(b.objects[n]))
+			b.deleteLocked(n)
+		}
+	}
+
+	b.size -= int64(len(b.objects[name]))
+	b.size += int64(len(body))
+	b.objects[name] = body
+	b.attrs[name] = withChecksums(attrs, body)
+	delete(b.tags, name)
+	return nil
+}
+
+// withChecksums returns the attributes with the ETag and checksums of the given content.
+func withChecksums(attrs ObjectAttributes, body []byte) ObjectAttributes {
+	// Like S3, use the MD5 checksum of the content as ETag, so that equal objects have equal ETags.
+	md5Sum := md5.Sum(body)
+	crc32cSum := crc32.Checksum(body, crc32cTable)
+	attrs.ETag = hex.EncodeToString(md5Sum[:])
+	attrs.MD5, attrs.CRC32C = md5Sum[:], &crc32cSum
+	return attrs
+}
+
+// deleteLocked removes the object. The mutex has to be held for writing.
+func (b *InMemBucket) deleteLocked(name string) {
+	b.size -= int64(len(b.objects[name]))
+	delete(b.objects, name)
+	delete(b.attrs, name)
+	delete(b.tags, name)
 }
 
 // Objects returns a copy of the internally stored objects.
@@ -48,6 +164,134 @@ func (b *InMemBucket) Objects() map[string][]byte {
 	return objs
 }
 
+// PAX records of the archives written by Save, which carry the attributes and tags of the objects.
+const (
+	paxContentType     = "OBJSTORE.content_type"
+	paxContentEncoding = "OBJSTORE.content_encoding"
+	paxCacheControl    = "OBJSTORE.cache_control"
+	paxStorageClass    = "OBJSTORE.storage_class"
+	paxMetadataPrefix  = "OBJSTORE.metadata."
+	paxTagPrefix       = "OBJSTORE.tag."
+)
+
+// Save writes all objects to w as a tar archive, e.g. to inspect them after a test. Objects are stored in
+// lexicographic order as files named after the objects, with LastModified as modification time. The content
+// type, content encoding, storage class, user metadata and tags are stored in PAX records. The archive can be
+// loaded again with Load. Save fails for objects with an empty name, as they can't be stored in a tar archive.
+func (b *InMemBucket) Save(w io.Writer) error {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	names := make([]string, 0, len(b.objects))
+	for name := range b.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		body, attrs := b.objects[name], b.attrs[name]
+		records := map[string]string{}
+		for k, v := range map[string]string{
+			paxContentType:     attrs.ContentType,
+			paxContentEncoding: attrs.ContentEncoding,
+			paxCacheControl:    attrs.CacheControl,
+			paxStorageClass:    attrs.StorageClass,
+		} {
+			if v != "" {
+				records[k] = v
+			}
+		}
+		for k, v := range attrs.UserMetadata {
+			records[paxMetadataPrefix+k] = v
+		}
+		for k, v := range b.tags[name] {
+			records[paxTagPrefix+k] = v
+		}
+		hdr := &tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       name,
+			Mode:       0o644,
+			Size:       int64(len(body)),
+			ModTime:    attrs.LastModified,
+			PAXRecords: records,
+			Format:     tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "write header of %s", name)
+		}
+		if _, err := tw.Write(body); err != nil {
+			return errors.Wrapf(err, "write content of %s", name)
+		}
+	}
+	return errors.Wrap(tw.Close(), "close archive")
+}
+
+// Load replaces all objects with the objects of a tar archive written by Save, e.g. to load fixtures. Regular
+// files of other archives are loaded as objects as well, with their path as name. The archive is read
+// completely before the objects are replaced, so the bucket is left unchanged if it is invalid or exceeds the
+// max size of the bucket.
+func (b *InMemBucket) Load(r io.Reader) error {
+	var (
+		objects = map[string][]byte{}
+		attrs   = map[string]ObjectAttributes{}
+		tags    = map[string]map[string]string{}
+		size    int64
+	)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "read archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			return errors.Wrapf(err, "read content of %s", hdr.Name)
+		}
+
+		a := ObjectAttributes{
+			Size:            int64(len(body)),
+			LastModified:    hdr.ModTime,
+			ContentType:     hdr.PAXRecords[paxContentType],
+			ContentEncoding: hdr.PAXRecords[paxContentEncoding],
+			CacheControl:    hdr.PAXRecords[paxCacheControl],
+			StorageClass:    hdr.PAXRecords[paxStorageClass],
+		}
+		delete(tags, hdr.Name)
+		for k, v := range hdr.PAXRecords {
+			switch {
+			case strings.HasPrefix(k, paxMetadataPrefix):
+				if a.UserMetadata == nil {
+					a.UserMetadata = map[string]string{}
+				}
+				a.UserMetadata[strings.TrimPrefix(k, paxMetadataPrefix)] = v
+			case strings.HasPrefix(k, paxTagPrefix):
+				if tags[hdr.Name] == nil {
+					tags[hdr.Name] = map[string]string{}
+				}
+				tags[hdr.Name][strings.TrimPrefix(k, paxTagPrefix)] = v
+			}
+		}
+		size += int64(len(body)) - int64(len(objects[hdr.Name]))
+		objects[hdr.Name] = body
+		attrs[hdr.Name] = withChecksums(a, body)
+	}
+	if b.maxSize > 0 && size > b.maxSize {
+		return errors.Wrapf(errMaxSizeExceeded, "loading %d bytes would exceed the max size of %d bytes", size, b.maxSize)
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.objects, b.attrs, b.tags, b.size = objects, attrs, tags, size
+	return nil
+}
+
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error, options ...IterOption) error {
@@ -71,17 +315,26 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error,
 
 		if params.Recursive {
 			// Any object matching the prefix should be included.
-			unique[filename] = struct{}{}
+			if !params.PrefixesOnly && !params.SkipStorageClass(b.attrs[filename].StorageClass) {
+				unique[filename] = struct{}{}
+			}
 			continue
 		}
 
 		parts := strings.SplitAfter(filename, DirDelim)
-		unique[strings.Join(parts[:dirPartsCount+1], "")] = struct{}{}
+		entry := strings.Join(parts[:dirPartsCount+1], "")
+		if entry == filename && (params.PrefixesOnly || params.SkipStorageClass(b.attrs[filename].StorageClass)) {
+			continue
+		}
+		unique[entry] = struct{}{}
 	}
 	b.mtx.RUnlock()
 
 	var keys []string
 	for n := range unique {
+		if params.StartAfter != "" && n <= params.StartAfter {
+			continue
+		}
 		keys = append(keys, n)
 	}
 	sort.Slice(keys, func(i, j int) bool {
@@ -97,6 +350,9 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error,
 
 		return strings.Compare(keys[i], keys[j]) < 0
 	})
+	if params.MaxResults > 0 && len(keys) > params.MaxResults {
+		keys = keys[:params.MaxResults]
+	}
 
 	for _, k := range keys {
 		if err := f(k); err != nil {
@@ -106,33 +362,90 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error,
 	return nil
 }
 
+func (b *InMemBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs IterObjectAttributes) error, options ...IterOption) error {
+	if err := ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	params := ApplyIterOptions(options...)
+	return b.Iter(ctx, dir, func(name string) error {
+		attrs := IterObjectAttributes{Name: name}
+		if !strings.HasSuffix(name, DirDelim) {
+			b.mtx.RLock()
+			if params.StorageClass {
+				attrs.SetStorageClass(b.attrs[name].StorageClass)
+			}
+			if params.UserMetadata {
+				attrs.SetUserMetadata(b.attrs[name].UserMetadata)
+			}
+			if params.LastModified {
+				attrs.SetLastModified(b.attrs[name].LastModified)
+			}
+			if params.Size {
+				attrs.SetSize(int64(len(b.objects[name])))
+			}
+			b.mtx.RUnlock()
+		}
+		return f(attrs)
+	}, options...)
+}
+
+func (b *InMemBucket) SupportedIterOptions() []IterOptionType {
+	return []IterOptionType{Recursive, MaxResults, Size, StorageClass, StartAfter, PrefixesOnly, UserMetadata, UpdatedAt}
+}
+
 // Get returns a reader for the given object name.
 func (b *InMemBucket) Get(_ context.Context, name string) (io.ReadCloser, error) {
 	if name == "" {
-		return nil, errors.New("inmem: object name is empty")
+		return nil, wrapErr(OpGet, name, errors.New("inmem: object name is empty"))
 	}
 
 	b.mtx.RLock()
 	file, ok := b.objects[name]
 	b.mtx.RUnlock()
 	if !ok {
-		return nil, errNotFound
+		return nil, wrapErr(OpGet, name, errNotFound)
 	}
 
 	return io.NopCloser(bytes.NewReader(file)), nil
 }
 
+// GetWithOptions returns a reader for the given object name. Objects are returned as they were uploaded, unless
+// WithDecodeContent is given.
+func (b *InMemBucket) GetWithOptions(ctx context.Context, name string, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	rc, err := b.Get(ctx, name)
+	if err != nil || !ApplyObjectGetOptions(opts...).DecodeContent {
+		return rc, err
+	}
+	b.mtx.RLock()
+	contentEncoding := b.attrs[name].ContentEncoding
+	b.mtx.RUnlock()
+	rc, err = NewContentDecodingReader(rc, contentEncoding)
+	return rc, wrapErr(OpGet, name, err)
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (b *InMemBucket) GetRange(_ context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	if name == "" {
-		return nil, errors.New("inmem: object name is empty")
+		return nil, wrapErr(OpGetRange, name, errors.New("inmem: object name is empty"))
 	}
 
 	b.mtx.RLock()
 	file, ok := b.objects[name]
 	b.mtx.RUnlock()
 	if !ok {
-		return nil, errNotFound
+		return nil, wrapErr(OpGetRange, name, errNotFound)
+	}
+
+	if off < 0 {
+		if length != -1 {
+			return nil, wrapErr(OpGetRange, name, errors.Errorf("suffix range requires length -1, got %d", length))
+		}
+		// Return the last -off bytes, or the whole object if it is smaller.
+		off += int64(len(file))
+		if off < 0 {
+			off = 0
+		}
 	}
 
 	if int64(len(file)) < off {
@@ -144,7 +457,7 @@ func (b *InMemBucket) GetRange(_ context.Context, name string, off, length int64
 	}
 
 	if length <= 0 {
-		return io.NopCloser(bytes.NewReader(nil)), errors.New("length cannot be smaller or equal 0")
+		return io.NopCloser(bytes.NewReader(nil)), wrapErr(OpGetRange, name, errors.New("length cannot be smaller or equal 0"))
 	}
 
 	if int64(len(file)) <= off+length {
@@ -169,25 +482,126 @@ func (b *InMemBucket) Attributes(_ context.Context, name string) (ObjectAttribut
 	attrs, ok := b.attrs[name]
 	b.mtx.RUnlock()
 	if !ok {
-		return ObjectAttributes{}, errNotFound
+		return ObjectAttributes{}, wrapErr(OpAttributes, name, errNotFound)
 	}
 	return attrs, nil
 }
 
 // Upload writes the file specified in src to into the memory.
-func (b *InMemBucket) Upload(_ context.Context, name string, r io.Reader) error {
+func (b *InMemBucket) Upload(_ context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	params := ApplyObjectUploadOptions(opts...)
+	if err := ValidateUserMetadata(params.UserMetadata); err != nil {
+		return wrapErr(OpUpload, name, err)
+	}
+	if params.PublicRead {
+		return wrapErr(OpUpload, name, ErrOptionNotSupported)
+	}
+
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
-	body, err := io.ReadAll(r)
+	body, err := b.readBody(r)
 	if err != nil {
-		return err
+		return wrapErr(OpUpload, name, err)
 	}
-	b.objects[name] = body
-	b.attrs[name] = ObjectAttributes{
+	if err := verifyUploadChecksums(params, body); err != nil {
+		return wrapErr(OpUpload, name, err)
+	}
+	return b.storeLocked(OpUpload, name, body, ObjectAttributes{
+		Size:            int64(len(body)),
+		LastModified:    time.Now(),
+		ContentType:     params.ContentType,
+		StorageClass:    params.StorageClass,
+		UserMetadata:    copyMetadata(params.UserMetadata),
+		ContentEncoding: params.ContentEncoding,
+		CacheControl:    params.CacheControl,
+	})
+}
+
+// verifyUploadChecksums returns a ChecksumMismatchError if the checksums sent along with an upload don't
+// match the body.
+func verifyUploadChecksums(params UploadObjectParams, body []byte) error {
+	if params.MD5 != nil {
+		if sum := md5.Sum(body); !bytes.Equal(sum[:], params.MD5) {
+			return &ChecksumMismatchError{Algorithm: "MD5", Expected: params.MD5, Actual: sum[:]}
+		}
+	}
+	if params.SendCRC32C {
+		if sum := crc32.Checksum(body, crc32cTable); sum != params.CRC32C {
+			return &ChecksumMismatchError{Algorithm: "CRC32C", Expected: crc32cBytes(params.CRC32C), Actual: crc32cBytes(sum)}
+		}
+	}
+	return nil
+}
+
+// copyMetadata returns a copy of the metadata, so that later changes by the caller don't affect stored objects.
+func copyMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		c[k] = v
+	}
+	return c
+}
+
+// UploadIfNotExists writes the file specified in src into the memory only if an object with the given
+// name does not exist yet.
+func (b *InMemBucket) UploadIfNotExists(_ context.Context, name string, r io.Reader) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.objects[name]; ok {
+		return false, nil
+	}
+	body, err := b.readBody(r)
+	if err != nil {
+		return false, wrapErr(OpUpload, name, err)
+	}
+	if err := b.storeLocked(OpUpload, name, body, ObjectAttributes{
 		Size:         int64(len(body)),
 		LastModified: time.Now(),
+	}); err != nil {
+		return false, err
 	}
-	return nil
+	return true, nil
+}
+
+// UploadIfMatch writes the file specified in src into the memory only if the ETag of the existing object
+// equals etag.
+func (b *InMemBucket) UploadIfMatch(_ context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	params := ApplyObjectUploadOptions(opts...)
+	if err := ValidateUserMetadata(params.UserMetadata); err != nil {
+		return wrapErr(OpUpload, name, err)
+	}
+	if params.PublicRead {
+		return wrapErr(OpUpload, name, ErrOptionNotSupported)
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	attrs, ok := b.attrs[name]
+	if !ok {
+		return wrapErr(OpUpload, name, errors.Wrap(ErrPreconditionFailed, "object does not exist"))
+	}
+	if attrs.ETag != etag {
+		return wrapErr(OpUpload, name, errors.Wrapf(ErrPreconditionFailed, "ETag %s does not match %s", attrs.ETag, etag))
+	}
+	body, err := b.readBody(r)
+	if err != nil {
+		return wrapErr(OpUpload, name, err)
+	}
+	if err := verifyUploadChecksums(params, body); err != nil {
+		return wrapErr(OpUpload, name, err)
+	}
+	return b.storeLocked(OpUpload, name, body, ObjectAttributes{
+		Size:            int64(len(body)),
+		LastModified:    time.Now(),
+		ContentType:     params.ContentType,
+		StorageClass:    params.StorageClass,
+		UserMetadata:    copyMetadata(params.UserMetadata),
+		ContentEncoding: params.ContentEncoding,
+		CacheControl:    params.CacheControl,
+	})
 }
 
 // Delete removes all data prefixed with the dir.
@@ -195,16 +609,130 @@ func (b *InMemBucket) Delete(_ context.Context, name string) error {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
 	if _, ok := b.objects[name]; !ok {
-		return errNotFound
+		return wrapErr(OpDelete, name, errNotFound)
 	}
-	delete(b.objects, name)
-	delete(b.attrs, name)
+	b.deleteLocked(name)
+	return nil
+}
+
+// DeleteMany removes the objects with the given names.
+func (b *InMemBucket) DeleteMany(ctx context.Context, names []string) error {
+	return DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+func (b *InMemBucket) Copy(_ context.Context, src, dst string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	body, ok := b.objects[src]
+	if !ok {
+		return wrapErr(OpCopy, src, errNotFound)
+	}
+	return b.storeLocked(OpCopy, dst, body, ObjectAttributes{
+		Size:         int64(len(body)),
+		LastModified: time.Now(),
+	})
+}
+
+// Rename moves the object with the src name to the dst name atomically.
+func (b *InMemBucket) Rename(_ context.Context, src, dst string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	body, ok := b.objects[src]
+	if !ok {
+		return wrapErr(OpCopy, src, errNotFound)
+	}
+	if src == dst {
+		return nil
+	}
+	attrs := b.attrs[src]
+	b.deleteLocked(src)
+	// Storing can't exceed the max size, as the object was removed from its old name first.
+	return b.storeLocked(OpCopy, dst, body, attrs)
+}
+
+// UpdateMetadata changes the user metadata and the attributes set by the options of the object.
+func (b *InMemBucket) UpdateMetadata(_ context.Context, name string, md map[string]string, opts ...ObjectUploadOption) error {
+	if err := ValidateUserMetadata(md); err != nil {
+		return wrapErr(OpUpload, name, err)
+	}
+	params := ApplyObjectUpdateOptions(opts...)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	attrs, ok := b.attrs[name]
+	if !ok {
+		return wrapErr(OpUpload, name, errNotFound)
+	}
+	if md != nil {
+		attrs.UserMetadata = copyMetadata(md)
+	}
+	if params.ContentType != "" {
+		attrs.ContentType = params.ContentType
+	}
+	if params.ContentEncoding != "" {
+		attrs.ContentEncoding = params.ContentEncoding
+	}
+	if params.CacheControl != "" {
+		attrs.CacheControl = params.CacheControl
+	}
+	if params.StorageClass != "" {
+		attrs.StorageClass = params.StorageClass
+	}
+	attrs.LastModified = time.Now()
+	b.attrs[name] = attrs
 	return nil
 }
 
+// SetObjectTags replaces the tags of the object.
+func (b *InMemBucket) SetObjectTags(_ context.Context, name string, tags map[string]string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.objects[name]; !ok {
+		return wrapErr(OpUpload, name, errNotFound)
+	}
+	b.tags[name] = copyMetadata(tags)
+	return nil
+}
+
+// GetObjectTags returns the tags of the object.
+func (b *InMemBucket) GetObjectTags(_ context.Context, name string) (map[string]string, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if _, ok := b.objects[name]; !ok {
+		return nil, wrapErr(OpAttributes, name, errNotFound)
+	}
+	tags := make(map[string]string, len(b.tags[name]))
+	for k, v := range b.tags[name] {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// DeleteObjectTags removes all tags of the object.
+func (b *InMemBucket) DeleteObjectTags(_ context.Context, name string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.objects[name]; !ok {
+		return wrapErr(OpUpload, name, errNotFound)
+	}
+	delete(b.tags, name)
+	return nil
+}
+
+// PresignedGetURL returns ErrPresignNotSupported as in-memory objects can't be accessed through a URL.
+func (b *InMemBucket) PresignedGetURL(_ context.Context, _ string, _ time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// PresignPut returns ErrPresignNotSupported as in-memory objects can't be accessed through a URL.
+func (b *InMemBucket) PresignPut(_ context.Context, _ string, _ time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *InMemBucket) IsObjNotFoundErr(err error) bool {
-	return errors.Is(err, errNotFound)
+	return errors.Is(err, ErrNotFound)
 }
 
 // IsCustomerManagedKeyError returns true if the permissions for key used to encrypt the object was revoked.
@@ -212,6 +740,9 @@ func (b *InMemBucket) IsCustomerManagedKeyError(_ error) bool {
 	return false
 }
 
+// Ping always succeeds, as the in-memory bucket can't be unreachable.
+func (b *InMemBucket) Ping(_ context.Context) error { return nil }
+
 func (b *InMemBucket) Close() error { return nil }
 
 // Name returns the bucket name.
@@ -0,0 +1,91 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package lru implements the size-bounded index shared by the caching bucket wrappers.
+package lru
+
+import "container/list"
+
+// LRU maps keys to values and evicts the least recently used entries once the total size of the entries
+// exceeds its maximum. It is not safe for concurrent use.
+type LRU[V any] struct {
+	maxSize int64
+
+	list    *list.List
+	entries map[string]*list.Element
+	size    int64
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+	size  int64
+}
+
+// New returns a new LRU holding entries of up to maxSize in total.
+func New[V any](maxSize int64) *LRU[V] {
+	return &LRU[V]{
+		maxSize: maxSize,
+		list:    list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the value stored for the key and marks it as recently used.
+func (l *LRU[V]) Get(key string) (V, bool) {
+	elem, ok := l.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	l.list.MoveToFront(elem)
+	return elem.Value.(*entry[V]).value, true
+}
+
+// Contains reports whether a value is stored for the key, without marking it as recently used.
+func (l *LRU[V]) Contains(key string) bool {
+	_, ok := l.entries[key]
+	return ok
+}
+
+// Add stores the value of the given size for the key, replacing the previous value, and returns the keys of
+// the entries evicted to make space for it. The added entry itself is never evicted, so that callers decide
+// whether values larger than the maximum are stored.
+func (l *LRU[V]) Add(key string, value V, size int64) []string {
+	l.Remove(key)
+	l.entries[key] = l.list.PushFront(&entry[V]{key: key, value: value, size: size})
+	l.size += size
+
+	var evicted []string
+	for l.size > l.maxSize {
+		victim := l.list.Back().Value.(*entry[V]).key
+		if victim == key {
+			break
+		}
+		l.Remove(victim)
+		evicted = append(evicted, victim)
+	}
+	return evicted
+}
+
+// Remove removes the value stored for the key and reports whether there was one.
+func (l *LRU[V]) Remove(key string) bool {
+	elem, ok := l.entries[key]
+	if !ok {
+		return false
+	}
+	l.list.Remove(elem)
+	delete(l.entries, key)
+	l.size -= elem.Value.(*entry[V]).size
+	return true
+}
+
+// Len returns the number of stored entries.
+func (l *LRU[V]) Len() int {
+	return len(l.entries)
+}
+
+// Size returns the total size of the stored entries.
+func (l *LRU[V]) Size() int64 {
+	return l.size
+}
@@ -0,0 +1,46 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package lru
+
+import (
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestLRU(t *testing.T) {
+	l := New[string](10)
+
+	testutil.Equals(t, []string(nil), l.Add("a", "va", 4))
+	testutil.Equals(t, []string(nil), l.Add("b", "vb", 4))
+	testutil.Equals(t, 2, l.Len())
+	testutil.Equals(t, int64(8), l.Size())
+
+	// Getting an entry marks it as recently used, so that the other one is evicted first.
+	v, ok := l.Get("a")
+	testutil.Assert(t, ok)
+	testutil.Equals(t, "va", v)
+	testutil.Equals(t, []string{"b"}, l.Add("c", "vc", 4))
+	testutil.Assert(t, !l.Contains("b"))
+	testutil.Equals(t, int64(8), l.Size())
+
+	// Replacing an entry updates the size.
+	testutil.Equals(t, []string(nil), l.Add("a", "va2", 2))
+	testutil.Equals(t, int64(6), l.Size())
+	v, ok = l.Get("a")
+	testutil.Assert(t, ok)
+	testutil.Equals(t, "va2", v)
+
+	// The added entry is kept even if it exceeds the maximum on its own.
+	testutil.Equals(t, []string{"c", "a"}, l.Add("d", "vd", 12))
+	testutil.Equals(t, 1, l.Len())
+	testutil.Equals(t, int64(12), l.Size())
+
+	testutil.Assert(t, l.Remove("d"))
+	testutil.Assert(t, !l.Remove("d"))
+	_, ok = l.Get("d")
+	testutil.Assert(t, !ok)
+	testutil.Equals(t, 0, l.Len())
+	testutil.Equals(t, int64(0), l.Size())
+}
@@ -0,0 +1,250 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidObjectName is matched by InvalidObjectNameErrors with errors.Is.
+var ErrInvalidObjectName = errors.New("invalid object name")
+
+// InvalidObjectNameError is returned by a bucket returned by NewNormalizingBucket if an object name is rejected
+// before it is passed to the wrapped bucket. It matches ErrInvalidObjectName with errors.Is.
+type InvalidObjectNameError struct {
+	// Name is the object name as passed by the caller.
+	Name string
+	// Reason describes why the name was rejected.
+	Reason string
+}
+
+func (e *InvalidObjectNameError) Error() string {
+	return fmt.Sprintf("%s %q: %s", ErrInvalidObjectName, e.Name, e.Reason)
+}
+
+func (e *InvalidObjectNameError) Is(target error) bool {
+	return target == ErrInvalidObjectName
+}
+
+// IsInvalidObjectNameErr returns true if the error reports that an object name was rejected by a bucket returned
+// by NewNormalizingBucket.
+func IsInvalidObjectNameErr(err error) bool {
+	return errors.Is(err, ErrInvalidObjectName)
+}
+
+// NormalizeConfig configures a bucket returned by NewNormalizingBucket.
+type NormalizeConfig struct {
+	// MaxNameLength is the maximum length in bytes of normalized object names, e.g. 1024 for S3 and GCS.
+	// Zero disables the check.
+	MaxNameLength int
+}
+
+// NewNormalizingBucket returns a bucket which normalizes object names before passing them to bkt, so that the
+// same name refers to the same object with every provider. Leading delimiters are removed and repeated
+// delimiters are collapsed into one, e.g. "/a//b" is passed as "a/b". Names containing ".." segments, names
+// which are empty after normalization and names longer than the configured maximum length are rejected with an
+// InvalidObjectNameError without sending a request. Directories passed to Iter are normalized the same way, but
+// may be empty to list the whole bucket.
+//
+// Names passed to Iter callbacks are returned by bkt unchanged. Besides GetWithOptions, GetRangeWithOptions and
+// GetWithAttributes, optional interfaces of bkt are not exposed.
+func NewNormalizingBucket(bkt Bucket, cfg NormalizeConfig) Bucket {
+	return &normalizingBucket{bkt: bkt, cfg: cfg}
+}
+
+type normalizingBucket struct {
+	bkt Bucket
+	cfg NormalizeConfig
+}
+
+// normalize returns the normalized name, or an InvalidObjectNameError wrapped in a BucketError of op.
+func (b *normalizingBucket) normalize(op, name string, allowEmpty bool) (string, error) {
+	segments := strings.Split(name, DirDelim)
+	normalized := make([]string, 0, len(segments))
+	for i, s := range segments {
+		switch {
+		case s == "..":
+			return "", b.invalid(op, name, "path traversal segments are not allowed")
+		// Empty segments are caused by leading or repeated delimiters. A trailing delimiter is kept, as it
+		// marks a directory.
+		case s == "" && (i < len(segments)-1 || len(normalized) == 0):
+			continue
+		}
+		normalized = append(normalized, s)
+	}
+	n := strings.Join(normalized, DirDelim)
+	if n == "" && !allowEmpty {
+		return "", b.invalid(op, name, "name is empty")
+	}
+	if b.cfg.MaxNameLength > 0 && len(n) > b.cfg.MaxNameLength {
+		return "", b.invalid(op, name, fmt.Sprintf("name is longer than %d bytes", b.cfg.MaxNameLength))
+	}
+	return n, nil
+}
+
+func (b *normalizingBucket) invalid(op, name, reason string) error {
+	return NewBucketError(op, name, "", ErrKindUnknown, &InvalidObjectNameError{Name: name, Reason: reason})
+}
+
+func (b *normalizingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	dir, err := b.normalize(OpIter, dir, true)
+	if err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *normalizingBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	dir, err := b.normalize(OpIter, dir, true)
+	if err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *normalizingBucket) SupportedIterOptions() []IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *normalizingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	name, err := b.normalize(OpGet, name, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.bkt.Get(ctx, name)
+}
+
+func (b *normalizingBucket) GetWithOptions(ctx context.Context, name string, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	name, err := b.normalize(OpGet, name, false)
+	if err != nil {
+		return nil, err
+	}
+	return GetWithOptions(ctx, b.bkt, name, opts...)
+}
+
+func (b *normalizingBucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, ObjectAttributes, error) {
+	name, err := b.normalize(OpGet, name, false)
+	if err != nil {
+		return nil, ObjectAttributes{}, err
+	}
+	return GetWithAttributes(ctx, b.bkt, name)
+}
+
+func (b *normalizingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	name, err := b.normalize(OpGetRange, name, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *normalizingBucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	name, err := b.normalize(OpGetRange, name, false)
+	if err != nil {
+		return nil, err
+	}
+	return GetRangeWithOptions(ctx, b.bkt, name, off, length, opts...)
+}
+
+func (b *normalizingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	name, err := b.normalize(OpExists, name, false)
+	if err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *normalizingBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	name, err := b.normalize(OpAttributes, name, false)
+	if err != nil {
+		return ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *normalizingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	name, err := b.normalize(OpUpload, name, false)
+	if err != nil {
+		return err
+	}
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *normalizingBucket) Delete(ctx context.Context, name string) error {
+	name, err := b.normalize(OpDelete, name, false)
+	if err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+// DeleteMany removes the objects with the given names. If any of the names is invalid, no object is removed.
+// The names reported in a *BatchDeleteResult error are the ones passed by the caller.
+func (b *normalizingBucket) DeleteMany(ctx context.Context, names []string) error {
+	normalized := make([]string, 0, len(names))
+	original := make(map[string]string, len(names))
+	for _, name := range names {
+		n, err := b.normalize(OpDelete, name, false)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, n)
+		original[n] = name
+	}
+
+	err := b.bkt.DeleteMany(ctx, normalized)
+	var res *BatchDeleteResult
+	if !errors.As(err, &res) {
+		return err
+	}
+	mapped := &BatchDeleteResult{Errors: make(map[string]error, len(res.Errors))}
+	for name, objErr := range res.Errors {
+		if o, ok := original[name]; ok {
+			name = o
+		}
+		mapped.Errors[name] = objErr
+	}
+	return mapped
+}
+
+func (b *normalizingBucket) Copy(ctx context.Context, src, dst string) error {
+	src, err := b.normalize(OpCopy, src, false)
+	if err != nil {
+		return err
+	}
+	dst, err = b.normalize(OpCopy, dst, false)
+	if err != nil {
+		return err
+	}
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+// SupportedCopy returns true if the wrapped bucket copies objects server-side.
+func (b *normalizingBucket) SupportedCopy() bool {
+	if c, ok := b.bkt.(ServerSideCopier); ok {
+		return c.SupportedCopy()
+	}
+	return false
+}
+
+func (b *normalizingBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *normalizingBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *normalizingBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *normalizingBucket) Name() string {
+	return b.bkt.Name()
+}
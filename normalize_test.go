@@ -0,0 +1,70 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+)
+
+func TestNormalizingBucket_Acceptance(t *testing.T) {
+	AcceptanceTest(t, NewNormalizingBucket(NewInMemBucket(), NormalizeConfig{MaxNameLength: 1024}))
+}
+
+func TestNormalizingBucket(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	bkt := NewNormalizingBucket(failingDeleteBucket{Bucket: inner, name: "failing"}, NormalizeConfig{MaxNameLength: 10})
+
+	testutil.Ok(t, bkt.Upload(ctx, "/dir//obj", strings.NewReader("content")))
+	testutil.Equals(t, map[string][]byte{"dir/obj": []byte("content")}, inner.Objects())
+
+	rc, err := bkt.Get(ctx, "dir///obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	var listed []string
+	testutil.Ok(t, bkt.Iter(ctx, "//dir//", func(name string) error {
+		listed = append(listed, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/obj"}, listed)
+
+	testutil.Ok(t, bkt.Copy(ctx, "dir//obj", "/copy"))
+	ok, err := inner.Exists(ctx, "copy")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected copy to exist")
+
+	for _, name := range []string{"", "//", "../obj", "dir/../../obj", "dir/..", "0123456789a"} {
+		_, err := bkt.Exists(ctx, name)
+		testutil.Assert(t, IsInvalidObjectNameErr(err), "expected invalid name error for %q, got %v", name, err)
+		var nameErr *InvalidObjectNameError
+		testutil.Assert(t, errors.As(err, &nameErr), "expected InvalidObjectNameError for %q, got %v", name, err)
+		testutil.Equals(t, name, nameErr.Name)
+	}
+	// Names which are only longer before normalization are accepted.
+	_, err = bkt.Exists(ctx, "//dir//obj")
+	testutil.Ok(t, err)
+
+	// The whole batch is rejected if any name is invalid.
+	err = bkt.DeleteMany(ctx, []string{"dir/obj", "../copy"})
+	testutil.Assert(t, IsInvalidObjectNameErr(err), "expected invalid name error, got %v", err)
+	testutil.Equals(t, 2, len(inner.Objects()))
+
+	// Failures are reported for the names passed by the caller.
+	err = bkt.DeleteMany(ctx, []string{"/dir//obj", "/failing"})
+	var res *BatchDeleteResult
+	testutil.Assert(t, errors.As(err, &res), "expected batch delete error, got %v", err)
+	testutil.Equals(t, 1, len(res.Errors))
+	testutil.NotOk(t, res.Errors["/failing"])
+	testutil.Equals(t, map[string][]byte{"copy": []byte("content")}, inner.Objects())
+}
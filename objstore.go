@@ -5,16 +5,27 @@ package objstore
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
+	"github.com/efficientgo/core/errcapture"
 	"github.com/efficientgo/core/logerrcapture"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -32,6 +43,8 @@ const (
 	OpUpload     = "upload"
 	OpDelete     = "delete"
 	OpAttributes = "attributes"
+	OpCopy       = "copy"
+	OpPing       = "ping"
 )
 
 // Bucket provides read and write access to an object storage bucket.
@@ -42,16 +55,784 @@ type Bucket interface {
 
 	// Upload the contents of the reader as an object into the bucket.
 	// Upload should be idempotent.
-	Upload(ctx context.Context, name string, r io.Reader) error
+	Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error
 
 	// Delete removes the object with the given name.
 	// If object does not exist in the moment of deletion, Delete should throw error.
 	Delete(ctx context.Context, name string) error
 
+	// DeleteMany removes the objects with the given names, using fewer round trips than calling Delete for each
+	// of them where the provider allows. Objects which don't exist are skipped, as S3's batch delete API doesn't
+	// report them. If some of the objects could not be deleted, a *BatchDeleteResult error reporting each of the
+	// failures is returned. Providers without a batch delete API use DefaultDeleteMany.
+	DeleteMany(ctx context.Context, names []string) error
+
+	// Copy copies the object with the src name into a new object with the dst name within the bucket.
+	// Providers should use their native server-side copy API where available, so the object content does not
+	// have to pass through the client. If the src object does not exist, IsObjNotFoundErr should return true
+	// for the returned error.
+	Copy(ctx context.Context, src, dst string) error
+
 	// Name returns the bucket name for the provider.
 	Name() string
 }
 
+// ServerSideCopier is an optional interface that can be implemented by a Bucket to advertise whether
+// Copy is done server-side by the provider.
+type ServerSideCopier interface {
+	// SupportedCopy returns true if Copy does not transfer the object content through the client.
+	SupportedCopy() bool
+}
+
+// ErrCopyWithAttributesNotSupported is returned by CopyWithAttributes if the bucket does not implement AttributesCopier.
+var ErrCopyWithAttributesNotSupported = errors.New("copy with attributes is not supported")
+
+// CopyObjectAttributes are the attributes which can be changed when copying an object with CopyWithAttributes.
+// Empty attributes are copied from the source object.
+type CopyObjectAttributes struct {
+	ContentType     string
+	CacheControl    string
+	ContentEncoding string
+	StorageClass    string
+	// UserMetadata replaces the user metadata of the source object if not nil.
+	UserMetadata map[string]string
+}
+
+// AttributesCopier is an optional interface that can be implemented by a Bucket which is able to change the
+// attributes of an object while copying it server-side.
+type AttributesCopier interface {
+	// CopyWithAttributes copies the object with the src name into a new object with the dst name, setting the
+	// given attributes on the new object. If the src object does not exist, IsObjNotFoundErr should return true
+	// for the returned error.
+	CopyWithAttributes(ctx context.Context, src, dst string, attrs CopyObjectAttributes) error
+}
+
+// CopyWithAttributes copies the object with the src name into a new object with the dst name, setting the given
+// attributes on the new object. It returns ErrCopyWithAttributesNotSupported if the bucket does not implement
+// AttributesCopier.
+func CopyWithAttributes(ctx context.Context, bkt Bucket, src, dst string, attrs CopyObjectAttributes) error {
+	ac, ok := bkt.(AttributesCopier)
+	if !ok {
+		return ErrCopyWithAttributesNotSupported
+	}
+	return ac.CopyWithAttributes(ctx, src, dst, attrs)
+}
+
+// ErrUpdateMetadataNotSupported is returned by UpdateMetadata if the bucket does not implement MetadataUpdater.
+var ErrUpdateMetadataNotSupported = errors.New("update metadata is not supported")
+
+// MetadataUpdater is an optional interface that can be implemented by a Bucket which is able to change the
+// metadata of an object without uploading its content again.
+type MetadataUpdater interface {
+	// UpdateMetadata replaces the user metadata of the object with the given name with md, unless md is nil.
+	// The content type, cache control, content encoding and storage class are changed if they are set by the
+	// options, other options are ignored. If the object does not exist, IsObjNotFoundErr should return true
+	// for the returned error.
+	UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...ObjectUploadOption) error
+}
+
+// UpdateMetadata changes the metadata of the object with the given name without uploading its content again, see
+// MetadataUpdater. It returns ErrUpdateMetadataNotSupported if the bucket does not implement MetadataUpdater.
+func UpdateMetadata(ctx context.Context, bkt Bucket, name string, md map[string]string, opts ...ObjectUploadOption) error {
+	mu, ok := bkt.(MetadataUpdater)
+	if !ok {
+		return ErrUpdateMetadataNotSupported
+	}
+	return mu.UpdateMetadata(ctx, name, md, opts...)
+}
+
+// ErrRenameNotSupported is returned by Rename when the bucket does not implement Renamer.
+var ErrRenameNotSupported = errors.New("rename is not supported")
+
+// Renamer is an optional interface that can be implemented by a Bucket which is able to move an object
+// to a new name.
+type Renamer interface {
+	// Rename moves the object with the src name to the dst name, replacing the dst object if it exists.
+	// Providers without an atomic rename copy the object and delete src afterwards. If src is changed or
+	// deleted concurrently, an error is returned and dst might already exist. If the src object does not
+	// exist, IsObjNotFoundErr should return true for the returned error.
+	Rename(ctx context.Context, src, dst string) error
+}
+
+// IsRenameSupported returns true if the bucket implements Renamer, and so do all the buckets it wraps.
+func IsRenameSupported(bkt Bucket) bool {
+	return implements[Renamer](bkt)
+}
+
+// implements returns true if bkt and all the buckets it wraps implement T. Wrappers like the metric bucket
+// implement the optional interfaces regardless of the wrapped bucket and return the error of the latter, so the
+// outermost bucket implementing T doesn't mean that T is supported.
+func implements[T any](bkt Bucket) bool {
+	for {
+		if _, ok := bkt.(T); !ok {
+			return false
+		}
+		w, ok := bkt.(WrappingBucket)
+		if !ok {
+			return true
+		}
+		bkt = w.WrappedBucket()
+	}
+}
+
+// Rename moves the object with the src name to the dst name. It returns ErrRenameNotSupported if the bucket
+// does not implement Renamer.
+func Rename(ctx context.Context, bkt Bucket, src, dst string) error {
+	r, ok := bkt.(Renamer)
+	if !ok {
+		return ErrRenameNotSupported
+	}
+	return r.Rename(ctx, src, dst)
+}
+
+// ErrVersioningNotSupported is returned by the versioning helpers when the bucket does not implement Versioned.
+var ErrVersioningNotSupported = errors.New("versioning is not supported")
+
+// VersionInfo describes a single version of an object in a versioned bucket.
+type VersionInfo struct {
+	// VersionID identifies the version, e.g. the generation of a GCS object or the version ID of an S3 object.
+	VersionID string
+	// LastModified is the time the version was created.
+	LastModified time.Time
+	// Size is the size of the version in bytes. It is 0 for delete markers.
+	Size int64
+	// IsDeleteMarker is true if the version marks the deletion of the object rather than holding content.
+	IsDeleteMarker bool
+}
+
+// Versioned is an optional interface that can be implemented by a Bucket which gives access to
+// non-current versions of objects in buckets with object versioning enabled.
+type Versioned interface {
+	// ListVersions returns all versions of the object with the given name, including delete markers.
+	ListVersions(ctx context.Context, name string) ([]VersionInfo, error)
+	// GetVersion returns a reader for the given version of the object.
+	GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error)
+	// DeleteVersion permanently deletes the given version of the object.
+	DeleteVersion(ctx context.Context, name, versionID string) error
+	// RestoreVersion makes the content of the given version the current version of the object by copying it.
+	RestoreVersion(ctx context.Context, name, versionID string) error
+}
+
+// IsVersionedBucket returns true if the bucket implements Versioned, and so do all the buckets it wraps.
+func IsVersionedBucket(bkt Bucket) bool {
+	return implements[Versioned](bkt)
+}
+
+// ListVersions returns all versions of the object with the given name. It returns ErrVersioningNotSupported if the
+// bucket does not implement Versioned.
+func ListVersions(ctx context.Context, bkt Bucket, name string) ([]VersionInfo, error) {
+	v, ok := bkt.(Versioned)
+	if !ok {
+		return nil, ErrVersioningNotSupported
+	}
+	return v.ListVersions(ctx, name)
+}
+
+// GetVersion returns a reader for the given version of the object. It returns ErrVersioningNotSupported if the
+// bucket does not implement Versioned.
+func GetVersion(ctx context.Context, bkt Bucket, name, versionID string) (io.ReadCloser, error) {
+	v, ok := bkt.(Versioned)
+	if !ok {
+		return nil, ErrVersioningNotSupported
+	}
+	return v.GetVersion(ctx, name, versionID)
+}
+
+// DeleteVersion permanently deletes the given version of the object. It returns ErrVersioningNotSupported if the
+// bucket does not implement Versioned.
+func DeleteVersion(ctx context.Context, bkt Bucket, name, versionID string) error {
+	v, ok := bkt.(Versioned)
+	if !ok {
+		return ErrVersioningNotSupported
+	}
+	return v.DeleteVersion(ctx, name, versionID)
+}
+
+// RestoreVersion makes the given version the current version of the object. It returns ErrVersioningNotSupported
+// if the bucket does not implement Versioned.
+func RestoreVersion(ctx context.Context, bkt Bucket, name, versionID string) error {
+	v, ok := bkt.(Versioned)
+	if !ok {
+		return ErrVersioningNotSupported
+	}
+	return v.RestoreVersion(ctx, name, versionID)
+}
+
+// VersionLister is an optional interface that can be implemented by a Bucket which lists the versions of all
+// objects with a given prefix in buckets with object versioning enabled.
+type VersionLister interface {
+	// IterVersions calls f for each version of the objects whose names start with prefix, including delete
+	// markers, for which deleted is true. isLatest is true for the current version of each object.
+	IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error
+}
+
+// IterVersions calls f for each version of the objects whose names start with prefix, so that the history of
+// the objects can be reconstructed. The versions of an object are passed from the newest to the oldest one.
+// It returns ErrVersioningNotSupported if the bucket does not implement VersionLister.
+func IterVersions(ctx context.Context, bkt Bucket, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	v, ok := bkt.(VersionLister)
+	if !ok {
+		return ErrVersioningNotSupported
+	}
+	return v.IterVersions(ctx, prefix, f)
+}
+
+// ErrTaggingNotSupported is returned by the tagging helpers when the bucket does not implement Tagger.
+var ErrTaggingNotSupported = errors.New("object tagging is not supported")
+
+// Tagger is an optional interface that can be implemented by a Bucket which can attach key-value tags to objects.
+// Unlike user metadata, tags can be changed without uploading the object again. Tags are removed when the object
+// is overwritten.
+type Tagger interface {
+	// SetObjectTags replaces the tags of the object with the given name.
+	SetObjectTags(ctx context.Context, name string, tags map[string]string) error
+	// GetObjectTags returns the tags of the object with the given name. It returns an empty map if the object
+	// has no tags.
+	GetObjectTags(ctx context.Context, name string) (map[string]string, error)
+	// DeleteObjectTags removes all tags of the object with the given name.
+	DeleteObjectTags(ctx context.Context, name string) error
+}
+
+// SupportsTagger returns true if the bucket implements Tagger, and so do all the buckets it wraps.
+func SupportsTagger(bkt Bucket) bool {
+	return implements[Tagger](bkt)
+}
+
+// SetObjectTags replaces the tags of the object with the given name. It returns ErrTaggingNotSupported if the
+// bucket does not implement Tagger.
+func SetObjectTags(ctx context.Context, bkt Bucket, name string, tags map[string]string) error {
+	t, ok := bkt.(Tagger)
+	if !ok {
+		return ErrTaggingNotSupported
+	}
+	return t.SetObjectTags(ctx, name, tags)
+}
+
+// GetObjectTags returns the tags of the object with the given name. It returns ErrTaggingNotSupported if the
+// bucket does not implement Tagger.
+func GetObjectTags(ctx context.Context, bkt Bucket, name string) (map[string]string, error) {
+	t, ok := bkt.(Tagger)
+	if !ok {
+		return nil, ErrTaggingNotSupported
+	}
+	return t.GetObjectTags(ctx, name)
+}
+
+// DeleteObjectTags removes all tags of the object with the given name. It returns ErrTaggingNotSupported if the
+// bucket does not implement Tagger.
+func DeleteObjectTags(ctx context.Context, bkt Bucket, name string) error {
+	t, ok := bkt.(Tagger)
+	if !ok {
+		return ErrTaggingNotSupported
+	}
+	return t.DeleteObjectTags(ctx, name)
+}
+
+// ErrHealthCheckNotSupported is returned by Ping when the bucket does not implement HealthChecker.
+var ErrHealthCheckNotSupported = errors.New("health check is not supported")
+
+// HealthChecker is an optional interface that can be implemented by a Bucket which is able to verify
+// that the bucket is reachable with the configured credentials without reading or writing any object.
+type HealthChecker interface {
+	// Ping returns nil if the bucket can be accessed. Errors are wrapped in a BucketError for OpPing, so
+	// that IsNotFoundErr and IsPermissionDeniedErr can tell missing buckets and credentials apart from
+	// network errors.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the bucket can be accessed. It returns ErrHealthCheckNotSupported if the bucket does
+// not implement HealthChecker.
+func Ping(ctx context.Context, bkt Bucket) error {
+	h, ok := bkt.(HealthChecker)
+	if !ok {
+		return ErrHealthCheckNotSupported
+	}
+	return h.Ping(ctx)
+}
+
+// PingWithTimeout is like Ping, but cancels the check if it takes longer than d.
+func PingWithTimeout(ctx context.Context, bkt Bucket, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	return Ping(ctx, bkt)
+}
+
+// Stater is an optional interface that can be implemented by a Bucket wrapper which handles Stat itself,
+// e.g. to not record missing objects as failures.
+type Stater interface {
+	// Stat returns the attributes of the object with the given name and whether it exists, see Stat.
+	Stat(ctx context.Context, name string) (ObjectAttributes, bool, error)
+}
+
+// Stat returns the attributes of the object with the given name and whether it exists, using a single
+// metadata request instead of calling Exists and Attributes. Unlike Attributes, it doesn't return an
+// error if the object does not exist, only for failed requests.
+func Stat(ctx context.Context, bkt BucketReader, name string) (ObjectAttributes, bool, error) {
+	if s, ok := bkt.(Stater); ok {
+		return s.Stat(ctx, name)
+	}
+	attrs, err := bkt.Attributes(ctx, name)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return ObjectAttributes{}, false, nil
+		}
+		return ObjectAttributes{}, false, err
+	}
+	return attrs, true, nil
+}
+
+// ErrConditionalUploadNotSupported is returned by UploadIfNotExists when the bucket does not
+// implement ConditionalUploader.
+var ErrConditionalUploadNotSupported = errors.New("conditional upload is not supported")
+
+// ConditionalUploader is an optional interface that can be implemented by a Bucket which is able to
+// atomically create an object only if it does not exist yet.
+type ConditionalUploader interface {
+	// UploadIfNotExists uploads the contents of the reader as an object into the bucket only if an object
+	// with the given name does not exist yet. It returns false and no error if the object already existed.
+	UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error)
+}
+
+// UploadIfNotExists uploads the contents of the reader as an object with the given name only if it
+// does not exist yet. It returns false and no error if the object already existed, and
+// ErrConditionalUploadNotSupported if the bucket does not implement ConditionalUploader.
+func UploadIfNotExists(ctx context.Context, bkt Bucket, name string, r io.Reader) (bool, error) {
+	cu, ok := bkt.(ConditionalUploader)
+	if !ok {
+		return false, ErrConditionalUploadNotSupported
+	}
+	return cu.UploadIfNotExists(ctx, name, r)
+}
+
+// ConditionalUpdater is an optional interface that can be implemented by a Bucket which is able to
+// atomically replace an object only if it was not modified since it was read.
+type ConditionalUpdater interface {
+	// UploadIfMatch uploads the contents of the reader as an object into the bucket only if the ETag of
+	// the existing object equals etag. Otherwise, it returns an error for which IsPreconditionFailedErr
+	// returns true. Like Upload, it replaces the attributes of the object, e.g. its content type and user
+	// metadata, with the ones set by the options.
+	UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error
+}
+
+// UploadIfMatch uploads the contents of the reader as an object with the given name only if the ETag of
+// the existing object equals etag. It returns an error for which IsPreconditionFailedErr returns true if
+// it doesn't, and ErrConditionalUploadNotSupported if the bucket does not implement ConditionalUpdater.
+func UploadIfMatch(ctx context.Context, bkt Bucket, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	cu, ok := bkt.(ConditionalUpdater)
+	if !ok {
+		return ErrConditionalUploadNotSupported
+	}
+	return cu.UploadIfMatch(ctx, name, r, etag, opts...)
+}
+
+// UpdateObject replaces the content of the object with the given name by the content returned by fn,
+// which is called with the current content, or nil if the object does not exist. The content type and user
+// metadata of an existing object are kept. The object is only
+// written if it was not modified or created concurrently, otherwise an error for which
+// IsPreconditionFailedErr returns true is returned, and the caller can retry the update.
+// It returns ErrConditionalUploadNotSupported if the bucket does not implement ConditionalUploader and
+// ConditionalUpdater, and errors returned by fn as is.
+func UpdateObject(ctx context.Context, bkt Bucket, name string, fn func(old []byte) ([]byte, error)) error {
+	attrs, err := bkt.Attributes(ctx, name)
+	if err != nil {
+		if !bkt.IsObjNotFoundErr(err) {
+			return err
+		}
+		content, err := fn(nil)
+		if err != nil {
+			return err
+		}
+		created, err := UploadIfNotExists(ctx, bkt, name, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		if !created {
+			return NewBucketError(OpUpload, name, "", ErrKindPreconditionFailed, errors.Wrap(ErrPreconditionFailed, "object was created concurrently"))
+		}
+		return nil
+	}
+	if attrs.ETag == "" {
+		return ErrConditionalUploadNotSupported
+	}
+
+	// The object might be replaced after its attributes were read, in which case the upload fails.
+	rc, err := bkt.Get(ctx, name)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return NewBucketError(OpGet, name, "", ErrKindPreconditionFailed, errors.Wrap(ErrPreconditionFailed, "object was deleted concurrently"))
+		}
+		return err
+	}
+	old, err := io.ReadAll(rc)
+	if closeErr := rc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read %s", name)
+	}
+
+	content, err := fn(old)
+	if err != nil {
+		return err
+	}
+	opts := []ObjectUploadOption{WithUserMetadata(attrs.UserMetadata)}
+	if attrs.ContentType != "" {
+		opts = append(opts, WithContentType(attrs.ContentType))
+	}
+	return UploadIfMatch(ctx, bkt, name, bytes.NewReader(content), attrs.ETag, opts...)
+}
+
+// BatchDeleteResult is the error returned by DeleteMany when some of the objects could not be deleted.
+type BatchDeleteResult struct {
+	// Errors holds the error for each object which could not be deleted.
+	Errors map[string]error
+}
+
+func (r *BatchDeleteResult) Error() string {
+	names := make([]string, 0, len(r.Errors))
+	for name := range r.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to delete %d objects", len(names))
+	for i, name := range names {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		// BucketErrors already mention the object name.
+		var bErr *BucketError
+		if errors.As(r.Errors[name], &bErr) {
+			b.WriteString(r.Errors[name].Error())
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %v", name, r.Errors[name])
+	}
+	return b.String()
+}
+
+// Err returns the result as error, or nil if all objects were deleted.
+func (r *BatchDeleteResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return r
+}
+
+// IsBatchDeletePartialErr returns true if the error reports that only some of the objects passed to
+// DeleteMany could not be deleted.
+func IsBatchDeletePartialErr(err error) bool {
+	var r *BatchDeleteResult
+	return errors.As(err, &r)
+}
+
+// DefaultDeleteMany removes the objects with the given names by calling Delete for each of them sequentially,
+// skipping the ones which don't exist. It can be used by providers without a batch delete API to implement
+// DeleteMany.
+func DefaultDeleteMany(ctx context.Context, bkt Bucket, names []string) error {
+	res := &BatchDeleteResult{Errors: map[string]error{}}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := bkt.Delete(ctx, name); err != nil && !bkt.IsObjNotFoundErr(err) {
+			res.Errors[name] = err
+		}
+	}
+	return res.Err()
+}
+
+// deletePrefixBatchSize is the number of objects DeletePrefix passes to a single DeleteMany call. It matches the
+// maximum number of objects S3 deletes with a single request.
+const deletePrefixBatchSize = 1000
+
+// DeletePrefixOption configures the provided params.
+type DeletePrefixOption func(params *deletePrefixParams)
+
+// deletePrefixParams holds the DeletePrefix() parameters.
+type deletePrefixParams struct {
+	progress func(deleted, failed int)
+}
+
+// WithDeleteProgress is an option to set a function which DeletePrefix calls after each batch of objects it
+// attempted to delete, with the number of objects deleted and failed to be deleted so far. It is never called
+// concurrently.
+func WithDeleteProgress(f func(deleted, failed int)) DeletePrefixOption {
+	return func(params *deletePrefixParams) {
+		params.progress = f
+	}
+}
+
+// DeletePrefix removes all objects in the given directory and its subdirectories. The objects are listed
+// recursively and deleted in batches with DeleteMany by up to concurrency workers, so providers with a batch
+// delete API need few requests. Objects which could not be deleted don't stop the deletion of the others; they
+// are reported by a *BatchDeleteResult error once all objects were attempted. If the listing fails, the deletion
+// stops and the listing error is returned.
+func DeletePrefix(ctx context.Context, bkt Bucket, prefix string, concurrency int, options ...DeletePrefixOption) error {
+	if concurrency <= 0 {
+		return errors.New("concurrency must be positive")
+	}
+	params := deletePrefixParams{}
+	for _, opt := range options {
+		opt(&params)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		deleted int
+		batches = make(chan []string)
+		res     = &BatchDeleteResult{Errors: map[string]error{}}
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				err := bkt.DeleteMany(ctx, batch)
+
+				mtx.Lock()
+				failed := len(res.Errors)
+				var partial *BatchDeleteResult
+				switch {
+				case err == nil:
+				case errors.As(err, &partial):
+					for name, err := range partial.Errors {
+						res.Errors[name] = err
+					}
+				default:
+					for _, name := range batch {
+						res.Errors[name] = err
+					}
+				}
+				deleted += len(batch) - (len(res.Errors) - failed)
+				if params.progress != nil {
+					params.progress(deleted, len(res.Errors))
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	var batch []string
+	err := bkt.Iter(ctx, prefix, func(name string) error {
+		batch = append(batch, name)
+		if len(batch) == deletePrefixBatchSize {
+			batches <- batch
+			batch = nil
+		}
+		return nil
+	}, WithRecursiveIter)
+	if err == nil && len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	wg.Wait()
+
+	if err != nil {
+		return errors.Wrapf(err, "list objects in %s", prefix)
+	}
+	return res.Err()
+}
+
+// ErrPresignNotSupported is returned by Presigner implementations which are not able to generate presigned URLs.
+var ErrPresignNotSupported = errors.New("presigned URLs are not supported")
+
+// PresignedDownloader is an optional interface that can be implemented by a Bucket to generate time-limited URLs
+// which allow clients to download an object directly without credentials.
+type PresignedDownloader interface {
+	// PresignedGetURL returns a URL which can be used to download the object with the given name until expiry passes.
+	PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error)
+}
+
+// Presigner is an optional interface that can be implemented by a Bucket to generate time-limited URLs
+// which allow direct access to an object without credentials.
+type Presigner interface {
+	PresignedDownloader
+
+	// PresignPut returns a URL which can be used to upload the object with the given name until expiry passes.
+	PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error)
+}
+
+// PresignedGetURL returns a URL which can be used to download the object with the given name until expiry passes.
+// It returns ErrPresignNotSupported if the bucket does not implement PresignedDownloader.
+func PresignedGetURL(ctx context.Context, bkt Bucket, name string, expiry time.Duration) (string, error) {
+	p, ok := bkt.(PresignedDownloader)
+	if !ok {
+		return "", ErrPresignNotSupported
+	}
+	return p.PresignedGetURL(ctx, name, expiry)
+}
+
+// PresignPut returns a URL which can be used to upload the object with the given name until expiry passes.
+// It returns ErrPresignNotSupported if the bucket does not implement Presigner.
+func PresignPut(ctx context.Context, bkt Bucket, name string, expiry time.Duration) (string, error) {
+	p, ok := bkt.(Presigner)
+	if !ok {
+		return "", ErrPresignNotSupported
+	}
+	return p.PresignPut(ctx, name, expiry)
+}
+
+// ErrMultipartUploadNotSupported is returned by NewMultipartUpload if the bucket does not implement MultipartUploader.
+var ErrMultipartUploadNotSupported = errors.New("multipart uploads are not supported")
+
+// MultipartUploader is an optional interface that can be implemented by a Bucket to upload large objects
+// in parts, without buffering the whole object and retrying only the parts which failed.
+type MultipartUploader interface {
+	// NewMultipartUpload starts a new upload of the object with the given name. The object only becomes
+	// visible once the upload is completed.
+	NewMultipartUpload(ctx context.Context, name string, opts ...ObjectUploadOption) (MultipartWriter, error)
+}
+
+// MultipartWriter uploads an object in parts. It is not safe for concurrent use.
+type MultipartWriter interface {
+	// WritePart uploads the next part of the object with the given size. Providers might require a minimum
+	// size for all parts except the last one, e.g. 5MiB for S3. Whether a failed part can be retried by
+	// calling WritePart again with the same content depends on the provider.
+	WritePart(ctx context.Context, r io.Reader, size int64) error
+
+	// Complete finishes the upload and makes the object visible.
+	Complete(ctx context.Context) error
+
+	// Abort cancels the upload and removes all parts uploaded so far, so that they don't occupy storage.
+	Abort(ctx context.Context) error
+}
+
+// NewMultipartUpload starts a new multipart upload of the object with the given name.
+// It returns ErrMultipartUploadNotSupported if the bucket does not implement MultipartUploader.
+func NewMultipartUpload(ctx context.Context, bkt Bucket, name string, opts ...ObjectUploadOption) (MultipartWriter, error) {
+	mu, ok := bkt.(MultipartUploader)
+	if !ok {
+		return nil, ErrMultipartUploadNotSupported
+	}
+	return mu.NewMultipartUpload(ctx, name, opts...)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// DefaultMultipartChunkSize is the part size used by UploadLargeObject if MultipartUploadOptions.ChunkSize is not set.
+const DefaultMultipartChunkSize = 64 * 1024 * 1024
+
+// ProgressFunc is called with the number of bytes uploaded so far and the total size of the object,
+// which is -1 if it is not known in advance.
+type ProgressFunc func(uploaded, total int64)
+
+// MultipartUploadOptions configures UploadLargeObject.
+type MultipartUploadOptions struct {
+	// ChunkSize is the size of each part. Objects which are not larger than ChunkSize are uploaded
+	// with a single Upload call. It defaults to DefaultMultipartChunkSize.
+	ChunkSize int64
+	// ContentType is the MIME type of the object. It defaults to DefaultContentType.
+	ContentType string
+	// ProgressFunc is called after each uploaded part, if not nil.
+	ProgressFunc ProgressFunc
+}
+
+// UploadLargeObject uploads the contents of the reader as an object with the given name. Objects larger than
+// opts.ChunkSize are uploaded in parts of that size if the bucket implements MultipartUploader, so that only
+// one part has to be held in memory. The upload is aborted if any part fails.
+func UploadLargeObject(ctx context.Context, bkt Bucket, name string, r io.Reader, opts MultipartUploadOptions) (err error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultMultipartChunkSize
+	}
+	progress := opts.ProgressFunc
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	uploadOpts := []ObjectUploadOption{WithContentType(opts.ContentType)}
+
+	total, sizeErr := TryToGetSize(r)
+	if sizeErr != nil {
+		total = -1
+	}
+	upload := func(r io.Reader, total int64) error {
+		cr := &countingReader{r: r}
+		if total < 0 {
+			// Only wrap readers of unknown size, so that providers can still get the size of r.
+			r = cr
+		}
+		if err := bkt.Upload(ctx, name, r, uploadOpts...); err != nil {
+			return err
+		}
+		if total < 0 {
+			total = cr.n
+		}
+		progress(total, total)
+		return nil
+	}
+	if _, ok := bkt.(MultipartUploader); !ok || (total >= 0 && total <= chunkSize) {
+		return upload(r, total)
+	}
+
+	// The buffer holds one byte more than a part, to tell whether the object fits into a single part.
+	buf := make([]byte, chunkSize+1)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return upload(bytes.NewReader(buf[:n]), int64(n))
+	}
+	if err != nil {
+		return errors.Wrap(err, "read part")
+	}
+
+	w, err := NewMultipartUpload(ctx, bkt, name, uploadOpts...)
+	if errors.Is(err, ErrMultipartUploadNotSupported) {
+		// Wrapped buckets might not support multipart uploads, even though the wrapper does.
+		return upload(io.MultiReader(bytes.NewReader(buf), r), total)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if abortErr := w.Abort(ctx); abortErr != nil {
+				err = errors.Wrapf(err, "abort multipart upload: %v", abortErr)
+			}
+		}
+	}()
+
+	var uploaded int64
+	writePart := func(p []byte) error {
+		if err := w.WritePart(ctx, bytes.NewReader(p), int64(len(p))); err != nil {
+			return err
+		}
+		uploaded += int64(len(p))
+		progress(uploaded, total)
+		return nil
+	}
+	for {
+		if err := writePart(buf[:chunkSize]); err != nil {
+			return err
+		}
+		// The additional byte starts the next part.
+		buf[0] = buf[chunkSize]
+		n, err = io.ReadFull(r, buf[1:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if err := writePart(buf[:n+1]); err != nil {
+				return err
+			}
+			return w.Complete(ctx)
+		}
+		if err != nil {
+			return errors.Wrap(err, "read part")
+		}
+	}
+}
+
 // InstrumentedBucket is a Bucket with optional instrumentation control on reader.
 type InstrumentedBucket interface {
 	Bucket
@@ -77,6 +858,9 @@ type BucketReader interface {
 	Get(ctx context.Context, name string) (io.ReadCloser, error)
 
 	// GetRange returns a new range reader for the given object name and range.
+	// A length of -1 reads the object until the end. A negative off reads the last -off bytes of the object
+	// (a suffix range, like the HTTP "Range: bytes=-N" header), in which case length has to be -1.
+	// Providers which do not support suffix ranges return an error for a negative off.
 	GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error)
 
 	// Exists checks if the given object exists in the bucket.
@@ -90,95 +874,1095 @@ type BucketReader interface {
 
 	// Attributes returns information about the specified object.
 	Attributes(ctx context.Context, name string) (ObjectAttributes, error)
+
+	// IterWithAttributes calls f for each entry in the given directory similar to Iter.
+	// In addition to Name, it also includes requested object attributes in the argument to f.
+	//
+	// Attributes can be requested using IterOption.
+	// Not all IterOptions are supported by all providers, requesting for an unsupported option will fail with ErrOptionNotSupported.
+	IterWithAttributes(ctx context.Context, dir string, f func(attrs IterObjectAttributes) error, options ...IterOption) error
+
+	// SupportedIterOptions returns a list of supported IterOptions by the underlying provider.
+	SupportedIterOptions() []IterOptionType
+}
+
+// InstrumentedBucketReader is a BucketReader with optional instrumentation control.
+type InstrumentedBucketReader interface {
+	BucketReader
+
+	// ReaderWithExpectedErrs allows to specify a filter that marks certain errors as expected, so it will not increment
+	// objstore_bucket_operation_failures_total metric.
+	ReaderWithExpectedErrs(IsOpFailureExpectedFunc) BucketReader
+}
+
+// ErrOptionNotSupported is returned when an IterOption or an ObjectUploadOption is not supported by the provider.
+var ErrOptionNotSupported = errors.New("iter option is not supported")
+
+// IterOptionType is used for type-safe option support checking.
+type IterOptionType int
+
+const (
+	Recursive IterOptionType = iota
+	ETag
+	MaxResults
+	Size
+	StorageClass
+	StartAfter
+	PrefixesOnly
+	UserMetadata
+	UpdatedAt
+	Filter
+	MaxDepth
+	CreatedAt
+)
+
+// IterOption configures the provided params.
+type IterOption func(params *IterParams)
+
+// WithRecursiveIter is an option that can be applied to Iter() to recursively list objects
+// in the bucket.
+func WithRecursiveIter(params *IterParams) {
+	params.Recursive = true
+}
+
+// WithETag is an option that can be applied to IterWithAttributes() to include the
+// ETag of each object in the IterObjectAttributes.
+func WithETag(params *IterParams) {
+	params.ETag = true
+}
+
+// WithSize is an option that can be applied to IterWithAttributes() to include the
+// size of each object in the IterObjectAttributes.
+func WithSize(params *IterParams) {
+	params.Size = true
+}
+
+// WithStorageClassIter is an option that can be applied to IterWithAttributes() to include the
+// storage class of each object in the IterObjectAttributes.
+func WithStorageClassIter(params *IterParams) {
+	params.StorageClass = true
+}
+
+// WithUserMetadataIter is an option that can be applied to IterWithAttributes() to include the
+// user metadata of each object in the IterObjectAttributes.
+func WithUserMetadataIter(params *IterParams) {
+	params.UserMetadata = true
+}
+
+// WithUpdatedAt is an option that can be applied to IterWithAttributes() to include the
+// last modification time of each object in the IterObjectAttributes.
+func WithUpdatedAt(params *IterParams) {
+	params.LastModified = true
+}
+
+// WithCreatedAt is an option that can be applied to IterWithAttributes() to include the
+// creation time of each object in the IterObjectAttributes. It is only supported by providers
+// which track the creation time separately from the last modification time.
+func WithCreatedAt(params *IterParams) {
+	params.CreatedAt = true
+}
+
+// FilterStorageClass is an option that can be applied to Iter() to skip objects which are not stored
+// with the given storage class. Directories are not filtered. It requires support for the StorageClass
+// option type.
+func FilterStorageClass(class string) IterOption {
+	return func(params *IterParams) {
+		params.StorageClassFilter = class
+	}
+}
+
+// WithStartAfter is an option that can be applied to Iter() to only list entries whose names are
+// lexicographically greater than the given name. It allows to resume an iteration from the last name seen.
+func WithStartAfter(name string) IterOption {
+	return func(params *IterParams) {
+		params.StartAfter = name
+	}
+}
+
+// WithPrefixesOnly is an option that can be applied to Iter() to only list the directories (common prefixes)
+// in the given directory, without the objects. Combined with WithRecursiveIter nothing is listed, as recursive
+// iterations don't return directories.
+func WithPrefixesOnly(params *IterParams) {
+	params.PrefixesOnly = true
+}
+
+// WithMaxResults is an option that can be applied to Iter() to stop the iteration after n entries
+// were passed to the callback. A value lower or equal to zero means no limit.
+func WithMaxResults(n int) IterOption {
+	return func(params *IterParams) {
+		params.MaxResults = n
+	}
+}
+
+// WithFilter is an option that can be applied to Iter() to only pass the entries whose names match the given
+// predicate to the callback. The predicate is applied to directories too. It is a client-side filter: the
+// provider still lists all entries, only the callback is skipped for the entries which don't match. Entries
+// which don't match are not counted for WithMaxResults. It is applied by the Iter, IterWithAttributes and Walk
+// functions for every bucket, buckets don't support it themselves.
+func WithFilter(pred func(name string) bool) IterOption {
+	return func(params *IterParams) {
+		params.Filter = pred
+	}
+}
+
+// WithRegexFilter returns an option which can be applied to Iter() to only pass the entries whose names match
+// the given regular expression to the callback, see WithFilter. It returns an error if the pattern is invalid.
+func WithRegexFilter(pattern string) (IterOption, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compile filter pattern %q", pattern)
+	}
+	return WithFilter(re.MatchString), nil
+}
+
+// WithMaxDepth is an option that can be applied to Iter() to list the given directory recursively, but only up
+// to n levels of directories below it, counted by the number of DirDelim in the names relative to the directory.
+// Depth 0 lists the direct children of the directory like a non-recursive listing, depth 1 the entries of its
+// sub-directories as well, and so on. Directories at the max depth are passed to the callback once instead of
+// the objects in them. It is a client-side limit: the provider still lists all objects recursively. It is
+// applied by the Iter, IterWithAttributes and Walk functions, buckets don't support it themselves.
+func WithMaxDepth(n int) IterOption {
+	return func(params *IterParams) {
+		params.LimitDepth = true
+		params.MaxDepth = n
+	}
+}
+
+// WithConcurrency is an option that can be applied to recursive Iter() calls to list the directories found
+// directly in the given directory concurrently, using up to n listings at once. The callback is still called
+// serially, so it doesn't have to be thread-safe, but the order of the entries is not guaranteed anymore if n
+// is greater than one. It is applied by the Iter, IterWithAttributes and Walk functions, buckets list serially
+// themselves.
+func WithConcurrency(n int) IterOption {
+	return func(params *IterParams) {
+		params.Concurrency = n
+	}
+}
+
+// IterParams holds the Iter() parameters and is used by objstore clients implementations.
+type IterParams struct {
+	Recursive  bool
+	ETag       bool
+	MaxResults int
+	Size       bool
+
+	StorageClass       bool
+	StorageClassFilter string
+
+	StartAfter string
+
+	PrefixesOnly bool
+	UserMetadata bool
+	LastModified bool
+	CreatedAt    bool
+
+	Filter      func(name string) bool
+	Concurrency int
+
+	LimitDepth bool
+	MaxDepth   int
+}
+
+// SkipName returns true if the entry with the given name has to be skipped because of the WithFilter option.
+func (p IterParams) SkipName(name string) bool {
+	return p.Filter != nil && !p.Filter(name)
+}
+
+// SkipStorageClass returns true if an object with the given storage class has to be skipped because
+// of the FilterStorageClass option.
+func (p IterParams) SkipStorageClass(class string) bool {
+	return p.StorageClassFilter != "" && p.StorageClassFilter != class
+}
+
+func ApplyIterOptions(options ...IterOption) IterParams {
+	out := IterParams{}
+	for _, opt := range options {
+		opt(&out)
+	}
+	return out
+}
+
+// ValidateIterOptions checks that all the given options are in the list of supported option types.
+// It returns ErrOptionNotSupported otherwise.
+func ValidateIterOptions(supportedOptions []IterOptionType, options ...IterOption) error {
+	params := ApplyIterOptions(options...)
+
+	requested := map[IterOptionType]bool{
+		Recursive:  params.Recursive,
+		ETag:       params.ETag,
+		MaxResults: params.MaxResults > 0,
+		Size:       params.Size,
+
+		StorageClass: params.StorageClass || params.StorageClassFilter != "",
+		StartAfter:   params.StartAfter != "",
+		PrefixesOnly: params.PrefixesOnly,
+		UserMetadata: params.UserMetadata,
+		UpdatedAt:    params.LastModified,
+		CreatedAt:    params.CreatedAt,
+		Filter:       params.Filter != nil,
+		MaxDepth:     params.LimitDepth,
+	}
+	supported := map[IterOptionType]struct{}{}
+	for _, opt := range supportedOptions {
+		supported[opt] = struct{}{}
+	}
+	for opt, ok := range requested {
+		if !ok {
+			continue
+		}
+		if _, ok := supported[opt]; !ok {
+			return ErrOptionNotSupported
+		}
+	}
+	return nil
+}
+
+// IterObjectAttributes holds the name of an object and the attributes requested with
+// IterOption in IterWithAttributes.
+type IterObjectAttributes struct {
+	Name string
+	etag string
+
+	size    int64
+	sizeSet bool
+
+	storageClass string
+	userMetadata map[string]string
+	lastModified time.Time
+	createdAt    time.Time
+}
+
+// SetETag sets the ETag of the object.
+func (i *IterObjectAttributes) SetETag(etag string) {
+	i.etag = etag
+}
+
+// ETag returns the ETag of the object. It is only populated when the WithETag option is
+// requested, an empty string is returned otherwise.
+func (i IterObjectAttributes) ETag() string {
+	return i.etag
+}
+
+// SetSize sets the size of the object in bytes.
+func (i *IterObjectAttributes) SetSize(size int64) {
+	i.size = size
+	i.sizeSet = true
+}
+
+// Size returns the size of the object in bytes. The returned bool is false if the size was not set,
+// because the WithSize option was not requested or the entry is a directory.
+func (i IterObjectAttributes) Size() (int64, bool) {
+	return i.size, i.sizeSet
+}
+
+// SetStorageClass sets the storage class of the object.
+func (i *IterObjectAttributes) SetStorageClass(class string) {
+	i.storageClass = class
+}
+
+// StorageClass returns the storage class of the object. It is only populated when the WithStorageClassIter
+// option is requested, an empty string is returned otherwise or if the provider has no storage classes.
+func (i IterObjectAttributes) StorageClass() string {
+	return i.storageClass
+}
+
+// errPageFull stops the iteration of IterCollectPage once the page is full.
+var errPageFull = errors.New("page is full")
+
+// IterCollectPage returns up to pageSize entries of the given directory whose names are lexicographically
+// greater than after, together with the token to pass as after to get the next page. The token is the name
+// of the last returned entry, or empty if there are no more entries. Since the token is only empty for a
+// page with less than pageSize entries, the page following a full page might be empty.
+// The bucket has to support the StartAfter option type, and all options given to IterWithAttributes.
+func IterCollectPage(ctx context.Context, bkt BucketReader, dir string, pageSize int, after string, options ...IterOption) ([]IterObjectAttributes, string, error) {
+	if pageSize <= 0 {
+		return nil, "", errors.New("page size must be positive")
+	}
+	if after != "" {
+		options = append(options, WithStartAfter(after))
+	}
+	// Let the bucket stop the iteration if possible, as stopping it with an error from f counts as a failure
+	// in the metrics.
+	limited := false
+	for _, opt := range bkt.SupportedIterOptions() {
+		if opt == MaxResults {
+			options = append(options, WithMaxResults(pageSize))
+			limited = true
+		}
+	}
+
+	page := make([]IterObjectAttributes, 0, pageSize)
+	if err := IterWithAttributes(ctx, bkt, dir, func(attrs IterObjectAttributes) error {
+		page = append(page, attrs)
+		if !limited && len(page) >= pageSize {
+			return errPageFull
+		}
+		return nil
+	}, options...); err != nil && !errors.Is(err, errPageFull) {
+		return nil, "", err
+	}
+
+	if len(page) < pageSize {
+		return page, "", nil
+	}
+	return page, page[len(page)-1].Name, nil
+}
+
+// ParallelIterator is implemented by buckets which instrument or implement IterParallel themselves.
+type ParallelIterator interface {
+	// IterParallel calls f for each entry in the given directory with the attributes requested by the
+	// options, see IterParallel.
+	IterParallel(ctx context.Context, dir string, f func(IterObjectAttributes) error, concurrency int, ordered bool, options ...IterOption) error
+}
+
+// List returns the names of the entries in the given directory, as passed by Iter to its callback, in the
+// order they were listed. If the listing fails or ctx is canceled, the names collected until then are returned
+// along with the error.
+func List(ctx context.Context, bkt BucketReader, dir string, options ...IterOption) ([]string, error) {
+	var names []string
+	err := Iter(ctx, bkt, dir, func(name string) error {
+		// Not every bucket checks the context between the entries of a page.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	}, options...)
+	return names, err
+}
+
+// ListWithAttributes returns the entries in the given directory with the attributes requested by the options,
+// as passed by IterWithAttributes to its callback, in the order they were listed. If the listing fails or ctx
+// is canceled, the entries collected until then are returned along with the error.
+func ListWithAttributes(ctx context.Context, bkt BucketReader, dir string, options ...IterOption) ([]IterObjectAttributes, error) {
+	var entries []IterObjectAttributes
+	err := IterWithAttributes(ctx, bkt, dir, func(attrs IterObjectAttributes) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries = append(entries, attrs)
+		return nil
+	}, options...)
+	return entries, err
+}
+
+// IterParallel calls f for each entry in the given directory similar to IterWithAttributes, but lists the
+// entries with Iter and fetches the attributes requested by the options with Attributes, for up to
+// concurrency objects at once. It is meant for buckets which don't support the requested attributes in
+// IterWithAttributes, or can't return them with the listing. Directories are passed to f with their name only.
+// If ordered is true, f is called in the order the entries were listed, otherwise as soon as the attributes
+// of an entry were fetched. f is never called concurrently. The first error cancels the iteration.
+func IterParallel(ctx context.Context, bkt BucketReader, dir string, f func(IterObjectAttributes) error, concurrency int, ordered bool, options ...IterOption) error {
+	if p, ok := bkt.(ParallelIterator); ok {
+		return p.IterParallel(ctx, dir, f, concurrency, ordered, options...)
+	}
+	return iterParallel(ctx, bkt, dir, f, concurrency, ordered, options...)
+}
+
+// parallelIterEntry is an entry of IterParallel whose attributes are fetched once done is closed.
+type parallelIterEntry struct {
+	attrs IterObjectAttributes
+	done  chan struct{}
+}
+
+func iterParallel(ctx context.Context, bkt BucketReader, dir string, f func(IterObjectAttributes) error, concurrency int, ordered bool, options ...IterOption) error {
+	if concurrency <= 0 {
+		return errors.New("concurrency must be positive")
+	}
+	params := ApplyIterOptions(options...)
+	// Only pass the options affecting the listing to Iter, the attributes are fetched separately.
+	var listOptions []IterOption
+	if params.Recursive {
+		listOptions = append(listOptions, WithRecursiveIter)
+	}
+	if params.MaxResults > 0 {
+		listOptions = append(listOptions, WithMaxResults(params.MaxResults))
+	}
+	if params.StorageClassFilter != "" {
+		listOptions = append(listOptions, FilterStorageClass(params.StorageClassFilter))
+	}
+	if params.StartAfter != "" {
+		listOptions = append(listOptions, WithStartAfter(params.StartAfter))
+	}
+	if params.PrefixesOnly {
+		listOptions = append(listOptions, WithPrefixesOnly)
+	}
+	if params.Filter != nil {
+		listOptions = append(listOptions, WithFilter(params.Filter))
+	}
+	if params.LimitDepth {
+		listOptions = append(listOptions, WithMaxDepth(params.MaxDepth))
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	var (
+		// entries passes the entries to f, in listing order if ordered is set, otherwise once fetched.
+		entries = make(chan *parallelIterEntry, concurrency)
+		sem     = make(chan struct{}, concurrency)
+		fetches sync.WaitGroup
+	)
+	send := func(e *parallelIterEntry) error {
+		select {
+		case entries <- e:
+			return nil
+		case <-gctx.Done():
+			return gctx.Err()
+		}
+	}
+
+	g.Go(func() error {
+		defer func() {
+			fetches.Wait()
+			close(entries)
+		}()
+		return Iter(gctx, bkt, dir, func(name string) error {
+			e := &parallelIterEntry{attrs: IterObjectAttributes{Name: name}, done: make(chan struct{})}
+			if strings.HasSuffix(name, DirDelim) {
+				close(e.done)
+				return send(e)
+			}
+			if ordered {
+				if err := send(e); err != nil {
+					return err
+				}
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			fetches.Add(1)
+			g.Go(func() error {
+				defer fetches.Done()
+				defer func() { <-sem }()
+
+				attrs, err := bkt.Attributes(gctx, name)
+				if err != nil {
+					return errors.Wrapf(err, "get attributes of %s", name)
+				}
+				if params.ETag {
+					e.attrs.SetETag(attrs.ETag)
+				}
+				if params.Size {
+					e.attrs.SetSize(attrs.Size)
+				}
+				if params.StorageClass {
+					e.attrs.SetStorageClass(attrs.StorageClass)
+				}
+				if params.UserMetadata {
+					e.attrs.SetUserMetadata(attrs.UserMetadata)
+				}
+				if params.LastModified {
+					e.attrs.SetLastModified(attrs.LastModified)
+				}
+				if params.CreatedAt {
+					e.attrs.SetCreatedAt(attrs.CreatedAt)
+				}
+				close(e.done)
+				if !ordered {
+					return send(e)
+				}
+				return nil
+			})
+			return nil
+		}, listOptions...)
+	})
+	g.Go(func() error {
+		for e := range entries {
+			select {
+			case <-e.done:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			if err := f(e.attrs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return g.Wait()
+}
+
+// errIterDone stops the listings of IterWithAttributes once enough entries were passed to the callback.
+var errIterDone = errors.New("iteration done")
+
+// Iter calls f for each entry in the given directory like bkt.Iter, but applies the client-side options
+// WithFilter, WithMaxDepth and WithConcurrency itself, so that they are supported by every bucket, see
+// IterWithAttributes.
+func Iter(ctx context.Context, bkt BucketReader, dir string, f func(name string) error, options ...IterOption) error {
+	if !hasClientSideIterOptions(ApplyIterOptions(options...)) {
+		return bkt.Iter(ctx, dir, f, options...)
+	}
+	return IterWithAttributes(ctx, bkt, dir, func(attrs IterObjectAttributes) error {
+		return f(attrs.Name)
+	}, options...)
+}
+
+// IterWithAttributes calls f for each entry in the given directory like bkt.IterWithAttributes, but applies
+// the client-side options WithFilter, WithMaxDepth and WithConcurrency itself, so that they are supported by
+// every bucket. The other options are passed to the bucket and have to be supported by it. f is never called
+// concurrently.
+func IterWithAttributes(ctx context.Context, bkt BucketReader, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	params := ApplyIterOptions(options...)
+	if !hasClientSideIterOptions(params) {
+		return bkt.IterWithAttributes(ctx, dir, f, options...)
+	}
+	if params.LimitDepth && params.MaxDepth < 0 {
+		return errors.New("max depth must not be negative")
+	}
+
+	prefix := dir
+	if prefix != "" && !strings.HasSuffix(prefix, DirDelim) {
+		prefix += DirDelim
+	}
+	var (
+		listed int
+		dirs   = map[string]struct{}{}
+	)
+	// The options which apply to the reported entries, some of which are directories, are handled here.
+	err := iterConcurrently(ctx, bkt, dir, func(attrs IterObjectAttributes) error {
+		if params.LimitDepth {
+			parts := strings.SplitAfterN(strings.TrimPrefix(attrs.Name, prefix), DirDelim, params.MaxDepth+2)
+			if len(parts) > params.MaxDepth+1 {
+				name := prefix + strings.Join(parts[:params.MaxDepth+1], "")
+				if _, ok := dirs[name]; ok || (params.StartAfter != "" && name <= params.StartAfter) {
+					return nil
+				}
+				dirs[name] = struct{}{}
+				attrs = IterObjectAttributes{Name: name}
+			} else if params.PrefixesOnly {
+				return nil
+			}
+		}
+		if params.SkipName(attrs.Name) {
+			return nil
+		}
+		if params.MaxResults > 0 && listed >= params.MaxResults {
+			return errIterDone
+		}
+		listed++
+		return f(attrs)
+	}, params.Concurrency, append(options, func(p *IterParams) {
+		p.MaxResults = 0
+		p.Filter = nil
+		p.Concurrency = 0
+		if p.LimitDepth {
+			p.Recursive = true
+			p.LimitDepth = false
+			p.PrefixesOnly = false
+		}
+	})...)
+	if err != nil && !errors.Is(err, errIterDone) {
+		return err
+	}
+	return nil
+}
+
+// hasClientSideIterOptions returns true if any of the options applied by IterWithAttributes itself is set.
+func hasClientSideIterOptions(params IterParams) bool {
+	return params.Filter != nil || params.LimitDepth || params.Concurrency > 1
+}
+
+// iterConcurrently lists the directories found directly in the given directory with up to concurrency
+// listings at once if the listing is recursive, otherwise it lists the directory with IterWithAttributes.
+// Entries are passed to f serially.
+func iterConcurrently(ctx context.Context, bkt BucketReader, dir string, f func(IterObjectAttributes) error, concurrency int, options ...IterOption) error {
+	params := ApplyIterOptions(options...)
+	if !params.Recursive || concurrency <= 1 || params.PrefixesOnly {
+		return bkt.IterWithAttributes(ctx, dir, f, options...)
+	}
+	if err := ValidateIterOptions(bkt.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	var (
+		mtx  sync.Mutex
+		dirs []string
+	)
+	serialF := func(attrs IterObjectAttributes) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return f(attrs)
+	}
+
+	// List the given directory first to find its sub-directories, and pass the objects in it to f.
+	err := bkt.IterWithAttributes(ctx, dir, func(attrs IterObjectAttributes) error {
+		if strings.HasSuffix(attrs.Name, DirDelim) {
+			dirs = append(dirs, attrs.Name)
+			return nil
+		}
+		return serialF(attrs)
+	}, append(options, func(params *IterParams) {
+		params.Recursive = false
+	})...)
+	if err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, d := range dirs {
+		d := d
+		g.Go(func() error {
+			return bkt.IterWithAttributes(gctx, d, serialF, options...)
+		})
+	}
+	return g.Wait()
+}
+
+// WalkFunc is called by Walk for each entry. For objects, attrs holds the attributes of the object which the
+// bucket returns with the listing. For directories, which are only passed to it at the depth given with
+// WithMaxDepth, attrs is empty. err is reserved for errors of a single entry and is nil for now. If the
+// function returns an error, Walk stops and returns it.
+type WalkFunc func(path string, attrs ObjectAttributes, err error) error
+
+// walkAttributes are the attributes Walk requests with the listing if the bucket supports them.
+var walkAttributes = map[IterOptionType]IterOption{
+	Size:         WithSize,
+	UpdatedAt:    WithUpdatedAt,
+	ETag:         WithETag,
+	StorageClass: WithStorageClassIter,
+	UserMetadata: WithUserMetadataIter,
+}
+
+// Walk calls f for each object found recursively in the given directory, with the attributes the bucket
+// supports returning with IterWithAttributes, see SupportedIterOptions. The attributes are not fetched one
+// by one, attributes the bucket can't list are left empty. The depth of the walk can be limited with
+// WithMaxDepth. Errors listing the directory are returned as is.
+func Walk(ctx context.Context, bkt BucketReader, dir string, f WalkFunc, options ...IterOption) error {
+	options = append(options, WithRecursiveIter)
+	for _, opt := range bkt.SupportedIterOptions() {
+		if o, ok := walkAttributes[opt]; ok {
+			options = append(options, o)
+		}
+	}
+	return IterWithAttributes(ctx, bkt, dir, func(entry IterObjectAttributes) error {
+		if strings.HasSuffix(entry.Name, DirDelim) {
+			return f(entry.Name, ObjectAttributes{}, nil)
+		}
+		attrs := ObjectAttributes{
+			ETag:         entry.ETag(),
+			StorageClass: entry.StorageClass(),
+			UserMetadata: entry.UserMetadata(),
+		}
+		attrs.Size, _ = entry.Size()
+		attrs.LastModified, _ = entry.LastModified()
+		return f(entry.Name, attrs, nil)
+	}, options...)
+}
+
+// SetUserMetadata sets the user metadata of the object.
+func (i *IterObjectAttributes) SetUserMetadata(metadata map[string]string) {
+	i.userMetadata = metadata
+}
+
+// UserMetadata returns the user metadata of the object. It is only populated when the WithUserMetadataIter
+// option is requested, nil is returned otherwise or if the object has no user metadata.
+func (i IterObjectAttributes) UserMetadata() map[string]string {
+	return i.userMetadata
+}
+
+// SetLastModified sets the last modification time of the object.
+func (i *IterObjectAttributes) SetLastModified(lastModified time.Time) {
+	i.lastModified = lastModified
+}
+
+// LastModified returns the last modification time of the object. The returned bool is false if the time was
+// not set, because the WithUpdatedAt option was not requested or the entry is a directory.
+func (i IterObjectAttributes) LastModified() (time.Time, bool) {
+	return i.lastModified, !i.lastModified.IsZero()
+}
+
+// SetCreatedAt sets the creation time of the object.
+func (i *IterObjectAttributes) SetCreatedAt(createdAt time.Time) {
+	i.createdAt = createdAt
+}
+
+// CreatedAt returns the creation time of the object. The returned bool is false if the time was not set,
+// because the WithCreatedAt option was not requested or the entry is a directory.
+func (i IterObjectAttributes) CreatedAt() (time.Time, bool) {
+	return i.createdAt, !i.createdAt.IsZero()
+}
+
+// DownloadOption configures the provided params.
+type DownloadOption func(params *downloadParams)
+
+// downloadParams holds the DownloadDir() parameters and is used by objstore clients implementations.
+type downloadParams struct {
+	concurrency  int
+	ignoredPaths []string
+}
+
+// WithDownloadIgnoredPaths is an option to set the paths to not be downloaded.
+func WithDownloadIgnoredPaths(ignoredPaths ...string) DownloadOption {
+	return func(params *downloadParams) {
+		params.ignoredPaths = ignoredPaths
+	}
+}
+
+// WithFetchConcurrency is an option to set the concurrency of the download operation.
+func WithFetchConcurrency(concurrency int) DownloadOption {
+	return func(params *downloadParams) {
+		params.concurrency = concurrency
+	}
+}
+
+func applyDownloadOptions(options ...DownloadOption) downloadParams {
+	out := downloadParams{
+		concurrency: 1,
+	}
+	for _, opt := range options {
+		opt(&out)
+	}
+	return out
+}
+
+// UploadOption configures the provided params.
+type UploadOption func(params *uploadParams)
+
+// uploadParams holds the UploadDir() parameters and is used by objstore clients implementations.
+type uploadParams struct {
+	concurrency int
+}
+
+// WithUploadConcurrency is an option to set the concurrency of the upload operation.
+func WithUploadConcurrency(concurrency int) UploadOption {
+	return func(params *uploadParams) {
+		params.concurrency = concurrency
+	}
+}
+
+func applyUploadOptions(options ...UploadOption) uploadParams {
+	out := uploadParams{
+		concurrency: 1,
+	}
+	for _, opt := range options {
+		opt(&out)
+	}
+	return out
+}
+
+// DefaultContentType is the content type of objects uploaded without WithContentType.
+const DefaultContentType = "application/octet-stream"
+
+// ObjectUploadOption configures UploadObjectParams.
+type ObjectUploadOption func(params *UploadObjectParams)
+
+// UploadObjectParams holds the parameters of a single object upload and is used by objstore clients implementations.
+type UploadObjectParams struct {
+	// ContentType is the MIME type of the object. It defaults to DefaultContentType.
+	ContentType string
+	// CacheControl is the value of the Cache-Control header served with the object.
+	CacheControl string
+	// ContentEncoding is the value of the Content-Encoding header served with the object, e.g. gzip.
+	ContentEncoding string
+	// UserMetadata is the custom metadata stored alongside the object.
+	UserMetadata map[string]string
+	// StorageClass is the provider-specific storage class of the object, e.g. NEARLINE for GCS or STANDARD_IA
+	// for S3. The default storage class of the bucket is used if it is empty.
+	StorageClass string
+	// MD5 is the MD5 checksum of the content, sent along with the upload so that the provider rejects
+	// corrupted uploads. It is not sent if nil.
+	MD5 []byte
+	// CRC32C is the CRC32C checksum of the content, using the Castagnoli table. It is only sent if SendCRC32C is true.
+	CRC32C     uint32
+	SendCRC32C bool
+	// PublicRead makes the object readable by anyone, see WithPublicRead.
+	PublicRead bool
+}
+
+// WithContentType is an option to set the content type of the uploaded object.
+func WithContentType(contentType string) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.ContentType = contentType
+	}
+}
+
+// WithCacheControl is an option to set the cache control of the uploaded object.
+func WithCacheControl(cacheControl string) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.CacheControl = cacheControl
+	}
+}
+
+// WithContentEncoding is an option to set the content encoding of the uploaded object.
+func WithContentEncoding(contentEncoding string) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.ContentEncoding = contentEncoding
+	}
+}
+
+// WithUserMetadata is an option to set custom metadata of the uploaded object. The metadata is validated with
+// ValidateUserMetadata by the upload. S3 and Azure treat keys case-insensitively and return them in lowercase,
+// while GCS, the filesystem and the in-memory bucket keep their case. Use lowercase keys, e.g. "block_id", so that
+// the metadata reads back the same from all providers.
+func WithUserMetadata(metadata map[string]string) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.UserMetadata = metadata
+	}
+}
+
+// ValidateUserMetadata returns an error if the user metadata can't be stored by all providers. As Azure only
+// accepts keys which are valid C# identifiers, keys have to consist of ASCII letters, digits and underscores and
+// must not start with a digit. Keys must not only differ in case. Values must not contain control characters.
+func ValidateUserMetadata(metadata map[string]string) error {
+	lowercase := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if k == "" {
+			return errors.New("user metadata key must not be empty")
+		}
+		for i, c := range k {
+			if !isIdentifierChar(c) || (i == 0 && c >= '0' && c <= '9') {
+				return errors.Errorf("invalid character %q in user metadata key %q", c, k)
+			}
+		}
+		if other, ok := lowercase[strings.ToLower(k)]; ok {
+			return errors.Errorf("user metadata keys %q and %q only differ in case", other, k)
+		}
+		lowercase[strings.ToLower(k)] = k
+		for _, c := range v {
+			if unicode.IsControl(c) {
+				return errors.Errorf("invalid character %q in the value of user metadata key %q", c, k)
+			}
+		}
+	}
+	return nil
 }
 
-// InstrumentedBucketReader is a BucketReader with optional instrumentation control.
-type InstrumentedBucketReader interface {
-	BucketReader
+// isIdentifierChar returns true if the character is an ASCII letter, digit or underscore.
+func isIdentifierChar(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
 
-	// ReaderWithExpectedErrs allows to specify a filter that marks certain errors as expected, so it will not increment
-	// objstore_bucket_operation_failures_total metric.
-	ReaderWithExpectedErrs(IsOpFailureExpectedFunc) BucketReader
+// WithStorageClass is an option to set the storage class of the uploaded object. The value is specific to the
+// provider, e.g. NEARLINE or COLDLINE for GCS and STANDARD_IA or GLACIER for S3.
+func WithStorageClass(storageClass string) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.StorageClass = storageClass
+	}
 }
 
-// IterOption configures the provided params.
-type IterOption func(params *IterParams)
+// WithMD5 is an option to send the MD5 checksum of the content along with the upload, so that providers which
+// support it reject the upload if the received content doesn't match. Providers which don't support it ignore it.
+func WithMD5(sum []byte) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.MD5 = sum
+	}
+}
 
-// WithRecursiveIter is an option that can be applied to Iter() to recursively list objects
-// in the bucket.
-func WithRecursiveIter(params *IterParams) {
-	params.Recursive = true
+// WithCRC32C is an option to send the CRC32C checksum of the content along with the upload, so that providers
+// which support it reject the upload if the received content doesn't match. Providers which don't support it
+// ignore it.
+func WithCRC32C(sum uint32) ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.CRC32C = sum
+		params.SendCRC32C = true
+	}
 }
 
-// IterParams holds the Iter() parameters and is used by objstore clients implementations.
-type IterParams struct {
-	Recursive bool
+// WithPublicRead is an option to make the uploaded object readable by anyone, without authentication. It sets the
+// publicRead predefined ACL on GCS and the public-read canned ACL on S3. GCS rejects it for buckets with uniform
+// bucket-level access enabled, where only the IAM policy of the bucket grants access. Such uploads, and uploads
+// to providers without object ACLs, fail with an error matching ErrOptionNotSupported.
+func WithPublicRead() ObjectUploadOption {
+	return func(params *UploadObjectParams) {
+		params.PublicRead = true
+	}
 }
 
-func ApplyIterOptions(options ...IterOption) IterParams {
-	out := IterParams{}
-	for _, opt := range options {
+// ApplyObjectUploadOptions creates UploadObjectParams from the options.
+func ApplyObjectUploadOptions(opts ...ObjectUploadOption) UploadObjectParams {
+	out := UploadObjectParams{}
+	for _, opt := range opts {
 		opt(&out)
 	}
+	if out.ContentType == "" {
+		out.ContentType = DefaultContentType
+	}
 	return out
 }
 
-// DownloadOption configures the provided params.
-type DownloadOption func(params *downloadParams)
+// ApplyObjectUpdateOptions creates UploadObjectParams from the options without applying defaults, so that
+// UpdateMetadata implementations can leave the attributes which are not set unchanged.
+func ApplyObjectUpdateOptions(opts ...ObjectUploadOption) UploadObjectParams {
+	out := UploadObjectParams{}
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
 
-// downloadParams holds the DownloadDir() parameters and is used by objstore clients implementations.
-type downloadParams struct {
-	concurrency  int
-	ignoredPaths []string
+// ObjectGetOption configures GetObjectParams.
+type ObjectGetOption func(params *GetObjectParams)
+
+// GetObjectParams holds the parameters of a single object read with GetWithOptions and is used by objstore
+// clients implementations.
+type GetObjectParams struct {
+	// DecodeContent makes the reader return the decoded content of objects uploaded with a content encoding,
+	// e.g. the gunzipped content of objects uploaded with WithContentEncoding("gzip").
+	DecodeContent bool
+	// ReadCompressed makes the reader return the content of objects uploaded with a content encoding as it is
+	// stored, for providers which decode it transparently otherwise, e.g. GCS.
+	ReadCompressed bool
 }
 
-// WithDownloadIgnoredPaths is an option to set the paths to not be downloaded.
-func WithDownloadIgnoredPaths(ignoredPaths ...string) DownloadOption {
-	return func(params *downloadParams) {
-		params.ignoredPaths = ignoredPaths
+// WithDecodeContent is an option to decode the content of objects uploaded with a content encoding when reading
+// them. Only the gzip encoding is supported.
+func WithDecodeContent() ObjectGetOption {
+	return func(params *GetObjectParams) {
+		params.DecodeContent = true
 	}
 }
 
-// WithFetchConcurrency is an option to set the concurrency of the download operation.
-func WithFetchConcurrency(concurrency int) DownloadOption {
-	return func(params *downloadParams) {
-		params.concurrency = concurrency
+// WithReadCompressed is an option to read the content of objects uploaded with a content encoding as it is
+// stored, e.g. for byte-exact downloads of objects which GCS would decompress otherwise.
+func WithReadCompressed() ObjectGetOption {
+	return func(params *GetObjectParams) {
+		params.ReadCompressed = true
 	}
 }
 
-func applyDownloadOptions(options ...DownloadOption) downloadParams {
-	out := downloadParams{
-		concurrency: 1,
-	}
-	for _, opt := range options {
+// ApplyObjectGetOptions creates GetObjectParams from the options.
+func ApplyObjectGetOptions(opts ...ObjectGetOption) GetObjectParams {
+	out := GetObjectParams{}
+	for _, opt := range opts {
 		opt(&out)
 	}
 	return out
 }
 
-// UploadOption configures the provided params.
-type UploadOption func(params *uploadParams)
+// OptionsGetter is an optional interface that can be implemented by a BucketReader which is able to apply
+// ObjectGetOptions when reading objects.
+type OptionsGetter interface {
+	// GetWithOptions returns a reader for the given object name, applying the given options. If the object
+	// does not exist, IsObjNotFoundErr should return true for the returned error.
+	GetWithOptions(ctx context.Context, name string, opts ...ObjectGetOption) (io.ReadCloser, error)
+}
 
-// uploadParams holds the UploadDir() parameters and is used by objstore clients implementations.
-type uploadParams struct {
-	concurrency int
+// GetWithOptions returns a reader for the given object name, applying the given options. For buckets which don't
+// implement OptionsGetter, the content is decoded according to the content encoding reported by GetWithAttributes
+// if WithDecodeContent is set, and returned as Get does otherwise, as such buckets don't transcode it.
+func GetWithOptions(ctx context.Context, bkt BucketReader, name string, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	params := ApplyObjectGetOptions(opts...)
+	if params.DecodeContent && params.ReadCompressed {
+		return nil, errors.New("decoding and reading compressed content are mutually exclusive")
+	}
+	if og, ok := bkt.(OptionsGetter); ok {
+		return og.GetWithOptions(ctx, name, opts...)
+	}
+	if !params.DecodeContent {
+		return bkt.Get(ctx, name)
+	}
+	rc, attrs, err := GetWithAttributes(ctx, bkt, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewContentDecodingReader(rc, attrs.ContentEncoding)
 }
 
-// WithUploadConcurrency is an option to set the concurrency of the upload operation.
-func WithUploadConcurrency(concurrency int) UploadOption {
-	return func(params *uploadParams) {
-		params.concurrency = concurrency
+// OptionsRangeGetter is an optional interface that can be implemented by a BucketReader which is able to apply
+// ObjectGetOptions when reading ranges of objects.
+type OptionsRangeGetter interface {
+	// GetRangeWithOptions returns a new range reader for the given object name and range, applying the given
+	// options. If the object does not exist, IsObjNotFoundErr should return true for the returned error.
+	GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...ObjectGetOption) (io.ReadCloser, error)
+}
+
+// GetRangeWithOptions returns a new range reader for the given object name and range, applying the given options,
+// e.g. WithReadCompressed to read a range of the content as it is stored. WithDecodeContent is not supported, as
+// a range of encoded content can't be decoded on its own. The options are ignored by buckets which don't implement
+// OptionsRangeGetter, which return the range as GetRange does.
+func GetRangeWithOptions(ctx context.Context, bkt BucketReader, name string, off, length int64, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	if ApplyObjectGetOptions(opts...).DecodeContent {
+		return nil, errors.New("decoding content is not supported for range reads")
+	}
+	og, ok := bkt.(OptionsRangeGetter)
+	if !ok {
+		return bkt.GetRange(ctx, name, off, length)
 	}
+	return og.GetRangeWithOptions(ctx, name, off, length, opts...)
 }
 
-func applyUploadOptions(options ...UploadOption) uploadParams {
-	out := uploadParams{
-		concurrency: 1,
+// AttributedGetter is an optional interface that can be implemented by a BucketReader which is able to return
+// the attributes of an object along with its content in a single request.
+type AttributedGetter interface {
+	// GetWithAttributes returns a reader for the given object name and the attributes of the object which is
+	// read. If the object does not exist, IsObjNotFoundErr should return true for the returned error.
+	GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, ObjectAttributes, error)
+}
+
+// GetWithAttributes returns a reader for the given object name and the attributes of the object. Providers may
+// only return the attributes which are part of the response of the read, as documented by their implementations.
+// Buckets which don't implement AttributedGetter are asked for the attributes first and the content afterwards,
+// so if the object is replaced in between, the attributes may not match the content.
+func GetWithAttributes(ctx context.Context, bkt BucketReader, name string) (io.ReadCloser, ObjectAttributes, error) {
+	if ag, ok := bkt.(AttributedGetter); ok {
+		return ag.GetWithAttributes(ctx, name)
 	}
-	for _, opt := range options {
-		opt(&out)
+	attrs, err := bkt.Attributes(ctx, name)
+	if err != nil {
+		return nil, ObjectAttributes{}, err
 	}
-	return out
+	rc, err := bkt.Get(ctx, name)
+	if err != nil {
+		return nil, ObjectAttributes{}, err
+	}
+	return rc, attrs, nil
+}
+
+// NewContentDecodingReader returns a reader of the decoded content of rc, which was stored with the given content
+// encoding. An empty or identity encoding returns rc. Closing the returned reader closes rc.
+func NewContentDecodingReader(rc io.ReadCloser, contentEncoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(contentEncoding) {
+	case "", "identity":
+		return rc, nil
+	case "gzip":
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			_ = rc.Close()
+			return nil, errors.Wrap(err, "create gzip reader")
+		}
+		return gzipReadCloser{Reader: zr, rc: rc}, nil
+	default:
+		_ = rc.Close()
+		return nil, errors.Errorf("unsupported content encoding %q", contentEncoding)
+	}
+}
+
+// gzipReadCloser closes both the gzip reader and the reader of the compressed content.
+type gzipReadCloser struct {
+	*gzip.Reader
+	rc io.ReadCloser
+}
+
+func (r gzipReadCloser) Close() error {
+	err := r.Reader.Close()
+	if cerr := r.rc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// UploadObjectAttributes are the attributes which can be set when uploading an object with UploadWithAttributes.
+type UploadObjectAttributes struct {
+	ContentType     string
+	CacheControl    string
+	ContentEncoding string
+	UserMetadata    map[string]string
+	StorageClass    string
+}
+
+// UploadWithAttributes uploads the contents of the reader as an object into the bucket, setting the given attributes.
+// Empty attributes are left to the provider defaults.
+func UploadWithAttributes(ctx context.Context, bkt Bucket, name string, r io.Reader, attrs UploadObjectAttributes) error {
+	return bkt.Upload(ctx, name, r,
+		WithContentType(attrs.ContentType),
+		WithCacheControl(attrs.CacheControl),
+		WithContentEncoding(attrs.ContentEncoding),
+		WithUserMetadata(attrs.UserMetadata),
+		WithStorageClass(attrs.StorageClass),
+	)
 }
 
 type ObjectAttributes struct {
@@ -187,6 +1971,43 @@ type ObjectAttributes struct {
 
 	// LastModified is the timestamp the object was last modified.
 	LastModified time.Time `json:"last_modified"`
+
+	// ETag is the entity tag of the object. It is empty if the provider does not support it.
+	ETag string `json:"etag"`
+
+	// ContentType is the MIME type of the object. It is empty if the provider does not support it.
+	ContentType string `json:"content_type"`
+
+	// StorageClass is the storage class of the object. It is empty if the provider does not support it
+	// or the object has the default storage class of the bucket.
+	StorageClass string `json:"storage_class"`
+
+	// UserMetadata is the custom metadata set when uploading the object. It is nil if the object has
+	// no user metadata or the provider does not support it.
+	UserMetadata map[string]string `json:"user_metadata,omitempty"`
+
+	// MD5 is the MD5 checksum of the content of the object. It is nil if the provider does not report it.
+	MD5 []byte `json:"md5,omitempty"`
+
+	// CRC32C is the CRC32C checksum of the content of the object. It is nil if the provider does not report it.
+	CRC32C *uint32 `json:"crc32c,omitempty"`
+
+	// ContentEncoding is the content encoding the object was uploaded with, e.g. gzip. It is empty if the object
+	// was uploaded without one or the provider does not report it.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// CacheControl is the value of the Cache-Control header served with the object. It is empty if the object was
+	// uploaded without one or the provider does not report it.
+	CacheControl string `json:"cache_control,omitempty"`
+
+	// VersionID identifies the current version of the object, e.g. the generation of a GCS object or the version
+	// ID of an S3 object in a versioned bucket, and can be passed to GetVersion to read this version after the
+	// object was overwritten. It is empty if the provider does not support versions.
+	VersionID string `json:"version_id,omitempty"`
+
+	// CreatedAt is the timestamp the object was created. It is zero if the provider does not track the creation
+	// time separately from the last modification time.
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // TryToGetSize tries to get upfront size from reader.
@@ -232,6 +2053,216 @@ func NopCloserWithSize(r io.Reader) io.ReadCloser {
 	return nopCloserWithObjectSize{r}
 }
 
+// crc32cTable is the table of the Castagnoli polynomial used for CRC32C checksums.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32cBytes encodes the CRC32C checksum in big-endian byte order.
+func crc32cBytes(sum uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, sum)
+	return b
+}
+
+// checksumVerifyingReader computes the checksums of the content read from the wrapped reader and compares them
+// to the expected ones once all bytes of the object were read.
+type checksumVerifyingReader struct {
+	io.ReadCloser
+	attrs ObjectAttributes
+
+	read     int64
+	md5      hash.Hash
+	crc32c   hash.Hash32
+	verified bool
+	err      error
+}
+
+// NewChecksumVerifyingReader wraps the reader of the whole content of an object, e.g. returned by Get, so that
+// the MD5 and CRC32C checksums reported in attrs are verified once the content was read completely. A mismatch
+// is returned as a ChecksumMismatchError instead of io.EOF, and again by Close. Nothing is verified if attrs
+// don't report any checksum or if the number of read bytes doesn't match attrs.Size, e.g. because the caller
+// stopped reading early.
+func NewChecksumVerifyingReader(rc io.ReadCloser, attrs ObjectAttributes) io.ReadCloser {
+	r := &checksumVerifyingReader{ReadCloser: rc, attrs: attrs}
+	if attrs.MD5 != nil {
+		r.md5 = md5.New()
+	}
+	if attrs.CRC32C != nil {
+		r.crc32c = crc32.New(crc32cTable)
+	}
+	return r
+}
+
+func (r *checksumVerifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if r.md5 != nil {
+		_, _ = r.md5.Write(p[:n])
+	}
+	if r.crc32c != nil {
+		_, _ = r.crc32c.Write(p[:n])
+	}
+	if err == io.EOF {
+		if verifyErr := r.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+// verify compares the checksums once all content was read. A mismatch is reported again by each call.
+func (r *checksumVerifyingReader) verify() error {
+	if r.verified || r.read != r.attrs.Size {
+		return r.err
+	}
+	r.verified = true
+	if r.md5 != nil {
+		if sum := r.md5.Sum(nil); !bytes.Equal(sum, r.attrs.MD5) {
+			r.err = &ChecksumMismatchError{Algorithm: "MD5", Expected: r.attrs.MD5, Actual: sum}
+			return r.err
+		}
+	}
+	if r.crc32c != nil {
+		if sum := r.crc32c.Sum32(); sum != *r.attrs.CRC32C {
+			r.err = &ChecksumMismatchError{Algorithm: "CRC32C", Expected: crc32cBytes(*r.attrs.CRC32C), Actual: crc32cBytes(sum)}
+		}
+	}
+	return r.err
+}
+
+func (r *checksumVerifyingReader) ObjectSize() (int64, error) {
+	return r.attrs.Size, nil
+}
+
+func (r *checksumVerifyingReader) Close() error {
+	verifyErr := r.verify()
+	if err := r.ReadCloser.Close(); err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// resilientRangeReader reads a range of an object, reopening it at the first unread offset if reading fails.
+type resilientRangeReader struct {
+	ctx        context.Context
+	bkt        BucketReader
+	name       string
+	off        int64
+	length     int64
+	maxResumes int
+
+	rc      io.ReadCloser
+	read    int64
+	resumes int
+	// err is returned by all reads after the range couldn't be reopened.
+	err error
+
+	// size and sizeErr are returned by ObjectSize, as reported by the reader of the first response.
+	size    int64
+	sizeErr error
+}
+
+// NewResilientRangeReader returns a reader of the given range of the object like GetRange, which transparently
+// requests the rest of the range again with GetRange if reading fails mid-stream, e.g. because the connection
+// was dropped, or ends before length bytes were read. A response ending before length bytes were read is only
+// resumed if the range doesn't run past the end of the object according to Attributes. The range is reopened at
+// most maxResumes times. Errors opening the range, context cancellations, not found errors and checksum
+// mismatches are returned as they are.
+//
+// Suffix ranges with a negative off can't be resumed and are rejected. The object is expected not to change
+// while it is read, otherwise the content before and after a resume might belong to different objects.
+func NewResilientRangeReader(ctx context.Context, bkt BucketReader, name string, off, length int64, maxResumes int) (io.ReadCloser, error) {
+	if off < 0 {
+		return nil, errors.Errorf("suffix range of %s can't be resumed", name)
+	}
+	rc, err := bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	r := &resilientRangeReader{ctx: ctx, bkt: bkt, name: name, off: off, length: length, maxResumes: maxResumes, rc: rc}
+	r.size, r.sizeErr = TryToGetSize(rc)
+	return r, nil
+}
+
+func (r *resilientRangeReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for {
+		n, err := r.rc.Read(p)
+		r.read += int64(n)
+		if err == nil || err == io.EOF && r.length < 0 {
+			return n, err
+		}
+		if r.length >= 0 && r.read >= r.length {
+			// The whole range was read, only errors about its content are relevant.
+			if r.recoverable(err) {
+				return n, io.EOF
+			}
+			return n, err
+		}
+		if err == io.EOF {
+			if r.pastEnd() {
+				// The range runs past the end of the object, which was read completely.
+				r.length = r.read
+				return n, io.EOF
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		if resumeErr := r.resume(err); resumeErr != nil {
+			return n, resumeErr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume reopens the range at the first unread offset after reading failed with err, unless the maximum number
+// of resumes was reached or err can't be recovered from. It returns the error to return to the reader otherwise.
+func (r *resilientRangeReader) resume(err error) error {
+	if r.resumes >= r.maxResumes || !r.recoverable(err) {
+		return err
+	}
+	r.resumes++
+	_ = r.rc.Close()
+
+	length := r.length
+	if length >= 0 {
+		length -= r.read
+	}
+	rc, openErr := r.bkt.GetRange(r.ctx, r.name, r.off+r.read, length)
+	if openErr != nil {
+		r.rc = nil
+		r.err = errors.Wrapf(openErr, "resume reading %s at offset %d after %v", r.name, r.off+r.read, err)
+		return r.err
+	}
+	r.rc = rc
+	return nil
+}
+
+// pastEnd returns true if all bytes of the object after off were read. It is false if the size of the object
+// can't be requested.
+func (r *resilientRangeReader) pastEnd() bool {
+	attrs, err := r.bkt.Attributes(r.ctx, r.name)
+	return err == nil && r.off+r.read >= attrs.Size
+}
+
+// recoverable returns true if reading the range again might not fail with err.
+func (r *resilientRangeReader) recoverable(err error) bool {
+	return r.ctx.Err() == nil && !r.bkt.IsObjNotFoundErr(err) && !IsChecksumMismatchErr(err)
+}
+
+func (r *resilientRangeReader) ObjectSize() (int64, error) {
+	return r.size, r.sizeErr
+}
+
+func (r *resilientRangeReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
+
 // UploadDir uploads all files in srcdir to the bucket with into a top-level directory
 // named dstdir. It is a caller responsibility to clean partial upload in case of failure.
 func UploadDir(ctx context.Context, logger log.Logger, bkt Bucket, srcdir, dstdir string, options ...UploadOption) error {
@@ -292,6 +2323,21 @@ func UploadFile(ctx context.Context, logger log.Logger, bkt Bucket, src, dst str
 	return nil
 }
 
+// DefaultCopy copies the src object into dst by downloading it with Get and uploading it again with Upload.
+// It can be used by Bucket implementations which don't support server-side copy.
+func DefaultCopy(ctx context.Context, bkt Bucket, src, dst string) (err error) {
+	rc, err := bkt.Get(ctx, src)
+	if err != nil {
+		return errors.Wrapf(err, "get object %s", src)
+	}
+	defer errcapture.Do(&err, rc.Close, "close object reader %s", src)
+
+	if err := bkt.Upload(ctx, dst, rc); err != nil {
+		return errors.Wrapf(err, "upload object %s as %s", src, dst)
+	}
+	return nil
+}
+
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
@@ -395,6 +2441,287 @@ func DownloadDir(ctx context.Context, logger log.Logger, bkt BucketReader, origi
 	return nil
 }
 
+// WrappingBucket is implemented by buckets which wrap another bucket, e.g. to instrument it, so that the bucket
+// of the provider can be found with UnwrapBucket.
+type WrappingBucket interface {
+	// WrappedBucket returns the wrapped bucket.
+	WrappedBucket() Bucket
+}
+
+// UnwrapBucket returns the innermost bucket wrapped by bkt, or bkt if it doesn't implement WrappingBucket.
+// Wrappers can change the names of the objects, e.g. the prefixed bucket, see UnwrapObject.
+func UnwrapBucket(bkt Bucket) Bucket {
+	bkt, _ = UnwrapObject(bkt, "")
+	return bkt
+}
+
+// UnwrapObject returns the innermost bucket wrapped by bkt like UnwrapBucket, and the name the object with the
+// given name has in it, e.g. including the prefix of a prefixed bucket.
+func UnwrapObject(bkt Bucket, name string) (Bucket, string) {
+	for {
+		if p, ok := bkt.(*PrefixedBucket); ok {
+			name = conditionalPrefix(p.prefix, name)
+		}
+		w, ok := bkt.(WrappingBucket)
+		if !ok {
+			return bkt, name
+		}
+		bkt = w.WrappedBucket()
+	}
+}
+
+// DiffResult is the difference between the objects of two buckets, as returned by BucketDiff. All names are
+// sorted.
+type DiffResult struct {
+	// OnlyInSrc are the objects which only exist in the source bucket.
+	OnlyInSrc []string
+	// OnlyInDst are the objects which only exist in the destination bucket.
+	OnlyInDst []string
+	// Different are the objects which exist in both buckets, but with different ETags or sizes.
+	Different []string
+}
+
+// diffEntry is an object listed by BucketDiff.
+type diffEntry struct {
+	name string
+	etag string
+	size int64
+}
+
+// diffAttributesConcurrency is the number of objects whose attributes are fetched at once by BucketDiff for
+// buckets which can't return them with the listing.
+const diffAttributesConcurrency = 16
+
+// BucketDiff compares the objects found recursively under the given prefix in both buckets, by name, ETag and
+// size. ETags are specific to the provider, so they are only compared if both buckets are of the same provider,
+// see UnwrapBucket, and both report one. Objects of buckets of different providers are only compared by size.
+// ETags of the same content can still differ within a provider, e.g. objects uploaded in multiple parts to S3
+// don't have the MD5 checksum of their content as ETag, so such objects are reported as different. The
+// attributes are listed with IterWithAttributes, or fetched for each object with IterParallel if the bucket
+// doesn't support the ETag and Size option types.
+func BucketDiff(ctx context.Context, src, dst Bucket, prefix string) (*DiffResult, error) {
+	diff, _, err := bucketDiff(ctx, src, dst, prefix)
+	return diff, err
+}
+
+// bucketDiff compares the buckets like BucketDiff, and returns the names of the objects which are the same in
+// both buckets as well.
+func bucketDiff(ctx context.Context, src, dst Bucket, prefix string) (*DiffResult, []string, error) {
+	var srcEntries, dstEntries []diffEntry
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		srcEntries, err = listDiffEntries(gctx, src, prefix)
+		return errors.Wrapf(err, "list source bucket %s", src.Name())
+	})
+	g.Go(func() (err error) {
+		dstEntries, err = listDiffEntries(gctx, dst, prefix)
+		return errors.Wrapf(err, "list destination bucket %s", dst.Name())
+	})
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	compareETags := reflect.TypeOf(UnwrapBucket(src)) == reflect.TypeOf(UnwrapBucket(dst))
+	var (
+		diff = &DiffResult{}
+		same []string
+	)
+	i, j := 0, 0
+	for i < len(srcEntries) || j < len(dstEntries) {
+		switch {
+		case j == len(dstEntries) || (i < len(srcEntries) && srcEntries[i].name < dstEntries[j].name):
+			diff.OnlyInSrc = append(diff.OnlyInSrc, srcEntries[i].name)
+			i++
+		case i == len(srcEntries) || dstEntries[j].name < srcEntries[i].name:
+			diff.OnlyInDst = append(diff.OnlyInDst, dstEntries[j].name)
+			j++
+		default:
+			s, d := srcEntries[i], dstEntries[j]
+			if s.size != d.size || (compareETags && s.etag != "" && d.etag != "" && s.etag != d.etag) {
+				diff.Different = append(diff.Different, s.name)
+			} else {
+				same = append(same, s.name)
+			}
+			i++
+			j++
+		}
+	}
+	return diff, same, nil
+}
+
+// listDiffEntries returns the objects found recursively under the given prefix, sorted by name.
+func listDiffEntries(ctx context.Context, bkt Bucket, prefix string) ([]diffEntry, error) {
+	var (
+		entries []diffEntry
+		options = []IterOption{WithRecursiveIter, WithETag, WithSize}
+	)
+	collect := func(attrs IterObjectAttributes) error {
+		if strings.HasSuffix(attrs.Name, DirDelim) {
+			return nil
+		}
+		size, _ := attrs.Size()
+		entries = append(entries, diffEntry{name: attrs.Name, etag: attrs.ETag(), size: size})
+		return nil
+	}
+
+	var err error
+	if ValidateIterOptions(bkt.SupportedIterOptions(), options...) == nil {
+		err = bkt.IterWithAttributes(ctx, prefix, collect, options...)
+	} else {
+		err = IterParallel(ctx, bkt, prefix, collect, diffAttributesConcurrency, false, options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// syncObject streams the object with the given name from src to dst through the client.
+func syncObject(ctx context.Context, src, dst Bucket, name string) (err error) {
+	rc, err := src.Get(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "get object %s", name)
+	}
+	defer errcapture.Do(&err, rc.Close, "close object reader %s", name)
+
+	if err := dst.Upload(ctx, name, rc); err != nil {
+		return errors.Wrapf(err, "upload object %s", name)
+	}
+	return nil
+}
+
+// ErrCrossBucketCopyNotSupported is returned by CrossBucketCopier implementations which are not able to copy
+// objects from the given bucket server-side.
+var ErrCrossBucketCopyNotSupported = errors.New("copy between these buckets is not supported")
+
+// CrossBucketCopier is an optional interface that can be implemented by a Bucket which is able to copy objects
+// from another bucket of the same provider server-side. Wrappers forward it to the bucket they wrap, and
+// providers find the bucket wrapped by src with UnwrapObject.
+type CrossBucketCopier interface {
+	// CopyFromBucket copies the object with the src name in the src bucket into a new object with the dst name
+	// in this bucket. It returns ErrCrossBucketCopyNotSupported if src can't be copied from server-side, e.g.
+	// because it is a bucket of another provider.
+	CopyFromBucket(ctx context.Context, src Bucket, srcName, dstName string) error
+}
+
+// CopyFromBucket copies the object with the srcName in the src bucket into a new object with the dstName in the
+// dst bucket server-side. It returns ErrCrossBucketCopyNotSupported if dst does not implement CrossBucketCopier.
+func CopyFromBucket(ctx context.Context, src, dst Bucket, srcName, dstName string) error {
+	c, ok := dst.(CrossBucketCopier)
+	if !ok {
+		return ErrCrossBucketCopyNotSupported
+	}
+	return c.CopyFromBucket(ctx, src, srcName, dstName)
+}
+
+// SyncOptions configures SyncBuckets.
+type SyncOptions struct {
+	// Prefix is the directory whose objects are synced, including those of its subdirectories.
+	Prefix string
+	// Concurrency is the number of objects copied at once. Objects are copied one by one if it is not positive.
+	Concurrency int
+	// DryRun only reports the objects which would be copied, without copying them.
+	DryRun bool
+	// OverwriteExisting copies objects which exist in both buckets with different ETags or sizes as well.
+	// Otherwise, objects which already exist in the destination bucket are skipped.
+	OverwriteExisting bool
+	// ProgressCallback is called after each object with the number of objects copied, skipped and failed to
+	// be copied so far. It is never called concurrently.
+	ProgressCallback func(copied, skipped, failed int)
+}
+
+// SyncResult is the result of SyncBuckets.
+type SyncResult struct {
+	// Copied is the number of objects copied, or which would have been copied in a dry run.
+	Copied int
+	// Skipped is the number of objects which were not copied because they already exist in the destination
+	// bucket.
+	Skipped int
+	// Failed is the number of objects which could not be copied.
+	Failed int
+	// Errors holds the error for each object which could not be copied.
+	Errors map[string]error
+}
+
+// SyncBuckets copies the objects found recursively under the prefix of opts from src to dst, unless they already
+// exist in dst. Objects are compared with BucketDiff. They are copied server-side if dst implements
+// CrossBucketCopier for src, and streamed through the client otherwise. Only the content of the objects is
+// copied, not their attributes.
+//
+// Objects which could not be copied don't stop the sync of the others; they are reported by the returned
+// SyncResult. An error is only returned if the buckets could not be listed.
+func SyncBuckets(ctx context.Context, src, dst Bucket, opts SyncOptions) (*SyncResult, error) {
+	diff, same, err := bucketDiff(ctx, src, dst, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	toCopy, toSkip := diff.OnlyInSrc, same
+	if opts.OverwriteExisting {
+		toCopy = append(toCopy, diff.Different...)
+	} else {
+		toSkip = append(toSkip, diff.Different...)
+	}
+
+	var (
+		wg          sync.WaitGroup
+		mtx         sync.Mutex
+		res         = &SyncResult{Errors: map[string]error{}}
+		names       = make(chan string)
+		concurrency = opts.Concurrency
+	)
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	done := func(name string, copied bool, err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch {
+		case err != nil:
+			res.Failed++
+			res.Errors[name] = err
+		case copied:
+			res.Copied++
+		default:
+			res.Skipped++
+		}
+		if opts.ProgressCallback != nil {
+			opts.ProgressCallback(res.Copied, res.Skipped, res.Failed)
+		}
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				done(name, true, copyObjectBetweenBuckets(ctx, src, dst, name))
+			}
+		}()
+	}
+
+	for _, name := range toSkip {
+		done(name, false, nil)
+	}
+	for _, name := range toCopy {
+		if opts.DryRun {
+			done(name, true, nil)
+			continue
+		}
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+	return res, nil
+}
+
+// copyObjectBetweenBuckets copies the object with the given name from src to dst, server-side if possible.
+func copyObjectBetweenBuckets(ctx context.Context, src, dst Bucket, name string) error {
+	if err := CopyFromBucket(ctx, src, dst, name, name); !errors.Is(err, ErrCrossBucketCopyNotSupported) {
+		return err
+	}
+	return syncObject(ctx, src, dst, name)
+}
+
 // IsOpFailureExpectedFunc allows to mark certain errors as expected, so they will not increment objstore_bucket_operation_failures_total metric.
 type IsOpFailureExpectedFunc func(error) bool
 
@@ -424,6 +2751,18 @@ func WrapWithMetrics(b Bucket, reg prometheus.Registerer, name string) *metricBu
 			ConstLabels: prometheus.Labels{"bucket": name},
 		}, []string{"operation"}),
 
+		opsTransferredBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_bucket_operation_transferred_bytes_total",
+			Help:        "Total number of bytes read from or sent to the bucket by get, get_range and upload operations, including partial and failed transfers.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}, []string{"operation"}),
+
+		bytesTransferred: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_bucket_bytes_total",
+			Help:        "Total number of bytes transferred to and from the bucket by uploads and downloads, including partial reads and failed uploads.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}, []string{"operation"}),
+
 		opsDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 			Name:        "objstore_bucket_operation_duration_seconds",
 			Help:        "Duration of successful operations against the bucket",
@@ -431,10 +2770,23 @@ func WrapWithMetrics(b Bucket, reg prometheus.Registerer, name string) *metricBu
 			Buckets:     []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
 		}, []string{"operation"}),
 
+		opsListedObjects: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "objstore_bucket_operation_listed_objects",
+			Help:        "Number of entries passed to the callback by a single listing operation against the bucket, including listings which failed or were canceled.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+			Buckets:     prometheus.ExponentialBuckets(1, 4, 10),
+		}, []string{"operation"}),
+
 		lastSuccessfulUploadTime: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "objstore_bucket_last_successful_upload_time",
 			Help: "Second timestamp of the last successful upload to the bucket.",
 		}, []string{"bucket"}),
+
+		health: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "objstore_bucket_health",
+			Help:        "Result of the last health check of the bucket, 1 if it succeeded and 0 if it failed.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}),
 	}
 	for _, op := range []string{
 		OpIter,
@@ -444,13 +2796,20 @@ func WrapWithMetrics(b Bucket, reg prometheus.Registerer, name string) *metricBu
 		OpUpload,
 		OpDelete,
 		OpAttributes,
+		OpCopy,
 	} {
 		bkt.ops.WithLabelValues(op)
 		bkt.opsFailures.WithLabelValues(op)
 		bkt.opsDuration.WithLabelValues(op)
 		bkt.opsFetchedBytes.WithLabelValues(op)
 	}
+	for _, op := range []string{OpGet, OpGetRange, OpUpload} {
+		bkt.opsTransferredBytes.WithLabelValues(op)
+	}
+	bkt.opsListedObjects.WithLabelValues(OpIter)
 	bkt.lastSuccessfulUploadTime.WithLabelValues(b.Name())
+	bkt.bytesUploaded = bkt.bytesTransferred.WithLabelValues(bytesOpUpload)
+	bkt.bytesDownloaded = bkt.bytesTransferred.WithLabelValues(bytesOpDownload)
 	return bkt
 }
 
@@ -462,9 +2821,19 @@ type metricBucket struct {
 	isOpFailureExpected IsOpFailureExpectedFunc
 
 	opsFetchedBytes *prometheus.CounterVec
+	// opsTransferredBytes counts the bytes streamed by get, get range and upload operations as they are read.
+	opsTransferredBytes *prometheus.CounterVec
+
+	// bytesTransferred counts the bytes of uploads and downloads as they are sent or read, regardless of the
+	// operation used for them and whether it succeeded.
+	bytesTransferred *prometheus.CounterVec
+	bytesUploaded    prometheus.Counter
+	bytesDownloaded  prometheus.Counter
 
 	opsDuration              *prometheus.HistogramVec
+	opsListedObjects         *prometheus.HistogramVec
 	lastSuccessfulUploadTime *prometheus.GaugeVec
+	health                   prometheus.Gauge
 }
 
 func (b *metricBucket) WithExpectedErrs(fn IsOpFailureExpectedFunc) Bucket {
@@ -473,9 +2842,15 @@ func (b *metricBucket) WithExpectedErrs(fn IsOpFailureExpectedFunc) Bucket {
 		ops:                      b.ops,
 		opsFailures:              b.opsFailures,
 		opsFetchedBytes:          b.opsFetchedBytes,
+		opsTransferredBytes:      b.opsTransferredBytes,
+		bytesTransferred:         b.bytesTransferred,
+		bytesUploaded:            b.bytesUploaded,
+		bytesDownloaded:          b.bytesDownloaded,
 		isOpFailureExpected:      fn,
 		opsDuration:              b.opsDuration,
+		opsListedObjects:         b.opsListedObjects,
 		lastSuccessfulUploadTime: b.lastSuccessfulUploadTime,
+		health:                   b.health,
 	}
 }
 
@@ -487,13 +2862,61 @@ func (b *metricBucket) Iter(ctx context.Context, dir string, f func(name string)
 	const op = OpIter
 	b.ops.WithLabelValues(op).Inc()
 
-	err := b.bkt.Iter(ctx, dir, f, options...)
+	var listed int
+	start := time.Now()
+	err := b.bkt.Iter(ctx, dir, func(name string) error {
+		listed++
+		return f(name)
+	}, options...)
+	b.observeIter(ctx, op, start, listed, err)
+	return err
+}
+
+func (b *metricBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	const op = OpIter
+	b.ops.WithLabelValues(op).Inc()
+
+	var listed int
+	start := time.Now()
+	err := b.bkt.IterWithAttributes(ctx, dir, func(attrs IterObjectAttributes) error {
+		listed++
+		return f(attrs)
+	}, options...)
+	b.observeIter(ctx, op, start, listed, err)
+	return err
+}
+
+// IterParallel records the whole parallel iteration as an iter operation, the calls to Attributes are not
+// recorded on their own.
+func (b *metricBucket) IterParallel(ctx context.Context, dir string, f func(IterObjectAttributes) error, concurrency int, ordered bool, options ...IterOption) error {
+	const op = OpIter
+	b.ops.WithLabelValues(op).Inc()
+
+	var listed int
+	start := time.Now()
+	err := IterParallel(ctx, b.bkt, dir, func(attrs IterObjectAttributes) error {
+		listed++
+		return f(attrs)
+	}, concurrency, ordered, options...)
+	b.observeIter(ctx, op, start, listed, err)
+	return err
+}
+
+// observeIter records the number of listed entries of an iteration, which is partial if it failed, and
+// its duration if it succeeded.
+func (b *metricBucket) observeIter(ctx context.Context, op string, start time.Time, listed int, err error) {
+	b.opsListedObjects.WithLabelValues(op).Observe(float64(listed))
 	if err != nil {
 		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
 			b.opsFailures.WithLabelValues(op).Inc()
 		}
+		return
 	}
-	return err
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+func (b *metricBucket) SupportedIterOptions() []IterOptionType {
+	return b.bkt.SupportedIterOptions()
 }
 
 func (b *metricBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
@@ -530,14 +2953,69 @@ func (b *metricBucket) Get(ctx context.Context, name string) (io.ReadCloser, err
 		b.opsFailures,
 		b.isOpFailureExpected,
 		b.opsFetchedBytes,
+		b.opsTransferredBytes,
+		b.bytesDownloaded,
+	), nil
+}
+
+// GetWithOptions is counted as a get operation.
+func (b *metricBucket) GetWithOptions(ctx context.Context, name string, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	const op = OpGet
+	b.ops.WithLabelValues(op).Inc()
+
+	rc, err := GetWithOptions(ctx, b.bkt, name, opts...)
+	if err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return nil, err
+	}
+	return newTimingReadCloser(
+		rc,
+		op,
+		b.opsDuration,
+		b.opsFailures,
+		b.isOpFailureExpected,
+		b.opsFetchedBytes,
+		b.opsTransferredBytes,
+		b.bytesDownloaded,
 	), nil
 }
 
+// GetWithAttributes is counted as a get operation, also if the wrapped bucket asks for the attributes separately.
+func (b *metricBucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, ObjectAttributes, error) {
+	const op = OpGet
+	b.ops.WithLabelValues(op).Inc()
+
+	rc, attrs, err := GetWithAttributes(ctx, b.bkt, name)
+	if err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return nil, ObjectAttributes{}, err
+	}
+	return newTimingReadCloser(
+		rc,
+		op,
+		b.opsDuration,
+		b.opsFailures,
+		b.isOpFailureExpected,
+		b.opsFetchedBytes,
+		b.opsTransferredBytes,
+		b.bytesDownloaded,
+	), attrs, nil
+}
+
 func (b *metricBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.GetRangeWithOptions(ctx, name, off, length)
+}
+
+// GetRangeWithOptions is counted as a get_range operation.
+func (b *metricBucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...ObjectGetOption) (io.ReadCloser, error) {
 	const op = OpGetRange
 	b.ops.WithLabelValues(op).Inc()
 
-	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	rc, err := GetRangeWithOptions(ctx, b.bkt, name, off, length, opts...)
 	if err != nil {
 		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
 			b.opsFailures.WithLabelValues(op).Inc()
@@ -551,6 +3029,8 @@ func (b *metricBucket) GetRange(ctx context.Context, name string, off, length in
 		b.opsFailures,
 		b.isOpFailureExpected,
 		b.opsFetchedBytes,
+		b.opsTransferredBytes,
+		b.bytesDownloaded,
 	), nil
 }
 
@@ -570,15 +3050,71 @@ func (b *metricBucket) Exists(ctx context.Context, name string) (bool, error) {
 	return ok, nil
 }
 
-func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+// Stat records the request as an attributes operation. Missing objects are not recorded as failures.
+func (b *metricBucket) Stat(ctx context.Context, name string) (ObjectAttributes, bool, error) {
+	const op = OpAttributes
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	attrs, ok, err := Stat(ctx, b.bkt, name)
+	if err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return attrs, false, err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return attrs, ok, nil
+}
+
+func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	const op = OpUpload
+	b.ops.WithLabelValues(op).Inc()
+
+	r = b.countUploadedBytes(op, r)
+	start := time.Now()
+	if err := b.bkt.Upload(ctx, name, r, opts...); err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return err
+	}
+	b.lastSuccessfulUploadTime.WithLabelValues(b.bkt.Name()).SetToCurrentTime()
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (b *metricBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
 	const op = OpUpload
 	b.ops.WithLabelValues(op).Inc()
 
+	r = b.countUploadedBytes(op, r)
 	start := time.Now()
-	if err := b.bkt.Upload(ctx, name, r); err != nil {
+	created, err := UploadIfNotExists(ctx, b.bkt, name, r)
+	if err != nil {
 		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
 			b.opsFailures.WithLabelValues(op).Inc()
 		}
+		return false, err
+	}
+	if created {
+		b.lastSuccessfulUploadTime.WithLabelValues(b.bkt.Name()).SetToCurrentTime()
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return created, nil
+}
+
+func (b *metricBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	const op = OpUpload
+	b.ops.WithLabelValues(op).Inc()
+
+	r = b.countUploadedBytes(op, r)
+	start := time.Now()
+	if err := UploadIfMatch(ctx, b.bkt, name, r, etag, opts...); err != nil {
+		// Conflicts are expected when updating objects concurrently.
+		if !b.isOpFailureExpected(err) && !IsPreconditionFailedErr(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
 		return err
 	}
 	b.lastSuccessfulUploadTime.WithLabelValues(b.bkt.Name()).SetToCurrentTime()
@@ -586,6 +3122,31 @@ func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader) err
 	return nil
 }
 
+// countUploadedBytes returns the reader to upload, which adds the bytes read from it to the uploaded bytes and the
+// transferred bytes of the operation right away, so that failed and retried uploads are reflected as well.
+func (b *metricBucket) countUploadedBytes(op string, r io.Reader) io.Reader {
+	size, sizeErr := TryToGetSize(r)
+	ur := &uploadCountingReader{
+		r:           r,
+		uploaded:    b.bytesUploaded,
+		transferred: b.opsTransferredBytes.WithLabelValues(op),
+		size:        size,
+		sizeErr:     sizeErr,
+	}
+
+	// Keep readers seekable, so that uploads can still be retried, and readable at offsets, so that large
+	// uploads of files are still sent in parallel parts without being buffered.
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return ur
+	}
+	rs := &uploadCountingReadSeeker{uploadCountingReader: ur, seeker: s}
+	if ra, ok := r.(io.ReaderAt); ok {
+		return &uploadCountingReadSeekerAt{uploadCountingReadSeeker: rs, readerAt: ra}
+	}
+	return rs
+}
+
 func (b *metricBucket) Delete(ctx context.Context, name string) error {
 	const op = OpDelete
 	b.ops.WithLabelValues(op).Inc()
@@ -602,6 +3163,210 @@ func (b *metricBucket) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
+// DeleteMany removes the objects with the given names. Each object is counted as a separate delete operation.
+// The duration of the batch is not comparable with a single delete, so it is not observed.
+func (b *metricBucket) DeleteMany(ctx context.Context, names []string) error {
+	const op = OpDelete
+	b.ops.WithLabelValues(op).Add(float64(len(names)))
+
+	err := b.bkt.DeleteMany(ctx, names)
+	if err == nil || ctx.Err() == context.Canceled {
+		return err
+	}
+
+	var res *BatchDeleteResult
+	if !errors.As(err, &res) {
+		if !b.isOpFailureExpected(err) {
+			b.opsFailures.WithLabelValues(op).Add(float64(len(names)))
+		}
+		return err
+	}
+	for _, objErr := range res.Errors {
+		if !b.isOpFailureExpected(objErr) {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+	}
+	return err
+}
+
+func (b *metricBucket) Copy(ctx context.Context, src, dst string) error {
+	const op = OpCopy
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	if err := b.bkt.Copy(ctx, src, dst); err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (b *metricBucket) CopyWithAttributes(ctx context.Context, src, dst string, attrs CopyObjectAttributes) error {
+	return b.trackOptional(ctx, OpCopy, ErrCopyWithAttributesNotSupported, func() error {
+		return CopyWithAttributes(ctx, b.bkt, src, dst, attrs)
+	})
+}
+
+// CopyFromBucket is counted as a copy operation.
+func (b *metricBucket) CopyFromBucket(ctx context.Context, src Bucket, srcName, dstName string) error {
+	return b.trackOptional(ctx, OpCopy, ErrCrossBucketCopyNotSupported, func() error {
+		return CopyFromBucket(ctx, src, b.bkt, srcName, dstName)
+	})
+}
+
+// Rename is counted as a copy operation.
+func (b *metricBucket) Rename(ctx context.Context, src, dst string) error {
+	return b.trackOptional(ctx, OpCopy, ErrRenameNotSupported, func() error {
+		return Rename(ctx, b.bkt, src, dst)
+	})
+}
+
+// ListVersions is counted as an iter operation.
+func (b *metricBucket) ListVersions(ctx context.Context, name string) (versions []VersionInfo, err error) {
+	err = b.trackOptional(ctx, OpIter, ErrVersioningNotSupported, func() (err error) {
+		versions, err = ListVersions(ctx, b.bkt, name)
+		return err
+	})
+	return versions, err
+}
+
+// UpdateMetadata is counted as an upload operation.
+func (b *metricBucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...ObjectUploadOption) error {
+	return b.trackOptional(ctx, OpUpload, ErrUpdateMetadataNotSupported, func() error {
+		return UpdateMetadata(ctx, b.bkt, name, md, opts...)
+	})
+}
+
+// SetObjectTags is counted as an upload operation.
+func (b *metricBucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) error {
+	return b.trackOptional(ctx, OpUpload, ErrTaggingNotSupported, func() error {
+		return SetObjectTags(ctx, b.bkt, name, tags)
+	})
+}
+
+// GetObjectTags is counted as an attributes operation.
+func (b *metricBucket) GetObjectTags(ctx context.Context, name string) (tags map[string]string, err error) {
+	err = b.trackOptional(ctx, OpAttributes, ErrTaggingNotSupported, func() (err error) {
+		tags, err = GetObjectTags(ctx, b.bkt, name)
+		return err
+	})
+	return tags, err
+}
+
+// DeleteObjectTags is counted as an upload operation.
+func (b *metricBucket) DeleteObjectTags(ctx context.Context, name string) error {
+	return b.trackOptional(ctx, OpUpload, ErrTaggingNotSupported, func() error {
+		return DeleteObjectTags(ctx, b.bkt, name)
+	})
+}
+
+// trackOptional records the metrics of an operation of an optional interface, counted as op, with f. Attempts
+// failing with notSupported aren't counted, as the wrapped bucket doesn't implement the interface. GetVersion
+// does the same, but observes the duration once the returned reader is closed.
+func (b *metricBucket) trackOptional(ctx context.Context, op string, notSupported error, f func() error) error {
+	start := time.Now()
+	err := f()
+	if errors.Is(err, notSupported) {
+		return err
+	}
+
+	b.ops.WithLabelValues(op).Inc()
+	if err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// IterVersions is counted as an iter operation.
+func (b *metricBucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	return b.trackOptional(ctx, OpIter, ErrVersioningNotSupported, func() error {
+		return IterVersions(ctx, b.bkt, prefix, f)
+	})
+}
+
+// GetVersion is counted as a get operation.
+func (b *metricBucket) GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
+	const op = OpGet
+
+	rc, err := GetVersion(ctx, b.bkt, name, versionID)
+	if errors.Is(err, ErrVersioningNotSupported) {
+		return nil, err
+	}
+
+	b.ops.WithLabelValues(op).Inc()
+	if err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return nil, err
+	}
+	return newTimingReadCloser(
+		rc,
+		op,
+		b.opsDuration,
+		b.opsFailures,
+		b.isOpFailureExpected,
+		b.opsFetchedBytes,
+		b.opsTransferredBytes,
+		b.bytesDownloaded,
+	), nil
+}
+
+// DeleteVersion is counted as a delete operation.
+func (b *metricBucket) DeleteVersion(ctx context.Context, name, versionID string) error {
+	return b.trackOptional(ctx, OpDelete, ErrVersioningNotSupported, func() error {
+		return DeleteVersion(ctx, b.bkt, name, versionID)
+	})
+}
+
+// RestoreVersion is counted as a copy operation.
+func (b *metricBucket) RestoreVersion(ctx context.Context, name, versionID string) error {
+	return b.trackOptional(ctx, OpCopy, ErrVersioningNotSupported, func() error {
+		return RestoreVersion(ctx, b.bkt, name, versionID)
+	})
+}
+
+// Ping checks that the bucket can be accessed and updates the health gauge with the result.
+func (b *metricBucket) Ping(ctx context.Context) error {
+	err := Ping(ctx, b.bkt)
+	if errors.Is(err, ErrHealthCheckNotSupported) {
+		return err
+	}
+	if err != nil {
+		b.health.Set(0)
+		return err
+	}
+	b.health.Set(1)
+	return nil
+}
+
+// SupportedCopy returns true if the wrapped bucket copies objects server-side.
+func (b *metricBucket) SupportedCopy() bool {
+	if c, ok := b.bkt.(ServerSideCopier); ok {
+		return c.SupportedCopy()
+	}
+	return false
+}
+
+func (b *metricBucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return PresignedGetURL(ctx, b.bkt, name, expiry)
+}
+
+func (b *metricBucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return PresignPut(ctx, b.bkt, name, expiry)
+}
+
+func (b *metricBucket) NewMultipartUpload(ctx context.Context, name string, opts ...ObjectUploadOption) (MultipartWriter, error) {
+	return NewMultipartUpload(ctx, b.bkt, name, opts...)
+}
+
 func (b *metricBucket) IsObjNotFoundErr(err error) bool {
 	return b.bkt.IsObjNotFoundErr(err)
 }
@@ -618,6 +3383,62 @@ func (b *metricBucket) Name() string {
 	return b.bkt.Name()
 }
 
+func (b *metricBucket) WrappedBucket() Bucket {
+	return b.bkt
+}
+
+// Values of the operation label of the objstore_bucket_bytes_total metric.
+const (
+	bytesOpUpload   = "upload"
+	bytesOpDownload = "download"
+)
+
+// uploadCountingReader adds every byte read from the reader of an upload to the uploaded bytes and the transferred
+// bytes of the operation. It reports the size of the wrapped reader, so that providers can still determine it.
+type uploadCountingReader struct {
+	r           io.Reader
+	uploaded    prometheus.Counter
+	transferred prometheus.Counter
+
+	size    int64
+	sizeErr error
+}
+
+func (r *uploadCountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.uploaded.Add(float64(n))
+	r.transferred.Add(float64(n))
+	return n, err
+}
+
+func (r *uploadCountingReader) ObjectSize() (int64, error) {
+	return r.size, r.sizeErr
+}
+
+// uploadCountingReadSeeker is an uploadCountingReader of a seekable reader. The bytes read again after rewinding
+// the reader, e.g. to retry an upload, are counted again, as they are sent again.
+type uploadCountingReadSeeker struct {
+	*uploadCountingReader
+	seeker io.Seeker
+}
+
+func (r *uploadCountingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.seeker.Seek(offset, whence)
+}
+
+// uploadCountingReadSeekerAt is an uploadCountingReadSeeker of a reader which can be read at offsets as well.
+type uploadCountingReadSeekerAt struct {
+	*uploadCountingReadSeeker
+	readerAt io.ReaderAt
+}
+
+func (r *uploadCountingReadSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.readerAt.ReadAt(p, off)
+	r.uploaded.Add(float64(n))
+	r.transferred.Add(float64(n))
+	return n, err
+}
+
 type timingReadCloser struct {
 	io.ReadCloser
 	objSize    int64
@@ -631,9 +3452,11 @@ type timingReadCloser struct {
 	failed            *prometheus.CounterVec
 	isFailureExpected IsOpFailureExpectedFunc
 	fetchedBytes      *prometheus.CounterVec
+	transferredBytes  *prometheus.CounterVec
+	downloadedBytes   prometheus.Counter
 }
 
-func newTimingReadCloser(rc io.ReadCloser, op string, dur *prometheus.HistogramVec, failed *prometheus.CounterVec, isFailureExpected IsOpFailureExpectedFunc, fetchedBytes *prometheus.CounterVec) *timingReadCloser {
+func newTimingReadCloser(rc io.ReadCloser, op string, dur *prometheus.HistogramVec, failed *prometheus.CounterVec, isFailureExpected IsOpFailureExpectedFunc, fetchedBytes, transferredBytes *prometheus.CounterVec, downloadedBytes prometheus.Counter) *timingReadCloser {
 	// Initialize the metrics with 0.
 	dur.WithLabelValues(op)
 	failed.WithLabelValues(op)
@@ -648,6 +3471,8 @@ func newTimingReadCloser(rc io.ReadCloser, op string, dur *prometheus.HistogramV
 		failed:            failed,
 		isFailureExpected: isFailureExpected,
 		fetchedBytes:      fetchedBytes,
+		transferredBytes:  transferredBytes,
+		downloadedBytes:   downloadedBytes,
 	}
 }
 
@@ -670,6 +3495,8 @@ func (rc *timingReadCloser) Close() error {
 func (rc *timingReadCloser) Read(b []byte) (n int, err error) {
 	n, err = rc.ReadCloser.Read(b)
 	rc.fetchedBytes.WithLabelValues(rc.op).Add(float64(n))
+	rc.transferredBytes.WithLabelValues(rc.op).Add(float64(n))
+	rc.downloadedBytes.Add(float64(n))
 	// Report metric just once.
 	if !rc.alreadyGotErr && err != nil && err != io.EOF {
 		if !rc.isFailureExpected(err) {
@@ -5,11 +5,18 @@ package objstore
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/efficientgo/core/testutil"
 	"github.com/go-kit/log"
@@ -17,61 +24,85 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/atomic"
+	"golang.org/x/sync/errgroup"
 )
 
 func TestMetricBucket_Close(t *testing.T) {
 	bkt := WrapWithMetrics(NewInMemBucket(), nil, "abc")
 	// Expected initialized metrics.
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsDuration))
 
 	AcceptanceTest(t, bkt.WithExpectedErrs(bkt.IsObjNotFoundErr))
-	testutil.Equals(t, float64(9), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
-	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
-	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
+	testutil.Equals(t, float64(25), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
+	testutil.Equals(t, float64(20), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
+	testutil.Equals(t, float64(11), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
 	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGetRange)))
-	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
-	testutil.Equals(t, float64(9), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
-	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
-	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpIter)))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
+	testutil.Equals(t, float64(31), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
+	testutil.Equals(t, float64(12), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.ops))
+	// In-memory bucket does not support the ETag iter option.
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpIter)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpAttributes)))
 	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpGet)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpGetRange)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpExists)))
-	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
+	// Upload with invalid user metadata.
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsDuration))
 	lastUpload := promtest.ToFloat64(bkt.lastSuccessfulUploadTime)
 	testutil.Assert(t, lastUpload > 0, "last upload not greater than 0, val: %f", lastUpload)
 
 	// Clear bucket, but don't clear metrics to ensure we use same.
 	bkt.bkt = NewInMemBucket()
 	AcceptanceTest(t, bkt)
-	testutil.Equals(t, float64(18), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
-	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
+	testutil.Equals(t, float64(50), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
+	testutil.Equals(t, float64(40), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
+	testutil.Equals(t, float64(22), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
 	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGetRange)))
-	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
-	testutil.Equals(t, float64(18), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
-	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpIter)))
-	// Not expected not found error here.
-	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpAttributes)))
+	testutil.Equals(t, float64(8), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
+	testutil.Equals(t, float64(62), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
+	testutil.Equals(t, float64(24), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
+	testutil.Equals(t, float64(8), promtest.ToFloat64(bkt.ops.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpIter)))
+	// Not expected not found errors of Attributes, also for the missing object created by UpdateObject.
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpAttributes)))
 	// Not expected not found errors, this should increment failure metric on get for not found as well, so +2.
 	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpGet)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpGetRange)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpExists)))
-	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
+	// Not expected not found errors of tagging and updating the metadata of a missing object.
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	// Not expected not found errors on copy and rename of a missing object.
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsDuration))
 	testutil.Assert(t, promtest.ToFloat64(bkt.lastSuccessfulUploadTime) > lastUpload)
 }
 
+func TestMetricBucket_OptionalNotSupported(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(struct{ Bucket }{NewInMemBucket()}, nil, "abc")
+
+	testutil.Equals(t, ErrRenameNotSupported, bkt.Rename(ctx, "a", "b"))
+	testutil.Equals(t, ErrTaggingNotSupported, bkt.SetObjectTags(ctx, "a", nil))
+	_, err := bkt.GetVersion(ctx, "a", "1")
+	testutil.Equals(t, ErrVersioningNotSupported, err)
+
+	// Attempts against a bucket which doesn't implement the optional interfaces are not counted.
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.ops.WithLabelValues(OpCopy)))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
+}
+
 func TestDownloadUploadDirConcurrency(t *testing.T) {
 	r := prometheus.NewRegistry()
 	m := WrapWithMetrics(NewInMemBucket(), r, "")
@@ -85,6 +116,7 @@ func TestDownloadUploadDirConcurrency(t *testing.T) {
 		# HELP objstore_bucket_operations_total Total number of all attempted operations against a bucket.
         # TYPE objstore_bucket_operations_total counter
         objstore_bucket_operations_total{bucket="",operation="attributes"} 0
+        objstore_bucket_operations_total{bucket="",operation="copy"} 0
         objstore_bucket_operations_total{bucket="",operation="delete"} 0
         objstore_bucket_operations_total{bucket="",operation="exists"} 0
         objstore_bucket_operations_total{bucket="",operation="get"} 0
@@ -101,6 +133,7 @@ func TestDownloadUploadDirConcurrency(t *testing.T) {
 		# HELP objstore_bucket_operations_total Total number of all attempted operations against a bucket.
         # TYPE objstore_bucket_operations_total counter
         objstore_bucket_operations_total{bucket="",operation="attributes"} 0
+        objstore_bucket_operations_total{bucket="",operation="copy"} 0
         objstore_bucket_operations_total{bucket="",operation="delete"} 0
         objstore_bucket_operations_total{bucket="",operation="exists"} 0
         objstore_bucket_operations_total{bucket="",operation="get"} 3
@@ -113,6 +146,7 @@ func TestDownloadUploadDirConcurrency(t *testing.T) {
 		# HELP objstore_bucket_operation_fetched_bytes_total Total number of bytes fetched from bucket, per operation.
         # TYPE objstore_bucket_operation_fetched_bytes_total counter
         objstore_bucket_operation_fetched_bytes_total{bucket="",operation="attributes"} 0
+        objstore_bucket_operation_fetched_bytes_total{bucket="",operation="copy"} 0
         objstore_bucket_operation_fetched_bytes_total{bucket="",operation="delete"} 0
         objstore_bucket_operation_fetched_bytes_total{bucket="",operation="exists"} 0
         objstore_bucket_operation_fetched_bytes_total{bucket="",operation="get"} 3
@@ -127,6 +161,7 @@ func TestDownloadUploadDirConcurrency(t *testing.T) {
 		# HELP objstore_bucket_operations_total Total number of all attempted operations against a bucket.
         # TYPE objstore_bucket_operations_total counter
         objstore_bucket_operations_total{bucket="",operation="attributes"} 0
+        objstore_bucket_operations_total{bucket="",operation="copy"} 0
         objstore_bucket_operations_total{bucket="",operation="delete"} 0
         objstore_bucket_operations_total{bucket="",operation="exists"} 0
         objstore_bucket_operations_total{bucket="",operation="get"} 3
@@ -136,6 +171,1419 @@ func TestDownloadUploadDirConcurrency(t *testing.T) {
 		`), `objstore_bucket_operations_total`))
 }
 
+func TestDefaultCopy(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj1", strings.NewReader("content")))
+
+	testutil.Ok(t, DefaultCopy(ctx, bkt, "dir/obj1", "dir-copy/obj1"))
+	testutil.Equals(t, []byte("content"), bkt.Objects()["dir-copy/obj1"])
+	testutil.Equals(t, []byte("content"), bkt.Objects()["dir/obj1"])
+
+	err := DefaultCopy(ctx, bkt, "dir/obj2", "dir-copy/obj2")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+}
+
+func TestIsRenameSupported(t *testing.T) {
+	bkt := NewInMemBucket()
+	testutil.Assert(t, IsRenameSupported(bkt))
+	testutil.Assert(t, IsRenameSupported(WrapWithMetrics(NewPrefixedBucket(bkt, "prefix"), nil, "")))
+
+	// Wrappers implement Renamer even if the wrapped bucket doesn't.
+	plain := struct{ Bucket }{bkt}
+	testutil.Assert(t, !IsRenameSupported(plain))
+	testutil.Assert(t, !IsRenameSupported(WrapWithMetrics(plain, nil, "")))
+	testutil.Assert(t, !IsRenameSupported(WrapWithMetrics(NewPrefixedBucket(plain, "prefix"), nil, "")))
+}
+
+func TestSupportsTagger(t *testing.T) {
+	bkt := NewInMemBucket()
+	testutil.Assert(t, SupportsTagger(bkt))
+	testutil.Assert(t, SupportsTagger(WrapWithMetrics(bkt, nil, "")))
+
+	// Wrappers implement Tagger even if the wrapped bucket doesn't.
+	plain := struct{ Bucket }{bkt}
+	testutil.Assert(t, !SupportsTagger(plain))
+	testutil.Assert(t, !SupportsTagger(WrapWithMetrics(plain, nil, "")))
+}
+
+func TestInMemBucket_ContentType(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+
+	testutil.Ok(t, bkt.Upload(ctx, "obj.json", strings.NewReader(`{"a":1}`), WithContentType("application/json")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+
+	attrs, err := bkt.Attributes(ctx, "obj.json")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "application/json", attrs.ContentType)
+
+	attrs, err = bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, DefaultContentType, attrs.ContentType)
+}
+
+func TestInMemBucket_PublicRead(t *testing.T) {
+	bkt := NewInMemBucket()
+
+	err := bkt.Upload(context.Background(), "obj", strings.NewReader("content"), WithPublicRead())
+	testutil.Assert(t, errors.Is(err, ErrOptionNotSupported), "expected option not supported error, got %v", err)
+	testutil.Equals(t, 0, len(bkt.Objects()))
+}
+
+func TestInMemBucket_GetRangeSuffix(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("@test-data@")))
+
+	for _, tc := range []struct {
+		off      int64
+		expected string
+	}{
+		{off: -5, expected: "data@"},
+		{off: -11, expected: "@test-data@"},
+		{off: -100, expected: "@test-data@"},
+	} {
+		rc, err := bkt.GetRange(ctx, "obj", tc.off, -1)
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, tc.expected, string(content))
+	}
+
+	_, err := bkt.GetRange(ctx, "obj", -5, 2)
+	testutil.NotOk(t, err)
+}
+
+func TestInMemBucket_MaxSize(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket(WithInMemMaxSize(10))
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+	testutil.Ok(t, bkt.Upload(ctx, "b", strings.NewReader("bbbb")))
+
+	err := bkt.Upload(ctx, "c", strings.NewReader("cccc"))
+	testutil.Assert(t, IsQuotaExceededErr(err), "expected quota exceeded error, got %v", err)
+	err = bkt.Copy(ctx, "a", "c")
+	testutil.Assert(t, IsQuotaExceededErr(err), "expected quota exceeded error, got %v", err)
+
+	// Overwriting and deleting objects frees space.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("a")))
+	testutil.Ok(t, bkt.Upload(ctx, "c", strings.NewReader("cccc")))
+	testutil.Ok(t, bkt.Delete(ctx, "b"))
+	testutil.Ok(t, bkt.Upload(ctx, "d", strings.NewReader("dddd")))
+	testutil.Equals(t, map[string][]byte{"a": []byte("a"), "c": []byte("cccc"), "d": []byte("dddd")}, bkt.Objects())
+
+	bkt = NewInMemBucket(WithInMemMaxSize(10), WithInMemEvictOldest())
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+	testutil.Ok(t, bkt.Upload(ctx, "b", strings.NewReader("bbbb")))
+	testutil.Ok(t, bkt.Upload(ctx, "c", strings.NewReader("cccc")))
+	testutil.Equals(t, map[string][]byte{"b": []byte("bbbb"), "c": []byte("cccc")}, bkt.Objects())
+
+	// Objects larger than the max size are rejected without evicting others.
+	err = bkt.Upload(ctx, "large", strings.NewReader(strings.Repeat("l", 11)))
+	testutil.Assert(t, IsQuotaExceededErr(err), "expected quota exceeded error, got %v", err)
+	testutil.Equals(t, 2, len(bkt.Objects()))
+}
+
+func TestInMemBucket_SaveLoad(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", strings.NewReader("a"), WithContentType("text/plain"), WithUserMetadata(map[string]string{"team": "storage"})))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/sub/b", strings.NewReader("bb"), WithContentEncoding("gzip"), WithStorageClass("COLD")))
+	testutil.Ok(t, bkt.Upload(ctx, "c", strings.NewReader("")))
+	testutil.Ok(t, bkt.SetObjectTags(ctx, "c", map[string]string{"env": "prod"}))
+
+	var archive bytes.Buffer
+	testutil.Ok(t, bkt.Save(&archive))
+
+	loaded := NewInMemBucket()
+	testutil.Ok(t, loaded.Upload(ctx, "replaced", strings.NewReader("replaced")))
+	testutil.Ok(t, loaded.Load(bytes.NewReader(archive.Bytes())))
+
+	list := func(b Bucket) []string {
+		var names []string
+		testutil.Ok(t, b.Iter(ctx, "", func(name string) error {
+			names = append(names, name)
+			return nil
+		}, WithRecursiveIter))
+		return names
+	}
+	testutil.Equals(t, list(bkt), list(loaded))
+	testutil.Equals(t, []string{"c", "dir/a", "dir/sub/b"}, list(loaded))
+
+	for _, name := range list(bkt) {
+		expected, err := bkt.Attributes(ctx, name)
+		testutil.Ok(t, err)
+		actual, err := loaded.Attributes(ctx, name)
+		testutil.Ok(t, err)
+		testutil.Assert(t, expected.LastModified.Equal(actual.LastModified), "last modified of %s: expected %v, got %v", name, expected.LastModified, actual.LastModified)
+		actual.LastModified = expected.LastModified
+		testutil.Equals(t, expected, actual)
+		testutil.Equals(t, readAll(t, bkt, name), readAll(t, loaded, name))
+	}
+	tags, err := loaded.GetObjectTags(ctx, "c")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"env": "prod"}, tags)
+
+	// Saving is deterministic.
+	var again bytes.Buffer
+	testutil.Ok(t, loaded.Save(&again))
+	testutil.Equals(t, archive.Bytes(), again.Bytes())
+
+	// Invalid archives and archives exceeding the max size leave the bucket unchanged.
+	testutil.NotOk(t, loaded.Load(strings.NewReader("invalid")))
+	small := NewInMemBucket(WithInMemMaxSize(2))
+	testutil.NotOk(t, small.Load(bytes.NewReader(archive.Bytes())))
+	testutil.Equals(t, list(bkt), list(loaded))
+	testutil.Equals(t, 0, len(small.Objects()))
+}
+
+func TestInMemBucket_IterWithSize(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "empty", strings.NewReader("")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+
+	for _, tcase := range []struct {
+		name         string
+		object       string
+		opts         []IterOption
+		expectedSize int64
+		expectedOK   bool
+	}{
+		{name: "size requested, empty object", object: "empty", opts: []IterOption{WithSize}, expectedSize: 0, expectedOK: true},
+		{name: "size requested, non-empty object", object: "obj", opts: []IterOption{WithSize}, expectedSize: 7, expectedOK: true},
+		{name: "size not requested, empty object", object: "empty"},
+		{name: "size not requested, non-empty object", object: "obj"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var found bool
+			testutil.Ok(t, bkt.IterWithAttributes(ctx, "", func(attrs IterObjectAttributes) error {
+				if attrs.Name != tcase.object {
+					return nil
+				}
+				found = true
+				size, ok := attrs.Size()
+				testutil.Equals(t, tcase.expectedOK, ok)
+				testutil.Equals(t, tcase.expectedSize, size)
+				return nil
+			}, tcase.opts...))
+			testutil.Assert(t, found, "object %s not listed", tcase.object)
+		})
+	}
+}
+
+func TestUploadWithAttributes(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+
+	testutil.Ok(t, UploadWithAttributes(ctx, bkt, "obj.txt", strings.NewReader("content"), UploadObjectAttributes{
+		ContentType:  "text/plain",
+		CacheControl: "no-cache",
+	}))
+	testutil.Ok(t, UploadWithAttributes(ctx, bkt, "obj", strings.NewReader("content"), UploadObjectAttributes{}))
+
+	attrs, err := bkt.Attributes(ctx, "obj.txt")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "text/plain", attrs.ContentType)
+
+	attrs, err = bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, DefaultContentType, attrs.ContentType)
+}
+
+func TestDeleteMany(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "abc")
+	testutil.Ok(t, bkt.Upload(ctx, "obj1", strings.NewReader("content")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj2", strings.NewReader("content")))
+
+	// Objects which don't exist are skipped.
+	testutil.Ok(t, bkt.DeleteMany(ctx, []string{"obj1", "missing"}))
+
+	testutil.Ok(t, bkt.Upload(ctx, "obj3", strings.NewReader("content")))
+	bkt.bkt = failingDeleteBucket{Bucket: bkt.bkt, name: "obj3"}
+	err := bkt.DeleteMany(ctx, []string{"obj2", "obj3"})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, IsBatchDeletePartialErr(err), "expected partial error, got %v", err)
+	testutil.Assert(t, !IsBatchDeletePartialErr(errors.New("some error")))
+	testutil.Equals(t, "failed to delete 1 objects: obj3: delete obj3: some error", err.Error())
+
+	var res *BatchDeleteResult
+	testutil.Assert(t, errors.As(err, &res))
+	testutil.Equals(t, 1, len(res.Errors))
+	testutil.NotOk(t, res.Errors["obj3"])
+
+	exists, err := bkt.Exists(ctx, "obj2")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists)
+
+	// Each object is counted as a delete operation.
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDelete)))
+}
+
+// failingDeleteBucket fails to delete the object with the given name.
+type failingDeleteBucket struct {
+	Bucket
+
+	name string
+}
+
+func (b failingDeleteBucket) Delete(ctx context.Context, name string) error {
+	if name == b.name {
+		return errors.Errorf("delete %s: some error", name)
+	}
+	return b.Bucket.Delete(ctx, name)
+}
+
+func (b failingDeleteBucket) DeleteMany(ctx context.Context, names []string) error {
+	return DefaultDeleteMany(ctx, b, names)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	for i := 0; i < 2500; i++ {
+		testutil.Ok(t, bkt.Upload(ctx, fmt.Sprintf("tenant/dir%d/obj%d", i%3, i), strings.NewReader("content")))
+	}
+	testutil.Ok(t, bkt.Upload(ctx, "other/obj", strings.NewReader("content")))
+
+	var deleted, failed, calls int
+	testutil.Ok(t, DeletePrefix(ctx, bkt, "tenant/", 4, WithDeleteProgress(func(d, f int) {
+		deleted, failed = d, f
+		calls++
+	})))
+	testutil.Equals(t, 2500, deleted)
+	testutil.Equals(t, 0, failed)
+	testutil.Equals(t, 3, calls)
+	testutil.Equals(t, map[string][]byte{"other/obj": []byte("content")}, bkt.Objects())
+
+	// Failures are reported once all other objects were deleted.
+	for i := 0; i < 10; i++ {
+		testutil.Ok(t, bkt.Upload(ctx, fmt.Sprintf("tenant/obj%d", i), strings.NewReader("content")))
+	}
+	err := DeletePrefix(ctx, failingDeleteBucket{Bucket: bkt, name: "tenant/obj3"}, "tenant/", 2)
+	testutil.Assert(t, IsBatchDeletePartialErr(err), "expected partial error, got %v", err)
+	testutil.Equals(t, "failed to delete 1 objects: tenant/obj3: delete tenant/obj3: some error", err.Error())
+	testutil.Equals(t, 2, len(bkt.Objects()))
+
+	testutil.NotOk(t, DeletePrefix(ctx, bkt, "tenant/", 0))
+}
+
+// versionedBucket is an in-memory bucket which keeps the versions of objects and adds a delete marker when an
+// object is deleted, like a bucket with object versioning enabled.
+type versionedBucket struct {
+	*InMemBucket
+
+	mtx      sync.Mutex
+	next     int
+	versions map[string][]VersionInfo
+}
+
+func newVersionedBucket() *versionedBucket {
+	return &versionedBucket{InMemBucket: NewInMemBucket(), versions: map[string][]VersionInfo{}}
+}
+
+func (b *versionedBucket) addVersion(name string, deleteMarker bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.next++
+	b.versions[name] = append([]VersionInfo{{VersionID: strconv.Itoa(b.next), IsDeleteMarker: deleteMarker}}, b.versions[name]...)
+}
+
+func (b *versionedBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	if err := b.InMemBucket.Upload(ctx, name, r, opts...); err != nil {
+		return err
+	}
+	b.addVersion(name, false)
+	return nil
+}
+
+func (b *versionedBucket) Delete(ctx context.Context, name string) error {
+	if err := b.InMemBucket.Delete(ctx, name); err != nil {
+		return err
+	}
+	b.addVersion(name, true)
+	return nil
+}
+
+func (b *versionedBucket) ListVersions(_ context.Context, name string) ([]VersionInfo, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return append([]VersionInfo(nil), b.versions[name]...), nil
+}
+
+func (b *versionedBucket) GetVersion(context.Context, string, string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (b *versionedBucket) DeleteVersion(_ context.Context, name, versionID string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for i, v := range b.versions[name] {
+		if v.VersionID == versionID {
+			b.versions[name] = append(b.versions[name][:i], b.versions[name][i+1:]...)
+			if len(b.versions[name]) == 0 {
+				delete(b.versions, name)
+			}
+			return nil
+		}
+	}
+	return errors.Errorf("version %s of object %s not found", versionID, name)
+}
+
+func (b *versionedBucket) RestoreVersion(context.Context, string, string) error {
+	return errors.New("not implemented")
+}
+
+func (b *versionedBucket) IterVersions(_ context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	b.mtx.Lock()
+	var names []string
+	for name := range b.versions {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	versions := map[string][]VersionInfo{}
+	for _, name := range names {
+		versions[name] = append([]VersionInfo(nil), b.versions[name]...)
+	}
+	b.mtx.Unlock()
+
+	for _, name := range names {
+		for i, v := range versions[name] {
+			if err := f(name, v.VersionID, i == 0, v.IsDeleteMarker); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestIsVersionedBucket(t *testing.T) {
+	testutil.Assert(t, IsVersionedBucket(newVersionedBucket()))
+	testutil.Assert(t, IsVersionedBucket(WrapWithMetrics(newVersionedBucket(), nil, "")))
+
+	// Wrappers implement Versioned even if the wrapped bucket doesn't.
+	testutil.Assert(t, !IsVersionedBucket(NewInMemBucket()))
+	testutil.Assert(t, !IsVersionedBucket(WrapWithMetrics(NewInMemBucket(), nil, "")))
+}
+
+func TestEmptyBucket_Versioned(t *testing.T) {
+	ctx := context.Background()
+	bkt := newVersionedBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj1", strings.NewReader("v1")))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj1", strings.NewReader("v2")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj2", strings.NewReader("v1")))
+	// Only the versions of an object which was deleted before are left, which Iter doesn't list.
+	testutil.Ok(t, bkt.Upload(ctx, "obj3", strings.NewReader("v1")))
+	testutil.Ok(t, bkt.Delete(ctx, "obj3"))
+
+	EmptyBucket(t, ctx, bkt)
+
+	testutil.Equals(t, 0, len(bkt.Objects()))
+	var left []string
+	testutil.Ok(t, IterVersions(ctx, bkt, "", func(name, version string, _, _ bool) error {
+		left = append(left, name+"@"+version)
+		return nil
+	}))
+	testutil.Equals(t, []string(nil), left)
+}
+
+func TestUpdateObject(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "abc")
+
+	// Concurrent increments are retried on conflicts until all of them are applied.
+	const updaters = 10
+	g, gctx := errgroup.WithContext(ctx)
+	for i := 0; i < updaters; i++ {
+		g.Go(func() error {
+			for {
+				err := UpdateObject(gctx, bkt, "counter", func(old []byte) ([]byte, error) {
+					n := 0
+					if old != nil {
+						var err error
+						if n, err = strconv.Atoi(string(old)); err != nil {
+							return nil, err
+						}
+					}
+					return []byte(strconv.Itoa(n + 1)), nil
+				})
+				if !IsPreconditionFailedErr(err) {
+					return err
+				}
+			}
+		})
+	}
+	testutil.Ok(t, g.Wait())
+
+	rc, err := bkt.Get(ctx, "counter")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, strconv.Itoa(updaters), string(content))
+	// Conflicts are not counted as failures.
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
+
+	// Errors of fn are returned as is.
+	errUpdate := errors.New("update failed")
+	testutil.Equals(t, errUpdate, UpdateObject(ctx, bkt, "counter", func([]byte) ([]byte, error) {
+		return nil, errUpdate
+	}))
+
+	err = UploadIfMatch(ctx, bkt, "counter", strings.NewReader("0"), "outdated")
+	testutil.Assert(t, IsPreconditionFailedErr(err), "expected precondition failed error, got %v", err)
+	testutil.Assert(t, errors.Is(err, ErrPreconditionFailed), "expected ErrPreconditionFailed, got %v", err)
+
+	testutil.Equals(t, ErrConditionalUploadNotSupported, UpdateObject(ctx, struct{ Bucket }{NewInMemBucket()}, "obj", func([]byte) ([]byte, error) {
+		return []byte("content"), nil
+	}))
+}
+
+func TestMetricBucket_BytesTotal(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "")
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("0123456789")))
+	// Readers of unknown size are counted while they are uploaded.
+	testutil.Ok(t, bkt.Upload(ctx, "b", io.MultiReader(strings.NewReader("01234"))))
+	// Bytes sent by failed uploads are counted as well.
+	testutil.NotOk(t, bkt.Upload(ctx, "c", io.MultiReader(strings.NewReader("012"), iotest.ErrReader(errors.New("failed")))))
+	testutil.Equals(t, float64(18), promtest.ToFloat64(bkt.bytesTransferred.WithLabelValues("upload")))
+
+	rc, err := bkt.Get(ctx, "a")
+	testutil.Ok(t, err)
+	_, err = io.Copy(io.Discard, rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	rc, err = bkt.GetRange(ctx, "b", 1, 2)
+	testutil.Ok(t, err)
+	_, err = io.Copy(io.Discard, rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	// Aborted reads only count the bytes read.
+	rc, err = bkt.GetRange(ctx, "a", 2, 5)
+	testutil.Ok(t, err)
+	_, err = io.ReadFull(rc, make([]byte, 3))
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, float64(15), promtest.ToFloat64(bkt.bytesTransferred.WithLabelValues("download")))
+}
+
+func TestMetricBucket_TransferredBytes(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "")
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("0123456789")))
+	// Bytes sent by failed uploads are counted as well.
+	testutil.NotOk(t, bkt.Upload(ctx, "b", io.MultiReader(strings.NewReader("012"), iotest.ErrReader(errors.New("failed")))))
+	testutil.Equals(t, float64(13), promtest.ToFloat64(bkt.opsTransferredBytes.WithLabelValues(OpUpload)))
+
+	rc, err := bkt.Get(ctx, "a")
+	testutil.Ok(t, err)
+	_, err = io.Copy(io.Discard, rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	// Aborted reads only count the bytes read.
+	rc, err = bkt.GetRange(ctx, "a", 2, 5)
+	testutil.Ok(t, err)
+	_, err = io.ReadFull(rc, make([]byte, 3))
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, float64(10), promtest.ToFloat64(bkt.opsTransferredBytes.WithLabelValues(OpGet)))
+	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.opsTransferredBytes.WithLabelValues(OpGetRange)))
+}
+
+func TestMetricBucket_UploadReader(t *testing.T) {
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "")
+
+	// Uploaded readers keep their size and the ability to seek and read at offsets.
+	r := bkt.countUploadedBytes(OpUpload, strings.NewReader("0123456789"))
+	size, err := TryToGetSize(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), size)
+	_, ok := r.(io.ReadSeeker)
+	testutil.Assert(t, ok, "expected seekable reader")
+	_, ok = r.(io.ReaderAt)
+	testutil.Assert(t, ok, "expected reader at offsets")
+
+	r = bkt.countUploadedBytes(OpUpload, io.MultiReader(strings.NewReader("01234")))
+	_, err = TryToGetSize(r)
+	testutil.NotOk(t, err)
+	_, ok = r.(io.Seeker)
+	testutil.Assert(t, !ok, "expected reader not to be seekable")
+	_, err = io.Copy(io.Discard, r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, float64(5), promtest.ToFloat64(bkt.bytesTransferred.WithLabelValues("upload")))
+}
+
+func TestGetWithOptions(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte("content"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, zw.Close())
+
+	ctx := context.Background()
+	bkt := NewPrefixedBucket(WrapWithMetrics(NewInMemBucket(), nil, ""), "prefix")
+	testutil.Ok(t, bkt.Upload(ctx, "compressed", bytes.NewReader(compressed.Bytes()), WithContentEncoding("gzip")))
+	testutil.Ok(t, bkt.Upload(ctx, "plain", strings.NewReader("content")))
+	testutil.Ok(t, bkt.Upload(ctx, "other", strings.NewReader("content"), WithContentEncoding("br")))
+
+	attrs, err := bkt.Attributes(ctx, "compressed")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "gzip", attrs.ContentEncoding)
+
+	for _, tcase := range []struct {
+		name     string
+		opts     []ObjectGetOption
+		expected []byte
+	}{
+		{name: "compressed", expected: compressed.Bytes()},
+		{name: "compressed", opts: []ObjectGetOption{WithReadCompressed()}, expected: compressed.Bytes()},
+		{name: "compressed", opts: []ObjectGetOption{WithDecodeContent()}, expected: []byte("content")},
+		{name: "plain", opts: []ObjectGetOption{WithDecodeContent()}, expected: []byte("content")},
+	} {
+		rc, err := GetWithOptions(ctx, bkt, tcase.name, tcase.opts...)
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, tcase.expected, content)
+	}
+
+	_, err = GetWithOptions(ctx, bkt, "other", WithDecodeContent())
+	testutil.NotOk(t, err)
+	_, err = GetWithOptions(ctx, bkt, "missing", WithDecodeContent())
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+	_, err = GetWithOptions(ctx, bkt, "compressed", WithDecodeContent(), WithReadCompressed())
+	testutil.NotOk(t, err)
+
+	// Buckets which don't apply the options themselves are decoded according to the reported content encoding.
+	plain := struct{ Bucket }{bkt}
+	rc, err := GetWithOptions(ctx, plain, "compressed", WithDecodeContent())
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+	_, err = GetWithOptions(ctx, plain, "other", WithDecodeContent())
+	testutil.NotOk(t, err)
+}
+
+func TestGetRangeWithOptions(t *testing.T) {
+	ctx := context.Background()
+	metrics := WrapWithMetrics(NewInMemBucket(), nil, "")
+	bkt := NewPrefixedBucket(metrics, "prefix")
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+
+	// Buckets which don't transcode content return the range as it is stored.
+	rc, err := GetRangeWithOptions(ctx, bkt, "obj", 1, 3, WithReadCompressed())
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "ont", string(content))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(metrics.ops.WithLabelValues(OpGetRange)))
+
+	_, err = GetRangeWithOptions(ctx, bkt, "obj", 1, 3, WithDecodeContent())
+	testutil.NotOk(t, err)
+}
+
+func TestGetWithAttributes(t *testing.T) {
+	ctx := context.Background()
+	metrics := WrapWithMetrics(NewInMemBucket(), nil, "")
+	bkt := NewPrefixedBucket(metrics, "prefix")
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	expected, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+
+	// The in-memory bucket doesn't implement AttributedGetter, so the attributes are requested separately.
+	rc, attrs, err := GetWithAttributes(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+	testutil.Equals(t, expected, attrs)
+	testutil.Equals(t, float64(1), promtest.ToFloat64(metrics.ops.WithLabelValues(OpGet)))
+
+	_, _, err = GetWithAttributes(ctx, bkt, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+	testutil.Equals(t, float64(2), promtest.ToFloat64(metrics.ops.WithLabelValues(OpGet)))
+}
+
+func TestMetricBucket_IterListedObjects(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "abc")
+	for _, name := range []string{"a", "b", "c"} {
+		testutil.Ok(t, bkt.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "", func(IterObjectAttributes) error { return nil }))
+
+	// Iterations which are stopped early record the entries listed until then.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	err := bkt.Iter(cancelCtx, "", func(string) error {
+		cancel()
+		return cancelCtx.Err()
+	})
+	testutil.Assert(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+
+	expected := `
+		# HELP objstore_bucket_operation_listed_objects Number of entries passed to the callback by a single listing operation against the bucket, including listings which failed or were canceled.
+		# TYPE objstore_bucket_operation_listed_objects histogram
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="1"} 1
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="4"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="16"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="64"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="256"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="1024"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="4096"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="16384"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="65536"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="262144"} 3
+		objstore_bucket_operation_listed_objects_bucket{bucket="abc",operation="iter",le="+Inf"} 3
+		objstore_bucket_operation_listed_objects_sum{bucket="abc",operation="iter"} 7
+		objstore_bucket_operation_listed_objects_count{bucket="abc",operation="iter"} 3
+	`
+	testutil.Ok(t, promtest.CollectAndCompare(bkt.opsListedObjects, strings.NewReader(expected)))
+}
+
+// slowAttributesBucket delays each Attributes call.
+type slowAttributesBucket struct {
+	Bucket
+	delay     time.Duration
+	calls     atomic.Int64
+	createdAt time.Time
+}
+
+func (b *slowAttributesBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	b.calls.Inc()
+	time.Sleep(b.delay)
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	attrs.CreatedAt = b.createdAt
+	return attrs, err
+}
+
+// cancelingIterBucket cancels the context of a listing after the first entry was passed to the callback.
+type cancelingIterBucket struct {
+	Bucket
+	cancel context.CancelFunc
+}
+
+func (b cancelingIterBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	return b.Bucket.Iter(ctx, dir, func(name string) error {
+		defer b.cancel()
+		return f(name)
+	}, options...)
+}
+
+func (b cancelingIterBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	return b.Bucket.IterWithAttributes(ctx, dir, func(attrs IterObjectAttributes) error {
+		defer b.cancel()
+		return f(attrs)
+	}, options...)
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	for _, name := range []string{"dir/a", "dir/b", "dir/sub/c"} {
+		testutil.Ok(t, inmem.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	names, err := List(ctx, inmem, "dir/")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"dir/a", "dir/b", "dir/sub/"}, names)
+
+	names, err = List(ctx, inmem, "dir/", WithRecursiveIter)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"dir/a", "dir/b", "dir/sub/c"}, names)
+
+	entries, err := ListWithAttributes(ctx, inmem, "dir/", WithRecursiveIter, WithSize)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(entries))
+	for _, e := range entries {
+		size, ok := e.Size()
+		testutil.Assert(t, ok, "expected size of %s", e.Name)
+		testutil.Equals(t, int64(len(e.Name)), size)
+	}
+
+	// Listings canceled mid-way return the entries collected until then.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	names, err = List(cancelCtx, cancelingIterBucket{Bucket: inmem, cancel: cancel}, "dir/")
+	testutil.Assert(t, errors.Is(err, context.Canceled), "expected context canceled error, got %v", err)
+	testutil.Equals(t, []string{"dir/a"}, names)
+
+	cancelCtx, cancel = context.WithCancel(ctx)
+	entries, err = ListWithAttributes(cancelCtx, cancelingIterBucket{Bucket: inmem, cancel: cancel}, "dir/")
+	testutil.Assert(t, errors.Is(err, context.Canceled), "expected context canceled error, got %v", err)
+	testutil.Equals(t, 1, len(entries))
+	testutil.Equals(t, "dir/a", entries[0].Name)
+}
+
+func TestIterParallel(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("obj-%02d", i)
+		testutil.Ok(t, inner.Upload(ctx, name, strings.NewReader(name)))
+	}
+	testutil.Ok(t, inner.Upload(ctx, "dir/obj", strings.NewReader("obj")))
+	var expected []string
+	testutil.Ok(t, inner.Iter(ctx, "", func(name string) error {
+		expected = append(expected, name)
+		return nil
+	}))
+	bkt := &slowAttributesBucket{Bucket: inner, delay: time.Millisecond}
+
+	var seen []string
+	testutil.Ok(t, IterParallel(ctx, bkt, "", func(attrs IterObjectAttributes) error {
+		seen = append(seen, attrs.Name)
+		size, ok := attrs.Size()
+		if attrs.Name == "dir/" {
+			testutil.Assert(t, !ok, "expected no size for directories")
+			return nil
+		}
+		testutil.Assert(t, ok, "expected size of %s", attrs.Name)
+		testutil.Equals(t, int64(len(attrs.Name)), size)
+		return nil
+	}, 8, true, WithSize))
+	testutil.Equals(t, expected, seen)
+	testutil.Equals(t, int64(50), bkt.calls.Load())
+
+	seen = seen[:0]
+	testutil.Ok(t, IterParallel(ctx, bkt, "", func(attrs IterObjectAttributes) error {
+		seen = append(seen, attrs.Name)
+		return nil
+	}, 8, false, WithRecursiveIter))
+	sort.Strings(seen)
+	sort.Strings(expected)
+	testutil.Equals(t, append([]string{"dir/obj"}, expected[1:]...), seen)
+
+	// The depth of the listing is limited like with IterWithAttributes.
+	seen = seen[:0]
+	testutil.Ok(t, inner.Upload(ctx, "dir/sub/obj", strings.NewReader("obj")))
+	testutil.Ok(t, IterParallel(ctx, bkt, "dir/", func(attrs IterObjectAttributes) error {
+		seen = append(seen, attrs.Name)
+		return nil
+	}, 8, true, WithMaxDepth(0), WithSize))
+	testutil.Equals(t, []string{"dir/obj", "dir/sub/"}, seen)
+	testutil.Ok(t, inner.Delete(ctx, "dir/sub/obj"))
+
+	bkt.createdAt = time.Date(2015, 10, 20, 7, 28, 0, 0, time.UTC)
+	testutil.Ok(t, IterParallel(ctx, bkt, "dir/", func(attrs IterObjectAttributes) error {
+		createdAt, ok := attrs.CreatedAt()
+		testutil.Assert(t, ok, "expected creation time of %s", attrs.Name)
+		testutil.Equals(t, bkt.createdAt, createdAt)
+		return nil
+	}, 8, true, WithCreatedAt))
+
+	// The first error stops the iteration.
+	errStop := errors.New("stop")
+	calls := 0
+	err := IterParallel(ctx, bkt, "", func(IterObjectAttributes) error {
+		calls++
+		return errStop
+	}, 8, false)
+	testutil.Assert(t, errors.Is(err, errStop), "unexpected error: %v", err)
+	testutil.Equals(t, 1, calls)
+
+	err = IterParallel(ctx, bkt, "", func(IterObjectAttributes) error { return nil }, 0, false)
+	testutil.NotOk(t, err)
+}
+
+func TestMetricBucket_IterParallel(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "abc")
+	for _, name := range []string{"a", "b", "c"} {
+		testutil.Ok(t, bkt.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	testutil.Ok(t, IterParallel(ctx, bkt, "", func(IterObjectAttributes) error { return nil }, 2, true, WithETag))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
+}
+
+// BenchmarkIterParallel lists 1000 objects whose attributes take 1ms each to fetch.
+func BenchmarkIterParallel(b *testing.B) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	for i := 0; i < 1000; i++ {
+		testutil.Ok(b, inner.Upload(ctx, fmt.Sprintf("obj-%04d", i), strings.NewReader("content")))
+	}
+	bkt := &slowAttributesBucket{Bucket: inner, delay: time.Millisecond}
+
+	for _, concurrency := range []int{1, 32} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				testutil.Ok(b, IterParallel(ctx, bkt, "", func(IterObjectAttributes) error { return nil }, concurrency, true, WithSize))
+			}
+		})
+	}
+}
+
+type pingBucket struct {
+	Bucket
+	err error
+}
+
+func (b pingBucket) Ping(context.Context) error { return b.err }
+
+func TestIter_WithConcurrency(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 10; j++ {
+			name := fmt.Sprintf("dir-%d/sub-%d/obj", i, j)
+			testutil.Ok(t, inner.Upload(ctx, name, strings.NewReader(name)))
+		}
+		testutil.Ok(t, inner.Upload(ctx, fmt.Sprintf("obj-%d", i), strings.NewReader("obj")))
+	}
+	bkt := WrapWithMetrics(inner, nil, "abc")
+
+	var expected []string
+	testutil.Ok(t, inner.Iter(ctx, "", func(name string) error {
+		expected = append(expected, name)
+		return nil
+	}, WithRecursiveIter))
+	testutil.Equals(t, 55, len(expected))
+
+	// The callback is never called concurrently.
+	var (
+		seen    []string
+		running atomic.Bool
+	)
+	testutil.Ok(t, Iter(ctx, bkt, "", func(name string) error {
+		testutil.Assert(t, running.CAS(false, true), "callback called concurrently")
+		defer running.Store(false)
+		seen = append(seen, name)
+		time.Sleep(time.Millisecond)
+		return nil
+	}, WithRecursiveIter, WithConcurrency(3)))
+	sort.Strings(seen)
+	testutil.Equals(t, expected, seen)
+
+	seen = seen[:0]
+	testutil.Ok(t, IterWithAttributes(ctx, bkt, "dir-1/", func(attrs IterObjectAttributes) error {
+		seen = append(seen, attrs.Name)
+		return nil
+	}, WithRecursiveIter, WithConcurrency(3), WithMaxResults(4)))
+	testutil.Equals(t, 4, len(seen))
+
+	// Errors of the callback stop the iteration.
+	errStop := errors.New("stop")
+	testutil.Equals(t, errStop, Iter(ctx, bkt, "", func(string) error {
+		return errStop
+	}, WithRecursiveIter, WithConcurrency(3)))
+
+	// Unsupported options are rejected.
+	testutil.Equals(t, ErrOptionNotSupported, Iter(ctx, bkt, "", func(string) error {
+		return nil
+	}, WithRecursiveIter, WithConcurrency(3), WithETag))
+
+	// The metrics bucket records each listing of a sub-directory as its own iteration.
+	testutil.Equals(t, float64(18), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
+}
+
+func TestStat(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithMetrics(NewInMemBucket(), nil, "abc")
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+
+	for _, b := range []Bucket{bkt, NewPrefixedBucket(bkt, ""), struct{ Bucket }{bkt.bkt}} {
+		attrs, ok, err := Stat(ctx, b, "obj")
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok, "expected object to exist")
+		testutil.Equals(t, int64(7), attrs.Size)
+
+		_, ok, err = Stat(ctx, b, "missing")
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok, "expected object to not exist")
+	}
+
+	// Missing objects are not recorded as failures.
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpAttributes)))
+}
+
+func TestMetricBucket_Ping(t *testing.T) {
+	ctx := context.Background()
+	inner := &pingBucket{Bucket: NewInMemBucket()}
+	bkt := WrapWithMetrics(inner, nil, "abc")
+
+	testutil.Ok(t, PingWithTimeout(ctx, bkt, time.Second))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.health))
+
+	inner.err = errors.New("unreachable")
+	testutil.NotOk(t, PingWithTimeout(ctx, bkt, time.Second))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.health))
+
+	// Buckets which don't support health checks don't change the gauge.
+	bkt.bkt = struct{ Bucket }{NewInMemBucket()}
+	testutil.Equals(t, ErrHealthCheckNotSupported, Ping(ctx, bkt))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.health))
+}
+
+// partsBucket records the parts of multipart uploads and fails the part with the given number.
+type partsBucket struct {
+	Bucket
+
+	failPart int
+	parts    []int64
+	aborted  bool
+}
+
+func (b *partsBucket) NewMultipartUpload(_ context.Context, name string, opts ...ObjectUploadOption) (MultipartWriter, error) {
+	return &partsWriter{bkt: b, name: name, opts: opts}, nil
+}
+
+type partsWriter struct {
+	bkt  *partsBucket
+	name string
+	opts []ObjectUploadOption
+	buf  bytes.Buffer
+}
+
+func (w *partsWriter) WritePart(_ context.Context, r io.Reader, size int64) error {
+	if len(w.bkt.parts)+1 == w.bkt.failPart {
+		return errors.New("part failed")
+	}
+	w.bkt.parts = append(w.bkt.parts, size)
+	_, err := io.Copy(&w.buf, r)
+	return err
+}
+
+func (w *partsWriter) Complete(ctx context.Context) error {
+	return w.bkt.Upload(ctx, w.name, &w.buf, w.opts...)
+}
+
+func (w *partsWriter) Abort(context.Context) error {
+	w.bkt.aborted = true
+	return nil
+}
+
+func TestUploadLargeObject(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("a", 25)
+
+	for _, tcase := range []struct {
+		name   string
+		reader io.Reader
+
+		expectedParts    []int64
+		expectedProgress [][2]int64
+	}{
+		{
+			name:             "known size below chunk size",
+			reader:           strings.NewReader(content[:10]),
+			expectedProgress: [][2]int64{{10, 10}},
+		},
+		{
+			name:             "unknown size below chunk size",
+			reader:           io.MultiReader(strings.NewReader(content[:10])),
+			expectedProgress: [][2]int64{{10, 10}},
+		},
+		{
+			name:             "known size",
+			reader:           strings.NewReader(content),
+			expectedParts:    []int64{10, 10, 5},
+			expectedProgress: [][2]int64{{10, 25}, {20, 25}, {25, 25}},
+		},
+		{
+			name:             "unknown size",
+			reader:           io.MultiReader(strings.NewReader(content)),
+			expectedParts:    []int64{10, 10, 5},
+			expectedProgress: [][2]int64{{10, -1}, {20, -1}, {25, -1}},
+		},
+		{
+			name:             "unknown size multiple of chunk size",
+			reader:           io.MultiReader(strings.NewReader(content[:20])),
+			expectedParts:    []int64{10, 10},
+			expectedProgress: [][2]int64{{10, -1}, {20, -1}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			bkt := &partsBucket{Bucket: NewInMemBucket()}
+
+			var progress [][2]int64
+			testutil.Ok(t, UploadLargeObject(ctx, bkt, "obj", tcase.reader, MultipartUploadOptions{
+				ChunkSize:    10,
+				ContentType:  "text/plain",
+				ProgressFunc: func(uploaded, total int64) { progress = append(progress, [2]int64{uploaded, total}) },
+			}))
+			testutil.Equals(t, tcase.expectedParts, bkt.parts)
+			testutil.Equals(t, tcase.expectedProgress, progress)
+
+			attrs, err := bkt.Attributes(ctx, "obj")
+			testutil.Ok(t, err)
+			testutil.Equals(t, "text/plain", attrs.ContentType)
+			testutil.Equals(t, tcase.expectedProgress[len(tcase.expectedProgress)-1][0], attrs.Size)
+		})
+	}
+
+	t.Run("aborts failed upload", func(t *testing.T) {
+		bkt := &partsBucket{Bucket: NewInMemBucket(), failPart: 2}
+		testutil.NotOk(t, UploadLargeObject(ctx, bkt, "obj", strings.NewReader(content), MultipartUploadOptions{ChunkSize: 10}))
+		testutil.Assert(t, bkt.aborted, "expected upload to be aborted")
+
+		exists, err := bkt.Exists(ctx, "obj")
+		testutil.Ok(t, err)
+		testutil.Assert(t, !exists, "expected failed upload to not create an object")
+	})
+
+	t.Run("falls back to single upload", func(t *testing.T) {
+		for _, bkt := range []Bucket{NewInMemBucket(), WrapWithMetrics(NewInMemBucket(), nil, "")} {
+			var progress [][2]int64
+			testutil.Ok(t, UploadLargeObject(ctx, bkt, "obj", io.MultiReader(strings.NewReader(content)), MultipartUploadOptions{
+				ChunkSize:    10,
+				ProgressFunc: func(uploaded, total int64) { progress = append(progress, [2]int64{uploaded, total}) },
+			}))
+			testutil.Equals(t, [][2]int64{{25, 25}}, progress)
+
+			attrs, err := bkt.Attributes(ctx, "obj")
+			testutil.Ok(t, err)
+			testutil.Equals(t, int64(len(content)), attrs.Size)
+		}
+	})
+}
+
+func TestBucketError(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+
+	_, err := bkt.Get(ctx, "missing")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "get missing: inmem: object not found", err.Error())
+	testutil.Assert(t, IsNotFoundErr(err), "expected not found error, got %v", err)
+	testutil.Assert(t, !IsPermissionDeniedErr(err))
+	testutil.Assert(t, errors.Is(err, errNotFound))
+	testutil.Assert(t, bkt.IsObjNotFoundErr(errors.Wrap(err, "wrapped")))
+
+	var bErr *BucketError
+	testutil.Assert(t, errors.As(errors.Wrap(err, "wrapped"), &bErr))
+	testutil.Equals(t, OpGet, bErr.Op)
+	testutil.Equals(t, "missing", bErr.Name)
+	testutil.Equals(t, errNotFound, errors.Cause(err))
+
+	// Errors are neither wrapped twice nor wrapped at all if they are nil or caused by the context.
+	testutil.Equals(t, err, NewBucketError(OpGetRange, "other", "", ErrKindUnknown, err))
+	testutil.Ok(t, NewBucketError(OpGet, "missing", "", ErrKindNotFound, nil))
+	testutil.Equals(t, context.Canceled, NewBucketError(OpGet, "missing", "", ErrKindUnknown, context.Canceled))
+
+	for kind, is := range map[ErrorKind]func(error) bool{
+		ErrKindNotFound:           IsNotFoundErr,
+		ErrKindPermissionDenied:   IsPermissionDeniedErr,
+		ErrKindRateLimit:          IsRateLimitErr,
+		ErrKindPreconditionFailed: IsPreconditionFailedErr,
+		ErrKindQuotaExceeded:      IsQuotaExceededErr,
+	} {
+		testutil.Assert(t, is(NewBucketError(OpUpload, "obj", "code", kind, errors.New("some error"))))
+		testutil.Assert(t, !is(NewBucketError(OpUpload, "obj", "code", ErrKindUnknown, errors.New("some error"))))
+		testutil.Assert(t, !is(errors.New("some error")))
+	}
+
+	// Errors of every kind match the corresponding sentinel error, also when wrapped.
+	for kind, sentinel := range map[ErrorKind]error{
+		ErrKindNotFound:           ErrNotFound,
+		ErrKindPermissionDenied:   ErrPermissionDenied,
+		ErrKindRateLimit:          ErrThrottled,
+		ErrKindPreconditionFailed: ErrPreconditionFailed,
+	} {
+		err := errors.Wrap(NewBucketError(OpUpload, "obj", "code", kind, errors.New("some error")), "wrapped")
+		testutil.Assert(t, errors.Is(err, sentinel), "expected %v to match %v", err, sentinel)
+		testutil.Assert(t, !errors.Is(NewBucketError(OpUpload, "obj", "code", ErrKindQuotaExceeded, errors.New("some error")), sentinel))
+	}
+	testutil.Assert(t, errors.Is(err, ErrNotFound))
+	testutil.Assert(t, !errors.Is(err, ErrPermissionDenied))
+}
+
+func TestValidateIterOptions(t *testing.T) {
+	testutil.Ok(t, ValidateIterOptions(nil))
+	testutil.Ok(t, ValidateIterOptions([]IterOptionType{Recursive}, WithRecursiveIter))
+	testutil.Ok(t, ValidateIterOptions([]IterOptionType{Recursive, ETag}, WithRecursiveIter, WithETag))
+	testutil.Equals(t, ErrOptionNotSupported, ValidateIterOptions([]IterOptionType{Recursive}, WithETag))
+	testutil.Equals(t, ErrOptionNotSupported, ValidateIterOptions(nil, WithRecursiveIter))
+	testutil.Equals(t, ErrOptionNotSupported, ValidateIterOptions([]IterOptionType{Recursive}, WithMaxResults(1)))
+	testutil.Equals(t, ErrOptionNotSupported, ValidateIterOptions([]IterOptionType{Recursive, ETag}, WithSize))
+	testutil.Equals(t, ErrOptionNotSupported, ValidateIterOptions([]IterOptionType{UpdatedAt}, WithCreatedAt))
+	testutil.Ok(t, ValidateIterOptions([]IterOptionType{UpdatedAt, CreatedAt}, WithUpdatedAt, WithCreatedAt))
+	// No limit does not require support.
+	testutil.Ok(t, ValidateIterOptions([]IterOptionType{Recursive}, WithMaxResults(0)))
+}
+
+func TestIter_WithFilter(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	for _, name := range []string{"a/meta.json", "a/chunks/1", "b/meta.json", "b/index", "c/index"} {
+		testutil.Ok(t, bkt.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	filter, err := WithRegexFilter(`/meta\.json$`)
+	testutil.Ok(t, err)
+	var seen []string
+	testutil.Ok(t, Iter(ctx, bkt, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, WithRecursiveIter, filter))
+	testutil.Equals(t, []string{"a/meta.json", "b/meta.json"}, seen)
+
+	// Entries which don't match are not counted for the max results.
+	seen = seen[:0]
+	testutil.Ok(t, Iter(ctx, bkt, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, WithRecursiveIter, filter, WithMaxResults(1)))
+	testutil.Equals(t, []string{"a/meta.json"}, seen)
+
+	// Directories found while listing concurrently are not filtered.
+	seen = seen[:0]
+	testutil.Ok(t, Iter(ctx, bkt, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, WithRecursiveIter, filter, WithConcurrency(2)))
+	sort.Strings(seen)
+	testutil.Equals(t, []string{"a/meta.json", "b/meta.json"}, seen)
+
+	_, err = WithRegexFilter("[")
+	testutil.NotOk(t, err)
+}
+
+func TestIter_WithMaxDepth(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	for _, name := range []string{"obj", "a/obj", "a/b/obj", "a/b/c/obj", "d/e/obj"} {
+		testutil.Ok(t, inner.Upload(ctx, name, strings.NewReader(name)))
+	}
+	bkt := WrapWithMetrics(inner, nil, "abc")
+
+	for _, tc := range []struct {
+		dir      string
+		depth    int
+		options  []IterOption
+		expected []string
+	}{
+		{depth: 0, expected: []string{"obj", "a/", "d/"}},
+		{depth: 1, expected: []string{"a/obj", "a/b/", "d/e/", "obj"}},
+		{depth: 2, expected: []string{"a/b/obj", "a/b/c/", "a/obj", "d/e/obj", "obj"}},
+		{depth: 5, expected: []string{"a/b/c/obj", "a/b/obj", "a/obj", "d/e/obj", "obj"}},
+		{dir: "a", depth: 0, expected: []string{"a/obj", "a/b/"}},
+		{depth: 1, options: []IterOption{WithPrefixesOnly}, expected: []string{"a/b/", "d/e/"}},
+		{depth: 1, options: []IterOption{WithMaxResults(2)}, expected: []string{"a/obj", "a/b/"}},
+		{depth: 1, options: []IterOption{WithStartAfter("a/b/obj")}, expected: []string{"a/obj", "d/e/", "obj"}},
+		{depth: 1, options: []IterOption{WithConcurrency(2)}, expected: []string{"a/obj", "a/b/", "d/e/", "obj"}},
+	} {
+		t.Run(fmt.Sprintf("dir=%s,depth=%d,options=%d", tc.dir, tc.depth, len(tc.options)), func(t *testing.T) {
+			var seen []string
+			testutil.Ok(t, Iter(ctx, bkt, tc.dir, func(name string) error {
+				seen = append(seen, name)
+				return nil
+			}, append(tc.options, WithMaxDepth(tc.depth))...))
+			sort.Strings(seen)
+			sort.Strings(tc.expected)
+			testutil.Equals(t, tc.expected, seen)
+		})
+	}
+
+	// Buckets don't support it themselves, wrapped or not.
+	testutil.Equals(t, ErrOptionNotSupported, inner.IterWithAttributes(ctx, "", func(IterObjectAttributes) error { return nil }, WithMaxDepth(1)))
+	testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "", func(IterObjectAttributes) error { return nil }, WithMaxDepth(1)))
+}
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	for _, name := range []string{"obj", "a/obj", "a/b/obj"} {
+		testutil.Ok(t, bkt.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	sizes := map[string]int64{}
+	testutil.Ok(t, Walk(ctx, bkt, "", func(path string, attrs ObjectAttributes, err error) error {
+		testutil.Ok(t, err)
+		sizes[path] = attrs.Size
+		return nil
+	}))
+	testutil.Equals(t, map[string]int64{"obj": 3, "a/obj": 5, "a/b/obj": 7}, sizes)
+
+	sizes = map[string]int64{}
+	testutil.Ok(t, Walk(ctx, bkt, "", func(path string, attrs ObjectAttributes, err error) error {
+		testutil.Ok(t, err)
+		sizes[path] = attrs.Size
+		return nil
+	}, WithMaxDepth(1)))
+	testutil.Equals(t, map[string]int64{"obj": 3, "a/obj": 5, "a/b/": 0}, sizes)
+
+	// The attributes are returned by the listing, they are not fetched one by one.
+	sizes = map[string]int64{}
+	testutil.Ok(t, Walk(ctx, noAttributesBucket{bkt}, "a/", func(path string, attrs ObjectAttributes, err error) error {
+		testutil.Ok(t, err)
+		sizes[path] = attrs.Size
+		return nil
+	}))
+	testutil.Equals(t, map[string]int64{"a/obj": 5, "a/b/obj": 7}, sizes)
+
+	// Errors returned by f stop the walk.
+	errStop := errors.New("stop")
+	calls := 0
+	testutil.Equals(t, errStop, Walk(ctx, bkt, "", func(string, ObjectAttributes, error) error {
+		calls++
+		return errStop
+	}))
+	testutil.Equals(t, 1, calls)
+}
+
+type noAttributesBucket struct {
+	*InMemBucket
+}
+
+func (noAttributesBucket) Attributes(context.Context, string) (ObjectAttributes, error) {
+	return ObjectAttributes{}, errors.New("attributes must not be fetched")
+}
+
+// otherETagBucket is a bucket of another provider, whose ETags are computed differently.
+type otherETagBucket struct {
+	*InMemBucket
+}
+
+func (b otherETagBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	attrs, err := b.InMemBucket.Attributes(ctx, name)
+	attrs.ETag = "other-" + attrs.ETag
+	return attrs, err
+}
+
+func TestBucketDiff(t *testing.T) {
+	ctx := context.Background()
+	src, dst := NewInMemBucket(), NewInMemBucket()
+	for name, content := range map[string]string{"a/same": "same", "a/different": "src", "a/resized": "src", "a/src": "src", "b/src": "src"} {
+		testutil.Ok(t, src.Upload(ctx, name, strings.NewReader(content)))
+	}
+	for name, content := range map[string]string{"a/same": "same", "a/different": "dst", "a/resized": "dst content", "a/dst": "dst"} {
+		testutil.Ok(t, dst.Upload(ctx, name, strings.NewReader(content)))
+	}
+
+	// Wrapped buckets of the same provider are compared by ETag.
+	diff, err := BucketDiff(ctx, WrapWithMetrics(src, nil, "src"), dst, "a/")
+	testutil.Ok(t, err)
+	testutil.Equals(t, &DiffResult{
+		OnlyInSrc: []string{"a/src"},
+		OnlyInDst: []string{"a/dst"},
+		Different: []string{"a/different", "a/resized"},
+	}, diff)
+
+	// ETags of different providers are not comparable, only the sizes are compared.
+	otherDiff, err := BucketDiff(ctx, src, otherETagBucket{dst}, "a/")
+	testutil.Ok(t, err)
+	testutil.Equals(t, &DiffResult{
+		OnlyInSrc: []string{"a/src"},
+		OnlyInDst: []string{"a/dst"},
+		Different: []string{"a/resized"},
+	}, otherDiff)
+
+	_, err = SyncBuckets(ctx, src, dst, SyncOptions{Prefix: "a/", OverwriteExisting: true})
+	testutil.Ok(t, err)
+	diff, err = BucketDiff(ctx, src, dst, "a/")
+	testutil.Ok(t, err)
+	testutil.Equals(t, &DiffResult{OnlyInDst: []string{"a/dst"}}, diff)
+
+	diff, err = BucketDiff(ctx, src, dst, "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, &DiffResult{OnlyInSrc: []string{"b/src"}, OnlyInDst: []string{"a/dst"}}, diff)
+}
+
+// crossCopyBucket copies objects from other buckets through CopyFromBucket, failing for the given name.
+type crossCopyBucket struct {
+	Bucket
+
+	failing string
+	copied  []string
+}
+
+func (b *crossCopyBucket) WrappedBucket() Bucket {
+	return b.Bucket
+}
+
+func (b *crossCopyBucket) CopyFromBucket(ctx context.Context, src Bucket, srcName, dstName string) error {
+	if srcName == b.failing {
+		return errors.Errorf("copy %s: some error", srcName)
+	}
+	b.copied = append(b.copied, srcName)
+	return syncObject(ctx, src, b.Bucket, srcName)
+}
+
+func TestSyncBuckets(t *testing.T) {
+	ctx := context.Background()
+	src, dst := NewInMemBucket(), NewInMemBucket()
+	for name, content := range map[string]string{"a/same": "same", "a/different": "src", "a/src1": "src", "a/src2": "src", "b/src": "src"} {
+		testutil.Ok(t, src.Upload(ctx, name, strings.NewReader(content)))
+	}
+	for name, content := range map[string]string{"a/same": "same", "a/different": "dst", "a/dst": "dst"} {
+		testutil.Ok(t, dst.Upload(ctx, name, strings.NewReader(content)))
+	}
+
+	res, err := SyncBuckets(ctx, src, dst, SyncOptions{Prefix: "a/", DryRun: true, OverwriteExisting: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, &SyncResult{Copied: 3, Skipped: 1, Errors: map[string]error{}}, res)
+	testutil.Equals(t, 3, len(dst.Objects()))
+
+	var calls int
+	res, err = SyncBuckets(ctx, src, dst, SyncOptions{Prefix: "a/", Concurrency: 2, ProgressCallback: func(copied, skipped, failed int) {
+		calls++
+	}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, &SyncResult{Copied: 2, Skipped: 2, Errors: map[string]error{}}, res)
+	testutil.Equals(t, 4, calls)
+	testutil.Equals(t, []byte("src"), dst.Objects()["a/src1"])
+	testutil.Equals(t, []byte("dst"), dst.Objects()["a/different"])
+
+	// Objects are copied server-side if the destination supports it.
+	crossCopy := &crossCopyBucket{Bucket: dst, failing: "b/src"}
+	res, err = SyncBuckets(ctx, src, crossCopy, SyncOptions{OverwriteExisting: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, res.Copied)
+	testutil.Equals(t, 3, res.Skipped)
+	testutil.Equals(t, 1, res.Failed)
+	testutil.Equals(t, "copy b/src: some error", res.Errors["b/src"].Error())
+	testutil.Equals(t, []string{"a/different"}, crossCopy.copied)
+	testutil.Equals(t, []byte("src"), dst.Objects()["a/different"])
+
+	// Wrappers forward the server-side copy to the bucket they wrap.
+	testutil.Ok(t, src.Upload(ctx, "a/different", strings.NewReader("resized")))
+	res, err = SyncBuckets(ctx, src, WrapWithMetrics(crossCopy, nil, "abc"), SyncOptions{Prefix: "a/", OverwriteExisting: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, res.Copied)
+	testutil.Equals(t, []string{"a/different", "a/different"}, crossCopy.copied)
+	testutil.Equals(t, []byte("resized"), dst.Objects()["a/different"])
+}
+
+func TestValidateUserMetadata(t *testing.T) {
+	for _, metadata := range []map[string]string{
+		nil,
+		{"block_id": "01H", "compaction_level2": "2", "_Owner": "Thanos Store"},
+	} {
+		testutil.Ok(t, ValidateUserMetadata(metadata))
+	}
+	for _, metadata := range []map[string]string{
+		{"": "empty"},
+		{"with space": "v"},
+		{"with:colon": "v"},
+		{"block-id": "v"},
+		{"2nd": "v"},
+		{"ключ": "v"},
+		{"owner": "a", "Owner": "b"},
+		{"owner": "line\nbreak"},
+	} {
+		testutil.NotOk(t, ValidateUserMetadata(metadata), "metadata %v", metadata)
+	}
+}
+
 func TestTimingTracingReader(t *testing.T) {
 	m := WrapWithMetrics(NewInMemBucket(), nil, "")
 	r := bytes.NewReader([]byte("hello world"))
@@ -143,7 +1591,7 @@ func TestTimingTracingReader(t *testing.T) {
 	tr := NopCloserWithSize(r)
 	tr = newTimingReadCloser(tr, "", m.opsDuration, m.opsFailures, func(err error) bool {
 		return false
-	}, m.opsFetchedBytes)
+	}, m.opsFetchedBytes, m.opsTransferredBytes, m.bytesDownloaded)
 
 	size, err := TryToGetSize(tr)
 
@@ -162,6 +1610,165 @@ func TestTimingTracingReader(t *testing.T) {
 	testutil.Equals(t, int64(11), size)
 }
 
+var errConnectionDropped = errors.New("connection dropped")
+
+// droppingRangeBucket returns range readers which fail with err after reading n bytes, unless the range ends before.
+type droppingRangeBucket struct {
+	Bucket
+
+	n      int64
+	err    error
+	ranges []string
+}
+
+func (b *droppingRangeBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.ranges = append(b.ranges, fmt.Sprintf("%d+%d", off, length))
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return &droppingReader{ReadCloser: rc, left: b.n, err: b.err}, nil
+}
+
+type droppingReader struct {
+	io.ReadCloser
+
+	left int64
+	err  error
+}
+
+func (r *droppingReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, r.err
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
+
+// sizedRangeBucket returns range readers reporting the size of the range.
+type sizedRangeBucket struct {
+	Bucket
+}
+
+func (b *sizedRangeBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return NopCloserWithSize(bytes.NewReader(content)), nil
+}
+
+func TestNewResilientRangeReader(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("0123456789", 10)
+
+	for _, tc := range []struct {
+		name           string
+		err            error
+		off, length    int64
+		maxResumes     int
+		expected       string
+		expectedRanges []string
+		expectedErr    error
+	}{
+		{
+			name: "resumes dropped connections", err: errConnectionDropped, off: 10, length: 50, maxResumes: 10,
+			expected:       content[10:60],
+			expectedRanges: []string{"10+50", "30+30", "50+10"},
+		},
+		{
+			name: "resumes truncated responses", err: io.EOF, off: 10, length: 50, maxResumes: 10,
+			expected:       content[10:60],
+			expectedRanges: []string{"10+50", "30+30", "50+10"},
+		},
+		{
+			name: "resumes reads until the end", err: errConnectionDropped, off: 50, length: -1, maxResumes: 10,
+			expected:       content[50:],
+			expectedRanges: []string{"50+-1", "70+-1", "90+-1"},
+		},
+		{
+			name: "does not resume ranges past the end", err: errConnectionDropped, off: 90, length: 50, maxResumes: 10,
+			expected:       content[90:],
+			expectedRanges: []string{"90+50"},
+		},
+		{
+			name: "resumes ranges past the end until the end", err: errConnectionDropped, off: 70, length: 50, maxResumes: 10,
+			expected:       content[70:],
+			expectedRanges: []string{"70+50", "90+30"},
+		},
+		{
+			name: "does not resume checksum mismatches", err: ErrChecksumMismatch, off: 10, length: 50, maxResumes: 10,
+			expected:       content[10:30],
+			expectedRanges: []string{"10+50"},
+			expectedErr:    ErrChecksumMismatch,
+		},
+		{
+			name: "gives up after max resumes", err: errConnectionDropped, off: 10, length: 50, maxResumes: 1,
+			expected:       content[10:50],
+			expectedRanges: []string{"10+50", "30+30"},
+			expectedErr:    errConnectionDropped,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bkt := &droppingRangeBucket{Bucket: NewInMemBucket(), n: 20, err: tc.err}
+			testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader(content)))
+
+			rc, err := NewResilientRangeReader(ctx, bkt, "obj", tc.off, tc.length, tc.maxResumes)
+			testutil.Ok(t, err)
+			read, err := io.ReadAll(rc)
+			testutil.Ok(t, rc.Close())
+			if tc.expectedErr != nil {
+				testutil.Assert(t, errors.Is(err, tc.expectedErr), "expected %v, got %v", tc.expectedErr, err)
+			} else {
+				testutil.Ok(t, err)
+			}
+			testutil.Equals(t, tc.expected, string(read))
+			testutil.Equals(t, tc.expectedRanges, bkt.ranges)
+		})
+	}
+
+	t.Run("returns errors reopening the range", func(t *testing.T) {
+		bkt := &droppingRangeBucket{Bucket: NewInMemBucket(), n: 20, err: errConnectionDropped}
+		testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader(content)))
+
+		rc, err := NewResilientRangeReader(ctx, bkt, "obj", 0, -1, 10)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Delete(ctx, "obj"))
+		_, err = io.ReadAll(rc)
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+		// The error is sticky.
+		_, err = rc.Read(make([]byte, 1))
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+		testutil.Ok(t, rc.Close())
+	})
+
+	t.Run("reports the size of the first response", func(t *testing.T) {
+		bkt := &sizedRangeBucket{Bucket: NewInMemBucket()}
+		testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader(content)))
+
+		rc, err := NewResilientRangeReader(ctx, bkt, "obj", 10, 20, 10)
+		testutil.Ok(t, err)
+		size, err := TryToGetSize(rc)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(20), size)
+		testutil.Ok(t, rc.Close())
+	})
+
+	t.Run("rejects suffix ranges", func(t *testing.T) {
+		_, err := NewResilientRangeReader(ctx, NewInMemBucket(), "obj", -10, -1, 10)
+		testutil.NotOk(t, err)
+	})
+}
+
 func TestDownloadDir_CleanUp(t *testing.T) {
 	b := unreliableBucket{
 		Bucket:  NewInMemBucket(),
@@ -16,3 +16,13 @@ import (
 func TestObjStore_AcceptanceTest_e2e(t *testing.T) {
 	ForeachStore(t, objstore.AcceptanceTest)
 }
+
+// TestObjStore_PresignAcceptanceTest_e2e tests presigned URLs against all known implementations which support them.
+func TestObjStore_PresignAcceptanceTest_e2e(t *testing.T) {
+	ForeachStore(t, objstore.PresignAcceptanceTest)
+}
+
+// TestObjStore_MultipartUploadAcceptanceTest_e2e tests multipart uploads against all known implementations which support them.
+func TestObjStore_MultipartUploadAcceptanceTest_e2e(t *testing.T) {
+	ForeachStore(t, objstore.MultipartUploadAcceptanceTest)
+}
@@ -7,19 +7,31 @@ import (
 	"context"
 	"io"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+// PrefixedBucket is a bucket scoped to the objects below a prefix of the wrapped bucket.
 type PrefixedBucket struct {
 	bkt    Bucket
 	prefix string
 }
 
+// NewPrefixedBucket returns a bucket which prepends prefix to the names of all objects, and strips it from
+// the names passed to Iter callbacks, so that callers only see names relative to the prefix. Leading and
+// trailing delimiters of prefix are ignored. If prefix is empty, bkt is returned as is. Prefixing a
+// PrefixedBucket again returns a single PrefixedBucket with both prefixes joined.
 func NewPrefixedBucket(bkt Bucket, prefix string) Bucket {
-	if validPrefix(prefix) {
-		return &PrefixedBucket{bkt: bkt, prefix: strings.Trim(prefix, DirDelim)}
+	if !validPrefix(prefix) {
+		return bkt
 	}
 
-	return bkt
+	prefix = strings.Trim(prefix, DirDelim)
+	if p, ok := bkt.(*PrefixedBucket); ok {
+		return &PrefixedBucket{bkt: p.bkt, prefix: withPrefix(p.prefix, prefix)}
+	}
+	return &PrefixedBucket{bkt: bkt, prefix: prefix}
 }
 
 func validPrefix(prefix string) bool {
@@ -39,19 +51,95 @@ func withPrefix(prefix, name string) string {
 	return prefix + DirDelim + name
 }
 
+// ListVersions returns all versions of the object with the given name.
+func (p *PrefixedBucket) ListVersions(ctx context.Context, name string) ([]VersionInfo, error) {
+	return ListVersions(ctx, p.bkt, conditionalPrefix(p.prefix, name))
+}
+
+// IterVersions calls f for each version of the objects whose names start with prefix, relative to the bucket prefix.
+func (p *PrefixedBucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	return IterVersions(ctx, p.bkt, withPrefix(p.prefix, prefix), func(name, version string, isLatest bool, deleted bool) error {
+		return f(strings.TrimPrefix(name, p.prefix+DirDelim), version, isLatest, deleted)
+	})
+}
+
+// GetVersion returns a reader for the given version of the object.
+func (p *PrefixedBucket) GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
+	return GetVersion(ctx, p.bkt, conditionalPrefix(p.prefix, name), versionID)
+}
+
+// DeleteVersion permanently deletes the given version of the object.
+func (p *PrefixedBucket) DeleteVersion(ctx context.Context, name, versionID string) error {
+	return DeleteVersion(ctx, p.bkt, conditionalPrefix(p.prefix, name), versionID)
+}
+
+// RestoreVersion makes the given version the current version of the object.
+func (p *PrefixedBucket) RestoreVersion(ctx context.Context, name, versionID string) error {
+	return RestoreVersion(ctx, p.bkt, conditionalPrefix(p.prefix, name), versionID)
+}
+
+// UpdateMetadata changes the metadata of the object without uploading it again.
+func (p *PrefixedBucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...ObjectUploadOption) error {
+	return UpdateMetadata(ctx, p.bkt, conditionalPrefix(p.prefix, name), md, opts...)
+}
+
+// SetObjectTags replaces the tags of the object.
+func (p *PrefixedBucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) error {
+	return SetObjectTags(ctx, p.bkt, conditionalPrefix(p.prefix, name), tags)
+}
+
+// GetObjectTags returns the tags of the object.
+func (p *PrefixedBucket) GetObjectTags(ctx context.Context, name string) (map[string]string, error) {
+	return GetObjectTags(ctx, p.bkt, conditionalPrefix(p.prefix, name))
+}
+
+// DeleteObjectTags removes all tags of the object.
+func (p *PrefixedBucket) DeleteObjectTags(ctx context.Context, name string) error {
+	return DeleteObjectTags(ctx, p.bkt, conditionalPrefix(p.prefix, name))
+}
+
+// Ping checks that the underlying bucket can be accessed.
+func (p *PrefixedBucket) Ping(ctx context.Context) error {
+	return Ping(ctx, p.bkt)
+}
+
 func (p *PrefixedBucket) Close() error {
 	return p.bkt.Close()
 }
 
 // Iter calls f for each entry in the given directory (not recursive.). The argument to f is the full
-// object name including the prefix of the inspected directory.
+// object name including the prefix of the inspected directory, relative to the bucket prefix. An empty
+// dir lists the entries directly below the bucket prefix.
 // Entries are passed to function in sorted order.
 func (p *PrefixedBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
 	pdir := withPrefix(p.prefix, dir)
 
 	return p.bkt.Iter(ctx, pdir, func(s string) error {
 		return f(strings.TrimPrefix(s, p.prefix+DirDelim))
-	}, options...)
+	}, p.prefixIterOptions(options)...)
+}
+
+func (p *PrefixedBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	pdir := withPrefix(p.prefix, dir)
+
+	return p.bkt.IterWithAttributes(ctx, pdir, func(attrs IterObjectAttributes) error {
+		attrs.Name = strings.TrimPrefix(attrs.Name, p.prefix+DirDelim)
+		return f(attrs)
+	}, p.prefixIterOptions(options)...)
+}
+
+// prefixIterOptions prefixes the object names passed in the options.
+func (p *PrefixedBucket) prefixIterOptions(options []IterOption) []IterOption {
+	params := ApplyIterOptions(options...)
+	if params.StartAfter == "" {
+		return options
+	}
+	// Options are applied in order, so this overrides the original name.
+	return append(options[:len(options):len(options)], WithStartAfter(conditionalPrefix(p.prefix, params.StartAfter)))
+}
+
+func (p *PrefixedBucket) SupportedIterOptions() []IterOptionType {
+	return p.bkt.SupportedIterOptions()
 }
 
 // Get returns a reader for the given object name.
@@ -59,11 +147,26 @@ func (p *PrefixedBucket) Get(ctx context.Context, name string) (io.ReadCloser, e
 	return p.bkt.Get(ctx, conditionalPrefix(p.prefix, name))
 }
 
+// GetWithOptions returns a reader for the given object name, applying the given options.
+func (p *PrefixedBucket) GetWithOptions(ctx context.Context, name string, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	return GetWithOptions(ctx, p.bkt, conditionalPrefix(p.prefix, name), opts...)
+}
+
+// GetWithAttributes returns a reader for the given object name and the attributes of the object.
+func (p *PrefixedBucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, ObjectAttributes, error) {
+	return GetWithAttributes(ctx, p.bkt, conditionalPrefix(p.prefix, name))
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (p *PrefixedBucket) GetRange(ctx context.Context, name string, off int64, length int64) (io.ReadCloser, error) {
 	return p.bkt.GetRange(ctx, conditionalPrefix(p.prefix, name), off, length)
 }
 
+// GetRangeWithOptions returns a new range reader for the given object name and range, applying the given options.
+func (p *PrefixedBucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...ObjectGetOption) (io.ReadCloser, error) {
+	return GetRangeWithOptions(ctx, p.bkt, conditionalPrefix(p.prefix, name), off, length, opts...)
+}
+
 // Exists checks if the given object exists in the bucket.
 func (p *PrefixedBucket) Exists(ctx context.Context, name string) (bool, error) {
 	return p.bkt.Exists(ctx, conditionalPrefix(p.prefix, name))
@@ -86,8 +189,51 @@ func (p PrefixedBucket) Attributes(ctx context.Context, name string) (ObjectAttr
 
 // Upload the contents of the reader as an object into the bucket.
 // Upload should be idempotent.
-func (p *PrefixedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
-	return p.bkt.Upload(ctx, conditionalPrefix(p.prefix, name), r)
+func (p *PrefixedBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	return p.bkt.Upload(ctx, conditionalPrefix(p.prefix, name), r, opts...)
+}
+
+// UploadIfNotExists uploads the contents of the reader as an object into the bucket only if it does
+// not exist yet. It fails with ErrConditionalUploadNotSupported if the underlying bucket does not support it.
+func (p *PrefixedBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	return UploadIfNotExists(ctx, p.bkt, conditionalPrefix(p.prefix, name), r)
+}
+
+// UploadIfMatch uploads the contents of the reader as an object into the bucket only if the ETag of the existing
+// object equals etag. It fails with ErrConditionalUploadNotSupported if the underlying bucket does not support it.
+func (p *PrefixedBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	return UploadIfMatch(ctx, p.bkt, conditionalPrefix(p.prefix, name), r, etag, opts...)
+}
+
+// Stat returns the attributes of the object with the given name and whether it exists.
+func (p *PrefixedBucket) Stat(ctx context.Context, name string) (ObjectAttributes, bool, error) {
+	return Stat(ctx, p.bkt, conditionalPrefix(p.prefix, name))
+}
+
+// PresignedGetURL returns a URL which can be used to download the object with the given name until expiry passes.
+func (p *PrefixedBucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return PresignedGetURL(ctx, p.bkt, conditionalPrefix(p.prefix, name), expiry)
+}
+
+// PresignPut returns a URL which can be used to upload the object with the given name until expiry passes.
+func (p *PrefixedBucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return PresignPut(ctx, p.bkt, conditionalPrefix(p.prefix, name), expiry)
+}
+
+// Rename moves the object with the src name to the dst name.
+func (p *PrefixedBucket) Rename(ctx context.Context, src, dst string) error {
+	return Rename(ctx, p.bkt, conditionalPrefix(p.prefix, src), conditionalPrefix(p.prefix, dst))
+}
+
+// CopyWithAttributes copies the object with the src name into a new object with the dst name, setting the given
+// attributes on the new object.
+func (p *PrefixedBucket) CopyWithAttributes(ctx context.Context, src, dst string, attrs CopyObjectAttributes) error {
+	return CopyWithAttributes(ctx, p.bkt, conditionalPrefix(p.prefix, src), conditionalPrefix(p.prefix, dst), attrs)
+}
+
+// NewMultipartUpload starts a new multipart upload of the object with the given name.
+func (p *PrefixedBucket) NewMultipartUpload(ctx context.Context, name string, opts ...ObjectUploadOption) (MultipartWriter, error) {
+	return NewMultipartUpload(ctx, p.bkt, conditionalPrefix(p.prefix, name), opts...)
 }
 
 // Delete removes the object with the given name.
@@ -96,7 +242,51 @@ func (p *PrefixedBucket) Delete(ctx context.Context, name string) error {
 	return p.bkt.Delete(ctx, conditionalPrefix(p.prefix, name))
 }
 
+// DeleteMany removes the objects with the given names.
+// The names reported in a *BatchDeleteResult error are relative to the prefix.
+func (p *PrefixedBucket) DeleteMany(ctx context.Context, names []string) error {
+	prefixed := make([]string, 0, len(names))
+	for _, name := range names {
+		prefixed = append(prefixed, conditionalPrefix(p.prefix, name))
+	}
+
+	err := p.bkt.DeleteMany(ctx, prefixed)
+	var res *BatchDeleteResult
+	if !errors.As(err, &res) {
+		return err
+	}
+	trimmed := &BatchDeleteResult{Errors: make(map[string]error, len(res.Errors))}
+	for name, objErr := range res.Errors {
+		trimmed.Errors[strings.TrimPrefix(name, p.prefix+DirDelim)] = objErr
+	}
+	return trimmed
+}
+
+// Copy copies the object with the src name into a new object with the dst name within the bucket.
+func (p *PrefixedBucket) Copy(ctx context.Context, src, dst string) error {
+	return p.bkt.Copy(ctx, conditionalPrefix(p.prefix, src), conditionalPrefix(p.prefix, dst))
+}
+
+// CopyFromBucket copies the object with the src name in the src bucket into a new object with the dst name,
+// with the prefix, server-side if the wrapped bucket supports it.
+func (p *PrefixedBucket) CopyFromBucket(ctx context.Context, src Bucket, srcName, dstName string) error {
+	return CopyFromBucket(ctx, src, p.bkt, srcName, conditionalPrefix(p.prefix, dstName))
+}
+
+// SupportedCopy returns true if the wrapped bucket copies objects server-side.
+func (p *PrefixedBucket) SupportedCopy() bool {
+	if c, ok := p.bkt.(ServerSideCopier); ok {
+		return c.SupportedCopy()
+	}
+	return false
+}
+
 // Name returns the bucket name for the provider.
 func (p *PrefixedBucket) Name() string {
 	return p.bkt.Name()
 }
+
+// WrappedBucket returns the bucket without the prefix.
+func (p *PrefixedBucket) WrappedBucket() Bucket {
+	return p.bkt
+}
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
 )
 
 func TestPrefixedBucket_Acceptance(t *testing.T) {
@@ -28,6 +29,25 @@ func TestPrefixedBucket_Acceptance(t *testing.T) {
 	}
 }
 
+func TestPrefixedBucket_DeleteMany(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	pBkt := NewPrefixedBucket(failingDeleteBucket{Bucket: bkt, name: "someprefix/obj2"}, "someprefix")
+	testutil.Ok(t, pBkt.Upload(ctx, "obj1", strings.NewReader("content")))
+	testutil.Ok(t, pBkt.Upload(ctx, "obj2", strings.NewReader("content")))
+
+	err := pBkt.DeleteMany(ctx, []string{"obj1", "obj2"})
+	testutil.Assert(t, IsBatchDeletePartialErr(err), "expected partial error, got %v", err)
+
+	// Failed names are reported without the prefix.
+	var res *BatchDeleteResult
+	testutil.Assert(t, errors.As(err, &res))
+	testutil.Equals(t, 1, len(res.Errors))
+	testutil.NotOk(t, res.Errors["obj2"])
+
+	testutil.Equals(t, map[string][]byte{"someprefix/obj2": []byte("content")}, bkt.Objects())
+}
+
 func UsesPrefixTest(t *testing.T, bkt Bucket, prefix string) {
 	testutil.Ok(t, bkt.Upload(context.Background(), strings.Trim(prefix, "/")+"/file1.jpg", strings.NewReader("test-data1")))
 
@@ -90,3 +110,40 @@ func UsesPrefixTest(t *testing.T, bkt Bucket, prefix string) {
 	sort.Strings(seen)
 	testutil.Equals(t, expected, seen)
 }
+
+func TestNewPrefixedBucket_EmptyPrefix(t *testing.T) {
+	bkt := NewInMemBucket()
+	for _, prefix := range []string{"", "/", "//"} {
+		testutil.Assert(t, NewPrefixedBucket(bkt, prefix) == Bucket(bkt), "expected %q to return the bucket as is", prefix)
+	}
+}
+
+func TestPrefixedBucket_Nested(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+	testutil.Ok(t, bkt.Upload(ctx, "tenant-a/other/obj", strings.NewReader("other")))
+	testutil.Ok(t, bkt.Upload(ctx, "tenant-b/blocks/obj", strings.NewReader("other-tenant")))
+
+	pBkt := NewPrefixedBucket(NewPrefixedBucket(bkt, "/tenant-a/"), "blocks")
+	testutil.Equals(t, "tenant-a/blocks", pBkt.(*PrefixedBucket).prefix)
+
+	testutil.Ok(t, pBkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Ok(t, pBkt.Upload(ctx, "dir/obj", strings.NewReader("content")))
+	ok, err := bkt.Exists(ctx, "tenant-a/blocks/obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to be uploaded below both prefixes")
+
+	seen := []string{}
+	testutil.Ok(t, pBkt.Iter(ctx, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, WithRecursiveIter))
+	testutil.Equals(t, []string{"dir/obj", "obj"}, seen)
+
+	testutil.Ok(t, pBkt.Delete(ctx, "obj"))
+	testutil.Ok(t, pBkt.Delete(ctx, "dir/obj"))
+	testutil.Equals(t, map[string][]byte{
+		"tenant-a/other/obj":  []byte("other"),
+		"tenant-b/blocks/obj": []byte("other-tenant"),
+	}, bkt.Objects())
+}
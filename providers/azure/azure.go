@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
@@ -24,6 +25,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/clientutil"
 	"github.com/thanos-io/objstore/exthttp"
 )
 
@@ -156,26 +158,30 @@ func NewBucketWithConfig(logger log.Logger, conf Config, component string) (*Buc
 	if err != nil {
 		return nil, err
 	}
+	return newBucket(logger, containerClient, conf.ContainerName, conf.ReaderConfig.MaxRetryRequests)
+}
 
+// newBucket returns a new Bucket using the given container client, creating the container if it doesn't exist.
+func newBucket(logger log.Logger, containerClient *container.Client, containerName string, readerMaxRetries int) (*Bucket, error) {
 	// Check if storage account container already exists, and create one if it does not.
 	ctx := context.Background()
-	_, err = containerClient.GetProperties(ctx, &container.GetPropertiesOptions{})
+	_, err := containerClient.GetProperties(ctx, &container.GetPropertiesOptions{})
 	if err != nil {
 		if !bloberror.HasCode(err, bloberror.ContainerNotFound) {
 			return nil, err
 		}
 		_, err := containerClient.Create(ctx, nil)
 		if err != nil {
-			return nil, errors.Wrapf(err, "error creating Azure blob container: %s", conf.ContainerName)
+			return nil, errors.Wrapf(err, "error creating Azure blob container: %s", containerName)
 		}
-		level.Info(logger).Log("msg", "Azure blob container successfully created", "address", conf.ContainerName)
+		level.Info(logger).Log("msg", "Azure blob container successfully created", "address", containerName)
 	}
 
 	bkt := &Bucket{
 		logger:           logger,
 		containerClient:  containerClient,
-		containerName:    conf.ContainerName,
-		readerMaxRetries: conf.ReaderConfig.MaxRetryRequests,
+		containerName:    containerName,
+		readerMaxRetries: readerMaxRetries,
 	}
 	return bkt, nil
 }
@@ -183,22 +189,54 @@ func NewBucketWithConfig(logger log.Logger, conf Config, component string) (*Buc
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(attrs objstore.IterObjectAttributes) error {
+		return f(attrs.Name)
+	}, options...)
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter.
+// In addition to Name, it also includes requested object attributes in the argument to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	prefix := dir
 	if prefix != "" && !strings.HasSuffix(prefix, DirDelim) {
 		prefix += DirDelim
 	}
 
 	params := objstore.ApplyIterOptions(options...)
+	blobAttrs := func(blobItem *container.BlobItem) objstore.IterObjectAttributes {
+		attrs := objstore.IterObjectAttributes{Name: *blobItem.Name}
+		if blobItem.Properties == nil {
+			return attrs
+		}
+		if params.ETag && blobItem.Properties.ETag != nil {
+			attrs.SetETag(clientutil.TrimETag(string(*blobItem.Properties.ETag)))
+		}
+		if params.LastModified && blobItem.Properties.LastModified != nil {
+			attrs.SetLastModified(*blobItem.Properties.LastModified)
+		}
+		if params.StorageClass {
+			attrs.SetStorageClass(accessTier(blobItem))
+		}
+		return attrs
+	}
+
 	if params.Recursive {
 		opt := &container.ListBlobsFlatOptions{Prefix: &prefix}
 		pager := b.containerClient.NewListBlobsFlatPager(opt)
 		for pager.More() {
 			resp, err := pager.NextPage(ctx)
 			if err != nil {
-				return err
+				return wrapErr(objstore.OpIter, dir, err)
 			}
 			for _, blob := range resp.Segment.BlobItems {
-				if err := f(*blob.Name); err != nil {
+				if params.SkipStorageClass(accessTier(blob)) {
+					continue
+				}
+				if err := f(blobAttrs(blob)); err != nil {
 					return err
 				}
 			}
@@ -211,15 +249,18 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	for pager.More() {
 		resp, err := pager.NextPage(ctx)
 		if err != nil {
-			return err
+			return wrapErr(objstore.OpIter, dir, err)
 		}
 		for _, blobItem := range resp.Segment.BlobItems {
-			if err := f(*blobItem.Name); err != nil {
+			if params.SkipStorageClass(accessTier(blobItem)) {
+				continue
+			}
+			if err := f(blobAttrs(blobItem)); err != nil {
 				return err
 			}
 		}
 		for _, blobPrefix := range resp.Segment.BlobPrefixes {
-			if err := f(*blobPrefix.Name); err != nil {
+			if err := f(objstore.IterObjectAttributes{Name: *blobPrefix.Name}); err != nil {
 				return err
 			}
 		}
@@ -227,6 +268,39 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	return nil
 }
 
+// accessTier returns the access tier of the blob, which is reported as its storage class.
+func accessTier(blobItem *container.BlobItem) string {
+	if blobItem.Properties == nil || blobItem.Properties.AccessTier == nil {
+		return ""
+	}
+	return string(*blobItem.Properties.AccessTier)
+}
+
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive, objstore.ETag, objstore.StorageClass, objstore.UpdatedAt}
+}
+
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the Azure storage error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	var respErr *azcore.ResponseError
+	if err == nil || !errors.As(err, &respErr) {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	kind := objstore.ErrorKindFromHTTPStatus(respErr.StatusCode)
+	switch bloberror.Code(respErr.ErrorCode) {
+	case bloberror.BlobNotFound, bloberror.ContainerNotFound:
+		kind = objstore.ErrKindNotFound
+	case bloberror.AuthenticationFailed, bloberror.AuthorizationFailure, bloberror.AuthorizationPermissionMismatch, bloberror.InsufficientAccountPermissions:
+		kind = objstore.ErrKindPermissionDenied
+	case bloberror.ServerBusy:
+		kind = objstore.ErrKindRateLimit
+	case bloberror.ConditionNotMet:
+		kind = objstore.ErrKindPreconditionFailed
+	}
+	return objstore.NewBucketError(op, name, respErr.ErrorCode, kind, err)
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	if err == nil {
@@ -259,12 +333,18 @@ func (b *Bucket) getBlobReader(ctx context.Context, name string, httpRange blob.
 
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.getBlobReader(ctx, name, blob.HTTPRange{})
+	r, err := b.getBlobReader(ctx, name, blob.HTTPRange{})
+	return r, wrapErr(objstore.OpGet, name, err)
 }
 
 // GetRange returns a new range reader for the given object name and range.
+// Azure does not support suffix ranges, so a negative offset returns an error.
 func (b *Bucket) GetRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
-	return b.getBlobReader(ctx, name, blob.HTTPRange{Offset: offset, Count: length})
+	if offset < 0 {
+		return nil, wrapErr(objstore.OpGetRange, name, errors.Errorf("suffix ranges are not supported, got offset %d", offset))
+	}
+	r, err := b.getBlobReader(ctx, name, blob.HTTPRange{Offset: offset, Count: length})
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 // Attributes returns information about the specified object.
@@ -273,12 +353,33 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 	blobClient := b.containerClient.NewBlobClient(name)
 	resp, err := blobClient.GetProperties(ctx, nil)
 	if err != nil {
-		return objstore.ObjectAttributes{}, err
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, err)
 	}
-	return objstore.ObjectAttributes{
+	attrs := objstore.ObjectAttributes{
 		Size:         *resp.ContentLength,
 		LastModified: *resp.LastModified,
-	}, nil
+	}
+	if resp.ETag != nil {
+		attrs.ETag = clientutil.TrimETag(string(*resp.ETag))
+	}
+	if resp.ContentType != nil {
+		attrs.ContentType = *resp.ContentType
+	}
+	if resp.AccessTier != nil {
+		attrs.StorageClass = *resp.AccessTier
+	}
+	if len(resp.Metadata) > 0 {
+		// The keys are returned as canonical HTTP header keys, lowercase them like S3 does.
+		attrs.UserMetadata = make(map[string]string, len(resp.Metadata))
+		for k, v := range resp.Metadata {
+			attrs.UserMetadata[strings.ToLower(k)] = v
+		}
+	}
+	// Azure only stores the MD5 of blobs uploaded in a single request.
+	if len(resp.ContentMD5) > 0 {
+		attrs.MD5 = resp.ContentMD5
+	}
+	return attrs, nil
 }
 
 // Exists checks if the given object exists.
@@ -289,21 +390,37 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrapf(err, "cannot get properties for Azure blob, address: %s", name)
+		return false, wrapErr(objstore.OpExists, name, errors.Wrapf(err, "cannot get properties for Azure blob, address: %s", name))
 	}
 	return true, nil
 }
 
 // Upload the contents of the reader as an object into the bucket.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
 	level.Debug(b.logger).Log("msg", "uploading blob", "blob", name)
+	params := objstore.ApplyObjectUploadOptions(opts...)
+	if err := objstore.ValidateUserMetadata(params.UserMetadata); err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	// Azure only supports public access for whole containers.
+	if params.PublicRead {
+		return wrapErr(objstore.OpUpload, name, objstore.ErrOptionNotSupported)
+	}
 	blobClient := b.containerClient.NewBlockBlobClient(name)
-	opts := &blockblob.UploadStreamOptions{
+	uploadOpts := &blockblob.UploadStreamOptions{
 		BlockSize:   3 * 1024 * 1024,
 		Concurrency: 4,
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &params.ContentType},
+		Metadata:    params.UserMetadata,
+	}
+	if params.CacheControl != "" {
+		uploadOpts.HTTPHeaders.BlobCacheControl = &params.CacheControl
+	}
+	if params.ContentEncoding != "" {
+		uploadOpts.HTTPHeaders.BlobContentEncoding = &params.ContentEncoding
 	}
-	if _, err := blobClient.UploadStream(ctx, r, opts); err != nil {
-		return errors.Wrapf(err, "cannot upload Azure blob, address: %s", name)
+	if _, err := blobClient.UploadStream(ctx, r, uploadOpts); err != nil {
+		return wrapErr(objstore.OpUpload, name, errors.Wrapf(err, "cannot upload Azure blob, address: %s", name))
 	}
 	return nil
 }
@@ -316,11 +433,58 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 		DeleteSnapshots: to.Ptr(blob.DeleteSnapshotsOptionTypeInclude),
 	}
 	if _, err := blobClient.Delete(ctx, opt); err != nil {
-		return errors.Wrapf(err, "error deleting blob, address: %s", name)
+		return wrapErr(objstore.OpDelete, name, errors.Wrapf(err, "error deleting blob, address: %s", name))
+	}
+	return nil
+}
+
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+// The copy is done server-side and Copy waits until Azure reports it as finished.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) (err error) {
+	defer func() { err = wrapErr(objstore.OpCopy, src, err) }()
+
+	level.Debug(b.logger).Log("msg", "copying blob", "src", src, "dst", dst)
+	srcClient := b.containerClient.NewBlobClient(src)
+	// Check the source first, so that a missing object is reported as BlobNotFound.
+	if _, err := srcClient.GetProperties(ctx, nil); err != nil {
+		return errors.Wrapf(err, "cannot get properties for Azure blob, address: %s", src)
+	}
+
+	dstClient := b.containerClient.NewBlobClient(dst)
+	resp, err := dstClient.StartCopyFromURL(ctx, srcClient.URL(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "cannot copy Azure blob %s to %s", src, dst)
+	}
+
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+		props, err := dstClient.GetProperties(ctx, nil)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get copy status for Azure blob, address: %s", dst)
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return errors.Errorf("copy of Azure blob %s to %s finished with status %s", src, dst, *status)
 	}
 	return nil
 }
 
+// SupportedCopy returns true as Azure copies blobs server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
+}
+
 // Name returns Azure container name.
 func (b *Bucket) Name() string {
 	return b.containerName
@@ -328,19 +492,32 @@ func (b *Bucket) Name() string {
 
 // NewTestBucket creates test bkt client that before returning creates temporary bucket.
 // In a close function it empties and deletes the bucket.
+// If AZURE_STORAGE_CONNECTION_STRING is set, the bucket is created using the connection string, e.g. to run
+// the tests against the Azurite emulator, otherwise with AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_ACCESS_KEY.
 func NewTestBucket(t testing.TB, component string) (objstore.Bucket, func(), error) {
-	t.Log("Using test Azure bucket.")
-
-	conf := &DefaultConfig
-	conf.StorageAccountName = os.Getenv("AZURE_STORAGE_ACCOUNT")
-	conf.StorageAccountKey = os.Getenv("AZURE_STORAGE_ACCESS_KEY")
-	conf.ContainerName = objstore.CreateTemporaryTestBucketName(t)
-
-	bc, err := yaml.Marshal(conf)
-	if err != nil {
-		return nil, nil, err
+	var (
+		bkt *Bucket
+		err error
+	)
+	if connStr := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connStr != "" {
+		t.Log("Using test Azure bucket with connection string.")
+
+		bkt, err = newTestBucketFromConnectionString(t, connStr)
+	} else {
+		t.Log("Using test Azure bucket.")
+
+		conf := &DefaultConfig
+		conf.StorageAccountName = os.Getenv("AZURE_STORAGE_ACCOUNT")
+		conf.StorageAccountKey = os.Getenv("AZURE_STORAGE_ACCESS_KEY")
+		conf.ContainerName = objstore.CreateTemporaryTestBucketName(t)
+
+		var bc []byte
+		bc, err = yaml.Marshal(conf)
+		if err != nil {
+			return nil, nil, err
+		}
+		bkt, err = NewBucket(log.NewNopLogger(), bc, component)
 	}
-	bkt, err := NewBucket(log.NewNopLogger(), bc, component)
 	if err != nil {
 		t.Errorf("Cannot create Azure storage container:")
 		return nil, nil, err
@@ -355,6 +532,15 @@ func NewTestBucket(t testing.TB, component string) (objstore.Bucket, func(), err
 	}, nil
 }
 
+func newTestBucketFromConnectionString(t testing.TB, connStr string) (*Bucket, error) {
+	containerName := objstore.CreateTemporaryTestBucketName(t)
+	containerClient, err := container.NewClientFromConnectionString(connStr, containerName, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create container client from connection string")
+	}
+	return newBucket(log.NewNopLogger(), containerClient, containerName, DefaultConfig.ReaderConfig.MaxRetryRequests)
+}
+
 // Close bucket.
 func (b *Bucket) Close() error {
 	return nil
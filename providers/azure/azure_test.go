@@ -4,6 +4,8 @@
 package azure
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -212,3 +214,10 @@ http_config:
 	testutil.Ok(t, err)
 	testutil.Equals(t, true, transport.TLSClientConfig.InsecureSkipVerify)
 }
+
+func TestBucket_GetRangeSuffix(t *testing.T) {
+	bkt := &Bucket{}
+	_, err := bkt.GetRange(context.Background(), "obj", -4, -1)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "suffix ranges are not supported"), err.Error())
+}
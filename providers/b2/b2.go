@@ -0,0 +1,147 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package b2 implements the objstore.Bucket interface against Backblaze B2 through its S3-compatible API.
+package b2
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/exthttp"
+	"github.com/thanos-io/objstore/providers/s3"
+)
+
+// maxBucketNameLength is the maximum length of B2 bucket names.
+const maxBucketNameLength = 50
+
+// fileNotPresentCode is the error code B2 returns for missing files in some responses of its S3-compatible API,
+// which is the code of the native B2 API.
+const fileNotPresentCode = "file_not_present"
+
+// DefaultConfig is the default config for a B2 client.
+var DefaultConfig = Config{
+	HTTPConfig: s3.DefaultConfig.HTTPConfig,
+}
+
+// Config stores the configuration for a B2 bucket.
+type Config struct {
+	// AccountID is the ID of the application key, which is the account ID for the master application key.
+	AccountID      string `yaml:"account_id"`
+	ApplicationKey string `yaml:"application_key"`
+	Bucket         string `yaml:"bucket"`
+	// Endpoint is the S3-compatible endpoint of the region of the bucket, e.g. s3.us-west-004.backblazeb2.com.
+	Endpoint   string             `yaml:"endpoint"`
+	HTTPConfig exthttp.HTTPConfig `yaml:"http_config"`
+}
+
+func (conf Config) validate() error {
+	if conf.Bucket == "" {
+		return errors.New("no b2 bucket in config file")
+	}
+	if conf.Endpoint == "" {
+		return errors.New("no b2 endpoint in config file")
+	}
+	if conf.AccountID == "" || conf.ApplicationKey == "" {
+		return errors.New("account_id and application_key must be set in config file")
+	}
+	return nil
+}
+
+// s3Config returns the config of the S3 client for the S3-compatible API of B2.
+func (conf Config) s3Config() s3.Config {
+	c := s3.DefaultConfig
+	c.Bucket = conf.Bucket
+	c.Endpoint = conf.Endpoint
+	c.AccessKey = conf.AccountID
+	c.SecretKey = conf.ApplicationKey
+	c.HTTPConfig = conf.HTTPConfig
+	if strings.HasPrefix(c.Endpoint, "http://") {
+		c.Insecure = true
+	}
+	c.Endpoint = strings.TrimPrefix(strings.TrimPrefix(c.Endpoint, "https://"), "http://")
+	c.Region = regionFromEndpoint(c.Endpoint)
+	return c
+}
+
+// regionFromEndpoint returns the region of an S3-compatible B2 endpoint, e.g. us-west-004 for
+// s3.us-west-004.backblazeb2.com, or an empty string to let the client look it up.
+func regionFromEndpoint(endpoint string) string {
+	parts := strings.Split(endpoint, ".")
+	if len(parts) == 4 && parts[0] == "s3" && parts[2] == "backblazeb2" {
+		return parts[1]
+	}
+	return ""
+}
+
+// supportedIterOptions are the options B2 returns with its listing, which includes the ETags and sizes of the
+// objects. B2 has a single storage class, so listing options of the storage class are not supported.
+var supportedIterOptions = []objstore.IterOptionType{objstore.Recursive, objstore.ETag, objstore.MaxResults, objstore.Size, objstore.StartAfter, objstore.PrefixesOnly, objstore.UpdatedAt}
+
+// Bucket implements the objstore.Bucket interface against Backblaze B2, see s3.CompatibleBucket.
+type Bucket = s3.CompatibleBucket
+
+// NewBucket returns a new Bucket using the provided B2 config.
+func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error) {
+	config := DefaultConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return nil, err
+	}
+	return NewBucketWithConfig(logger, config, component)
+}
+
+// NewBucketWithConfig returns a new Bucket using the provided B2 config values.
+func NewBucketWithConfig(logger log.Logger, config Config, component string) (*Bucket, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	bkt, err := s3.NewBucketWithConfig(logger, config.s3Config(), component)
+	if err != nil {
+		return nil, errors.Wrap(err, "create s3 client for b2")
+	}
+	return s3.NewCompatibleBucket(bkt, fileNotPresentCode, supportedIterOptions...), nil
+}
+
+func configFromEnv() Config {
+	c := DefaultConfig
+	c.AccountID = os.Getenv("B2_ACCOUNT_ID")
+	c.ApplicationKey = os.Getenv("B2_APPLICATION_KEY")
+	c.Bucket = os.Getenv("B2_BUCKET")
+	c.Endpoint = os.Getenv("B2_ENDPOINT")
+	return c
+}
+
+// NewTestBucket creates test bkt client that before returning creates temporary bucket.
+// In a close function it empties and deletes the bucket.
+func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
+	c := configFromEnv()
+	if c.Endpoint == "" || c.AccountID == "" || c.ApplicationKey == "" {
+		return nil, nil, errors.New("insufficient b2 test configuration information, B2_ENDPOINT, B2_ACCOUNT_ID and B2_APPLICATION_KEY have to be set")
+	}
+	if c.Bucket != "" && os.Getenv("THANOS_ALLOW_EXISTING_BUCKET_USE") == "" {
+		return nil, nil, errors.New("B2_BUCKET is defined. Normally this tests will create temporary bucket " +
+			"and delete it after test. Unset B2_BUCKET env variable to use default logic. If you really want to run " +
+			"tests against provided (NOT USED!) bucket, set THANOS_ALLOW_EXISTING_BUCKET_USE=true. WARNING: That bucket " +
+			"needs to be manually cleared. This means that it is only useful to run one test in a time.")
+	}
+
+	reuseBucket := c.Bucket != ""
+	if c.Bucket == "" {
+		c.Bucket = objstore.CreateTemporaryTestBucketName(t)
+		if len(c.Bucket) > maxBucketNameLength {
+			c.Bucket = c.Bucket[:maxBucketNameLength]
+		}
+	}
+	s3Config := c.s3Config()
+	bkt, closeFn, err := s3.NewTestBucketFromConfig(t, s3Config.Region, s3Config, reuseBucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s3.NewCompatibleBucket(bkt.(*s3.Bucket), fileNotPresentCode, supportedIterOptions...), closeFn, nil
+}
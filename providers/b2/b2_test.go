@@ -0,0 +1,65 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package b2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/objstore"
+)
+
+func TestParseConfig(t *testing.T) {
+	bkt, err := NewBucket(log.NewNopLogger(), []byte(`account_id: "key-id"
+application_key: "key"
+bucket: "Test-Bucket"
+endpoint: "https://s3.us-west-004.backblazeb2.com"`), "test")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "Test-Bucket", bkt.Name())
+
+	cfg := Config{AccountID: "key-id", ApplicationKey: "key", Bucket: "test-bucket", Endpoint: "https://s3.us-west-004.backblazeb2.com"}.s3Config()
+	testutil.Equals(t, "s3.us-west-004.backblazeb2.com", cfg.Endpoint)
+	testutil.Equals(t, "us-west-004", cfg.Region)
+	testutil.Equals(t, "key-id", cfg.AccessKey)
+	testutil.Assert(t, !cfg.Insecure)
+
+	_, err = NewBucket(log.NewNopLogger(), []byte(`bucket: "test-bucket"
+endpoint: "s3.us-west-004.backblazeb2.com"`), "test")
+	testutil.NotOk(t, err)
+	_, err = NewBucket(log.NewNopLogger(), []byte(`account_id: "key-id"
+application_key: "key"
+bucket: "test-bucket"`), "test")
+	testutil.NotOk(t, err)
+}
+
+func TestBucket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>` + fileNotPresentCode + `</Code><Message>File not present</Message></Error>`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), Config{
+		AccountID:      "key-id",
+		ApplicationKey: "key",
+		Bucket:         "test-bucket",
+		Endpoint:       srv.URL,
+	}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	_, err = bkt.Get(ctx, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+
+	err = bkt.Iter(ctx, "", func(string) error { return nil }, objstore.WithStorageClassIter)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, !objstore.SupportsTagger(bkt))
+	testutil.Assert(t, !objstore.SupportsTagger(objstore.WrapWithMetrics(bkt, nil, "test")))
+}
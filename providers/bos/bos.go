@@ -23,6 +23,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/clientutil"
 )
 
 // partSize 128MB.
@@ -106,11 +107,35 @@ func (b *Bucket) Name() string {
 
 // Delete removes the object with the given name.
 func (b *Bucket) Delete(_ context.Context, name string) error {
-	return b.client.DeleteObject(b.name, name)
+	return wrapErr(objstore.OpDelete, name, b.client.DeleteObject(b.name, name))
+}
+
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+func (b *Bucket) Copy(_ context.Context, src, dst string) error {
+	if _, err := b.client.BasicCopyObject(b.name, dst, b.name, src); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy bos object %s to %s", src, dst))
+	}
+	return nil
+}
+
+// SupportedCopy returns true as BOS copies objects server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
 }
 
 // Upload the contents of the reader as an object into the bucket.
-func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) error {
+func (b *Bucket) Upload(_ context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+
 	size, err := objstore.TryToGetSize(r)
 	if err != nil {
 		return errors.Wrapf(err, "getting size of %s", name)
@@ -178,6 +203,10 @@ func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) error {
 // Iter calls f for each entry in the given directory (not recursive). The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), opt...); err != nil {
+		return err
+	}
+
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, objstore.DirDelim) + objstore.DirDelim
 	}
@@ -201,7 +230,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 			Prefix:    dir,
 		})
 		if err != nil {
-			return err
+			return wrapErr(objstore.OpIter, dir, err)
 		}
 
 		marker = objects.NextMarker
@@ -223,14 +252,30 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	return nil
 }
 
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	return b.Iter(ctx, dir, func(name string) error {
+		return f(objstore.IterObjectAttributes{Name: name})
+	}, options...)
+}
+
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive}
+}
+
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.getRange(ctx, b.name, name, 0, -1)
+	r, err := b.getRange(ctx, b.name, name, 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
 }
 
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	return b.getRange(ctx, b.name, name, off, length)
+	r, err := b.getRange(ctx, b.name, name, off, length)
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 // Exists checks if the given object exists in the bucket.
@@ -240,7 +285,7 @@ func (b *Bucket) Exists(_ context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrapf(err, "getting object metadata of %s", name)
+		return false, wrapErr(objstore.OpExists, name, errors.Wrapf(err, "getting object metadata of %s", name))
 	}
 	return true, nil
 }
@@ -259,7 +304,9 @@ func (b *Bucket) ObjectSize(_ context.Context, name string) (uint64, error) {
 }
 
 // Attributes returns information about the specified object.
-func (b *Bucket) Attributes(_ context.Context, name string) (objstore.ObjectAttributes, error) {
+func (b *Bucket) Attributes(_ context.Context, name string) (_ objstore.ObjectAttributes, err error) {
+	defer func() { err = wrapErr(objstore.OpAttributes, name, err) }()
+
 	objMeta, err := b.client.GetObjectMeta(b.name, name)
 	if err != nil {
 		return objstore.ObjectAttributes{}, errors.Wrapf(err, "gettting objectmeta of %s", name)
@@ -273,9 +320,29 @@ func (b *Bucket) Attributes(_ context.Context, name string) (objstore.ObjectAttr
 	return objstore.ObjectAttributes{
 		Size:         objMeta.ContentLength,
 		LastModified: lastModified,
+		ETag:         clientutil.TrimETag(objMeta.ETag),
 	}, nil
 }
 
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the BOS error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	bosErr, ok := errors.Cause(err).(*bce.BceServiceError)
+	if !ok {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	kind := objstore.ErrorKindFromHTTPStatus(bosErr.StatusCode)
+	switch bosErr.Code {
+	case "NoSuchKey", "NoSuchBucket":
+		kind = objstore.ErrKindNotFound
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		kind = objstore.ErrKindPermissionDenied
+	case "PreconditionFailed":
+		kind = objstore.ErrKindPreconditionFailed
+	}
+	return objstore.NewBucketError(op, name, bosErr.Code, kind, err)
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	switch bosErr := errors.Cause(err).(type) {
@@ -0,0 +1,291 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package cache implements a bucket wrapper which caches object attributes, existence checks and the
+// content of small objects in a pluggable cache.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/objstore"
+)
+
+// Cache stores values for a limited time. It has to be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored for the key. The returned bool is false if the key is not cached.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value for the key until ttl passes.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the given keys.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Config configures a CachingBucket.
+type Config struct {
+	// TTL is the time for which cached results are served without checking the bucket.
+	TTL time.Duration
+	// MaxCachedObjectSize is the maximum size of an object whose content is cached by Get.
+	// The content of objects is not cached if it is zero.
+	MaxCachedObjectSize int64
+}
+
+func (c Config) validate() error {
+	if c.TTL <= 0 {
+		return errors.New("TTL must be positive")
+	}
+	if c.MaxCachedObjectSize < 0 {
+		return errors.New("max cached object size must not be negative")
+	}
+	return nil
+}
+
+const (
+	itemAttributes = "attributes"
+	itemExists     = "exists"
+	itemContent    = "content"
+)
+
+// CachingBucket is a bucket wrapper which caches the results of Attributes and Exists, and the content of
+// small objects returned by Get. Writes and deletes through the CachingBucket remove the object from the
+// cache, changes by other clients are only seen once the cached results expire. See objstore.WrapWithCache
+// for an in-memory cache which checks the cached content on each Get, and the diskcache package for caching
+// large objects on local disk.
+type CachingBucket struct {
+	bkt    objstore.Bucket
+	cache  Cache
+	cfg    Config
+	logger log.Logger
+
+	hits   *prometheus.CounterVec
+	misses *prometheus.CounterVec
+}
+
+// NewCachingBucket returns a new CachingBucket wrapping bkt. Cache hits and misses are registered with reg,
+// if not nil.
+func NewCachingBucket(bkt objstore.Bucket, cache Cache, cfg Config, logger log.Logger, reg prometheus.Registerer) (*CachingBucket, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate cache config")
+	}
+	b := &CachingBucket{
+		bkt:    bkt,
+		cache:  cache,
+		cfg:    cfg,
+		logger: logger,
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_caching_bucket_hits_total",
+			Help:        "Total number of requests against a bucket served from the cache.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}, []string{"item"}),
+		misses: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_caching_bucket_misses_total",
+			Help:        "Total number of requests against a bucket which were not cached.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}, []string{"item"}),
+	}
+	for _, item := range []string{itemAttributes, itemExists, itemContent} {
+		b.hits.WithLabelValues(item)
+		b.misses.WithLabelValues(item)
+	}
+	return b, nil
+}
+
+func (b *CachingBucket) key(item, name string) string {
+	return "objstore:" + b.bkt.Name() + ":" + item + ":" + name
+}
+
+// get returns the cached value of the given item of the object. Failures of the cache are logged and
+// treated as misses.
+func (b *CachingBucket) get(ctx context.Context, item, name string) ([]byte, bool) {
+	value, ok, err := b.cache.Get(ctx, b.key(item, name))
+	if err != nil {
+		level.Warn(b.logger).Log("msg", "failed to get cached value", "item", item, "name", name, "err", err)
+	}
+	if !ok || err != nil {
+		b.misses.WithLabelValues(item).Inc()
+		return nil, false
+	}
+	b.hits.WithLabelValues(item).Inc()
+	return value, true
+}
+
+// set caches the value of the given item of the object. Failures of the cache are logged.
+func (b *CachingBucket) set(ctx context.Context, item, name string, value []byte) {
+	if err := b.cache.Set(ctx, b.key(item, name), value, b.cfg.TTL); err != nil {
+		level.Warn(b.logger).Log("msg", "failed to cache value", "item", item, "name", name, "err", err)
+	}
+}
+
+// invalidate removes all cached items of the given objects.
+func (b *CachingBucket) invalidate(ctx context.Context, names ...string) error {
+	keys := make([]string, 0, 3*len(names))
+	for _, name := range names {
+		keys = append(keys, b.key(itemAttributes, name), b.key(itemExists, name), b.key(itemContent, name))
+	}
+	return errors.Wrap(b.cache.Delete(ctx, keys...), "invalidate cache")
+}
+
+// Attributes returns the cached attributes of the object or requests them from the wrapped bucket.
+func (b *CachingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	var attrs objstore.ObjectAttributes
+	if value, ok := b.get(ctx, itemAttributes, name); ok {
+		if err := json.Unmarshal(value, &attrs); err == nil {
+			return attrs, nil
+		}
+	}
+
+	attrs, err := b.bkt.Attributes(ctx, name)
+	if err != nil {
+		return attrs, err
+	}
+	if value, err := json.Marshal(attrs); err == nil {
+		b.set(ctx, itemAttributes, name, value)
+	}
+	return attrs, nil
+}
+
+// Exists returns the cached result of checking whether the object exists or checks it in the wrapped bucket.
+func (b *CachingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if value, ok := b.get(ctx, itemExists, name); ok {
+		return string(value) == "true", nil
+	}
+
+	exists, err := b.bkt.Exists(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	b.set(ctx, itemExists, name, []byte(strconv.FormatBool(exists)))
+	return exists, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Get returns a reader for the cached content of the object or reads it from the wrapped bucket. The content
+// is cached if it is not larger than Config.MaxCachedObjectSize.
+func (b *CachingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if b.cfg.MaxCachedObjectSize == 0 {
+		return b.bkt.Get(ctx, name)
+	}
+	if value, ok := b.get(ctx, itemContent, name); ok {
+		return objstore.NopCloserWithSize(bytes.NewReader(value)), nil
+	}
+
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	// Read one more byte than the limit to find out whether the object is too large to be cached.
+	value, err := io.ReadAll(io.LimitReader(rc, b.cfg.MaxCachedObjectSize+1))
+	if err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(err, "read %s", name)
+	}
+	if int64(len(value)) > b.cfg.MaxCachedObjectSize {
+		return readCloser{Reader: io.MultiReader(bytes.NewReader(value), rc), Closer: rc}, nil
+	}
+	if err := rc.Close(); err != nil {
+		return nil, errors.Wrapf(err, "close %s", name)
+	}
+	b.set(ctx, itemContent, name, value)
+	return objstore.NopCloserWithSize(bytes.NewReader(value)), nil
+}
+
+func (b *CachingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *CachingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *CachingBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *CachingBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+// Upload uploads the contents of the reader as an object into the bucket and removes it from the cache.
+func (b *CachingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	err := b.bkt.Upload(ctx, name, r, opts...)
+	if invErr := b.invalidate(ctx, name); err == nil {
+		err = invErr
+	}
+	return err
+}
+
+// UploadIfNotExists uploads the contents of the reader if the object does not exist yet and removes it from the cache.
+func (b *CachingBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	uploaded, err := objstore.UploadIfNotExists(ctx, b.bkt, name, r)
+	if invErr := b.invalidate(ctx, name); err == nil {
+		err = invErr
+	}
+	return uploaded, err
+}
+
+// UploadIfMatch uploads the contents of the reader if the ETag of the object matches and removes it from the cache.
+func (b *CachingBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...objstore.ObjectUploadOption) error {
+	err := objstore.UploadIfMatch(ctx, b.bkt, name, r, etag, opts...)
+	if invErr := b.invalidate(ctx, name); err == nil {
+		err = invErr
+	}
+	return err
+}
+
+// Delete removes the object with the given name and removes it from the cache.
+func (b *CachingBucket) Delete(ctx context.Context, name string) error {
+	err := b.bkt.Delete(ctx, name)
+	if invErr := b.invalidate(ctx, name); err == nil {
+		err = invErr
+	}
+	return err
+}
+
+// DeleteMany removes the objects with the given names and removes them from the cache.
+func (b *CachingBucket) DeleteMany(ctx context.Context, names []string) error {
+	err := b.bkt.DeleteMany(ctx, names)
+	if invErr := b.invalidate(ctx, names...); err == nil {
+		err = invErr
+	}
+	return err
+}
+
+// Copy copies the object with the src name into a new object with the dst name and removes dst from the cache.
+func (b *CachingBucket) Copy(ctx context.Context, src, dst string) error {
+	err := b.bkt.Copy(ctx, src, dst)
+	if invErr := b.invalidate(ctx, dst); err == nil {
+		err = invErr
+	}
+	return err
+}
+
+func (b *CachingBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *CachingBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *CachingBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *CachingBucket) Name() string {
+	return b.bkt.Name()
+}
@@ -0,0 +1,187 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/objstore"
+)
+
+// countingBucket counts the calls to the read operations which are cached.
+type countingBucket struct {
+	objstore.Bucket
+	attributes, exists, gets atomic.Int64
+}
+
+func (b *countingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.attributes.Inc()
+	return b.Bucket.Attributes(ctx, name)
+}
+
+func (b *countingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	b.exists.Inc()
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b *countingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.gets.Inc()
+	return b.Bucket.Get(ctx, name)
+}
+
+func readAll(t *testing.T, bkt objstore.Bucket, name string) string {
+	t.Helper()
+
+	rc, err := bkt.Get(context.Background(), name)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rc.Close()) }()
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	return string(content)
+}
+
+func TestCachingBucket_Acceptance(t *testing.T) {
+	bkt, err := NewCachingBucket(objstore.NewInMemBucket(), NewInMemoryCacheBackend("test", 1024*1024, nil), Config{TTL: time.Minute, MaxCachedObjectSize: 128}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	objstore.AcceptanceTest(t, bkt)
+}
+
+func testCachingBucket(t *testing.T, cache Cache) {
+	ctx := context.Background()
+	inner := &countingBucket{Bucket: objstore.NewInMemBucket()}
+	bkt, err := NewCachingBucket(inner, cache, Config{TTL: time.Minute, MaxCachedObjectSize: 5}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+
+	// Objects which don't exist are cached as well.
+	for i := 0; i < 2; i++ {
+		exists, err := bkt.Exists(ctx, "obj")
+		testutil.Ok(t, err)
+		testutil.Assert(t, !exists)
+	}
+	testutil.Equals(t, int64(1), inner.exists.Load())
+
+	// Uploads invalidate the cached results.
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("1234")))
+	for i := 0; i < 2; i++ {
+		exists, err := bkt.Exists(ctx, "obj")
+		testutil.Ok(t, err)
+		testutil.Assert(t, exists)
+
+		attrs, err := bkt.Attributes(ctx, "obj")
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(4), attrs.Size)
+
+		testutil.Equals(t, "1234", readAll(t, bkt, "obj"))
+	}
+	testutil.Equals(t, int64(2), inner.exists.Load())
+	testutil.Equals(t, int64(1), inner.attributes.Load())
+	testutil.Equals(t, int64(1), inner.gets.Load())
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.hits.WithLabelValues(itemExists)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.hits.WithLabelValues(itemAttributes)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.misses.WithLabelValues(itemAttributes)))
+
+	// The content of objects larger than the max cached object size is not cached.
+	testutil.Ok(t, bkt.Upload(ctx, "large", strings.NewReader("123456")))
+	testutil.Equals(t, "123456", readAll(t, bkt, "large"))
+	testutil.Equals(t, "123456", readAll(t, bkt, "large"))
+	testutil.Equals(t, int64(3), inner.gets.Load())
+
+	// Deletes invalidate the cached results.
+	testutil.Ok(t, bkt.Delete(ctx, "obj"))
+	exists, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists)
+	_, err = bkt.Attributes(ctx, "obj")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+	_, err = bkt.Get(ctx, "obj")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+}
+
+func TestCachingBucket_InMemory(t *testing.T) {
+	testCachingBucket(t, NewInMemoryCacheBackend("test", 1024, nil))
+}
+
+func TestCachingBucket_Redis(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { testutil.Ok(t, client.Close()) })
+
+	testCachingBucket(t, NewRedisCacheBackend(client))
+}
+
+func TestRedisCacheBackend_TTL(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { testutil.Ok(t, client.Close()) })
+	cache := NewRedisCacheBackend(client)
+
+	testutil.Ok(t, cache.Set(ctx, "key", []byte("value"), time.Minute))
+	value, ok, err := cache.Get(ctx, "key")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, "value", string(value))
+
+	srv.FastForward(time.Minute)
+	_, ok, err = cache.Get(ctx, "key")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected key to expire")
+}
+
+func TestInMemoryCacheBackend(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	reg := prometheus.NewRegistry()
+	cache := NewInMemoryCacheBackend("test", 10, reg)
+	cache.now = func() time.Time { return now }
+	// Caches with different names can be registered with the same registerer.
+	NewInMemoryCacheBackend("other", 10, reg)
+
+	// Each entry takes 4 bytes.
+	testutil.Ok(t, cache.Set(ctx, "a", []byte("aaa"), time.Minute))
+	testutil.Ok(t, cache.Set(ctx, "b", []byte("bbb"), time.Minute))
+	_, ok, err := cache.Get(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok)
+
+	// Adding c evicts the least recently used entry b.
+	testutil.Ok(t, cache.Set(ctx, "c", []byte("ccc"), time.Minute))
+	_, ok, _ = cache.Get(ctx, "b")
+	testutil.Assert(t, !ok, "expected b to be evicted")
+	testutil.Equals(t, float64(1), promtest.ToFloat64(cache.evictions))
+	testutil.Equals(t, int64(8), cache.entries.Size())
+
+	// Values larger than the cache are not stored.
+	testutil.Ok(t, cache.Set(ctx, "large", []byte("0123456789"), time.Minute))
+	_, ok, _ = cache.Get(ctx, "large")
+	testutil.Assert(t, !ok)
+
+	// Expired entries are not returned.
+	now = now.Add(time.Minute)
+	_, ok, _ = cache.Get(ctx, "a")
+	testutil.Assert(t, !ok, "expected a to expire")
+	testutil.Equals(t, int64(4), cache.entries.Size())
+}
+
+func TestNewCachingBucket_InvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{TTL: 0},
+		{TTL: time.Minute, MaxCachedObjectSize: -1},
+	} {
+		_, err := NewCachingBucket(objstore.NewInMemBucket(), NewInMemoryCacheBackend("test", 10, nil), cfg, log.NewNopLogger(), nil)
+		testutil.NotOk(t, err)
+	}
+}
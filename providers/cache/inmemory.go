@@ -0,0 +1,92 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/objstore/internal/lru"
+)
+
+// InMemoryCacheBackend is a Cache which stores values in memory. The least recently used values are evicted
+// once the total size of the keys and values exceeds the configured maximum.
+type InMemoryCacheBackend struct {
+	maxSizeBytes int64
+
+	mtx     sync.Mutex
+	entries *lru.LRU[inMemoryEntry]
+
+	evictions prometheus.Counter
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type inMemoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewInMemoryCacheBackend returns a new InMemoryCacheBackend storing up to maxSizeBytes. Evictions are
+// counted and registered with reg, if not nil, labeled with the name of the cache, which has to be unique
+// among the caches registered with reg.
+func NewInMemoryCacheBackend(name string, maxSizeBytes int64, reg prometheus.Registerer) *InMemoryCacheBackend {
+	return &InMemoryCacheBackend{
+		maxSizeBytes: maxSizeBytes,
+		entries:      lru.New[inMemoryEntry](maxSizeBytes),
+		evictions: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "objstore_inmemory_cache_evictions_total",
+			Help:        "Total number of values evicted from the in-memory cache because it was full.",
+			ConstLabels: prometheus.Labels{"cache": name},
+		}),
+		now: time.Now,
+	}
+}
+
+// Get returns the value stored for the key, unless it expired.
+func (c *InMemoryCacheBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !c.now().Before(entry.expiresAt) {
+		c.entries.Remove(key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Set stores the value for the key until ttl passes. Values larger than the cache are not stored.
+func (c *InMemoryCacheBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	size := int64(len(key) + len(value))
+	if size > c.maxSizeBytes {
+		c.entries.Remove(key)
+		return nil
+	}
+	evicted := c.entries.Add(key, inMemoryEntry{value: value, expiresAt: c.now().Add(ttl)}, size)
+	c.evictions.Add(float64(len(evicted)))
+	return nil
+}
+
+// Delete removes the given keys.
+func (c *InMemoryCacheBackend) Delete(_ context.Context, keys ...string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, key := range keys {
+		c.entries.Remove(key)
+	}
+	return nil
+}
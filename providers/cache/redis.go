@@ -0,0 +1,53 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCacheBackend is a Cache which stores values in Redis, so that they can be shared between processes.
+type RedisCacheBackend struct {
+	client redis.UniversalClient
+}
+
+// NewRedisCacheBackend returns a new RedisCacheBackend using the given client.
+func NewRedisCacheBackend(client redis.UniversalClient) *RedisCacheBackend {
+	return &RedisCacheBackend{client: client}
+}
+
+// Get returns the value stored for the key.
+func (c *RedisCacheBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "get %s", key)
+	}
+	return value, true, nil
+}
+
+// Set stores the value for the key until ttl passes.
+func (c *RedisCacheBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errors.Wrapf(c.client.Set(ctx, key, value, ttl).Err(), "set %s", key)
+}
+
+// Delete removes the given keys. Each key is deleted with its own command, as the keys might be stored
+// on different nodes of a Redis cluster.
+func (c *RedisCacheBackend) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	return errors.Wrap(err, "delete keys")
+}
@@ -0,0 +1,262 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package chaos implements a bucket wrapper which injects failures and delays for testing.
+package chaos
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+// ErrInjectedFault is the cause of the errors returned for injected failures if FaultConfig.ErrorFactory is not set.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultConfig configures the failures injected by a ChaosBucket. Rates are the probability between 0 and 1
+// of an operation to fail without being passed to the wrapped bucket.
+type FaultConfig struct {
+	IterFaultRate       float64
+	GetFaultRate        float64
+	GetRangeFaultRate   float64
+	ExistsFaultRate     float64
+	AttributesFaultRate float64
+	UploadFaultRate     float64
+	DeleteFaultRate     float64
+	CopyFaultRate       float64
+
+	// ErrorFactory returns the error for an injected failure of the given operation, e.g. objstore.OpGet.
+	// If not set, the returned errors wrap ErrInjectedFault.
+	ErrorFactory func(op string) error
+	// Seed initializes the random number generator, so that the same sequence of operations fails the same
+	// way across runs. A random seed is used if it is zero.
+	Seed int64
+}
+
+func (c FaultConfig) validate() error {
+	for _, rate := range []float64{
+		c.IterFaultRate,
+		c.GetFaultRate,
+		c.GetRangeFaultRate,
+		c.ExistsFaultRate,
+		c.AttributesFaultRate,
+		c.UploadFaultRate,
+		c.DeleteFaultRate,
+		c.CopyFaultRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return errors.Errorf("fault rate %v is not between 0 and 1", rate)
+		}
+	}
+	return nil
+}
+
+// Option configures a ChaosBucket.
+type Option func(b *ChaosBucket)
+
+// WithDelay delays every operation by a random duration between min and max before passing it to
+// the wrapped bucket, to simulate a slow network.
+func WithDelay(min, max time.Duration) Option {
+	return func(b *ChaosBucket) {
+		b.minDelay = min
+		b.maxDelay = max
+	}
+}
+
+// WithOperationDelay delays every call of the given operation, e.g. objstore.OpGet, by d in addition to the
+// delay configured with WithDelay. DeleteMany is delayed as objstore.OpDelete and IterWithAttributes as
+// objstore.OpIter.
+func WithOperationDelay(op string, d time.Duration) Option {
+	return func(b *ChaosBucket) {
+		b.opDelays[op] = d
+	}
+}
+
+// WithObjectFault makes every call of the given operation for the object with the given name fail with err,
+// e.g. to always fail objstore.OpGet for one object. For Iter and IterWithAttributes, name is the listed
+// directory. DeleteMany fails if it is called for the object.
+func WithObjectFault(op, name string, err error) Option {
+	return func(b *ChaosBucket) {
+		b.objectFaults[objectFault{op: op, name: name}] = err
+	}
+}
+
+type objectFault struct {
+	op   string
+	name string
+}
+
+// ChaosBucket is a bucket wrapper which fails operations randomly according to a FaultConfig, and
+// deterministically for the objects configured with WithObjectFault.
+type ChaosBucket struct {
+	bkt objstore.Bucket
+	cfg FaultConfig
+
+	minDelay, maxDelay time.Duration
+	opDelays           map[string]time.Duration
+	objectFaults       map[objectFault]error
+
+	mtx sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewChaosBucket returns a new ChaosBucket wrapping bkt.
+func NewChaosBucket(bkt objstore.Bucket, cfg FaultConfig, opts ...Option) (*ChaosBucket, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate fault config")
+	}
+	if cfg.ErrorFactory == nil {
+		cfg.ErrorFactory = func(op string) error {
+			return errors.Wrap(ErrInjectedFault, op)
+		}
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	b := &ChaosBucket{
+		bkt:          bkt,
+		cfg:          cfg,
+		opDelays:     map[string]time.Duration{},
+		objectFaults: map[objectFault]error{},
+		rnd:          rand.New(rand.NewSource(seed)),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.maxDelay < b.minDelay {
+		return nil, errors.New("max delay must not be lower than min delay")
+	}
+	for op, d := range b.opDelays {
+		if d < 0 {
+			return nil, errors.Errorf("delay of operation %s must not be negative", op)
+		}
+	}
+	return b, nil
+}
+
+// inject delays the operation and returns an error if the operation should fail for one of the given
+// object names, or randomly.
+func (b *ChaosBucket) inject(ctx context.Context, op string, rate float64, names ...string) error {
+	b.mtx.Lock()
+	fail := b.rnd.Float64() < rate
+	delay := b.minDelay + b.opDelays[op]
+	if b.maxDelay > b.minDelay {
+		delay += time.Duration(b.rnd.Int63n(int64(b.maxDelay - b.minDelay)))
+	}
+	b.mtx.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	for _, name := range names {
+		if err, ok := b.objectFaults[objectFault{op: op, name: name}]; ok {
+			return err
+		}
+	}
+	if fail {
+		return b.cfg.ErrorFactory(op)
+	}
+	return nil
+}
+
+func (b *ChaosBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := b.inject(ctx, objstore.OpIter, b.cfg.IterFaultRate, dir); err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *ChaosBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := b.inject(ctx, objstore.OpIter, b.cfg.IterFaultRate, dir); err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *ChaosBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *ChaosBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.inject(ctx, objstore.OpGet, b.cfg.GetFaultRate, name); err != nil {
+		return nil, err
+	}
+	return b.bkt.Get(ctx, name)
+}
+
+func (b *ChaosBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.inject(ctx, objstore.OpGetRange, b.cfg.GetRangeFaultRate, name); err != nil {
+		return nil, err
+	}
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *ChaosBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.inject(ctx, objstore.OpExists, b.cfg.ExistsFaultRate, name); err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *ChaosBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	if err := b.inject(ctx, objstore.OpAttributes, b.cfg.AttributesFaultRate, name); err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *ChaosBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	if err := b.inject(ctx, objstore.OpUpload, b.cfg.UploadFaultRate, name); err != nil {
+		return err
+	}
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *ChaosBucket) Delete(ctx context.Context, name string) error {
+	if err := b.inject(ctx, objstore.OpDelete, b.cfg.DeleteFaultRate, name); err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *ChaosBucket) DeleteMany(ctx context.Context, names []string) error {
+	if err := b.inject(ctx, objstore.OpDelete, b.cfg.DeleteFaultRate, names...); err != nil {
+		return err
+	}
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *ChaosBucket) Copy(ctx context.Context, src, dst string) error {
+	if err := b.inject(ctx, objstore.OpCopy, b.cfg.CopyFaultRate, src); err != nil {
+		return err
+	}
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+func (b *ChaosBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *ChaosBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *ChaosBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *ChaosBucket) Name() string {
+	return b.bkt.Name()
+}
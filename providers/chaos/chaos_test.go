@@ -0,0 +1,142 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package chaos
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func newFilesystemBucket(t *testing.T) objstore.Bucket {
+	bkt, err := filesystem.NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+	return bkt
+}
+
+func TestChaosBucket_Acceptance(t *testing.T) {
+	bkt, err := NewChaosBucket(newFilesystemBucket(t), FaultConfig{})
+	testutil.Ok(t, err)
+	objstore.AcceptanceTest(t, bkt)
+}
+
+func TestChaosBucket_Faults(t *testing.T) {
+	ctx := context.Background()
+	fsBkt := newFilesystemBucket(t)
+	testutil.Ok(t, fsBkt.Upload(ctx, "obj", strings.NewReader("content")))
+
+	bkt, err := NewChaosBucket(fsBkt, FaultConfig{GetFaultRate: 1, UploadFaultRate: 0.5, Seed: 42})
+	testutil.Ok(t, err)
+
+	// Operations with a rate of 1 always fail, the ones without a rate never do.
+	_, err = bkt.Get(ctx, "obj")
+	testutil.Assert(t, errors.Is(err, ErrInjectedFault), "expected injected fault, got %v", err)
+	_, err = bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+
+	run := func(seed int64) []bool {
+		bkt, err := NewChaosBucket(fsBkt, FaultConfig{UploadFaultRate: 0.5, Seed: seed})
+		testutil.Ok(t, err)
+
+		var failed []bool
+		for i := 0; i < 100; i++ {
+			err := bkt.Upload(ctx, "obj", strings.NewReader("content"))
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	// The same seed fails the same operations.
+	first := run(42)
+	testutil.Equals(t, first, run(42))
+
+	failures := 0
+	for _, f := range first {
+		if f {
+			failures++
+		}
+	}
+	testutil.Assert(t, failures > 25 && failures < 75, "expected about half of the uploads to fail, got %d", failures)
+}
+
+func TestChaosBucket_ErrorFactory(t *testing.T) {
+	errCustom := errors.New("custom")
+	bkt, err := NewChaosBucket(newFilesystemBucket(t), FaultConfig{
+		DeleteFaultRate: 1,
+		ErrorFactory: func(op string) error {
+			testutil.Equals(t, objstore.OpDelete, op)
+			return errCustom
+		},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, errCustom, bkt.Delete(context.Background(), "obj"))
+}
+
+func TestChaosBucket_Delay(t *testing.T) {
+	bkt, err := NewChaosBucket(newFilesystemBucket(t), FaultConfig{}, WithDelay(50*time.Millisecond, 100*time.Millisecond))
+	testutil.Ok(t, err)
+
+	start := time.Now()
+	_, err = bkt.Exists(context.Background(), "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, time.Since(start) >= 50*time.Millisecond, "expected operation to be delayed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = bkt.Exists(ctx, "obj")
+	testutil.Equals(t, context.Canceled, err)
+}
+
+func TestChaosBucket_ObjectFaults(t *testing.T) {
+	ctx := context.Background()
+	errUnavailable := errors.New("503 service unavailable")
+	inner := objstore.NewInMemBucket()
+	testutil.Ok(t, inner.Upload(ctx, "a", strings.NewReader("a")))
+	testutil.Ok(t, inner.Upload(ctx, "b", strings.NewReader("b")))
+
+	bkt, err := NewChaosBucket(inner, FaultConfig{},
+		WithObjectFault(objstore.OpGet, "a", errUnavailable),
+		WithObjectFault(objstore.OpDelete, "b", errUnavailable),
+		WithOperationDelay(objstore.OpExists, 50*time.Millisecond),
+	)
+	testutil.Ok(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = bkt.Get(ctx, "a")
+		testutil.Equals(t, errUnavailable, err)
+	}
+	rc, err := bkt.Get(ctx, "b")
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	rc, err = bkt.GetRange(ctx, "a", 0, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+
+	testutil.Equals(t, errUnavailable, bkt.DeleteMany(ctx, []string{"a", "b"}))
+	testutil.Equals(t, 2, len(inner.Objects()))
+
+	start := time.Now()
+	_, err = bkt.Exists(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, time.Since(start) >= 50*time.Millisecond, "expected exists to be delayed")
+	start = time.Now()
+	_, err = bkt.Attributes(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, time.Since(start) < 50*time.Millisecond, "expected attributes not to be delayed")
+}
+
+func TestNewChaosBucket_InvalidConfig(t *testing.T) {
+	_, err := NewChaosBucket(newFilesystemBucket(t), FaultConfig{GetFaultRate: 1.5})
+	testutil.NotOk(t, err)
+	_, err = NewChaosBucket(newFilesystemBucket(t), FaultConfig{}, WithDelay(time.Second, time.Millisecond))
+	testutil.NotOk(t, err)
+	_, err = NewChaosBucket(newFilesystemBucket(t), FaultConfig{}, WithOperationDelay(objstore.OpGet, -time.Second))
+	testutil.NotOk(t, err)
+}
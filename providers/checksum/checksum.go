@@ -0,0 +1,172 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package checksum implements a bucket wrapper which verifies the checksums of downloaded objects.
+package checksum
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+// maxGetAttempts is the number of times Get reads an object which is replaced while it is read, before giving up.
+const maxGetAttempts = 3
+
+// ChecksumBucket is a bucket wrapper which verifies the content of objects read with Get against the MD5 and
+// CRC32C checksums reported by Attributes, for providers which report them, e.g. GCS and Azure. A mismatch is
+// returned as an error for which objstore.IsChecksumMismatchErr returns true, once the content was read
+// completely and again by Close. Objects for which no checksum is reported, objects stored with the gzip content
+// encoding, which GCS decompresses when reading them, and ranges read with GetRange are not verified.
+//
+// Every Get requests the attributes of the object as well. The read is pinned to the version the checksums belong
+// to if the bucket reports versions and implements objstore.Versioned, e.g. GCS. Otherwise, the attributes are
+// requested again after the read started, and the object is read again if it was replaced in between.
+type ChecksumBucket struct {
+	bkt objstore.Bucket
+}
+
+// NewChecksumBucket returns a new ChecksumBucket verifying the objects read from bkt.
+func NewChecksumBucket(bkt objstore.Bucket) *ChecksumBucket {
+	return &ChecksumBucket{bkt: bkt}
+}
+
+// Get returns a reader for the given object name, which verifies the checksums of the object once its content
+// was read completely.
+func (b *ChecksumBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	var err error
+	for i := 0; i < maxGetAttempts; i++ {
+		var (
+			rc       io.ReadCloser
+			replaced bool
+		)
+		if rc, replaced, err = b.get(ctx, name); !replaced {
+			return rc, err
+		}
+	}
+	return nil, err
+}
+
+// get returns a reader verifying the checksums of the object. It returns replaced set to true if the object was
+// replaced between reading its attributes and its content.
+func (b *ChecksumBucket) get(ctx context.Context, name string) (_ io.ReadCloser, replaced bool, _ error) {
+	attrs, err := b.bkt.Attributes(ctx, name)
+	if err != nil {
+		if !b.bkt.IsObjNotFoundErr(err) {
+			return nil, false, err
+		}
+		// Let Get report why the object can't be read, e.g. because its name is invalid.
+		rc, getErr := b.bkt.Get(ctx, name)
+		if getErr != nil {
+			return nil, false, getErr
+		}
+		// The object was created in the meantime.
+		_ = rc.Close()
+		return nil, true, err
+	}
+	if !verifiable(attrs) {
+		rc, err := b.bkt.Get(ctx, name)
+		return rc, false, err
+	}
+
+	if attrs.VersionID != "" {
+		rc, err := objstore.GetVersion(ctx, b.bkt, name, attrs.VersionID)
+		if err == nil {
+			return objstore.NewChecksumVerifyingReader(rc, attrs), false, nil
+		}
+		if !errors.Is(err, objstore.ErrVersioningNotSupported) {
+			// The version is gone if the object was replaced in a bucket without versioning.
+			return nil, b.bkt.IsObjNotFoundErr(err), err
+		}
+	}
+
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+	// The read started between both requests, so it returns the version of the attributes if they didn't change.
+	current, err := b.bkt.Attributes(ctx, name)
+	if err != nil {
+		_ = rc.Close()
+		return nil, b.bkt.IsObjNotFoundErr(err), err
+	}
+	if !sameVersion(attrs, current) {
+		_ = rc.Close()
+		return nil, true, errors.Errorf("object %s was replaced while reading it", name)
+	}
+	return objstore.NewChecksumVerifyingReader(rc, attrs), false, nil
+}
+
+// verifiable returns true if the content returned by Get can be verified against the checksums in attrs.
+func verifiable(attrs objstore.ObjectAttributes) bool {
+	if attrs.MD5 == nil && attrs.CRC32C == nil {
+		return false
+	}
+	// The checksums belong to the compressed content, but GCS serves it decompressed (decompressive transcoding).
+	return !strings.EqualFold(attrs.ContentEncoding, "gzip")
+}
+
+// sameVersion returns true if both attributes describe the same version of an object.
+func sameVersion(a, b objstore.ObjectAttributes) bool {
+	return a.ETag == b.ETag && a.VersionID == b.VersionID && a.Size == b.Size && a.LastModified.Equal(b.LastModified)
+}
+
+func (b *ChecksumBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *ChecksumBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *ChecksumBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *ChecksumBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *ChecksumBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *ChecksumBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *ChecksumBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *ChecksumBucket) Delete(ctx context.Context, name string) error {
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *ChecksumBucket) DeleteMany(ctx context.Context, names []string) error {
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *ChecksumBucket) Copy(ctx context.Context, src, dst string) error {
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+func (b *ChecksumBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *ChecksumBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *ChecksumBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *ChecksumBucket) Name() string {
+	return b.bkt.Name()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package checksum
+
+import (
+	"context"
+	"crypto/md5"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+
+	"github.com/thanos-io/objstore"
+)
+
+// corruptingBucket flips the first byte of the content returned by Get.
+type corruptingBucket struct {
+	objstore.Bucket
+}
+
+func (b corruptingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > 0 {
+		content[0] ^= 0xff
+	}
+	return io.NopCloser(strings.NewReader(string(content))), nil
+}
+
+// replacingBucket replaces the object once after Get returned its content.
+type replacingBucket struct {
+	objstore.Bucket
+	replaced bool
+}
+
+func (b *replacingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil || b.replaced {
+		return rc, err
+	}
+	b.replaced = true
+	if err := b.Bucket.Upload(ctx, name, strings.NewReader("replaced")); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func TestChecksumBucket_Acceptance(t *testing.T) {
+	objstore.AcceptanceTest(t, NewChecksumBucket(objstore.NewInMemBucket()))
+}
+
+func TestChecksumBucket(t *testing.T) {
+	ctx := context.Background()
+	inner := objstore.NewInMemBucket()
+	testutil.Ok(t, inner.Upload(ctx, "obj", strings.NewReader("content")))
+
+	rc, err := NewChecksumBucket(inner).Get(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "content", string(content))
+	testutil.Ok(t, rc.Close())
+
+	rc, err = NewChecksumBucket(corruptingBucket{Bucket: inner}).Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = io.ReadAll(rc)
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(err), "expected checksum mismatch, got %v", err)
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(rc.Close()), "expected Close to report the mismatch again")
+
+	// Streams which weren't read completely aren't verified.
+	rc, err = NewChecksumBucket(corruptingBucket{Bucket: inner}).Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = rc.Read(make([]byte, 3))
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+
+	// Objects which are replaced while they are read are read again.
+	rc, err = NewChecksumBucket(&replacingBucket{Bucket: inner}).Get(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err = io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "replaced", string(content))
+	testutil.Ok(t, rc.Close())
+
+	// Objects stored with the gzip content encoding aren't verified, as GCS decompresses them when reading them.
+	testutil.Ok(t, inner.Upload(ctx, "obj.gz", strings.NewReader("content"), objstore.WithContentEncoding("gzip")))
+	rc, err = NewChecksumBucket(corruptingBucket{Bucket: inner}).Get(ctx, "obj.gz")
+	testutil.Ok(t, err)
+	_, err = io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+}
+
+func TestUploadChecksums(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	md5Sum := md5.Sum([]byte("content"))
+	crc32cSum := crc32.Checksum([]byte("content"), crc32.MakeTable(crc32.Castagnoli))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithMD5(md5Sum[:]), objstore.WithCRC32C(crc32cSum)))
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, md5Sum[:], attrs.MD5)
+	testutil.Equals(t, crc32cSum, *attrs.CRC32C)
+
+	err = bkt.Upload(ctx, "obj", strings.NewReader("corrupted"), objstore.WithMD5(md5Sum[:]))
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(err), "expected checksum mismatch, got %v", err)
+	err = bkt.Upload(ctx, "obj", strings.NewReader("corrupted"), objstore.WithCRC32C(crc32cSum))
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(err), "expected checksum mismatch, got %v", err)
+}
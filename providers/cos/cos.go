@@ -151,7 +151,9 @@ func (b *Bucket) Name() string {
 }
 
 // Attributes returns information about the specified object.
-func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+func (b *Bucket) Attributes(ctx context.Context, name string) (_ objstore.ObjectAttributes, err error) {
+	defer func() { err = wrapErr(objstore.OpAttributes, name, err) }()
+
 	resp, err := b.client.Object.Head(ctx, name, nil)
 	if err != nil {
 		return objstore.ObjectAttributes{}, err
@@ -172,6 +174,7 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 	return objstore.ObjectAttributes{
 		Size:         size,
 		LastModified: mod,
+		ETag:         clientutil.ParseETag(resp.Header),
 	}, nil
 }
 
@@ -197,7 +200,13 @@ func (r fixedLengthReader) Size() int64 {
 }
 
 // Upload the contents of the reader as an object into the bucket.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+
 	size, err := objstore.TryToGetSize(r)
 	if err != nil {
 		return errors.Wrapf(err, "getting size of %s", name)
@@ -262,21 +271,44 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 // Delete removes the object with the given name.
 func (b *Bucket) Delete(ctx context.Context, name string) error {
 	if _, err := b.client.Object.Delete(ctx, name); err != nil {
-		return errors.Wrap(err, "delete cos object")
+		return wrapErr(objstore.OpDelete, name, errors.Wrap(err, "delete cos object"))
 	}
 	return nil
 }
 
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	srcURL := fmt.Sprintf("%s/%s", b.client.BaseURL.BucketURL.Host, src)
+	if _, _, err := b.client.Object.Copy(ctx, dst, srcURL, nil); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy cos object %s to %s", src, dst))
+	}
+	return nil
+}
+
+// SupportedCopy returns true as COS copies objects server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
+}
+
 // Iter calls f for each entry in the given directory (not recursive.). The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, dirDelim) + dirDelim
 	}
 
 	for object := range b.listObjects(ctx, dir, options...) {
 		if object.err != nil {
-			return object.err
+			return wrapErr(objstore.OpIter, dir, object.err)
 		}
 		if object.key == "" {
 			continue
@@ -289,6 +321,20 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	return nil
 }
 
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	return b.Iter(ctx, dir, func(name string) error {
+		return f(objstore.IterObjectAttributes{Name: name})
+	}, options...)
+}
+
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive}
+}
+
 func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	if name == "" {
 		return nil, errors.New("given object name should not empty")
@@ -330,12 +376,14 @@ func (o objectSizerReadCloser) ObjectSize() (int64, error) {
 
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, 0, -1)
+	r, err := b.getRange(ctx, name, 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
 }
 
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, off, length)
+	r, err := b.getRange(ctx, name, off, length)
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 // Exists checks if the given object exists in the bucket.
@@ -344,12 +392,36 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "head cos object")
+		return false, wrapErr(objstore.OpExists, name, errors.Wrap(err, "head cos object"))
 	}
 
 	return true, nil
 }
 
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the COS error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	cosErr, ok := errors.Cause(err).(*cos.ErrorResponse)
+	if !ok {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	kind := objstore.ErrKindUnknown
+	if cosErr.Response != nil {
+		kind = objstore.ErrorKindFromHTTPStatus(cosErr.Response.StatusCode)
+	}
+	switch cosErr.Code {
+	case "NoSuchKey", "NoSuchBucket":
+		kind = objstore.ErrKindNotFound
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		kind = objstore.ErrKindPermissionDenied
+	case "SlowDown":
+		kind = objstore.ErrKindRateLimit
+	case "PreconditionFailed":
+		kind = objstore.ErrKindPreconditionFailed
+	}
+	return objstore.NewBucketError(op, name, cosErr.Code, kind, err)
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	switch tmpErr := errors.Cause(err).(type) {
@@ -0,0 +1,557 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package diskcache implements a bucket wrapper which caches the content of objects in a local directory.
+package diskcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/internal/lru"
+)
+
+const (
+	cacheFileSuffix = ".cache"
+	tmpFilePattern  = "download-*.tmp"
+
+	// numLocks is the number of locks the cached files are spread over.
+	numLocks = 64
+)
+
+// Config configures a DiskCacheBucket.
+type Config struct {
+	// Dir is the directory the cached objects are stored in. Cached objects found in it on start are reused.
+	Dir string
+	// MaxBytes is the maximum total size of the cached objects. The least recently used objects are removed
+	// once it is exceeded. Larger objects are not cached.
+	MaxBytes int64
+	// TTL is the time after which a cached object is downloaded again, so that changes by other clients are
+	// seen. Cached objects don't expire if it is zero.
+	TTL time.Duration
+}
+
+func (c Config) validate() error {
+	if c.Dir == "" {
+		return errors.New("directory must not be empty")
+	}
+	if c.MaxBytes <= 0 {
+		return errors.New("max bytes must be positive")
+	}
+	if c.TTL < 0 {
+		return errors.New("TTL must not be negative")
+	}
+	return nil
+}
+
+type entry struct {
+	key     string
+	size    int64
+	created time.Time
+}
+
+// DiskCacheBucket is a bucket wrapper which caches the content of objects returned by Get in a local directory.
+// Get and GetRange of cached objects are served from disk, GetRange of objects which aren't cached is passed
+// through to the wrapped bucket without caching the object. Writes and deletes through the DiskCacheBucket
+// remove the object from the cache, changes by other clients are only seen once the cached object expires.
+// See the cache package for caching attributes and listings, and objstore.WrapWithCache for caching small
+// objects in memory.
+type DiskCacheBucket struct {
+	bkt    objstore.Bucket
+	cfg    Config
+	logger log.Logger
+
+	// locks serialize reading, replacing and removing the cached file of an object, by a hash of its name.
+	locks [numLocks]sync.RWMutex
+
+	// mtx guards the index of cached files. It is never held while waiting for one of locks.
+	mtx     sync.Mutex
+	entries *lru.LRU[entry]
+	// downloads holds the objects being downloaded by Get, so that downloads which overlap with a change of the
+	// object are not cached.
+	downloads map[string]*download
+
+	hits       prometheus.Counter
+	misses     prometheus.Counter
+	sizeBytes  prometheus.Gauge
+	numEntries prometheus.Gauge
+}
+
+// NewDiskCacheBucket returns a new DiskCacheBucket wrapping bkt. The cache size and cache hits and misses,
+// from which the hit rate is derived, are registered with reg, if not nil.
+func NewDiskCacheBucket(bkt objstore.Bucket, cfg Config, logger log.Logger, reg prometheus.Registerer) (*DiskCacheBucket, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate disk cache config")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0750); err != nil {
+		return nil, errors.Wrap(err, "create cache directory")
+	}
+
+	b := &DiskCacheBucket{
+		bkt:       bkt,
+		cfg:       cfg,
+		logger:    logger,
+		entries:   lru.New[entry](cfg.MaxBytes),
+		downloads: map[string]*download{},
+		hits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "objstore_disk_cache_bucket_hits_total",
+			Help:        "Total number of Get and GetRange operations against a bucket served from the disk cache.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}),
+		misses: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "objstore_disk_cache_bucket_misses_total",
+			Help:        "Total number of Get and GetRange operations against a bucket which were not cached on disk.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}),
+		sizeBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "objstore_disk_cache_bucket_size_bytes",
+			Help:        "Total size of the objects of a bucket cached on disk.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}),
+		numEntries: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "objstore_disk_cache_bucket_entries",
+			Help:        "Number of objects of a bucket cached on disk.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}),
+	}
+	if err := b.load(); err != nil {
+		return nil, errors.Wrap(err, "load cache directory")
+	}
+	return b, nil
+}
+
+// load adds the cached files found in the cache directory to the index, and removes incomplete downloads.
+func (b *DiskCacheBucket) load() error {
+	dirEntries, err := os.ReadDir(b.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	var loaded []entry
+	for _, de := range dirEntries {
+		name := de.Name()
+		if ok, _ := filepath.Match(tmpFilePattern, name); ok {
+			if err := os.Remove(filepath.Join(b.cfg.Dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if de.IsDir() || !strings.HasSuffix(name, cacheFileSuffix) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, entry{key: strings.TrimSuffix(name, cacheFileSuffix), size: info.Size(), created: info.ModTime()})
+	}
+
+	// Add the most recently written files last, so that they are evicted last.
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].created.Before(loaded[j].created) })
+	for _, e := range loaded {
+		b.removeFiles(b.add(e))
+	}
+	return nil
+}
+
+// cacheKey returns the key of the cached file of the object with the given name.
+func cacheKey(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *DiskCacheBucket) lock(key string) *sync.RWMutex {
+	h, _ := hex.DecodeString(key[:2])
+	return &b.locks[int(h[0])%numLocks]
+}
+
+func (b *DiskCacheBucket) path(key string) string {
+	return filepath.Join(b.cfg.Dir, key+cacheFileSuffix)
+}
+
+// lookup returns the cached entry for the key, if any, and marks it as recently used.
+// Expired entries are removed from the index and returned as keys to remove the files of.
+func (b *DiskCacheBucket) lookup(key string) (entry, bool, []string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	e, ok := b.entries.Get(key)
+	if !ok {
+		return entry{}, false, nil
+	}
+	if b.cfg.TTL > 0 && time.Since(e.created) > b.cfg.TTL {
+		b.removeLocked(key)
+		return entry{}, false, []string{key}
+	}
+	return e, true, nil
+}
+
+// add adds the entry to the index and returns the keys of the entries evicted to make space for it.
+func (b *DiskCacheBucket) add(e entry) []string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	evicted := b.entries.Add(e.key, e, e.size)
+	b.updateGaugesLocked()
+	return evicted
+}
+
+// remove removes the entry from the index and reports whether it was cached.
+func (b *DiskCacheBucket) remove(key string) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.removeLocked(key)
+}
+
+func (b *DiskCacheBucket) removeLocked(key string) bool {
+	if !b.entries.Remove(key) {
+		return false
+	}
+	b.updateGaugesLocked()
+	return true
+}
+
+func (b *DiskCacheBucket) updateGaugesLocked() {
+	b.sizeBytes.Set(float64(b.entries.Size()))
+	b.numEntries.Set(float64(b.entries.Len()))
+}
+
+// removeFiles removes the cached files of the given keys which are not in the index anymore.
+func (b *DiskCacheBucket) removeFiles(keys []string) {
+	for _, key := range keys {
+		l := b.lock(key)
+		l.Lock()
+		b.mtx.Lock()
+		readded := b.entries.Contains(key)
+		b.mtx.Unlock()
+		if !readded {
+			if err := os.Remove(b.path(key)); err != nil && !os.IsNotExist(err) {
+				level.Warn(b.logger).Log("msg", "failed to remove cached file", "err", err)
+			}
+		}
+		l.Unlock()
+	}
+}
+
+// download tracks the concurrent downloads of an object. Its generation is increased each time the object is
+// invalidated, so that downloads which started before can't cache stale content.
+type download struct {
+	refs       int
+	generation uint64
+}
+
+// startDownload registers a download of the object with the given key and returns the current generation of
+// the object, which is passed to commit.
+func (b *DiskCacheBucket) startDownload(key string) uint64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	d, ok := b.downloads[key]
+	if !ok {
+		d = &download{}
+		b.downloads[key] = d
+	}
+	d.refs++
+	return d.generation
+}
+
+// finishDownload unregisters a download started with startDownload.
+func (b *DiskCacheBucket) finishDownload(key string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	d := b.downloads[key]
+	if d.refs--; d.refs == 0 {
+		delete(b.downloads, key)
+	}
+}
+
+// invalidate removes the cached objects with the given names and prevents running downloads of them from
+// being cached.
+func (b *DiskCacheBucket) invalidate(names ...string) {
+	keys := make([]string, 0, len(names))
+	b.mtx.Lock()
+	for _, name := range names {
+		key := cacheKey(name)
+		if d, ok := b.downloads[key]; ok {
+			d.generation++
+		}
+		if b.removeLocked(key) {
+			keys = append(keys, key)
+		}
+	}
+	b.mtx.Unlock()
+	b.removeFiles(keys)
+}
+
+// open opens the cached file of the object, if it is cached.
+func (b *DiskCacheBucket) open(name string) (*os.File, entry, bool) {
+	key := cacheKey(name)
+	l := b.lock(key)
+	l.RLock()
+	e, ok, expired := b.lookup(key)
+	var (
+		f   *os.File
+		err error
+	)
+	if ok {
+		f, err = os.Open(b.path(key))
+	}
+	l.RUnlock()
+	b.removeFiles(expired)
+
+	if !ok {
+		return nil, entry{}, false
+	}
+	if err != nil {
+		level.Warn(b.logger).Log("msg", "failed to open cached file", "name", name, "err", err)
+		b.invalidate(name)
+		return nil, entry{}, false
+	}
+	return f, e, true
+}
+
+// Get returns the cached content of the object, or streams the object from the wrapped bucket while writing it to
+// the cache directory. The object is cached once it was read completely, unless it is larger than
+// Config.MaxBytes or it was changed through the DiskCacheBucket in the meantime.
+func (b *DiskCacheBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if f, e, ok := b.open(name); ok {
+		b.hits.Inc()
+		return &fileReader{Reader: f, f: f, size: e.size}, nil
+	}
+	b.misses.Inc()
+
+	key := cacheKey(name)
+	generation := b.startDownload(key)
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		b.finishDownload(key)
+		return nil, err
+	}
+	size, sizeErr := objstore.TryToGetSize(rc)
+	if sizeErr == nil && size > b.cfg.MaxBytes {
+		b.finishDownload(key)
+		return rc, nil
+	}
+
+	tmp, err := os.CreateTemp(b.cfg.Dir, tmpFilePattern)
+	if err != nil {
+		b.finishDownload(key)
+		level.Warn(b.logger).Log("msg", "failed to create cache file", "name", name, "err", err)
+		return rc, nil
+	}
+	return &cachingReader{b: b, name: name, key: key, generation: generation, rc: rc, tmp: tmp, size: size, sizeErr: sizeErr}, nil
+}
+
+// commit moves the downloaded file into place, unless the object was invalidated since the download started.
+func (b *DiskCacheBucket) commit(key string, tmp *os.File, size int64, generation uint64) error {
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	l := b.lock(key)
+	l.Lock()
+	if err := os.Rename(tmp.Name(), b.path(key)); err != nil {
+		l.Unlock()
+		return err
+	}
+
+	b.mtx.Lock()
+	if b.downloads[key].generation != generation {
+		b.mtx.Unlock()
+		err := os.Remove(b.path(key))
+		l.Unlock()
+		return err
+	}
+	b.mtx.Unlock()
+	evicted := b.add(entry{key: key, size: size, created: time.Now()})
+	l.Unlock()
+
+	b.removeFiles(evicted)
+	return nil
+}
+
+// discard closes and removes the temporary file of a download.
+func (b *DiskCacheBucket) discard(tmp *os.File) {
+	_ = tmp.Close()
+	if err := os.Remove(tmp.Name()); err != nil && !os.IsNotExist(err) {
+		level.Warn(b.logger).Log("msg", "failed to remove temporary file", "err", err)
+	}
+}
+
+// fileReader reads a cached file.
+type fileReader struct {
+	io.Reader
+	f    *os.File
+	size int64
+}
+
+func (r *fileReader) ObjectSize() (int64, error) {
+	return r.size, nil
+}
+
+func (r *fileReader) Close() error {
+	return r.f.Close()
+}
+
+// cachingReader reads an object from the wrapped bucket and writes it to a temporary file, which is committed
+// to the cache once the object was read completely. Objects which turn out to be larger than Config.MaxBytes
+// or fail to be written are read without caching them.
+type cachingReader struct {
+	b          *DiskCacheBucket
+	name, key  string
+	generation uint64
+	rc         io.ReadCloser
+
+	// tmp is nil once the object is not cached anymore.
+	tmp     *os.File
+	written int64
+
+	size    int64
+	sizeErr error
+	closed  bool
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if r.tmp == nil {
+		return n, err
+	}
+	if r.written += int64(n); r.written > r.b.cfg.MaxBytes {
+		r.b.discard(r.tmp)
+		r.tmp = nil
+		return n, err
+	}
+	if _, werr := r.tmp.Write(p[:n]); werr != nil {
+		level.Warn(r.b.logger).Log("msg", "failed to write cache file", "name", r.name, "err", werr)
+		r.b.discard(r.tmp)
+		r.tmp = nil
+		return n, err
+	}
+	if err == io.EOF {
+		if cerr := r.b.commit(r.key, r.tmp, r.written, r.generation); cerr != nil {
+			level.Warn(r.b.logger).Log("msg", "failed to cache object", "name", r.name, "err", cerr)
+			r.b.discard(r.tmp)
+		}
+		r.tmp = nil
+	}
+	return n, err
+}
+
+func (r *cachingReader) ObjectSize() (int64, error) {
+	return r.size, r.sizeErr
+}
+
+func (r *cachingReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.tmp != nil {
+		r.b.discard(r.tmp)
+		r.tmp = nil
+	}
+	r.b.finishDownload(r.key)
+	return r.rc.Close()
+}
+
+// GetRange returns the given range of the cached object, or of the object in the wrapped bucket if it is
+// not cached.
+func (b *DiskCacheBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	f, e, ok := b.open(name)
+	if !ok {
+		b.misses.Inc()
+		return b.bkt.GetRange(ctx, name, off, length)
+	}
+	b.hits.Inc()
+
+	if off < 0 {
+		if length != -1 {
+			_ = f.Close()
+			return nil, errors.Errorf("suffix range requires length -1, got %d", length)
+		}
+		off += e.size
+		if off < 0 {
+			off = 0
+		}
+	}
+	if off > e.size {
+		off = e.size
+	}
+	if length < 0 || off+length > e.size {
+		length = e.size - off
+	}
+	return &fileReader{Reader: io.NewSectionReader(f, off, length), f: f, size: length}, nil
+}
+
+func (b *DiskCacheBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *DiskCacheBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *DiskCacheBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *DiskCacheBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *DiskCacheBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *DiskCacheBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	defer b.invalidate(name)
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *DiskCacheBucket) Delete(ctx context.Context, name string) error {
+	defer b.invalidate(name)
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *DiskCacheBucket) DeleteMany(ctx context.Context, names []string) error {
+	defer b.invalidate(names...)
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *DiskCacheBucket) Copy(ctx context.Context, src, dst string) error {
+	defer b.invalidate(dst)
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+func (b *DiskCacheBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *DiskCacheBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+// Close closes the wrapped bucket. The cached files are kept to be reused.
+func (b *DiskCacheBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *DiskCacheBucket) Name() string {
+	return b.bkt.Name()
+}
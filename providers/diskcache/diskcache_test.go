@@ -0,0 +1,192 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package diskcache
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/objstore"
+)
+
+// countingBucket counts the calls to Get and hides the size of the returned readers.
+type countingBucket struct {
+	objstore.Bucket
+	gets atomic.Int64
+}
+
+func (b *countingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.gets.Inc()
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ io.ReadCloser }{rc}, nil
+}
+
+// contentReader returns a function reading the content of the stream returned by Get or GetRange.
+func contentReader(t *testing.T) func(io.ReadCloser, error) string {
+	return func(rc io.ReadCloser, err error) string {
+		t.Helper()
+
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, rc.Close()) }()
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		return string(content)
+	}
+}
+
+func cachedFiles(t *testing.T, dir string) int {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+cacheFileSuffix))
+	testutil.Ok(t, err)
+	return len(files)
+}
+
+func TestDiskCacheBucket_Acceptance(t *testing.T) {
+	bkt, err := NewDiskCacheBucket(objstore.NewInMemBucket(), Config{Dir: t.TempDir(), MaxBytes: 1024}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	objstore.AcceptanceTest(t, bkt)
+}
+
+func TestDiskCacheBucket(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	inner := &countingBucket{Bucket: objstore.NewInMemBucket()}
+	readAll := contentReader(t)
+	bkt, err := NewDiskCacheBucket(inner, Config{Dir: dir, MaxBytes: 10}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+	testutil.Equals(t, "aaaa", readAll(bkt.Get(ctx, "a")))
+	testutil.Equals(t, "aaaa", readAll(bkt.Get(ctx, "a")))
+	testutil.Equals(t, int64(1), inner.gets.Load())
+	testutil.Equals(t, 1, cachedFiles(t, dir))
+
+	// Ranges of cached objects are read from disk.
+	testutil.Equals(t, "aa", readAll(bkt.GetRange(ctx, "a", 1, 2)))
+	testutil.Equals(t, "aaa", readAll(bkt.GetRange(ctx, "a", 1, -1)))
+	testutil.Equals(t, "a", readAll(bkt.GetRange(ctx, "a", -1, -1)))
+	testutil.Equals(t, int64(1), inner.gets.Load())
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.hits))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.misses))
+
+	// Uploads invalidate the cached object.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("bbbb")))
+	testutil.Equals(t, 0, cachedFiles(t, dir))
+	testutil.Equals(t, "bbbb", readAll(bkt.Get(ctx, "a")))
+	testutil.Equals(t, int64(2), inner.gets.Load())
+
+	// Objects larger than the cache are streamed without caching them.
+	testutil.Ok(t, bkt.Upload(ctx, "large", strings.NewReader(strings.Repeat("l", 20))))
+	testutil.Equals(t, strings.Repeat("l", 20), readAll(bkt.Get(ctx, "large")))
+	testutil.Equals(t, 1, cachedFiles(t, dir))
+
+	// Caching b and c evicts the least recently used object a.
+	testutil.Ok(t, bkt.Upload(ctx, "b", strings.NewReader("bbbb")))
+	testutil.Ok(t, bkt.Upload(ctx, "c", strings.NewReader("cccc")))
+	readAll(bkt.Get(ctx, "b"))
+	readAll(bkt.Get(ctx, "c"))
+	testutil.Equals(t, 2, cachedFiles(t, dir))
+	testutil.Equals(t, float64(8), promtest.ToFloat64(bkt.sizeBytes))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.numEntries))
+	_, err = os.Stat(bkt.path(cacheKey("a")))
+	testutil.Assert(t, os.IsNotExist(err), "expected a to be evicted")
+
+	// Deletes invalidate the cached object.
+	testutil.Ok(t, bkt.Delete(ctx, "b"))
+	_, err = bkt.Get(ctx, "b")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+	testutil.Equals(t, 1, cachedFiles(t, dir))
+
+	// Cached objects are reused after a restart.
+	inner.gets.Store(0)
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "download-123.tmp"), []byte("partial"), 0600))
+	bkt, err = NewDiskCacheBucket(inner, Config{Dir: dir, MaxBytes: 10}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "cccc", readAll(bkt.Get(ctx, "c")))
+	testutil.Equals(t, int64(0), inner.gets.Load())
+	_, err = os.Stat(filepath.Join(dir, "download-123.tmp"))
+	testutil.Assert(t, os.IsNotExist(err), "expected incomplete download to be removed")
+}
+
+func TestDiskCacheBucket_ConcurrentInvalidation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	inner := &countingBucket{Bucket: objstore.NewInMemBucket()}
+	readAll := contentReader(t)
+	bkt, err := NewDiskCacheBucket(inner, Config{Dir: dir, MaxBytes: 10}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+
+	// The object is returned before it was downloaded completely.
+	rc, err := bkt.Get(ctx, "a")
+	testutil.Ok(t, err)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(rc, buf)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, cachedFiles(t, dir))
+
+	// The object changes while it is downloaded, so the stale content must not be cached.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("bbbb")))
+	testutil.Equals(t, "aaaa", string(buf)+readAll(rc, nil))
+	testutil.Equals(t, 0, cachedFiles(t, dir))
+
+	testutil.Equals(t, "bbbb", readAll(bkt.Get(ctx, "a")))
+	testutil.Equals(t, 1, cachedFiles(t, dir))
+	testutil.Equals(t, "bbbb", readAll(bkt.Get(ctx, "a")))
+	testutil.Equals(t, int64(2), inner.gets.Load())
+
+	// Objects read partially are not cached.
+	testutil.Ok(t, bkt.Delete(ctx, "a"))
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("cccc")))
+	rc, err = bkt.Get(ctx, "a")
+	testutil.Ok(t, err)
+	_, err = io.ReadFull(rc, buf)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, 0, cachedFiles(t, dir))
+	testutil.Equals(t, 0, len(bkt.downloads))
+}
+
+func TestDiskCacheBucket_TTL(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingBucket{Bucket: objstore.NewInMemBucket()}
+	readAll := contentReader(t)
+	bkt, err := NewDiskCacheBucket(inner, Config{Dir: t.TempDir(), MaxBytes: 10, TTL: 50 * time.Millisecond}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaa")))
+	readAll(bkt.Get(ctx, "a"))
+	readAll(bkt.Get(ctx, "a"))
+	testutil.Equals(t, int64(1), inner.gets.Load())
+
+	time.Sleep(100 * time.Millisecond)
+	readAll(bkt.Get(ctx, "a"))
+	testutil.Equals(t, int64(2), inner.gets.Load())
+}
+
+func TestNewDiskCacheBucket_InvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{MaxBytes: 10},
+		{Dir: t.TempDir()},
+		{Dir: t.TempDir(), MaxBytes: 10, TTL: -time.Second},
+	} {
+		_, err := NewDiskCacheBucket(objstore.NewInMemBucket(), cfg, log.NewNopLogger(), nil)
+		testutil.NotOk(t, err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package failover implements a bucket wrapper which falls back to a secondary bucket for failed reads.
+package failover
+
+import (
+	"context"
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/retry"
+)
+
+const (
+	backendPrimary   = "primary"
+	backendSecondary = "secondary"
+)
+
+// Config configures a FailoverBucket.
+type Config struct {
+	// IsFailoverErr decides whether a read failing against the primary bucket is retried against the secondary
+	// one. By default, reads fail over for errors for which retry.IsTransientErr returns true, e.g. HTTP 5xx
+	// responses. Reads of objects which don't exist in the primary bucket always fail over.
+	IsFailoverErr func(err error) bool
+}
+
+// FailoverBucket is a bucket wrapper which reads objects from a primary bucket, and from a secondary bucket if
+// the object doesn't exist in the primary one or reading it failed with a transient error, e.g. for buckets
+// replicated across regions. Only Get, GetRange, Exists and Attributes fail over: iterations and writes only
+// go to the primary bucket. To write to both buckets, wrap a mirror.MirrorBucket as the primary bucket.
+// Streams which fail after they were opened are not failed over.
+type FailoverBucket struct {
+	primary   objstore.Bucket
+	secondary objstore.Bucket
+	cfg       Config
+
+	reads *prometheus.CounterVec
+}
+
+// NewFailoverBucket returns a new FailoverBucket reading from primary, and from secondary on failures.
+// Successful reads are counted per operation and bucket which served them, and registered with reg, if not nil.
+func NewFailoverBucket(primary, secondary objstore.Bucket, cfg Config, reg prometheus.Registerer) *FailoverBucket {
+	if cfg.IsFailoverErr == nil {
+		cfg.IsFailoverErr = retry.IsTransientErr
+	}
+
+	b := &FailoverBucket{
+		primary:   primary,
+		secondary: secondary,
+		cfg:       cfg,
+		reads: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_failover_bucket_reads_total",
+			Help:        "Total number of successful reads of a failover bucket by the backend which served them.",
+			ConstLabels: prometheus.Labels{"bucket": primary.Name(), "secondary_bucket": secondary.Name()},
+		}, []string{"operation", "backend"}),
+	}
+	for _, op := range []string{objstore.OpGet, objstore.OpGetRange, objstore.OpExists, objstore.OpAttributes} {
+		b.reads.WithLabelValues(op, backendPrimary)
+		b.reads.WithLabelValues(op, backendSecondary)
+	}
+	return b
+}
+
+// read calls f with the primary bucket, and with the secondary bucket if the object wasn't found or the error
+// is a failover error. If both fail, the error of the primary bucket is returned, unless the object wasn't
+// found in it.
+func (b *FailoverBucket) read(op string, f func(bkt objstore.Bucket) error) error {
+	err := f(b.primary)
+	if err == nil {
+		b.reads.WithLabelValues(op, backendPrimary).Inc()
+		return nil
+	}
+	notFound := b.primary.IsObjNotFoundErr(err)
+	if !notFound && !b.cfg.IsFailoverErr(err) {
+		return err
+	}
+
+	secondaryErr := f(b.secondary)
+	if secondaryErr == nil {
+		b.reads.WithLabelValues(op, backendSecondary).Inc()
+		return nil
+	}
+	if notFound {
+		return secondaryErr
+	}
+	return err
+}
+
+func (b *FailoverBucket) Get(ctx context.Context, name string) (rc io.ReadCloser, err error) {
+	err = b.read(objstore.OpGet, func(bkt objstore.Bucket) (err error) {
+		rc, err = bkt.Get(ctx, name)
+		return err
+	})
+	return rc, err
+}
+
+func (b *FailoverBucket) GetRange(ctx context.Context, name string, off, length int64) (rc io.ReadCloser, err error) {
+	err = b.read(objstore.OpGetRange, func(bkt objstore.Bucket) (err error) {
+		rc, err = bkt.GetRange(ctx, name, off, length)
+		return err
+	})
+	return rc, err
+}
+
+// Exists checks if the given object exists in the primary or secondary bucket.
+func (b *FailoverBucket) Exists(ctx context.Context, name string) (exists bool, err error) {
+	exists, err = b.primary.Exists(ctx, name)
+	if err == nil && exists {
+		b.reads.WithLabelValues(objstore.OpExists, backendPrimary).Inc()
+		return true, nil
+	}
+	if err != nil && !b.cfg.IsFailoverErr(err) {
+		return false, err
+	}
+
+	secondaryExists, secondaryErr := b.secondary.Exists(ctx, name)
+	if secondaryErr != nil {
+		// Report the object as missing if the primary bucket said so, which is accurate as far as known.
+		return false, err
+	}
+	b.reads.WithLabelValues(objstore.OpExists, backendSecondary).Inc()
+	return secondaryExists, nil
+}
+
+func (b *FailoverBucket) Attributes(ctx context.Context, name string) (attrs objstore.ObjectAttributes, err error) {
+	err = b.read(objstore.OpAttributes, func(bkt objstore.Bucket) (err error) {
+		attrs, err = bkt.Attributes(ctx, name)
+		return err
+	})
+	return attrs, err
+}
+
+func (b *FailoverBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.primary.Iter(ctx, dir, f, options...)
+}
+
+func (b *FailoverBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.primary.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *FailoverBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.primary.SupportedIterOptions()
+}
+
+func (b *FailoverBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	return b.primary.Upload(ctx, name, r, opts...)
+}
+
+func (b *FailoverBucket) Delete(ctx context.Context, name string) error {
+	return b.primary.Delete(ctx, name)
+}
+
+func (b *FailoverBucket) DeleteMany(ctx context.Context, names []string) error {
+	return b.primary.DeleteMany(ctx, names)
+}
+
+func (b *FailoverBucket) Copy(ctx context.Context, src, dst string) error {
+	return b.primary.Copy(ctx, src, dst)
+}
+
+// IsObjNotFoundErr returns true if err means that the object was not found in either bucket.
+func (b *FailoverBucket) IsObjNotFoundErr(err error) bool {
+	return b.primary.IsObjNotFoundErr(err) || b.secondary.IsObjNotFoundErr(err)
+}
+
+func (b *FailoverBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.primary.IsCustomerManagedKeyError(err) || b.secondary.IsCustomerManagedKeyError(err)
+}
+
+// Close closes both buckets.
+func (b *FailoverBucket) Close() error {
+	primaryErr := b.primary.Close()
+	if err := b.secondary.Close(); err != nil && primaryErr == nil {
+		return err
+	}
+	return primaryErr
+}
+
+// Name returns the name of the primary bucket.
+func (b *FailoverBucket) Name() string {
+	return b.primary.Name()
+}
@@ -0,0 +1,114 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package failover
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/objstore"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// unavailableBucket fails all reads with errUnavailable.
+type unavailableBucket struct {
+	objstore.Bucket
+}
+
+func (b unavailableBucket) Get(context.Context, string) (io.ReadCloser, error) {
+	return nil, errUnavailable
+}
+
+func (b unavailableBucket) Exists(context.Context, string) (bool, error) {
+	return false, errUnavailable
+}
+
+func (b unavailableBucket) Attributes(context.Context, string) (objstore.ObjectAttributes, error) {
+	return objstore.ObjectAttributes{}, errUnavailable
+}
+
+func isUnavailable(err error) bool {
+	return errors.Is(err, errUnavailable)
+}
+
+func content(t *testing.T, bkt objstore.Bucket, name string) string {
+	t.Helper()
+
+	rc, err := bkt.Get(context.Background(), name)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rc.Close()) }()
+	b, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	return string(b)
+}
+
+func TestFailoverBucket_Acceptance(t *testing.T) {
+	objstore.AcceptanceTest(t, NewFailoverBucket(objstore.NewInMemBucket(), objstore.NewInMemBucket(), Config{}, nil))
+}
+
+func TestFailoverBucket(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := objstore.NewInMemBucket(), objstore.NewInMemBucket()
+	testutil.Ok(t, primary.Upload(ctx, "both", strings.NewReader("primary")))
+	testutil.Ok(t, secondary.Upload(ctx, "both", strings.NewReader("secondary")))
+	testutil.Ok(t, secondary.Upload(ctx, "replicated", strings.NewReader("secondary")))
+	bkt := NewFailoverBucket(primary, secondary, Config{}, nil)
+
+	testutil.Equals(t, "primary", content(t, bkt, "both"))
+	testutil.Equals(t, "secondary", content(t, bkt, "replicated"))
+	attrs, err := bkt.Attributes(ctx, "replicated")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(9), attrs.Size)
+	ok, err := bkt.Exists(ctx, "replicated")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object in secondary bucket to exist")
+
+	ok, err = bkt.Exists(ctx, "missing")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected missing object not to exist")
+	_, err = bkt.Get(ctx, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.reads.WithLabelValues(objstore.OpGet, backendPrimary)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.reads.WithLabelValues(objstore.OpGet, backendSecondary)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.reads.WithLabelValues(objstore.OpAttributes, backendSecondary)))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.reads.WithLabelValues(objstore.OpExists, backendSecondary)))
+
+	// Writes only go to the primary bucket.
+	testutil.Ok(t, bkt.Upload(ctx, "new", strings.NewReader("new")))
+	ok, err = secondary.Exists(ctx, "new")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected upload to primary bucket only")
+}
+
+func TestFailoverBucket_FailoverErrors(t *testing.T) {
+	ctx := context.Background()
+	secondary := objstore.NewInMemBucket()
+	testutil.Ok(t, secondary.Upload(ctx, "obj", strings.NewReader("secondary")))
+	primary := unavailableBucket{Bucket: objstore.NewInMemBucket()}
+
+	// Errors which are not failover errors are returned as is.
+	bkt := NewFailoverBucket(primary, secondary, Config{}, nil)
+	_, err := bkt.Get(ctx, "obj")
+	testutil.Assert(t, isUnavailable(err), "unexpected error: %v", err)
+	_, err = bkt.Exists(ctx, "obj")
+	testutil.Assert(t, isUnavailable(err), "unexpected error: %v", err)
+
+	bkt = NewFailoverBucket(primary, secondary, Config{IsFailoverErr: isUnavailable}, nil)
+	testutil.Equals(t, "secondary", content(t, bkt, "obj"))
+	ok, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object in secondary bucket to exist")
+
+	// The error of the primary bucket is returned if the object is missing in the secondary bucket.
+	_, err = bkt.Attributes(ctx, "missing")
+	testutil.Assert(t, isUnavailable(err), "unexpected error: %v", err)
+}
@@ -4,11 +4,22 @@
 package filesystem
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/efficientgo/core/errcapture"
 	"github.com/pkg/errors"
@@ -20,13 +31,25 @@ import (
 // Config stores the configuration for storing and accessing blobs in filesystem.
 type Config struct {
 	Directory string `yaml:"directory"`
+	// AutoDetectContentType enables detecting the content type of objects uploaded without one from their first
+	// 512 bytes, and storing it along with the object. Otherwise, it is detected each time the attributes are read.
+	AutoDetectContentType bool `yaml:"auto_detect_content_type"`
+	// Fsync enables syncing the content of uploaded objects and their metadata to disk before they are renamed into
+	// place, and their directory after the rename or removal of an object, so that objects are not lost or
+	// truncated if the machine crashes. This makes uploads considerably slower.
+	Fsync bool `yaml:"fsync"`
 }
 
 // Bucket implements the objstore.Bucket interfaces against filesystem that binary runs on.
 // Methods from Bucket interface are thread-safe. Objects are assumed to be immutable.
 // NOTE: It does not follow symbolic links.
 type Bucket struct {
-	rootDir string
+	rootDir               string
+	autoDetectContentType bool
+	fsync                 bool
+
+	// condMtx serializes conditional updates of objects.
+	condMtx sync.Mutex
 }
 
 // NewBucketFromConfig returns a new filesystem.Bucket from config.
@@ -35,10 +58,19 @@ func NewBucketFromConfig(conf []byte) (*Bucket, error) {
 	if err := yaml.Unmarshal(conf, &c); err != nil {
 		return nil, err
 	}
+	return NewBucketWithConfig(c)
+}
+
+// NewBucketWithConfig returns a new filesystem.Bucket from the given config values.
+func NewBucketWithConfig(c Config) (*Bucket, error) {
 	if c.Directory == "" {
 		return nil, errors.New("missing directory for filesystem bucket")
 	}
-	return NewBucket(c.Directory)
+	absDir, err := filepath.Abs(c.Directory)
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{rootDir: absDir, autoDetectContentType: c.AutoDetectContentType, fsync: c.Fsync}, nil
 }
 
 // NewBucket returns a new filesystem.Bucket.
@@ -53,18 +85,56 @@ func NewBucket(rootDir string) (*Bucket, error) {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(attrs objstore.IterObjectAttributes) error {
+		return f(attrs.Name)
+	}, options...)
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter.
+// In addition to Name, it also includes requested object attributes in the argument to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
 
 	params := objstore.ApplyIterOptions(options...)
+	if params.MaxResults > 0 {
+		count, next := 0, f
+		f = func(attrs objstore.IterObjectAttributes) error {
+			if err := next(attrs); err != nil {
+				return err
+			}
+			if count++; count >= params.MaxResults {
+				return errMaxResultsReached
+			}
+			return nil
+		}
+	}
+
+	if err := b.iterWithAttributes(ctx, dir, f, params); err != nil && err != errMaxResultsReached {
+		return err
+	}
+	return nil
+}
+
+// errMaxResultsReached stops the iteration once the requested number of entries was passed to the callback.
+var errMaxResultsReached = errors.New("max results reached")
+
+func (b *Bucket) iterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, params objstore.IterParams) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
 	absDir := filepath.Join(b.rootDir, dir)
 	info, err := os.Stat(absDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
-		return errors.Wrapf(err, "stat %s", absDir)
+		return wrapErr(objstore.OpIter, dir, errors.Wrapf(err, "stat %s", absDir))
 	}
 	if !info.IsDir() {
 		return nil
@@ -72,15 +142,36 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 
 	files, err := os.ReadDir(absDir)
 	if err != nil {
-		return err
+		return wrapErr(objstore.OpIter, dir, err)
+	}
+	// Sort the entries by their object names, which have a trailing delimiter for directories, so that
+	// the iteration can be resumed after the last name seen.
+	objectName := func(file os.DirEntry) string {
+		if file.IsDir() {
+			return filepath.Join(dir, file.Name()) + objstore.DirDelim
+		}
+		return filepath.Join(dir, file.Name())
 	}
+	sort.Slice(files, func(i, j int) bool { return objectName(files[i]) < objectName(files[j]) })
+	if params.StartAfter != "" {
+		i := sort.Search(len(files), func(i int) bool { return objectName(files[i]) > params.StartAfter })
+		// Objects after the name can still be found in the directory containing it.
+		if params.Recursive && i > 0 && files[i-1].IsDir() && strings.HasPrefix(params.StartAfter, objectName(files[i-1])) {
+			i--
+		}
+		files = files[i:]
+	}
+
 	for _, file := range files {
+		if !file.IsDir() && (params.PrefixesOnly || isMetadataFile(file.Name()) || isTempFile(file.Name())) {
+			continue
+		}
 		name := filepath.Join(dir, file.Name())
 
 		if file.IsDir() {
 			empty, err := isDirEmpty(filepath.Join(absDir, file.Name()))
 			if err != nil {
-				return err
+				return wrapErr(objstore.OpIter, dir, err)
 			}
 
 			if empty {
@@ -92,7 +183,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 
 			if params.Recursive {
 				// Recursively list files in the subdirectory.
-				if err := b.Iter(ctx, name, f, options...); err != nil {
+				if err := b.iterWithAttributes(ctx, name, f, params); err != nil {
 					return err
 				}
 
@@ -101,29 +192,164 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 				continue
 			}
 		}
-		if err := f(name); err != nil {
+
+		attrs := objstore.IterObjectAttributes{Name: name}
+		if (params.StorageClass || params.StorageClassFilter != "" || params.UserMetadata) && !file.IsDir() {
+			meta, err := readMetadata(filepath.Join(absDir, file.Name()))
+			if err != nil {
+				return wrapErr(objstore.OpIter, name, err)
+			}
+			if params.SkipStorageClass(meta.StorageClass) {
+				continue
+			}
+			if params.StorageClass {
+				attrs.SetStorageClass(meta.StorageClass)
+			}
+			if params.UserMetadata {
+				attrs.SetUserMetadata(meta.UserMetadata)
+			}
+		}
+		if params.ETag && !file.IsDir() {
+			etag, err := b.fileETag(filepath.Join(absDir, file.Name()))
+			if err != nil {
+				return wrapErr(objstore.OpIter, name, err)
+			}
+			attrs.SetETag(etag)
+		}
+		if (params.Size || params.LastModified) && !file.IsDir() {
+			info, err := file.Info()
+			if err != nil {
+				return wrapErr(objstore.OpIter, name, err)
+			}
+			if params.Size {
+				attrs.SetSize(info.Size())
+			}
+			if params.LastModified {
+				attrs.SetLastModified(info.ModTime())
+			}
+		}
+		if err := f(attrs); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// SupportedIterOptions returns the list of IterOptions supported by the filesystem provider.
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive, objstore.ETag, objstore.MaxResults, objstore.Size, objstore.StorageClass, objstore.StartAfter, objstore.PrefixesOnly, objstore.UserMetadata, objstore.UpdatedAt}
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// newETagHash returns the hash of the content from which ETags are computed, which is its CRC32C
+// (Castagnoli) checksum.
+func newETagHash() hash.Hash32 {
+	return crc32.New(castagnoliTable)
+}
+
+// fileETag returns the hex encoded CRC32C (Castagnoli) checksum of the file content.
+func fileETag(name string) (_ string, err error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return "", err
+	}
+	defer errcapture.Do(&err, f.Close, "close")
+
+	h := newETagHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "checksum %s", name)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// objectETag returns the ETag of the given object file. The ETag stored in its metadata is used if it was
+// computed for the current content of the file, otherwise the content is read to compute it.
+func objectETag(file string, stat os.FileInfo, meta objectMetadata) (string, error) {
+	if etag, ok := meta.cachedETag(stat); ok {
+		return etag, nil
+	}
+	return fileETag(file)
+}
+
+// fileETag returns the ETag of the given object file, reading its metadata to use the stored ETag.
+func (b *Bucket) fileETag(file string) (string, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	meta, err := readMetadata(file)
+	if err != nil {
+		return "", err
+	}
+	return objectETag(file, stat, meta)
+}
+
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.GetRange(ctx, name, 0, -1)
+	r, err := b.getRange(ctx, name, 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
+}
+
+// GetWithOptions returns a reader for the given object name. Objects are returned as they were uploaded, unless
+// WithDecodeContent is given.
+func (b *Bucket) GetWithOptions(ctx context.Context, name string, opts ...objstore.ObjectGetOption) (_ io.ReadCloser, err error) {
+	if !objstore.ApplyObjectGetOptions(opts...).DecodeContent {
+		return b.Get(ctx, name)
+	}
+	defer func() { err = wrapErr(objstore.OpGet, name, err) }()
+
+	rc, err := b.getRange(ctx, name, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readMetadata(filepath.Join(b.rootDir, name))
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return objstore.NewContentDecodingReader(rc, meta.ContentEncoding)
 }
 
-type rangeReaderCloser struct {
-	io.Reader
-	f *os.File
+// fileReadCloser reads an object file and fails once its context is canceled, so that copies of large objects
+// can be aborted.
+type fileReadCloser struct {
+	ctxReader
+	f    *os.File
+	size int64
 }
 
-func (r *rangeReaderCloser) Close() error {
+func (r *fileReadCloser) ObjectSize() (int64, error) {
+	return r.size, nil
+}
+
+func (r *fileReadCloser) Close() error {
 	return r.f.Close()
 }
 
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	attrs, err := b.attributes(ctx, name)
+	return attrs, wrapErr(objstore.OpAttributes, name, err)
+}
+
+// GetWithAttributes returns a reader for the given object name and the attributes of the object, which are read
+// right before the file is opened.
+func (b *Bucket) GetWithAttributes(ctx context.Context, name string) (_ io.ReadCloser, _ objstore.ObjectAttributes, err error) {
+	defer func() { err = wrapErr(objstore.OpGet, name, err) }()
+
+	attrs, err := b.attributes(ctx, name)
+	if err != nil {
+		return nil, objstore.ObjectAttributes{}, err
+	}
+	r, err := b.getRange(ctx, name, 0, -1)
+	if err != nil {
+		return nil, objstore.ObjectAttributes{}, err
+	}
+	return r, attrs, nil
+}
+
+func (b *Bucket) attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	if ctx.Err() != nil {
 		return objstore.ObjectAttributes{}, ctx.Err()
 	}
@@ -134,14 +360,89 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat %s", file)
 	}
 
+	var (
+		etag, contentType, storageClass, contentEncoding, cacheControl string
+		userMetadata                                                   map[string]string
+	)
+	if !stat.IsDir() {
+		meta, err := readMetadata(file)
+		if err != nil {
+			return objstore.ObjectAttributes{}, err
+		}
+		if etag, err = objectETag(file, stat, meta); err != nil {
+			return objstore.ObjectAttributes{}, err
+		}
+		contentType = meta.ContentType
+		storageClass = meta.StorageClass
+		userMetadata = meta.UserMetadata
+		contentEncoding = meta.ContentEncoding
+		cacheControl = meta.CacheControl
+		if contentType == "" {
+			if contentType, err = fileContentType(file); err != nil {
+				return objstore.ObjectAttributes{}, err
+			}
+		}
+	}
+
 	return objstore.ObjectAttributes{
-		Size:         stat.Size(),
-		LastModified: stat.ModTime(),
+		Size:            stat.Size(),
+		LastModified:    stat.ModTime(),
+		ETag:            etag,
+		ContentType:     contentType,
+		StorageClass:    storageClass,
+		UserMetadata:    userMetadata,
+		ContentEncoding: contentEncoding,
+		CacheControl:    cacheControl,
 	}, nil
 }
 
+// fileContentType detects the content type of the file from its first 512 bytes. It is used for files
+// without stored metadata.
+func fileContentType(name string) (_ string, err error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return "", err
+	}
+	defer errcapture.Do(&err, f.Close, "close")
+
+	contentType, _, err := sniffContentType(f)
+	if err != nil {
+		return "", errors.Wrapf(err, "read %s", name)
+	}
+	return contentType, nil
+}
+
+// sniffContentType detects the content type from the first 512 bytes of r, which are returned as well.
+func sniffContentType(r io.Reader) (string, []byte, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	return http.DetectContentType(buf[:n]), buf[:n], nil
+}
+
+// detectContentType sets the content type of meta from the content of r if automatic detection is enabled
+// and no content type was given. The returned reader returns the whole content of r.
+func (b *Bucket) detectContentType(r io.Reader, meta *objectMetadata, contentType string) (io.Reader, error) {
+	if !b.autoDetectContentType || contentType != "" {
+		return r, nil
+	}
+	detected, head, err := sniffContentType(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "detect content type")
+	}
+	meta.ContentType = detected
+	return io.MultiReader(bytes.NewReader(head), r), nil
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	r, err := b.getRange(ctx, name, off, length)
+	return r, wrapErr(objstore.OpGetRange, name, err)
+}
+
+func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
@@ -151,10 +452,22 @@ func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (
 	}
 
 	file := filepath.Join(b.rootDir, name)
-	if _, err := os.Stat(file); err != nil {
+	stat, err := os.Stat(file)
+	if err != nil {
 		return nil, errors.Wrapf(err, "stat %s", file)
 	}
 
+	if off < 0 {
+		if length != -1 {
+			return nil, errors.Errorf("suffix range requires length -1, got %d", length)
+		}
+		// Read the last -off bytes, or the whole file if it is smaller.
+		off += stat.Size()
+		if off < 0 {
+			off = 0
+		}
+	}
+
 	f, err := os.OpenFile(filepath.Clean(file), os.O_RDONLY, 0600)
 	if err != nil {
 		return nil, err
@@ -167,15 +480,23 @@ func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (
 		}
 	}
 
-	if length == -1 {
-		return f, nil
+	size := stat.Size() - off
+	if size < 0 {
+		size = 0
 	}
-
-	return &rangeReaderCloser{Reader: io.LimitReader(f, length), f: f}, nil
+	var r io.Reader = f
+	if length != -1 {
+		r = io.LimitReader(f, length)
+		if length < size {
+			size = length
+		}
+	}
+	return &fileReadCloser{ctxReader: ctxReader{ctx: ctx, r: r}, f: f, size: size}, nil
 }
 
 // Exists checks if the given directory exists in memory.
-func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+func (b *Bucket) Exists(ctx context.Context, name string) (_ bool, err error) {
+	defer func() { err = wrapErr(objstore.OpExists, name, err) }()
 	if ctx.Err() != nil {
 		return false, ctx.Err()
 	}
@@ -191,28 +512,438 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 }
 
 // Upload writes the file specified in src to into the memory.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
+// Upload attributes which differ from the defaults are stored in a hidden sidecar file next to the object.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
+	params := objstore.ApplyObjectUploadOptions(opts...)
+	if err := objstore.ValidateUserMetadata(params.UserMetadata); err != nil {
+		return err
+	}
+	if params.PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+
+	meta := newObjectMetadata(params)
+	// The content type of the params defaults to DefaultContentType, so check whether one was given explicitly.
+	r, err = b.detectContentType(r, &meta, objstore.ApplyObjectUpdateOptions(opts...).ContentType)
+	if err != nil {
+		return err
+	}
+
 	file := filepath.Join(b.rootDir, name)
-	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+	h := newETagHash()
+	if err := writeFileAtomically(ctx, file, io.TeeReader(r, h), b.fsync); err != nil {
 		return err
 	}
+	if err := meta.setETag(file, h); err != nil {
+		return err
+	}
+	return b.writeMetadata(ctx, file, meta)
+}
+
+// UploadIfNotExists writes the file specified in src only if it does not exist yet.
+// The content is written to a temporary file first, which is then hard linked to the object's path. The link
+// fails if the object exists, so concurrent callers can't both succeed and readers never observe a partially
+// written object.
+func (b *Bucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (_ bool, err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	meta := newObjectMetadata(objstore.ApplyObjectUploadOptions())
+	if r, err = b.detectContentType(r, &meta, ""); err != nil {
+		return false, err
+	}
 
-	f, err := os.Create(file)
+	file := filepath.Join(b.rootDir, name)
+	h := newETagHash()
+	tmp, err := writeTempFile(ctx, file, io.TeeReader(r, h), b.fsync)
 	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if rmErr := os.Remove(tmp); rmErr != nil && err == nil {
+			err = errors.Wrapf(rmErr, "rm %s", tmp)
+		}
+	}()
+
+	if err := os.Link(tmp, file); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "link %s to %s", tmp, file)
+	}
+	if err := b.syncDir(filepath.Dir(file)); err != nil {
+		return false, err
+	}
+	if err := meta.setETag(file, h); err != nil {
+		return false, err
+	}
+	if err := b.writeMetadata(ctx, file, meta); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UploadIfMatch writes the file specified in src only if the ETag of the existing file equals etag. Like Upload, it
+// replaces the attributes of the object with the ones set by the options.
+// Conditional updates through the same Bucket are serialized, but they are not atomic with respect to
+// other writers of the directory.
+func (b *Bucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	b.condMtx.Lock()
+	defer b.condMtx.Unlock()
+
+	file := filepath.Join(b.rootDir, name)
+	current, err := b.fileETag(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Wrap(objstore.ErrPreconditionFailed, "object does not exist")
+		}
 		return err
 	}
-	defer errcapture.Do(&err, f.Close, "close")
+	if current != etag {
+		return errors.Wrapf(objstore.ErrPreconditionFailed, "ETag %s does not match %s", current, etag)
+	}
+	params := objstore.ApplyObjectUploadOptions(opts...)
+	if err := objstore.ValidateUserMetadata(params.UserMetadata); err != nil {
+		return err
+	}
+	if params.PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+	meta := newObjectMetadata(params)
+	if r, err = b.detectContentType(r, &meta, objstore.ApplyObjectUpdateOptions(opts...).ContentType); err != nil {
+		return err
+	}
+	h := newETagHash()
+	if err := writeFileAtomically(ctx, file, io.TeeReader(r, h), b.fsync); err != nil {
+		return err
+	}
+	if err := meta.setETag(file, h); err != nil {
+		return err
+	}
+	return b.writeMetadata(ctx, file, meta)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+// The content is first written to a temporary file next to dst, which is then renamed,
+// so that readers never observe a partially copied object.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) (err error) {
+	defer func() { err = wrapErr(objstore.OpCopy, src, err) }()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	srcFile := filepath.Join(b.rootDir, src)
+	info, err := os.Stat(srcFile)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", srcFile)
+	}
+	if info.IsDir() {
+		return errors.Errorf("%s is a directory", srcFile)
+	}
+
+	sf, err := os.Open(filepath.Clean(srcFile))
+	if err != nil {
+		return err
+	}
+	defer errcapture.Do(&err, sf.Close, "close src")
+
+	dstFile := filepath.Join(b.rootDir, dst)
+	h := newETagHash()
+	if err := writeFileAtomically(ctx, dstFile, io.TeeReader(sf, h), b.fsync); err != nil {
+		return errors.Wrapf(err, "copy %s", srcFile)
+	}
 
-	if _, err := io.Copy(f, r); err != nil {
-		return errors.Wrapf(err, "copy to %s", file)
+	meta, err := readMetadata(srcFile)
+	if err != nil {
+		return err
+	}
+	if err := meta.setETag(dstFile, h); err != nil {
+		return err
+	}
+	return b.writeMetadata(ctx, dstFile, meta)
+}
+
+// NewMultipartUpload starts a new upload of the object with the given name. The parts are buffered in a
+// temporary file outside of the bucket, which is uploaded as the object once the upload is completed.
+func (b *Bucket) NewMultipartUpload(ctx context.Context, name string, opts ...objstore.ObjectUploadOption) (objstore.MultipartWriter, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return nil, wrapErr(objstore.OpUpload, name, objstore.ErrOptionNotSupported)
 	}
+	tmp, err := os.CreateTemp("", "objstore-multipart-")
+	if err != nil {
+		return nil, wrapErr(objstore.OpUpload, name, err)
+	}
+	return &multipartWriter{bkt: b, name: name, opts: opts, tmp: tmp}, nil
+}
+
+// multipartWriter buffers the parts of an object in a temporary file.
+type multipartWriter struct {
+	bkt  *Bucket
+	name string
+	opts []objstore.ObjectUploadOption
+
+	tmp     *os.File
+	written int64
+}
+
+// WritePart appends the part to the temporary file. If writing the part fails, the file is truncated
+// to the end of the previous part, so that the part can be retried.
+func (w *multipartWriter) WritePart(ctx context.Context, r io.Reader, _ int64) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	n, err := io.Copy(w.tmp, ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		if err := w.tmp.Truncate(w.written); err != nil {
+			return wrapErr(objstore.OpUpload, w.name, errors.Wrap(err, "truncate failed part"))
+		}
+		if _, err := w.tmp.Seek(w.written, io.SeekStart); err != nil {
+			return wrapErr(objstore.OpUpload, w.name, errors.Wrap(err, "seek to end of previous part"))
+		}
+		return wrapErr(objstore.OpUpload, w.name, errors.Wrapf(err, "write part to %s", w.tmp.Name()))
+	}
+	w.written += n
 	return nil
 }
 
+// Complete uploads the buffered parts as the object and removes the temporary file.
+func (w *multipartWriter) Complete(ctx context.Context) (err error) {
+	defer errcapture.Do(&err, w.cleanup, "remove temporary file")
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return wrapErr(objstore.OpUpload, w.name, err)
+	}
+	return w.bkt.Upload(ctx, w.name, w.tmp, w.opts...)
+}
+
+// Abort removes the temporary file.
+func (w *multipartWriter) Abort(_ context.Context) error {
+	return wrapErr(objstore.OpUpload, w.name, w.cleanup())
+}
+
+func (w *multipartWriter) cleanup() error {
+	if err := w.tmp.Close(); err != nil {
+		return err
+	}
+	return os.Remove(w.tmp.Name())
+}
+
+const (
+	metadataSuffix = ".meta.json"
+	// tmpPrefix is the prefix of the names of temporary files. Files with this prefix are reserved for the
+	// bucket and never listed, so that they can't be mistaken for objects whose names merely look temporary.
+	tmpPrefix = ".objstore-tmp-"
+)
+
+// ctxReader fails reads once its context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// writeFileAtomically writes the content of r to a hidden temporary file next to file, which is renamed to
+// file once all content was written, so that readers never observe a partially written file. The temporary
+// file is removed if writing fails or ctx is canceled before the rename. If fsync is true, the temporary file
+// is synced before the rename and the directory after it, so that the file survives a crash once this returns.
+func writeFileAtomically(ctx context.Context, file string, r io.Reader, fsync bool) error {
+	tmp, err := writeTempFile(ctx, file, r, fsync)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrapf(err, "rename %s to %s", tmp, file)
+	}
+	if fsync {
+		return syncDir(filepath.Dir(file))
+	}
+	return nil
+}
+
+// writeTempFile writes the content of r to a hidden temporary file next to file and returns its path. The
+// temporary file is removed if writing fails or ctx is canceled. If fsync is true, it is synced to disk.
+func writeTempFile(ctx context.Context, file string, r io.Reader, fsync bool) (_ string, err error) {
+	var tmp *os.File
+	// The directory might be removed by a concurrent Delete of its last object before the temporary
+	// file is created in it, so retry creating both.
+	for i := 0; ; i++ {
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			return "", err
+		}
+		tmp, err = os.CreateTemp(filepath.Dir(file), tmpPrefix+"*")
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) || i == 2 {
+			return "", err
+		}
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	// Use the permissions os.Create results in with the common umask of 022, instead of the 0600 of CreateTemp.
+	if err := tmp.Chmod(0644); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, ctxReader{ctx: ctx, r: r}); err != nil {
+		return "", errors.Wrapf(err, "copy to %s", tmp.Name())
+	}
+	if fsync {
+		if err := tmp.Sync(); err != nil {
+			return "", errors.Wrapf(err, "sync %s", tmp.Name())
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// syncDir syncs the directory, which persists the entries renamed into it.
+func syncDir(dir string) (err error) {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	defer errcapture.Do(&err, d.Close, "close dir")
+
+	return errors.Wrapf(d.Sync(), "sync %s", dir)
+}
+
+// isTempFile returns true for the temporary files objects are written to before they are renamed.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tmpPrefix)
+}
+
+// objectMetadata holds the upload attributes of an object which are stored in its sidecar file.
+type objectMetadata struct {
+	ContentType     string            `json:"content_type,omitempty"`
+	CacheControl    string            `json:"cache_control,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	UserMetadata    map[string]string `json:"user_metadata,omitempty"`
+	StorageClass    string            `json:"storage_class,omitempty"`
+	Tags            map[string]string `json:"tags,omitempty"`
+
+	// ETag is the checksum of the content written on upload, so that it doesn't have to be computed on each
+	// read. It is only used while the size and modification time of the object file are the ones stored with
+	// it, so that changes of the file by other writers are noticed.
+	ETag        string `json:"etag,omitempty"`
+	ETagSize    int64  `json:"etag_size,omitempty"`
+	ETagModTime int64  `json:"etag_mod_time,omitempty"`
+}
+
+// cachedETag returns the stored ETag if it was computed for the object file with the given stat.
+func (m objectMetadata) cachedETag(stat os.FileInfo) (string, bool) {
+	if m.ETag == "" || m.ETagSize != stat.Size() || m.ETagModTime != stat.ModTime().UnixNano() {
+		return "", false
+	}
+	return m.ETag, true
+}
+
+// setETag stores the ETag computed by h while writing the content of the given object file.
+func (m *objectMetadata) setETag(file string, h hash.Hash32) error {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	m.ETag = hex.EncodeToString(h.Sum(nil))
+	m.ETagSize = stat.Size()
+	m.ETagModTime = stat.ModTime().UnixNano()
+	return nil
+}
+
+// newObjectMetadata returns the metadata of an object uploaded with the given params.
+func newObjectMetadata(params objstore.UploadObjectParams) objectMetadata {
+	return objectMetadata{
+		ContentType:     params.ContentType,
+		CacheControl:    params.CacheControl,
+		ContentEncoding: params.ContentEncoding,
+		UserMetadata:    params.UserMetadata,
+		StorageClass:    params.StorageClass,
+	}
+}
+
+// metadataFile returns the path of the sidecar file storing the metadata of the given object file.
+func metadataFile(file string) string {
+	return filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+metadataSuffix)
+}
+
+func isMetadataFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, metadataSuffix)
+}
+
+// readMetadata returns the metadata stored for the given object file, or empty metadata if there is none.
+func readMetadata(file string) (objectMetadata, error) {
+	var meta objectMetadata
+	b, err := os.ReadFile(metadataFile(file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return meta, err
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return meta, errors.Wrapf(err, "unmarshal %s", metadataFile(file))
+	}
+	return meta, nil
+}
+
+// writeMetadata stores the upload attributes and the ETag of the given object file. The sidecar file is
+// only kept if there is an ETag or the attributes differ from the defaults, otherwise the content type is
+// detected on read. It is replaced atomically and synced like objects, so that readers never observe
+// partially written metadata.
+func (b *Bucket) writeMetadata(ctx context.Context, file string, meta objectMetadata) error {
+	isDefaultContentType := meta.ContentType == "" || meta.ContentType == objstore.DefaultContentType
+	if meta.ETag == "" && isDefaultContentType && meta.CacheControl == "" && meta.ContentEncoding == "" && len(meta.UserMetadata) == 0 && meta.StorageClass == "" && len(meta.Tags) == 0 {
+		if err := os.Remove(metadataFile(file)); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return b.syncDir(filepath.Dir(file))
+	}
+	if isDefaultContentType {
+		// Leave the content type to be detected on read, as for objects without a sidecar file.
+		meta.ContentType = ""
+	}
+
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(ctx, metadataFile(file), bytes.NewReader(content), b.fsync)
+}
+
 func isDirEmpty(name string) (ok bool, err error) {
 	f, err := os.Open(filepath.Clean(name))
 	if os.IsNotExist(err) {
@@ -231,31 +962,237 @@ func isDirEmpty(name string) (ok bool, err error) {
 }
 
 // Delete removes all data prefixed with the dir.
-func (b *Bucket) Delete(ctx context.Context, name string) error {
+func (b *Bucket) Delete(ctx context.Context, name string) (err error) {
+	defer func() { err = wrapErr(objstore.OpDelete, name, err) }()
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
 	file := filepath.Join(b.rootDir, name)
-	for file != b.rootDir {
-		if err := os.RemoveAll(file); err != nil {
-			return errors.Wrapf(err, "rm %s", file)
-		}
-		file = filepath.Dir(file)
-		empty, err := isDirEmpty(file)
+	if err := os.Remove(metadataFile(file)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "rm %s", metadataFile(file))
+	}
+	if file == b.rootDir {
+		return nil
+	}
+	if err := os.RemoveAll(file); err != nil {
+		return errors.Wrapf(err, "rm %s", file)
+	}
+	return b.removeEmptyDirs(filepath.Dir(file))
+}
+
+// removeEmptyDirs removes dir and its parent directories inside the bucket as long as they are empty.
+func (b *Bucket) removeEmptyDirs(dir string) error {
+	for dir != b.rootDir {
+		empty, err := isDirEmpty(dir)
 		if err != nil {
 			return err
 		}
 		if !empty {
 			break
 		}
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "rm %s", dir)
+		}
+		dir = filepath.Dir(dir)
 	}
-	return nil
+	// Persist the removal of the last removed entry.
+	return b.syncDir(dir)
+}
+
+// syncDir syncs the directory if fsync is enabled.
+func (b *Bucket) syncDir(dir string) error {
+	if !b.fsync {
+		return nil
+	}
+	return syncDir(dir)
+}
+
+// Rename moves the object with the src name to the dst name using os.Rename, which is atomic
+// as the objects are stored on the same filesystem.
+func (b *Bucket) Rename(ctx context.Context, src, dst string) (err error) {
+	defer func() { err = wrapErr(objstore.OpCopy, src, err) }()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	srcFile := filepath.Join(b.rootDir, src)
+	info, err := os.Stat(srcFile)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", srcFile)
+	}
+	if info.IsDir() {
+		return errors.Errorf("%s is a directory", srcFile)
+	}
+
+	dstFile := filepath.Join(b.rootDir, dst)
+	if err := os.MkdirAll(filepath.Dir(dstFile), os.ModePerm); err != nil {
+		return err
+	}
+	// Move the data first, so that a failed rename leaves the source object with its metadata in place.
+	if err := os.Rename(srcFile, dstFile); err != nil {
+		return errors.Wrapf(err, "rename %s to %s", srcFile, dstFile)
+	}
+	// The metadata of the object replaced at dst is in turn replaced atomically.
+	if err := os.Rename(metadataFile(srcFile), metadataFile(dstFile)); err != nil {
+		if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "rename %s to %s", metadataFile(srcFile), metadataFile(dstFile))
+		}
+		if err := os.Remove(metadataFile(dstFile)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "rm %s", metadataFile(dstFile))
+		}
+	}
+	if err := b.syncDir(filepath.Dir(dstFile)); err != nil {
+		return err
+	}
+	return b.removeEmptyDirs(filepath.Dir(srcFile))
+}
+
+// DeleteMany removes the objects with the given names sequentially.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// SetObjectTags replaces the tags of the object. The tags are stored in the metadata sidecar file of the object.
+func (b *Bucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+	return b.updateTags(ctx, name, tags)
+}
+
+// GetObjectTags returns the tags of the object.
+func (b *Bucket) GetObjectTags(ctx context.Context, name string) (_ map[string]string, err error) {
+	defer func() { err = wrapErr(objstore.OpAttributes, name, err) }()
+	file, err := b.objectFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readMetadata(file)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(meta.Tags))
+	for k, v := range meta.Tags {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// DeleteObjectTags removes all tags of the object.
+func (b *Bucket) DeleteObjectTags(ctx context.Context, name string) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+	return b.updateTags(ctx, name, nil)
+}
+
+func (b *Bucket) updateTags(ctx context.Context, name string, tags map[string]string) error {
+	file, err := b.objectFile(ctx, name)
+	if err != nil {
+		return err
+	}
+	meta, err := readMetadata(file)
+	if err != nil {
+		return err
+	}
+	meta.Tags = tags
+	return b.writeMetadata(ctx, file, meta)
+}
+
+// UpdateMetadata changes the user metadata and the attributes set by the options of the object in its sidecar
+// file, and sets its modification time to the current time.
+func (b *Bucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+	if err := objstore.ValidateUserMetadata(md); err != nil {
+		return err
+	}
+	params := objstore.ApplyObjectUpdateOptions(opts...)
+
+	file, err := b.objectFile(ctx, name)
+	if err != nil {
+		return err
+	}
+	meta, err := readMetadata(file)
+	if err != nil {
+		return err
+	}
+	if md != nil {
+		meta.UserMetadata = md
+	}
+	if params.ContentType != "" {
+		meta.ContentType = params.ContentType
+	}
+	if params.CacheControl != "" {
+		meta.CacheControl = params.CacheControl
+	}
+	if params.ContentEncoding != "" {
+		meta.ContentEncoding = params.ContentEncoding
+	}
+	if params.StorageClass != "" {
+		meta.StorageClass = params.StorageClass
+	}
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	etag, cached := meta.cachedETag(stat)
+	now := time.Now()
+	if err := os.Chtimes(file, now, now); err != nil {
+		return err
+	}
+	if cached {
+		// The content is unchanged, so the stored ETag stays valid for the new modification time.
+		if stat, err = os.Stat(file); err != nil {
+			return err
+		}
+		meta.ETag, meta.ETagModTime = etag, stat.ModTime().UnixNano()
+	}
+	return b.writeMetadata(ctx, file, meta)
+}
+
+// objectFile returns the path of the file storing the object with the given name, or an error if it doesn't exist.
+func (b *Bucket) objectFile(ctx context.Context, name string) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	file := filepath.Join(b.rootDir, name)
+	stat, err := os.Stat(file)
+	if err != nil {
+		return "", errors.Wrapf(err, "stat %s", file)
+	}
+	if stat.IsDir() {
+		return "", errors.Errorf("%s is a directory", file)
+	}
+	return file, nil
+}
+
+// PresignedGetURL returns objstore.ErrPresignNotSupported as the filesystem provider is not served over HTTP.
+func (b *Bucket) PresignedGetURL(_ context.Context, _ string, _ time.Duration) (string, error) {
+	return "", objstore.ErrPresignNotSupported
+}
+
+// PresignPut returns objstore.ErrPresignNotSupported as the filesystem provider is not served over HTTP.
+func (b *Bucket) PresignPut(_ context.Context, _ string, _ time.Duration) (string, error) {
+	return "", objstore.ErrPresignNotSupported
+}
+
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name.
+func wrapErr(op, name string, err error) error {
+	kind := objstore.ErrKindUnknown
+	switch cause := errors.Cause(err); {
+	case os.IsNotExist(cause):
+		kind = objstore.ErrKindNotFound
+	case os.IsPermission(cause):
+		kind = objstore.ErrKindPermissionDenied
+	case errors.Is(cause, syscall.ENOSPC), errors.Is(cause, syscall.EDQUOT):
+		kind = objstore.ErrKindQuotaExceeded
+	case errors.Is(cause, objstore.ErrPreconditionFailed):
+		kind = objstore.ErrKindPreconditionFailed
+	}
+	return objstore.NewBucketError(op, name, "", kind, err)
 }
 
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
-	return os.IsNotExist(errors.Cause(err))
+	return errors.Is(err, objstore.ErrNotFound) || os.IsNotExist(errors.Cause(err))
 }
 
 // IsCustomerManagedKeyError returns true if the permissions for key used to encrypt the object was revoked.
@@ -263,6 +1200,34 @@ func (b *Bucket) IsCustomerManagedKeyError(_ error) bool {
 	return false
 }
 
+// Ping checks that the root directory exists and is readable. It doesn't write to the directory, as it is
+// called periodically by health checks, see CheckWritable.
+func (b *Bucket) Ping(_ context.Context) error {
+	f, err := os.Open(b.rootDir)
+	if err != nil {
+		return wrapErr(objstore.OpPing, "", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return wrapErr(objstore.OpPing, "", errors.Wrapf(err, "read root directory %s", b.rootDir))
+	}
+	return nil
+}
+
+// CheckWritable checks that the root directory is writable by creating and removing a temporary file. It is
+// called by client.NewBucket if validate_on_create is set.
+func (b *Bucket) CheckWritable(_ context.Context) error {
+	tmp, err := os.CreateTemp(b.rootDir, tmpPrefix+"ping-*")
+	if err != nil {
+		return wrapErr(objstore.OpPing, "", errors.Wrapf(err, "write to root directory %s", b.rootDir))
+	}
+	if err := tmp.Close(); err != nil {
+		return wrapErr(objstore.OpPing, "", err)
+	}
+	return wrapErr(objstore.OpPing, "", os.Remove(tmp.Name()))
+}
+
 func (b *Bucket) Close() error { return nil }
 
 // Name returns the bucket name.
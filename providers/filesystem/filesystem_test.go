@@ -5,12 +5,20 @@ package filesystem
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 
 	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
 )
 
 func TestDelete_EmptyDirDeletionRaceCondition(t *testing.T) {
@@ -121,6 +129,22 @@ func TestUpload_CancelledContext(t *testing.T) {
 	testutil.Equals(t, context.Canceled, err)
 }
 
+func TestUpload_PublicRead(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	err = b.Upload(ctx, "some-file", bytes.NewReader([]byte("file content")), objstore.WithPublicRead())
+	testutil.Assert(t, errors.Is(err, objstore.ErrOptionNotSupported), "expected option not supported error, got %v", err)
+
+	_, err = b.NewMultipartUpload(ctx, "some-file", objstore.WithPublicRead())
+	testutil.Assert(t, errors.Is(err, objstore.ErrOptionNotSupported), "expected option not supported error, got %v", err)
+
+	exists, err := b.Exists(ctx, "some-file")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "expected no object to be uploaded")
+}
+
 func TestDelete_CancelledContext(t *testing.T) {
 	b, err := NewBucket(t.TempDir())
 	testutil.Ok(t, err)
@@ -132,3 +156,645 @@ func TestDelete_CancelledContext(t *testing.T) {
 	testutil.NotOk(t, err)
 	testutil.Equals(t, context.Canceled, err)
 }
+
+func TestGetRange_Suffix(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "obj", strings.NewReader("file content")))
+
+	for off, expected := range map[int64]string{
+		-7:   "content",
+		-100: "file content",
+	} {
+		rc, err := b.GetRange(ctx, "obj", off, -1)
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, expected, string(content))
+	}
+
+	_, err = b.GetRange(ctx, "obj", -7, 3)
+	testutil.NotOk(t, err)
+}
+
+func TestIter_MaxResults(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	for _, name := range []string{"a/1", "a/b/2", "a/b/3", "c/4"} {
+		testutil.Ok(t, b.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	// The limit applies across the recursively listed directories.
+	var seen []string
+	testutil.Ok(t, b.Iter(ctx, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, objstore.WithRecursiveIter, objstore.WithMaxResults(3)))
+	testutil.Equals(t, []string{"a/1", "a/b/2", "a/b/3"}, seen)
+}
+
+func TestContentType(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	// The content type of objects uploaded without one is detected from the content.
+	testutil.Ok(t, b.Upload(ctx, "dir/index.html", strings.NewReader("<html><body>hello</body></html>")))
+	testutil.Ok(t, b.Upload(ctx, "dir/obj.json", strings.NewReader(`{"a":1}`), objstore.WithContentType("application/json"), objstore.WithStorageClass("COLD")))
+
+	attrs, err := b.Attributes(ctx, "dir/index.html")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "text/html; charset=utf-8", attrs.ContentType)
+
+	attrs, err = b.Attributes(ctx, "dir/obj.json")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "application/json", attrs.ContentType)
+
+	// Copies keep the stored content type.
+	testutil.Ok(t, b.Copy(ctx, "dir/obj.json", "dir/copy.json"))
+	attrs, err = b.Attributes(ctx, "dir/copy.json")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "application/json", attrs.ContentType)
+	testutil.Equals(t, "COLD", attrs.StorageClass)
+
+	// Metadata sidecar files are not listed.
+	var seen []string
+	testutil.Ok(t, b.Iter(ctx, "dir/", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/copy.json", "dir/index.html", "dir/obj.json"}, seen)
+
+	// Objects can be filtered by the storage class stored in the sidecar files.
+	var cold []string
+	testutil.Ok(t, b.IterWithAttributes(ctx, "dir/", func(attrs objstore.IterObjectAttributes) error {
+		testutil.Equals(t, "COLD", attrs.StorageClass())
+		cold = append(cold, attrs.Name)
+		return nil
+	}, objstore.WithStorageClassIter, objstore.FilterStorageClass("COLD")))
+	testutil.Equals(t, []string{"dir/copy.json", "dir/obj.json"}, cold)
+
+	// Deleting the objects removes their sidecar files and the now empty directory.
+	for _, name := range seen {
+		testutil.Ok(t, b.Delete(ctx, name))
+	}
+	_, err = os.Stat(filepath.Join(b.rootDir, "dir"))
+	testutil.Assert(t, os.IsNotExist(err), "expected dir to be removed, got %v", err)
+}
+
+func TestContentType_AutoDetect(t *testing.T) {
+	b, err := NewBucketWithConfig(Config{Directory: t.TempDir(), AutoDetectContentType: true})
+	testutil.Ok(t, err)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write([]byte("content"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, zw.Close())
+
+	ctx := context.Background()
+	for _, tcase := range []struct {
+		name                string
+		content             []byte
+		expectedContentType string
+	}{
+		{name: "image.png", content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), expectedContentType: "image/png"},
+		{name: "data.gz", content: compressed.Bytes(), expectedContentType: "application/x-gzip"},
+		{name: "data.bin", content: []byte{0x00, 0x01, 0x02, 0xfe, 0xff}, expectedContentType: "application/octet-stream"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testutil.Ok(t, b.Upload(ctx, tcase.name, bytes.NewReader(tcase.content)))
+			attrs, err := b.Attributes(ctx, tcase.name)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedContentType, attrs.ContentType)
+
+			// The content is stored completely, including the bytes read for the detection.
+			rc, err := b.Get(ctx, tcase.name)
+			testutil.Ok(t, err)
+			content, err := io.ReadAll(rc)
+			testutil.Ok(t, err)
+			testutil.Ok(t, rc.Close())
+			testutil.Equals(t, tcase.content, content)
+		})
+	}
+
+	// The detected content type is stored in the metadata sidecar file.
+	meta, err := readMetadata(filepath.Join(b.rootDir, "image.png"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "image/png", meta.ContentType)
+
+	// Explicit content types are kept.
+	testutil.Ok(t, b.Upload(ctx, "explicit.png", strings.NewReader("\x89PNG\r\n\x1a\n"), objstore.WithContentType("application/vnd.custom")))
+	attrs, err := b.Attributes(ctx, "explicit.png")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "application/vnd.custom", attrs.ContentType)
+
+	ok, err := b.UploadIfNotExists(ctx, "new.png", strings.NewReader("\x89PNG\r\n\x1a\n"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected upload to succeed")
+	meta, err = readMetadata(filepath.Join(b.rootDir, "new.png"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "image/png", meta.ContentType)
+}
+
+func TestGetWithOptions(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write([]byte("content"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, zw.Close())
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "obj", bytes.NewReader(compressed.Bytes()), objstore.WithContentEncoding("gzip")))
+	attrs, err := b.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "gzip", attrs.ContentEncoding)
+
+	rc, err := b.GetWithOptions(ctx, "obj", objstore.WithReadCompressed())
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, compressed.Bytes(), content)
+
+	rc, err = b.GetWithOptions(ctx, "obj", objstore.WithDecodeContent())
+	testutil.Ok(t, err)
+	content, err = io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	_, err = b.GetWithOptions(ctx, "missing", objstore.WithDecodeContent())
+	testutil.Assert(t, b.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+}
+
+func TestGetWithAttributes(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithContentType("text/plain")))
+	expected, err := b.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+
+	rc, attrs, err := b.GetWithAttributes(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+	testutil.Equals(t, expected, attrs)
+
+	_, _, err = b.GetWithAttributes(ctx, "missing")
+	testutil.Assert(t, b.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+	var bErr *objstore.BucketError
+	testutil.Assert(t, errors.As(err, &bErr) && bErr.Op == objstore.OpGet, "expected error of get operation, got %v", err)
+}
+
+func TestETag(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "dir/obj", strings.NewReader("file content")))
+
+	// CRC32C of "file content".
+	const expected = "a9fa7740"
+	attrs, err := b.Attributes(ctx, "dir/obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, attrs.ETag)
+
+	var seen []objstore.IterObjectAttributes
+	testutil.Ok(t, b.IterWithAttributes(ctx, "dir/", func(attrs objstore.IterObjectAttributes) error {
+		seen = append(seen, attrs)
+		return nil
+	}, objstore.WithETag))
+	testutil.Equals(t, 1, len(seen))
+	testutil.Equals(t, "dir/obj", seen[0].Name)
+	testutil.Equals(t, expected, seen[0].ETag())
+
+	// ETag is not computed if not requested.
+	testutil.Ok(t, b.IterWithAttributes(ctx, "dir/", func(attrs objstore.IterObjectAttributes) error {
+		testutil.Equals(t, "", attrs.ETag())
+		return nil
+	}))
+}
+
+// attributesCountingBucket counts the calls to Attributes.
+type attributesCountingBucket struct {
+	objstore.Bucket
+	calls int
+}
+
+func (b *attributesCountingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.calls++
+	return b.Bucket.Attributes(ctx, name)
+}
+
+func BenchmarkIterObjectSizes(b *testing.B) {
+	const objects = 100
+
+	ctx := context.Background()
+	fsBkt, err := NewBucket(b.TempDir())
+	testutil.Ok(b, err)
+	for i := 0; i < objects; i++ {
+		testutil.Ok(b, fsBkt.Upload(ctx, filepath.Join("dir", strconv.Itoa(i)), strings.NewReader(strings.Repeat("a", i))))
+	}
+
+	b.Run("Attributes", func(b *testing.B) {
+		bkt := &attributesCountingBucket{Bucket: fsBkt}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			var total int64
+			testutil.Ok(b, bkt.Iter(ctx, "dir/", func(name string) error {
+				attrs, err := bkt.Attributes(ctx, name)
+				if err != nil {
+					return err
+				}
+				total += attrs.Size
+				return nil
+			}))
+			testutil.Equals(b, int64(objects*(objects-1)/2), total)
+		}
+		b.ReportMetric(float64(bkt.calls)/float64(b.N), "attributes-calls/op")
+	})
+
+	b.Run("WithSize", func(b *testing.B) {
+		bkt := &attributesCountingBucket{Bucket: fsBkt}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			var total int64
+			testutil.Ok(b, bkt.IterWithAttributes(ctx, "dir/", func(attrs objstore.IterObjectAttributes) error {
+				size, _ := attrs.Size()
+				total += size
+				return nil
+			}, objstore.WithSize))
+			testutil.Equals(b, int64(objects*(objects-1)/2), total)
+		}
+		testutil.Equals(b, 0, bkt.calls)
+		b.ReportMetric(float64(bkt.calls)/float64(b.N), "attributes-calls/op")
+	})
+}
+
+func TestIter_WithSize(t *testing.T) {
+	bkt, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "empty", strings.NewReader("")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+
+	for _, tcase := range []struct {
+		name         string
+		object       string
+		opts         []objstore.IterOption
+		expectedSize int64
+		expectedOK   bool
+	}{
+		{name: "size requested, empty object", object: "empty", opts: []objstore.IterOption{objstore.WithSize}, expectedSize: 0, expectedOK: true},
+		{name: "size requested, non-empty object", object: "obj", opts: []objstore.IterOption{objstore.WithSize}, expectedSize: 7, expectedOK: true},
+		{name: "size not requested, empty object", object: "empty"},
+		{name: "size not requested, non-empty object", object: "obj"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var found bool
+			testutil.Ok(t, bkt.IterWithAttributes(ctx, "", func(attrs objstore.IterObjectAttributes) error {
+				if attrs.Name != tcase.object {
+					return nil
+				}
+				found = true
+				size, ok := attrs.Size()
+				testutil.Equals(t, tcase.expectedOK, ok)
+				testutil.Equals(t, tcase.expectedSize, size)
+				return nil
+			}, tcase.opts...))
+			testutil.Assert(t, found, "object %s not listed", tcase.object)
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+	testutil.Ok(t, objstore.Ping(ctx, b))
+
+	b, err = NewBucket(filepath.Join(dir, "missing"))
+	testutil.Ok(t, err)
+	err = objstore.Ping(ctx, b)
+	testutil.Assert(t, objstore.IsNotFoundErr(err), "expected not found error, got %v", err)
+
+	file := filepath.Join(dir, "file")
+	testutil.Ok(t, os.WriteFile(file, []byte("content"), 0600))
+	b, err = NewBucket(file)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, objstore.Ping(ctx, b))
+}
+
+func TestCheckWritable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+	testutil.Ok(t, b.CheckWritable(ctx))
+	entries, err := os.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(entries))
+
+	b, err = NewBucket(filepath.Join(dir, "missing"))
+	testutil.Ok(t, err)
+	testutil.NotOk(t, b.CheckWritable(ctx))
+}
+
+// cancelingReader cancels the context after the first read.
+type cancelingReader struct {
+	cancel context.CancelFunc
+}
+
+func (r cancelingReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return copy(p, "partial"), nil
+}
+
+func TestUpload_CancelledMidUpload(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = b.Upload(ctx, "sub/obj", cancelingReader{cancel: cancel})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+
+	// Neither the object nor the temporary file it was written to are left behind.
+	_, err = os.Stat(filepath.Join(dir, "sub", "obj"))
+	testutil.Assert(t, os.IsNotExist(err), "expected no partial file, got %v", err)
+	entries, err := os.ReadDir(filepath.Join(dir, "sub"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(entries))
+}
+
+// checkingReader returns the content once and calls check before failing the next read.
+type checkingReader struct {
+	content string
+	check   func()
+	read    bool
+}
+
+func (r *checkingReader) Read(p []byte) (int, error) {
+	if r.read {
+		r.check()
+		return 0, errors.New("connection reset")
+	}
+	r.read = true
+	return copy(p, r.content), nil
+}
+
+func TestUpload_PartialWriteNotVisible(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucketWithConfig(Config{Directory: dir, Fsync: true})
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "sub/obj", strings.NewReader("old content")))
+
+	// While the new content is written, readers still see the old object, and the partially written temporary
+	// file is not listed.
+	var checked bool
+	err = b.Upload(ctx, "sub/obj", &checkingReader{content: "new", check: func() {
+		checked = true
+		content, err := os.ReadFile(filepath.Join(dir, "sub", "obj"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, "old content", string(content))
+
+		var seen []string
+		testutil.Ok(t, b.Iter(ctx, "sub/", func(name string) error {
+			seen = append(seen, name)
+			return nil
+		}))
+		testutil.Equals(t, []string{"sub/obj"}, seen)
+	}})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, checked, "expected the reader to be read twice")
+
+	// The failed upload leaves the old object in place and removes the temporary file.
+	rc, err := b.Get(ctx, "sub/obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "old content", string(content))
+	entries, err := os.ReadDir(filepath.Join(dir, "sub"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(entries))
+
+	testutil.Ok(t, b.Upload(ctx, "sub/obj", strings.NewReader("new content")))
+	content, err = os.ReadFile(filepath.Join(dir, "sub", "obj"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "new content", string(content))
+}
+
+func TestGet_CancelledMidRead(t *testing.T) {
+	b, err := NewBucket(t.TempDir())
+	testutil.Ok(t, err)
+	testutil.Ok(t, b.Upload(context.Background(), "obj", bytes.NewReader(make([]byte, 1<<20))))
+
+	for _, get := range []func(ctx context.Context) (io.ReadCloser, error){
+		func(ctx context.Context) (io.ReadCloser, error) { return b.Get(ctx, "obj") },
+		func(ctx context.Context) (io.ReadCloser, error) { return b.GetRange(ctx, "obj", 10, 1<<19) },
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		rc, err := get(ctx)
+		testutil.Ok(t, err)
+		_, err = rc.Read(make([]byte, 1024))
+		testutil.Ok(t, err)
+
+		// Reading stops once the context is canceled, before the whole object was read.
+		cancel()
+		n, err := io.Copy(io.Discard, rc)
+		testutil.Assert(t, errors.Is(err, context.Canceled), "expected context canceled error, got %v", err)
+		testutil.Equals(t, int64(0), n)
+		testutil.Ok(t, rc.Close())
+	}
+}
+
+func TestUploadIfNotExists_CancelledMidUpload(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = b.UploadIfNotExists(ctx, "obj", cancelingReader{cancel: cancel})
+	testutil.Assert(t, errors.Is(err, context.Canceled), "expected context canceled error, got %v", err)
+
+	// The partially written object is removed, so that the upload can be retried.
+	_, err = os.Stat(filepath.Join(dir, "obj"))
+	testutil.Assert(t, os.IsNotExist(err), "expected no partial file, got %v", err)
+	ok, err := b.UploadIfNotExists(context.Background(), "obj", strings.NewReader("content"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected upload to succeed")
+}
+
+func TestUploadIfNotExists_PartialWriteNotVisible(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucketWithConfig(Config{Directory: dir, Fsync: true})
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	var checked bool
+	_, err = b.UploadIfNotExists(ctx, "sub/obj", &checkingReader{content: "content", check: func() {
+		checked = true
+		exists, err := b.Exists(ctx, "sub/obj")
+		testutil.Ok(t, err)
+		testutil.Assert(t, !exists, "expected the partially written object not to exist")
+	}})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, checked, "expected the reader to be read twice")
+	entries, err := os.ReadDir(filepath.Join(dir, "sub"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(entries))
+
+	ok, err := b.UploadIfNotExists(ctx, "sub/obj", strings.NewReader("content"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected upload to succeed")
+	ok, err = b.UploadIfNotExists(ctx, "sub/obj", strings.NewReader("other content"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected upload of existing object to be skipped")
+
+	content, err := os.ReadFile(filepath.Join(dir, "sub", "obj"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "content", string(content))
+	// Only the object and its metadata sidecar file are left.
+	entries, err = os.ReadDir(filepath.Join(dir, "sub"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(entries))
+}
+
+func TestUpload_FsyncMetadata(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucketWithConfig(Config{Directory: dir, Fsync: true})
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "sub/obj", strings.NewReader("content"), objstore.WithUserMetadata(map[string]string{"k": "v1"})))
+	ok, err := b.UploadIfNotExists(ctx, "sub/other", strings.NewReader("content"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected upload to succeed")
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, b, "sub/obj", map[string]string{"k": "v2"}))
+
+	attrs, err := b.Attributes(ctx, "sub/obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"k": "v2"}, attrs.UserMetadata)
+
+	// The sidecar file is replaced atomically, without leaving temporary files behind.
+	entries, err := os.ReadDir(filepath.Join(dir, "sub"))
+	testutil.Ok(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	testutil.Equals(t, []string{".obj" + metadataSuffix, ".other" + metadataSuffix, "obj", "other"}, names)
+
+	testutil.Ok(t, b.Rename(ctx, "sub/obj", "renamed"))
+	testutil.Ok(t, b.Delete(ctx, "sub/other"))
+	_, err = os.Stat(filepath.Join(dir, "sub"))
+	testutil.Assert(t, os.IsNotExist(err), "expected empty directory to be removed, got %v", err)
+}
+
+func TestAttributes_StoredETag(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	file := filepath.Join(dir, "obj")
+	testutil.Ok(t, b.Upload(ctx, "obj", strings.NewReader("content")))
+	etag, err := fileETag(file)
+	testutil.Ok(t, err)
+
+	// The ETag is computed on upload and stored in the sidecar file.
+	meta, err := readMetadata(file)
+	testutil.Ok(t, err)
+	testutil.Equals(t, etag, meta.ETag)
+	attrs, err := b.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, etag, attrs.ETag)
+
+	// Updating the metadata keeps the stored ETag valid.
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, b, "obj", map[string]string{"k": "v"}))
+	meta, err = readMetadata(file)
+	testutil.Ok(t, err)
+	stat, err := os.Stat(file)
+	testutil.Ok(t, err)
+	_, ok := meta.cachedETag(stat)
+	testutil.Assert(t, ok, "expected stored ETag to be valid")
+
+	// Changes of the file by other writers are noticed.
+	testutil.Ok(t, os.WriteFile(file, []byte("changed content"), 0600))
+	changed, err := fileETag(file)
+	testutil.Ok(t, err)
+	attrs, err = b.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, changed, attrs.ETag)
+}
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "src", strings.NewReader("content"), objstore.WithUserMetadata(map[string]string{"k": "src"})))
+	testutil.Ok(t, b.Upload(ctx, "dst", strings.NewReader("other"), objstore.WithUserMetadata(map[string]string{"k": "dst"})))
+	testutil.Ok(t, b.Upload(ctx, "dir/obj", strings.NewReader("content")))
+
+	// A failed rename leaves the source object with its metadata in place.
+	testutil.NotOk(t, b.Rename(ctx, "src", "dir"))
+	attrs, err := b.Attributes(ctx, "src")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"k": "src"}, attrs.UserMetadata)
+
+	// Renaming replaces the object at dst together with its metadata.
+	testutil.Ok(t, b.Rename(ctx, "src", "dst"))
+	exists, err := b.Exists(ctx, "src")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "expected src to be moved")
+	attrs, err = b.Attributes(ctx, "dst")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"k": "src"}, attrs.UserMetadata)
+	testutil.Equals(t, int64(len("content")), attrs.Size)
+}
+
+func TestUpload_TempFileNotListed(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBucket(dir)
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, b.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, ".objstore-tmp-123"), []byte("partial"), 0600))
+	// Objects which merely look like temporary files are listed.
+	testutil.Ok(t, b.Upload(ctx, ".other.123.tmp", strings.NewReader("content")))
+
+	var seen []string
+	testutil.Ok(t, b.Iter(ctx, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{".other.123.tmp", "obj"}, seen)
+}
@@ -5,32 +5,131 @@
 package gcs
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"math"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/compute/metadata"
 	"cloud.google.com/go/storage"
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iamcredentials/v1"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/exthttp"
 )
 
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
+// DefaultBatchDeleteConcurrency is the default number of objects deleted concurrently by DeleteMany.
+const DefaultBatchDeleteConcurrency = 32
+
 // Config stores the configuration for gcs bucket.
 type Config struct {
 	Bucket         string `yaml:"bucket"`
 	ServiceAccount string `yaml:"service_account"`
+	// BatchDeleteConcurrency is the number of objects deleted concurrently by DeleteMany.
+	// DefaultBatchDeleteConcurrency is used if not set.
+	BatchDeleteConcurrency int `yaml:"batch_delete_concurrency"`
+	// ChunkSizeBytes is the size of the chunks in which objects are uploaded. Each chunk is buffered in memory
+	// and retried on its own if it fails. It must be a multiple of 256KiB. The default of the GCS client (16MiB)
+	// is used if not set. A negative value disables chunking, objects are then uploaded in a single request
+	// without buffering, which can't be retried.
+	ChunkSizeBytes int `yaml:"chunk_size_bytes"`
+	// KMSKeyName is the name of the Cloud KMS key used to encrypt uploaded and copied objects, e.g.
+	// projects/P/locations/L/keyRings/R/cryptoKeys/K. The default encryption of the bucket is used if empty.
+	KMSKeyName string `yaml:"kms_key_name"`
+	// BillingProject is the project which is billed for the requests to a requester pays bucket.
+	// Requests are billed to the project of the bucket if it is empty.
+	BillingProject string `yaml:"billing_project"`
+	// HTTPConfig configures the transport of the HTTP client. The default transport of the GCS client
+	// is used if not set. Otherwise, the fields which are not set are taken from DefaultHTTPConfig.
+	HTTPConfig exthttp.HTTPConfig `yaml:"http_config"`
+	// Retry configures retries of failed uploads.
+	Retry RetryConfig `yaml:"retry"`
+	// Endpoint overrides the URL of the GCS JSON API, e.g. https://localhost:4443/storage/v1/ to use a local
+	// emulator like fake-gcs-server. Objects are read over HTTPS from the host of the endpoint, so the emulator
+	// has to serve HTTPS; http_config.insecure_skip_verify can be set for self-signed certificates.
+	Endpoint string `yaml:"endpoint"`
+	// NoAuth disables the authentication of requests, e.g. for emulators. It can't be set together with
+	// ServiceAccount.
+	NoAuth bool `yaml:"no_auth"`
+	// VerifyChecksums makes Get and GetRange of whole objects verify the CRC32C checksum of the received
+	// content against the one stored by GCS, returning an error for which objstore.IsChecksumMismatchErr
+	// is true on a mismatch. It costs an additional request per read.
+	VerifyChecksums bool `yaml:"verify_checksums"`
+}
+
+// RetryPolicy decides which failed uploads are retried.
+type RetryPolicy string
+
+const (
+	// RetryIdempotent only retries requests which are idempotent. Uploads are not retried as a whole, as they
+	// replace the object unconditionally.
+	RetryIdempotent RetryPolicy = "idempotent"
+	// RetryAlways retries uploads as well, which is safe if uploading the same content twice is harmless.
+	RetryAlways RetryPolicy = "always"
+)
+
+// RetryConfig configures retries of uploads which failed with a transient error, i.e. HTTP 429 and 5xx
+// responses and connection errors. All other requests are retried by the GCS client itself until their
+// context is canceled, which is not configurable with the version of the client in use. Chunked uploads
+// retry each chunk on their own for a limited time as well, which RetryConfig adds to.
+type RetryConfig struct {
+	// MaxRetries is the maximum number of times a failed upload is retried. Zero disables retries.
+	MaxRetries int `yaml:"max_retries"`
+	// Policy is either "idempotent" (default) or "always". Uploads are only retried with "always".
+	Policy RetryPolicy `yaml:"policy"`
+	// InitialBackoff is the time to wait before the first retry, it doubles with each retry. Defaults to 1s.
+	InitialBackoff model.Duration `yaml:"initial_backoff"`
+	// MaxBackoff caps the time to wait between two attempts. Defaults to 30s.
+	MaxBackoff model.Duration `yaml:"max_backoff"`
+}
+
+func (c RetryConfig) validate() error {
+	if c.MaxRetries < 0 {
+		return errors.New("max retries must not be negative")
+	}
+	if c.Policy != "" && c.Policy != RetryIdempotent && c.Policy != RetryAlways {
+		return errors.Errorf("unknown retry policy %q, must be %q or %q", c.Policy, RetryIdempotent, RetryAlways)
+	}
+	if c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	if c.MaxBackoff != 0 && c.MaxBackoff < c.InitialBackoff {
+		return errors.New("max backoff must not be lower than initial backoff")
+	}
+	return nil
 }
 
 // Bucket implements the store.Bucket and shipper.Bucket interfaces against GCS.
@@ -39,53 +138,281 @@ type Bucket struct {
 	bkt    *storage.BucketHandle
 	name   string
 
+	// serviceAccount holds the configured credentials JSON. The credentials of credentialsProvider, or the
+	// default credentials if it is nil, are used if empty.
+	serviceAccount      []byte
+	credentialsProvider CredentialsProvider
+	// signer is used to sign URLs. It is resolved lazily on first use as resolving the default credentials
+	// might require talking to the metadata server.
+	signerMtx sync.Mutex
+	signer    *urlSigner
+
+	batchDeleteConcurrency int
+	chunkSize              int
+	kmsKeyName             string
+	retry                  RetryConfig
+	verifyChecksums        bool
+	billingProject         string
+
+	// jsonClient sends requests to the JSON API at jsonEndpoint which the GCS client doesn't support, e.g. for
+	// soft-deleted objects. It is nil for buckets created with NewBucketWithClient.
+	jsonClient   *http.Client
+	jsonEndpoint string
+
 	closer io.Closer
 }
 
+// CredentialsProvider returns the credentials used to authenticate the requests of a Bucket. It is called once
+// when the Bucket is created. The token source of the returned credentials is used for every request, so it has
+// to refresh expired tokens, as the token sources of google.FindDefaultCredentials do, e.g. for GKE Workload
+// Identity.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (*google.Credentials, error)
+}
+
+// DefaultCredentialsProvider looks up the Application Default Credentials with google.FindDefaultCredentials.
+// It is used unless the service account is set in the config or authentication is disabled.
+var DefaultCredentialsProvider CredentialsProvider = defaultCredentialsProvider{}
+
+type defaultCredentialsProvider struct{}
+
+func (defaultCredentialsProvider) Credentials(ctx context.Context) (*google.Credentials, error) {
+	return google.FindDefaultCredentials(ctx, storage.ScopeFullControl)
+}
+
+// Option configures a Bucket created by NewBucket or NewBucketWithConfig.
+type Option func(o *bucketOptions)
+
+type bucketOptions struct {
+	credentialsProvider CredentialsProvider
+}
+
+// WithCredentialsProvider authenticates requests with the credentials returned by p instead of the Application
+// Default Credentials, e.g. to use tokens from Vault or an external token file. It can't be used together with
+// the service account or no_auth options of the config.
+func WithCredentialsProvider(p CredentialsProvider) Option {
+	return func(o *bucketOptions) {
+		o.credentialsProvider = p
+	}
+}
+
 // NewBucket returns a new Bucket against the given bucket handle.
-func NewBucket(ctx context.Context, logger log.Logger, conf []byte, component string) (*Bucket, error) {
+func NewBucket(ctx context.Context, logger log.Logger, conf []byte, component string, options ...Option) (*Bucket, error) {
 	var gc Config
 	if err := yaml.Unmarshal(conf, &gc); err != nil {
 		return nil, err
 	}
 
-	return NewBucketWithConfig(ctx, logger, gc, component)
+	return NewBucketWithConfig(ctx, logger, gc, component, options...)
 }
 
 // NewBucketWithConfig returns a new Bucket with gcs Config struct.
-func NewBucketWithConfig(ctx context.Context, logger log.Logger, gc Config, component string) (*Bucket, error) {
+func NewBucketWithConfig(ctx context.Context, logger log.Logger, gc Config, component string, options ...Option) (*Bucket, error) {
 	if gc.Bucket == "" {
 		return nil, errors.New("missing Google Cloud Storage bucket name for stored blocks")
 	}
-
+	if gc.ChunkSizeBytes > 0 && gc.ChunkSizeBytes%googleapi.MinUploadChunkSize != 0 {
+		return nil, errors.Errorf("chunk size %d is not a multiple of %d bytes", gc.ChunkSizeBytes, googleapi.MinUploadChunkSize)
+	}
+	if err := gc.Retry.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate retry config")
+	}
+	if gc.NoAuth && gc.ServiceAccount != "" {
+		return nil, errors.New("no_auth and service_account are mutually exclusive")
+	}
+	var bo bucketOptions
+	for _, o := range options {
+		o(&bo)
+	}
+	if bo.credentialsProvider != nil && (gc.NoAuth || gc.ServiceAccount != "") {
+		return nil, errors.New("a credentials provider can't be used together with no_auth or service_account")
+	}
 	var opts []option.ClientOption
 
-	// If ServiceAccount is provided, use them in GCS client, otherwise fallback to Google default logic.
-	if gc.ServiceAccount != "" {
+	// If ServiceAccount is provided, use them in GCS client, otherwise fallback to the credentials provider,
+	// unless the requests are not authenticated anyway.
+	switch {
+	case gc.ServiceAccount != "":
 		credentials, err := google.CredentialsFromJSON(ctx, []byte(gc.ServiceAccount), storage.ScopeFullControl)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create credentials from JSON")
 		}
 		opts = append(opts, option.WithCredentials(credentials))
+	case gc.NoAuth, bo.credentialsProvider == nil && os.Getenv("STORAGE_EMULATOR_HOST") != "":
+		// The GCS client doesn't authenticate requests to emulators.
+	default:
+		provider := bo.credentialsProvider
+		if provider == nil {
+			provider = DefaultCredentialsProvider
+		}
+		credentials, err := provider.Credentials(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "get credentials")
+		}
+		opts = append(opts, option.WithCredentials(credentials))
 	}
 
 	opts = append(opts,
 		option.WithUserAgent(fmt.Sprintf("thanos-%s/%s (%s)", component, version.Version, runtime.Version())),
 	)
+	if gc.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(gc.Endpoint))
+	}
+	if gc.NoAuth {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+
+	if httpConfigSet(gc.HTTPConfig) {
+		rt, err := newTransport(gc.HTTPConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "create HTTP transport")
+		}
+		// A custom HTTP client replaces the authenticating client the GCS client creates otherwise,
+		// so the authentication has to be added to the transport here.
+		authOpts := append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, opts...)
+		if os.Getenv("STORAGE_EMULATOR_HOST") != "" || gc.NoAuth {
+			authOpts = append(authOpts, option.WithoutAuthentication())
+		}
+		authRT, err := htransport.NewTransport(ctx, rt, authOpts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "create authenticated HTTP transport")
+		}
+		opts = append(opts, option.WithHTTPClient(&http.Client{Transport: authRT}))
+	}
 
 	gcsClient, err := storage.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	bkt := &Bucket{
-		logger: logger,
-		bkt:    gcsClient.Bucket(gc.Bucket),
-		closer: gcsClient,
-		name:   gc.Bucket,
+	bkt := newBucket(logger, gcsClient, gc)
+	bkt.closer = gcsClient
+	bkt.credentialsProvider = bo.credentialsProvider
+	if bkt.jsonClient, bkt.jsonEndpoint, err = newJSONClient(ctx, opts); err != nil {
+		return nil, errors.Wrap(err, "create JSON API client")
 	}
 	return bkt, nil
 }
 
+// newJSONClient returns an HTTP client and the endpoint of the JSON API configured like the GCS client created
+// with the same options.
+func newJSONClient(ctx context.Context, opts []option.ClientOption) (*http.Client, string, error) {
+	endpoint := "https://storage.googleapis.com/storage/v1/"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = "http://" + host + "/storage/v1/"
+		opts = append([]option.ClientOption{option.WithoutAuthentication()}, opts...)
+	} else {
+		opts = append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, opts...)
+	}
+	client, ep, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	if ep != "" {
+		endpoint = ep
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	return client, endpoint, nil
+}
+
+// NewBucketWithClient returns a new Bucket using the given GCS client, e.g. to share it with other parts of an
+// application. The client is not closed by Close, as its lifecycle is managed by the caller. The Bucket uses
+// the defaults of Config for everything but the bucket name. The user agent is the one of the client, component
+// is accepted for consistency with NewBucket.
+func NewBucketWithClient(logger log.Logger, client *storage.Client, bucketName, component string) (*Bucket, error) {
+	if client == nil {
+		return nil, errors.New("missing Google Cloud Storage client")
+	}
+	if bucketName == "" {
+		return nil, errors.New("missing Google Cloud Storage bucket name for stored blocks")
+	}
+	return newBucket(logger, client, Config{Bucket: bucketName}), nil
+}
+
+// newBucket returns a new Bucket using the given client for the validated config.
+func newBucket(logger log.Logger, gcsClient *storage.Client, gc Config) *Bucket {
+	batchDeleteConcurrency := gc.BatchDeleteConcurrency
+	if batchDeleteConcurrency <= 0 {
+		batchDeleteConcurrency = DefaultBatchDeleteConcurrency
+	}
+	retry := gc.Retry
+	if retry.InitialBackoff == 0 {
+		retry.InitialBackoff = model.Duration(time.Second)
+	}
+	if retry.MaxBackoff == 0 {
+		retry.MaxBackoff = model.Duration(30 * time.Second)
+	}
+	if retry.MaxBackoff < retry.InitialBackoff {
+		retry.MaxBackoff = retry.InitialBackoff
+	}
+	bktHandle := gcsClient.Bucket(gc.Bucket)
+	if gc.BillingProject != "" {
+		bktHandle = bktHandle.UserProject(gc.BillingProject)
+	}
+	return &Bucket{
+		logger:                 logger,
+		bkt:                    bktHandle,
+		name:                   gc.Bucket,
+		serviceAccount:         []byte(gc.ServiceAccount),
+		batchDeleteConcurrency: batchDeleteConcurrency,
+		chunkSize:              gc.ChunkSizeBytes,
+		kmsKeyName:             gc.KMSKeyName,
+		retry:                  retry,
+		verifyChecksums:        gc.VerifyChecksums,
+		billingProject:         gc.BillingProject,
+	}
+}
+
+// DefaultHTTPConfig holds the transport settings used for the fields of Config.HTTPConfig which are not set,
+// if any of them is set.
+var DefaultHTTPConfig = exthttp.HTTPConfig{
+	IdleConnTimeout:       model.Duration(90 * time.Second),
+	ResponseHeaderTimeout: model.Duration(2 * time.Minute),
+	TLSHandshakeTimeout:   model.Duration(10 * time.Second),
+	ExpectContinueTimeout: model.Duration(1 * time.Second),
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   100,
+}
+
+// httpConfigSet returns true if any field of the given config is set. The config can't be compared to the zero
+// value as a whole, as the Transport field can hold a round tripper which is not comparable.
+func httpConfigSet(config exthttp.HTTPConfig) bool {
+	rt := config.Transport
+	config.Transport = nil
+	return rt != nil || config != (exthttp.HTTPConfig{})
+}
+
+// newTransport returns the base transport of the HTTP client for the given config, with the fields which are
+// not set taken from DefaultHTTPConfig.
+func newTransport(config exthttp.HTTPConfig) (http.RoundTripper, error) {
+	if config.Transport != nil {
+		return config.Transport, nil
+	}
+	if config.IdleConnTimeout == 0 {
+		config.IdleConnTimeout = DefaultHTTPConfig.IdleConnTimeout
+	}
+	if config.ResponseHeaderTimeout == 0 {
+		config.ResponseHeaderTimeout = DefaultHTTPConfig.ResponseHeaderTimeout
+	}
+	if config.TLSHandshakeTimeout == 0 {
+		config.TLSHandshakeTimeout = DefaultHTTPConfig.TLSHandshakeTimeout
+	}
+	if config.ExpectContinueTimeout == 0 {
+		config.ExpectContinueTimeout = DefaultHTTPConfig.ExpectContinueTimeout
+	}
+	if config.MaxIdleConns == 0 {
+		config.MaxIdleConns = DefaultHTTPConfig.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost == 0 {
+		config.MaxIdleConnsPerHost = DefaultHTTPConfig.MaxIdleConnsPerHost
+	}
+	if config.MaxConnsPerHost == 0 {
+		config.MaxConnsPerHost = DefaultHTTPConfig.MaxConnsPerHost
+	}
+	return exthttp.DefaultTransport(config)
+}
+
 // Name returns the bucket name for gcs.
 func (b *Bucket) Name() string {
 	return b.name
@@ -94,62 +421,289 @@ func (b *Bucket) Name() string {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(attrs objstore.IterObjectAttributes) error {
+		return f(attrs.Name)
+	}, options...)
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter.
+// In addition to Name, it also includes requested object attributes in the argument to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
 
+	params := objstore.ApplyIterOptions(options...)
+
 	// If recursive iteration is enabled we should pass an empty delimiter.
 	delimiter := DirDelim
-	if objstore.ApplyIterOptions(options...).Recursive {
+	if params.Recursive {
 		delimiter = ""
 	}
 
+	// The context is passed to the requests listing the objects, so a cancellation aborts a pending
+	// request and is returned by it.Next.
 	it := b.bkt.Objects(ctx, &storage.Query{
 		Prefix:    dir,
 		Delimiter: delimiter,
 	})
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	for count := 0; params.MaxResults <= 0 || count < params.MaxResults; {
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			return nil
 		}
 		if err != nil {
-			return err
+			return wrapErr(objstore.OpIter, dir, err)
+		}
+
+		// The GCS client doesn't support the startOffset parameter of the API yet, so the entries
+		// before it are skipped here.
+		if params.StartAfter != "" && attrs.Prefix+attrs.Name <= params.StartAfter {
+			continue
+		}
+		isDir := attrs.Prefix != ""
+		if !isDir && (params.PrefixesOnly || params.SkipStorageClass(attrs.StorageClass)) {
+			continue
+		}
+
+		objAttrs := objstore.IterObjectAttributes{Name: attrs.Prefix + attrs.Name}
+		if params.ETag {
+			objAttrs.SetETag(attrs.Etag)
+		}
+		if params.Size && !isDir {
+			objAttrs.SetSize(attrs.Size)
+		}
+		if params.StorageClass && !isDir {
+			objAttrs.SetStorageClass(attrs.StorageClass)
+		}
+		if params.LastModified && !isDir {
+			objAttrs.SetLastModified(attrs.Updated)
 		}
-		if err := f(attrs.Prefix + attrs.Name); err != nil {
+		if params.CreatedAt && !isDir {
+			objAttrs.SetCreatedAt(attrs.Created)
+		}
+		if params.UserMetadata && !isDir {
+			objAttrs.SetUserMetadata(userMetadata(attrs.Metadata))
+		}
+		if err := f(objAttrs); err != nil {
 			return err
 		}
+		count++
 	}
+	return nil
+}
+
+// SupportedIterOptions returns the list of IterOptions supported by GCS.
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive, objstore.ETag, objstore.MaxResults, objstore.Size, objstore.StorageClass, objstore.StartAfter, objstore.PrefixesOnly, objstore.UserMetadata, objstore.UpdatedAt, objstore.CreatedAt}
 }
 
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.bkt.Object(name).NewReader(ctx)
+	if b.verifyChecksums {
+		return b.getVerified(ctx, objstore.OpGet, name, 0, -1)
+	}
+	r, err := b.bkt.Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	return r, nil
+}
+
+// GetWithAttributes returns a reader for the given object name and the attributes of the object. The attributes
+// are taken from the response of the read, which only holds the size, last modification time, content type,
+// content encoding and generation of the object. If checksums are verified, the attributes are fetched before the
+// read anyway, so all of them are returned.
+func (b *Bucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, objstore.ObjectAttributes, error) {
+	if b.verifyChecksums {
+		r, attrs, err := b.getVerifiedWithAttrs(ctx, objstore.OpGet, name, 0, -1)
+		if err != nil {
+			return nil, objstore.ObjectAttributes{}, err
+		}
+		return r, objectAttributes(attrs), nil
+	}
+	r, err := b.bkt.Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, objstore.ObjectAttributes{}, wrapErr(objstore.OpGet, name, err)
+	}
+	return r, objstore.ObjectAttributes{
+		Size:            r.Attrs.Size,
+		LastModified:    r.Attrs.LastModified,
+		ContentType:     r.Attrs.ContentType,
+		ContentEncoding: r.Attrs.ContentEncoding,
+		VersionID:       strconv.FormatInt(r.Attrs.Generation, 10),
+	}, nil
+}
+
+// GetWithOptions returns a reader for the given object name. GCS decompresses objects uploaded with the gzip
+// content encoding when reading them, so WithDecodeContent doesn't change the returned content, unless
+// WithReadCompressed is given to read them as they are stored.
+func (b *Bucket) GetWithOptions(ctx context.Context, name string, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	if !objstore.ApplyObjectGetOptions(opts...).ReadCompressed {
+		return b.Get(ctx, name)
+	}
+	r, err := b.bkt.Object(name).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	return r, nil
+}
+
+// GetRangeWithOptions returns a new range reader for the given object name and range. The range is taken from the
+// decompressed content of objects uploaded with the gzip content encoding, unless WithReadCompressed is given to
+// take it from the content as it is stored.
+func (b *Bucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	if !objstore.ApplyObjectGetOptions(opts...).ReadCompressed {
+		return b.GetRange(ctx, name, off, length)
+	}
+	if off < 0 && length != -1 {
+		return nil, wrapErr(objstore.OpGetRange, name, errors.Errorf("suffix range requires length -1, got %d", length))
+	}
+	r, err := b.bkt.Object(name).ReadCompressed(true).NewRangeReader(ctx, off, length)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGetRange, name, err)
+	}
+	return r, nil
 }
 
 // GetRange returns a new range reader for the given object name and range.
+// A negative off is passed through to GCS as a suffix range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	return b.bkt.Object(name).NewRangeReader(ctx, off, length)
+	if off < 0 && length != -1 {
+		return nil, wrapErr(objstore.OpGetRange, name, errors.Errorf("suffix range requires length -1, got %d", length))
+	}
+	if b.verifyChecksums {
+		return b.getVerified(ctx, objstore.OpGetRange, name, off, length)
+	}
+	r, err := b.bkt.Object(name).NewRangeReader(ctx, off, length)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGetRange, name, err)
+	}
+	return r, nil
+}
+
+// getVerified returns a reader for the given range which verifies the CRC32C checksum of the object once it
+// was read completely. Ranges which don't cover the whole object can't be verified, as GCS only stores
+// the checksum of the whole object.
+func (b *Bucket) getVerified(ctx context.Context, op, name string, off, length int64) (io.ReadCloser, error) {
+	r, _, err := b.getVerifiedWithAttrs(ctx, op, name, off, length)
+	return r, err
+}
+
+// getVerifiedWithAttrs is getVerified which also returns the attributes of the generation which is read.
+func (b *Bucket) getVerifiedWithAttrs(ctx context.Context, op, name string, off, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	obj := b.bkt.Object(name)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, nil, wrapErr(op, name, err)
+	}
+	// Read the generation the checksum belongs to, so that concurrent overwrites aren't reported as corruption.
+	r, err := obj.Generation(attrs.Generation).NewRangeReader(ctx, off, length)
+	if err != nil {
+		return nil, nil, wrapErr(op, name, err)
+	}
+	if off != 0 || (length >= 0 && length < attrs.Size) {
+		return r, attrs, nil
+	}
+	return &crc32cVerifyReader{r: r, op: op, name: name, size: attrs.Size, want: attrs.CRC32C, hash: crc32.New(crc32cTable)}, attrs, nil
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32cVerifyReader computes the CRC32C checksum of the content read from r and compares it to the expected
+// one once all bytes were read, before EOF is returned to the caller, or on Close if the caller stopped
+// reading right after the last byte.
+type crc32cVerifyReader struct {
+	r    *storage.Reader
+	op   string
+	name string
+
+	size     int64
+	read     int64
+	want     uint32
+	hash     hash.Hash32
+	verified bool
+	err      error
+}
+
+func (r *crc32cVerifyReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	_, _ = r.hash.Write(p[:n])
+	// The GCS client may report its own error for a corrupted read, which is replaced to report the mismatch.
+	if err != nil && r.read == r.size {
+		if verifyErr := r.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+// verify compares the checksums once all content was read. A mismatch is reported again by each call.
+func (r *crc32cVerifyReader) verify() error {
+	if r.verified || r.read != r.size {
+		return r.err
+	}
+	r.verified = true
+	if got := r.hash.Sum32(); got != r.want {
+		r.err = wrapErr(r.op, r.name, &objstore.ChecksumMismatchError{
+			Algorithm: "CRC32C",
+			Expected:  crc32cBytes(r.want),
+			Actual:    crc32cBytes(got),
+		})
+	}
+	return r.err
+}
+
+// crc32cBytes encodes the checksum in big-endian byte order, as done by GCS.
+func crc32cBytes(sum uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, sum)
+	return b
+}
+
+func (r *crc32cVerifyReader) ObjectSize() (int64, error) {
+	return r.size, nil
+}
+
+func (r *crc32cVerifyReader) Close() error {
+	verifyErr := r.verify()
+	if err := r.r.Close(); err != nil {
+		return err
+	}
+	return verifyErr
 }
 
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	attrs, err := b.bkt.Object(name).Attrs(ctx)
 	if err != nil {
-		return objstore.ObjectAttributes{}, err
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, err)
 	}
+	return objectAttributes(attrs), nil
+}
 
+func objectAttributes(attrs *storage.ObjectAttrs) objstore.ObjectAttributes {
 	return objstore.ObjectAttributes{
-		Size:         attrs.Size,
-		LastModified: attrs.Updated,
-	}, nil
+		Size:            attrs.Size,
+		LastModified:    attrs.Updated,
+		ETag:            attrs.Etag,
+		ContentType:     attrs.ContentType,
+		StorageClass:    attrs.StorageClass,
+		UserMetadata:    userMetadata(attrs.Metadata),
+		MD5:             attrs.MD5,
+		CRC32C:          &attrs.CRC32C,
+		VersionID:       strconv.FormatInt(attrs.Generation, 10),
+		ContentEncoding: attrs.ContentEncoding,
+		CacheControl:    attrs.CacheControl,
+		CreatedAt:       attrs.Created,
+	}
 }
 
 // Handle returns the underlying GCS bucket handle.
@@ -163,37 +717,1148 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	if _, err := b.bkt.Object(name).Attrs(ctx); err == nil {
 		return true, nil
 	} else if err != storage.ErrObjectNotExist {
-		return false, err
+		return false, wrapErr(objstore.OpExists, name, err)
 	}
 	return false, nil
 }
 
 // Upload writes the file specified in src to remote GCS location specified as target.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
-	w := b.bkt.Object(name).NewWriter(ctx)
+// Failed uploads are retried according to the retry config if r implements io.Seeker, so that it can be rewound.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	upload := func() error {
+		return b.writeObject(ctx, b.bkt.Object(name), r, opts...)
+	}
+
+	seeker, ok := r.(io.Seeker)
+	if b.retry.Policy != RetryAlways || b.retry.MaxRetries == 0 || !ok {
+		return upload()
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return upload()
+	}
+
+	backoff := time.Duration(b.retry.InitialBackoff)
+	for retries := 0; ; retries++ {
+		err := upload()
+		if err == nil || retries >= b.retry.MaxRetries || !isRetryable(err) {
+			return err
+		}
+
+		// Wait between half and the full backoff, so that concurrent uploads don't retry in lockstep.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = time.Duration(math.Min(float64(2*backoff), float64(b.retry.MaxBackoff)))
+
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return errors.Wrap(err, "rewind reader")
+		}
+	}
+}
+
+// isRetryable returns true for errors which GCS recommends to retry: HTTP 429 and 5xx responses and
+// connection errors.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code == http.StatusTooManyRequests || (gerr.Code >= 500 && gerr.Code < 600)
+	}
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		msg := uerr.Error()
+		return strings.Contains(msg, "connection refused") || strings.Contains(msg, "connection reset")
+	}
+	return false
+}
+
+// UploadIfNotExists writes the contents of the reader as an object into the bucket only if it does not exist yet.
+// It uses the DoesNotExist precondition, so it is safe to use for concurrent creators.
+func (b *Bucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	if err := b.writeObject(ctx, b.bkt.Object(name).If(storage.Conditions{DoesNotExist: true}), r); err != nil {
+		if isPreconditionFailed(err) {
+			return false, nil
+		}
+		return false, wrapErr(objstore.OpUpload, name, err)
+	}
+	return true, nil
+}
 
+// UploadIfMatch writes the contents of the reader as an object into the bucket only if the ETag of the existing
+// object equals etag. The ETag is mapped to the generation of the object, which the upload is conditioned on,
+// so it is safe to use for concurrent updaters.
+func (b *Bucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...objstore.ObjectUploadOption) error {
+	obj := b.bkt.Object(name)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return wrapErr(objstore.OpUpload, name, errors.Wrap(objstore.ErrPreconditionFailed, "object does not exist"))
+		}
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	if attrs.Etag != etag {
+		return wrapErr(objstore.OpUpload, name, errors.Wrapf(objstore.ErrPreconditionFailed, "ETag %s does not match %s", attrs.Etag, etag))
+	}
+
+	return wrapErr(objstore.OpUpload, name, b.writeObject(ctx, obj.If(storage.Conditions{GenerationMatch: attrs.Generation}), r, opts...))
+}
+
+// UploadPrecondition is a precondition on the generation of the existing object, which GCS checks atomically
+// when an upload is completed.
+type UploadPrecondition struct {
+	conds storage.Conditions
+}
+
+// IfDoesNotExist makes an upload fail if the object already exists.
+var IfDoesNotExist = UploadPrecondition{conds: storage.Conditions{DoesNotExist: true}}
+
+// IfGenerationMatch makes an upload fail unless the current generation of the object is gen, i.e. the object
+// was not overwritten since the generation was read.
+func IfGenerationMatch(gen int64) UploadPrecondition {
+	return UploadPrecondition{conds: storage.Conditions{GenerationMatch: gen}}
+}
+
+// IfGenerationNotMatch makes an upload fail if the current generation of the object is gen.
+func IfGenerationNotMatch(gen int64) UploadPrecondition {
+	return UploadPrecondition{conds: storage.Conditions{GenerationNotMatch: gen}}
+}
+
+// UploadWithPrecondition writes the contents of the reader as an object into the bucket if the precondition is
+// met when the upload is completed. Otherwise, it fails with an error for which objstore.IsPreconditionFailedErr
+// returns true. The generation of an object is reported as the VersionID of its attributes.
+func (b *Bucket) UploadWithPrecondition(ctx context.Context, name string, r io.Reader, cond UploadPrecondition, opts ...objstore.ObjectUploadOption) error {
+	return wrapErr(objstore.OpUpload, name, b.writeObject(ctx, b.bkt.Object(name).If(cond.conds), r, opts...))
+}
+
+// writeObject uploads the contents of the reader as the given object. If reading the content or writing it
+// fails, the upload is aborted by cancelling the context of the writer, which is the only way to abort a GCS
+// upload, so that neither a partial object is created nor the upload is left pending.
+func (b *Bucket) writeObject(ctx context.Context, obj *storage.ObjectHandle, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := b.newWriter(ctx, obj, opts...)
+	if err != nil {
+		return err
+	}
 	if _, err := io.Copy(w, r); err != nil {
+		return publicReadErr(err, opts...)
+	}
+	return publicReadErr(w.Close(), opts...)
+}
+
+// publicReadErr returns an error matching objstore.ErrOptionNotSupported if err reports that the publicRead ACL
+// requested with objstore.WithPublicRead was rejected, because the bucket has uniform bucket-level access enabled.
+// Otherwise, it returns err.
+func publicReadErr(err error, opts ...objstore.ObjectUploadOption) error {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusBadRequest || !strings.Contains(gerr.Message, "uniform bucket-level access") {
 		return err
 	}
-	return w.Close()
+	if !objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return err
+	}
+	return errors.Wrapf(objstore.ErrOptionNotSupported, "public read on bucket with uniform bucket-level access: %s", gerr.Message)
 }
 
-// Delete removes the object with the given name.
-func (b *Bucket) Delete(ctx context.Context, name string) error {
-	return b.bkt.Object(name).Delete(ctx)
+// newWriter returns a writer for the given object which uploads it in chunks of the configured size.
+func (b *Bucket) newWriter(ctx context.Context, obj *storage.ObjectHandle, opts ...objstore.ObjectUploadOption) (*storage.Writer, error) {
+	params := objstore.ApplyObjectUploadOptions(opts...)
+	if err := validateStorageClass(params.StorageClass); err != nil {
+		return nil, err
+	}
+	if err := objstore.ValidateUserMetadata(params.UserMetadata); err != nil {
+		return nil, err
+	}
+
+	w := obj.NewWriter(ctx)
+	if b.chunkSize > 0 {
+		w.ChunkSize = b.chunkSize
+	} else if b.chunkSize < 0 {
+		w.ChunkSize = 0
+	}
+	w.ContentType = params.ContentType
+	w.CacheControl = params.CacheControl
+	w.ContentEncoding = params.ContentEncoding
+	w.Metadata = params.UserMetadata
+	w.StorageClass = params.StorageClass
+	w.KMSKeyName = b.kmsKeyName
+	// GCS rejects the upload for buckets with uniform bucket-level access enabled, see publicReadErr.
+	if params.PublicRead {
+		w.PredefinedACL = "publicRead"
+	}
+	// GCS rejects the upload if the checksums of the received content don't match.
+	w.MD5 = params.MD5
+	w.CRC32C = params.CRC32C
+	w.SendCRC32C = params.SendCRC32C
+	return w, nil
 }
 
-// IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
-func (b *Bucket) IsObjNotFoundErr(err error) bool {
-	return errors.Is(err, storage.ErrObjectNotExist)
+// storageClasses are the storage classes supported by GCS, including the legacy ones.
+var storageClasses = []string{"STANDARD", "NEARLINE", "COLDLINE", "ARCHIVE", "MULTI_REGIONAL", "REGIONAL", "DURABLE_REDUCED_AVAILABILITY"}
+
+// validateStorageClass returns an error if the storage class is not empty and not known to GCS.
+func validateStorageClass(storageClass string) error {
+	if storageClass == "" {
+		return nil
+	}
+	for _, c := range storageClasses {
+		if storageClass == c {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown storage class %q, expected one of %s", storageClass, strings.Join(storageClasses, ", "))
 }
 
-// IsCustomerManagedKeyError returns true if the permissions for key used to encrypt the object was revoked.
-func (b *Bucket) IsCustomerManagedKeyError(_ error) bool {
-	return false
+// NewMultipartUpload starts a new GCS resumable upload of the object with the given name. The parts are
+// streamed into the upload, which is sent in chunks of Config.ChunkSizeBytes. Failed chunks are retried
+// by the GCS client, so a failed part can't be retried and the upload has to be aborted.
+func (b *Bucket) NewMultipartUpload(ctx context.Context, name string, opts ...objstore.ObjectUploadOption) (objstore.MultipartWriter, error) {
+	// Cancelling the context of the writer is the only way to abort a GCS upload.
+	ctx, cancel := context.WithCancel(ctx)
+	w, err := b.newWriter(ctx, b.bkt.Object(name), opts...)
+	if err != nil {
+		cancel()
+		return nil, wrapErr(objstore.OpUpload, name, err)
+	}
+	return &multipartWriter{w: w, name: name, cancel: cancel}, nil
 }
 
-func (b *Bucket) Close() error {
+// multipartWriter streams the parts of an object into a GCS resumable upload.
+type multipartWriter struct {
+	w      *storage.Writer
+	name   string
+	cancel context.CancelFunc
+}
+
+// WritePart writes the next part of the object into the upload. The context and size are not used,
+// as the upload is bound to the context passed to NewMultipartUpload.
+func (w *multipartWriter) WritePart(_ context.Context, r io.Reader, _ int64) error {
+	if _, err := io.Copy(w.w, r); err != nil {
+		return wrapErr(objstore.OpUpload, w.name, err)
+	}
+	return nil
+}
+
+// Complete flushes the remaining data and finalizes the upload.
+func (w *multipartWriter) Complete(_ context.Context) error {
+	defer w.cancel()
+	return wrapErr(objstore.OpUpload, w.name, w.w.Close())
+}
+
+// Abort cancels the upload. GCS doesn't keep the data of unfinished resumable uploads.
+func (w *multipartWriter) Abort(_ context.Context) error {
+	w.cancel()
+	// Close only reports the cancellation at this point.
+	_ = w.w.Close()
+	return nil
+}
+
+func isPreconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
+
+// Delete removes the object with the given name.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	return wrapErr(objstore.OpDelete, name, b.bkt.Object(name).Delete(ctx))
+}
+
+// DeleteMany removes the objects with the given names. GCS has no bulk delete API, so the objects are
+// deleted concurrently by a bounded pool of Config.BatchDeleteConcurrency workers. Objects which don't exist are
+// skipped.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	var (
+		wg  sync.WaitGroup
+		mtx sync.Mutex
+		sem = make(chan struct{}, b.batchDeleteConcurrency)
+		res = &objstore.BatchDeleteResult{Errors: map[string]error{}}
+	)
+	for _, name := range names {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := b.bkt.Object(name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				mtx.Lock()
+				res.Errors[name] = wrapErr(objstore.OpDelete, name, err)
+				mtx.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+	return res.Err()
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+// The copy is done server-side using the GCS rewrite API.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	copier := b.bkt.Object(dst).CopierFrom(b.bkt.Object(src))
+	copier.DestinationKMSKeyName = b.kmsKeyName
+	if _, err := copier.Run(ctx); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy gcs object %s to %s", src, dst))
+	}
+	return nil
+}
+
+// CopyFromBucket copies the object with the src name in the src bucket into a new object with the dst name
+// server-side using the GCS rewrite API. It returns objstore.ErrCrossBucketCopyNotSupported unless src is a GCS
+// bucket, which can be wrapped. The credentials of this bucket have to allow reading from src.
+func (b *Bucket) CopyFromBucket(ctx context.Context, src objstore.Bucket, srcName, dstName string) error {
+	inner, srcName := objstore.UnwrapObject(src, srcName)
+	s, ok := inner.(*Bucket)
+	if !ok {
+		return objstore.ErrCrossBucketCopyNotSupported
+	}
+	copier := b.bkt.Object(dstName).CopierFrom(s.bkt.Object(srcName))
+	copier.DestinationKMSKeyName = b.kmsKeyName
+	if _, err := copier.Run(ctx); err != nil {
+		return wrapErr(objstore.OpCopy, srcName, errors.Wrapf(err, "copy gcs object %s of bucket %s to %s", srcName, s.name, dstName))
+	}
+	return nil
+}
+
+// Rename moves the object with the src name to the dst name by copying it and deleting src afterwards.
+// Both requests are conditioned on the generation of src, so that a src which is replaced concurrently
+// is neither copied nor deleted.
+func (b *Bucket) Rename(ctx context.Context, src, dst string) error {
+	srcObj := b.bkt.Object(src)
+	attrs, err := srcObj.Attrs(ctx)
+	if err != nil {
+		return wrapErr(objstore.OpCopy, src, err)
+	}
+	srcObj = srcObj.If(storage.Conditions{GenerationMatch: attrs.Generation})
+
+	copier := b.bkt.Object(dst).CopierFrom(srcObj)
+	copier.DestinationKMSKeyName = b.kmsKeyName
+	if _, err := copier.Run(ctx); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy gcs object %s to %s", src, dst))
+	}
+	if err := srcObj.Delete(ctx); err != nil {
+		return wrapErr(objstore.OpDelete, src, errors.Wrapf(err, "delete gcs object %s after copying it to %s", src, dst))
+	}
+	return nil
+}
+
+// ListVersions returns all generations of the object with the given name, including noncurrent ones.
+// GCS has no delete markers, deleting an object in a versioned bucket only makes its generation noncurrent.
+func (b *Bucket) ListVersions(ctx context.Context, name string) ([]objstore.VersionInfo, error) {
+	var versions []objstore.VersionInfo
+	it := b.bkt.Objects(ctx, &storage.Query{Prefix: name, Versions: true})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			// GCS lists the generations of an object from the oldest to the newest one.
+			for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+				versions[i], versions[j] = versions[j], versions[i]
+			}
+			return versions, nil
+		}
+		if err != nil {
+			return nil, wrapErr(objstore.OpIter, name, errors.Wrapf(err, "list versions of gcs object %s", name))
+		}
+		if attrs.Name != name {
+			continue
+		}
+		versions = append(versions, objstore.VersionInfo{
+			VersionID:    strconv.FormatInt(attrs.Generation, 10),
+			LastModified: attrs.Updated,
+			Size:         attrs.Size,
+		})
+	}
+}
+
+// tagsMetadataKey is the metadata key under which the tags of an object are stored as JSON. GCS has no object
+// tagging API, so tags are kept in the object metadata, which can be updated without uploading the object again.
+const tagsMetadataKey = "x-goog-meta-tags"
+
+// userMetadata returns the metadata of an object without the reserved key holding its tags.
+func userMetadata(metadata map[string]string) map[string]string {
+	if _, ok := metadata[tagsMetadataKey]; !ok {
+		return metadata
+	}
+	res := make(map[string]string, len(metadata)-1)
+	for k, v := range metadata {
+		if k != tagsMetadataKey {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// SetObjectTags replaces the tags of the object. The tags are stored in the object metadata under a reserved key,
+// which is hidden from the user metadata returned by Attributes and IterWithAttributes.
+func (b *Bucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) error {
+	value, err := json.Marshal(tags)
+	if err != nil {
+		return wrapErr(objstore.OpUpload, name, errors.Wrap(err, "encode tags"))
+	}
+	return b.updateTags(ctx, name, string(value))
+}
+
+// GetObjectTags returns the tags of the object.
+func (b *Bucket) GetObjectTags(ctx context.Context, name string) (map[string]string, error) {
+	attrs, err := b.bkt.Object(name).Attrs(ctx)
+	if err != nil {
+		return nil, wrapErr(objstore.OpAttributes, name, err)
+	}
+	tags := map[string]string{}
+	if value := attrs.Metadata[tagsMetadataKey]; value != "" {
+		if err := json.Unmarshal([]byte(value), &tags); err != nil {
+			return nil, wrapErr(objstore.OpAttributes, name, errors.Wrap(err, "decode tags"))
+		}
+	}
+	return tags, nil
+}
+
+// DeleteObjectTags removes all tags of the object.
+func (b *Bucket) DeleteObjectTags(ctx context.Context, name string) error {
+	return b.updateTags(ctx, name, "")
+}
+
+// updateTags sets the metadata key holding the tags of the object, leaving the rest of its metadata untouched.
+func (b *Bucket) updateTags(ctx context.Context, name, value string) error {
+	_, err := b.bkt.Object(name).Update(ctx, storage.ObjectAttrsToUpdate{Metadata: map[string]string{tagsMetadataKey: value}})
+	return wrapErr(objstore.OpUpload, name, err)
+}
+
+// IterVersions calls f for each generation of the objects whose names start with prefix. GCS has no delete
+// markers, so deleted is always false: the latest generation of a deleted object is reported as not being
+// the latest one instead.
+func (b *Bucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	// GCS lists the generations of an object from the oldest to the newest one, so they are buffered per object
+	// to pass them from the newest one.
+	var generations []*storage.ObjectAttrs
+	flush := func() error {
+		for i := len(generations) - 1; i >= 0; i-- {
+			attrs := generations[i]
+			// Noncurrent generations have the time they became noncurrent as deletion time.
+			if err := f(attrs.Name, strconv.FormatInt(attrs.Generation, 10), attrs.Deleted.IsZero(), false); err != nil {
+				return err
+			}
+		}
+		generations = generations[:0]
+		return nil
+	}
+
+	it := b.bkt.Objects(ctx, &storage.Query{Prefix: prefix, Versions: true})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return flush()
+		}
+		if err != nil {
+			return wrapErr(objstore.OpIter, prefix, errors.Wrapf(err, "list versions of gcs objects with prefix %s", prefix))
+		}
+		if len(generations) > 0 && generations[0].Name != attrs.Name {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		generations = append(generations, attrs)
+	}
+}
+
+// versionObject returns the handle of the given generation of the object.
+func (b *Bucket) versionObject(name, versionID string) (*storage.ObjectHandle, error) {
+	gen, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse generation %q of gcs object %s", versionID, name)
+	}
+	return b.bkt.Object(name).Generation(gen), nil
+}
+
+// GetVersion returns a reader for the given generation of the object.
+func (b *Bucket) GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
+	obj, err := b.versionObject(name, versionID)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	return r, nil
+}
+
+// DeleteVersion permanently deletes the given generation of the object.
+func (b *Bucket) DeleteVersion(ctx context.Context, name, versionID string) error {
+	obj, err := b.versionObject(name, versionID)
+	if err != nil {
+		return wrapErr(objstore.OpDelete, name, err)
+	}
+	return wrapErr(objstore.OpDelete, name, obj.Delete(ctx))
+}
+
+// RestoreVersion copies the given generation of the object over its live version.
+func (b *Bucket) RestoreVersion(ctx context.Context, name, versionID string) error {
+	obj, err := b.versionObject(name, versionID)
+	if err != nil {
+		return wrapErr(objstore.OpCopy, name, err)
+	}
+	copier := b.bkt.Object(name).CopierFrom(obj)
+	copier.DestinationKMSKeyName = b.kmsKeyName
+	if _, err := copier.Run(ctx); err != nil {
+		return wrapErr(objstore.OpCopy, name, errors.Wrapf(err, "restore generation %s of gcs object %s", versionID, name))
+	}
+	return nil
+}
+
+// SoftDeletedObject is an object which was deleted from a bucket with a soft delete policy. It can be restored
+// with RestoreSoftDeleted until HardDeleteTime.
+type SoftDeletedObject struct {
+	Name           string
+	Generation     int64
+	SoftDeleteTime time.Time
+	HardDeleteTime time.Time
+}
+
+// IterSoftDeleted calls f for each soft-deleted object whose name starts with prefix. Soft-deleted objects are
+// retained by GCS until the retention of the soft delete policy of the bucket passes and are not returned by
+// Iter. They can't be deleted before, the retention can only be lowered with the policy of the bucket.
+func (b *Bucket) IterSoftDeleted(ctx context.Context, prefix string, f func(SoftDeletedObject) error) error {
+	if b.jsonClient == nil {
+		return errors.New("soft-deleted objects are not supported by buckets created with NewBucketWithClient")
+	}
+	var pageToken string
+	for {
+		query := url.Values{"softDeleted": {"true"}, "prefix": {prefix}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var list struct {
+			Items []struct {
+				Name           string    `json:"name"`
+				Generation     int64     `json:"generation,string"`
+				SoftDeleteTime time.Time `json:"softDeleteTime"`
+				HardDeleteTime time.Time `json:"hardDeleteTime"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := b.doJSON(ctx, http.MethodGet, "o", query, &list); err != nil {
+			return wrapErr(objstore.OpIter, prefix, errors.Wrap(err, "list soft-deleted gcs objects"))
+		}
+		for _, item := range list.Items {
+			if err := f(SoftDeletedObject(item)); err != nil {
+				return err
+			}
+		}
+		if list.NextPageToken == "" {
+			return nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// RestoreSoftDeleted restores the most recently soft-deleted generation of the object with the given name as its
+// live version. It fails with an error for which IsObjNotFoundErr returns true if no such generation exists.
+func (b *Bucket) RestoreSoftDeleted(ctx context.Context, name string) error {
+	var latest *SoftDeletedObject
+	if err := b.IterSoftDeleted(ctx, name, func(obj SoftDeletedObject) error {
+		if obj.Name == name && (latest == nil || obj.SoftDeleteTime.After(latest.SoftDeleteTime)) {
+			latest = &obj
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if latest == nil {
+		return wrapErr(objstore.OpCopy, name, storage.ErrObjectNotExist)
+	}
+	query := url.Values{"generation": {strconv.FormatInt(latest.Generation, 10)}}
+	if err := b.doJSON(ctx, http.MethodPost, "o/"+url.PathEscape(name)+"/restore", query, nil); err != nil {
+		return wrapErr(objstore.OpCopy, name, errors.Wrapf(err, "restore soft-deleted generation %d of gcs object %s", latest.Generation, name))
+	}
+	return nil
+}
+
+// maxBatchSize is the maximum number of requests GCS accepts in a single batch request.
+const maxBatchSize = 100
+
+// BatchAttributes returns the attributes of the objects with the given names, requesting them with batch requests
+// of up to 100 objects of the JSON API. Objects which don't exist are left out of the returned map. Any other
+// failure fails the whole call. Buckets created with NewBucketWithClient request the attributes one by one.
+func (b *Bucket) BatchAttributes(ctx context.Context, names []string) (map[string]objstore.ObjectAttributes, error) {
+	res := make(map[string]objstore.ObjectAttributes, len(names))
+	if b.jsonClient == nil {
+		for _, name := range names {
+			attrs, err := b.Attributes(ctx, name)
+			if b.IsObjNotFoundErr(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			res[name] = attrs
+		}
+		return res, nil
+	}
+
+	unique := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			unique = append(unique, name)
+		}
+	}
+	for len(unique) > 0 {
+		n := len(unique)
+		if n > maxBatchSize {
+			n = maxBatchSize
+		}
+		if err := b.batchAttributes(ctx, unique[:n], res); err != nil {
+			return nil, err
+		}
+		unique = unique[n:]
+	}
+	return res, nil
+}
+
+// BatchExists returns whether the objects with the given names exist, checking them with BatchAttributes.
+func (b *Bucket) BatchExists(ctx context.Context, names []string) (map[string]bool, error) {
+	attrs, err := b.BatchAttributes(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]bool, len(names))
+	for _, name := range names {
+		_, res[name] = attrs[name]
+	}
+	return res, nil
+}
+
+// batchAttributes requests the attributes of the objects with the given names in a single batch request and adds
+// the ones of existing objects to res.
+func (b *Bucket) batchAttributes(ctx context.Context, names []string, res map[string]objstore.ObjectAttributes) error {
+	endpoint, err := url.Parse(b.jsonEndpoint)
+	if err != nil {
+		return errors.Wrap(err, "parse gcs json endpoint")
+	}
+	query := url.Values{}
+	if b.billingProject != "" {
+		query.Set("userProject", b.billingProject)
+	}
+
+	// Each part of the request body is a request of the JSON API, which is identified by its Content-ID in the
+	// part of the response body.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, name := range names {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {fmt.Sprintf("<%d>", i)},
+		})
+		if err != nil {
+			return err
+		}
+		path := endpoint.Path + "b/" + url.PathEscape(b.name) + "/o/" + url.PathEscape(name)
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+		if _, err := fmt.Fprintf(pw, "GET %s HTTP/1.1\r\n\r\n", path); err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	batchURL := *endpoint
+	batchURL.Path = strings.TrimSuffix(endpoint.Path, "storage/v1/") + "batch/storage/v1"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, batchURL.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	resp, err := b.jsonClient.Do(req)
+	if err != nil {
+		return wrapErr(objstore.OpAttributes, "", errors.Wrap(err, "send gcs batch request"))
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return wrapErr(objstore.OpAttributes, "", errors.Wrap(err, "send gcs batch request"))
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		return errors.Errorf("unexpected content type %q of gcs batch response", resp.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read gcs batch response")
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(part.Header.Get("Content-Id"), "<response-"), ">")
+		i, err := strconv.Atoi(id)
+		if err != nil || i < 0 || i >= len(names) {
+			return errors.Errorf("unexpected content id %q in gcs batch response", part.Header.Get("Content-Id"))
+		}
+		if err := batchPartAttributes(part, names[i], res); err != nil {
+			return err
+		}
+	}
+}
+
+// batchPartAttributes reads the response of a single object from a part of a batch response.
+func batchPartAttributes(part io.Reader, name string, res map[string]objstore.ObjectAttributes) error {
+	resp, err := http.ReadResponse(bufio.NewReader(part), nil)
+	if err != nil {
+		return errors.Wrapf(err, "read gcs batch response for object %s", name)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return wrapErr(objstore.OpAttributes, name, err)
+	}
+
+	var obj struct {
+		Size            int64             `json:"size,string"`
+		Updated         time.Time         `json:"updated"`
+		Etag            string            `json:"etag"`
+		ContentType     string            `json:"contentType"`
+		ContentEncoding string            `json:"contentEncoding"`
+		CacheControl    string            `json:"cacheControl"`
+		StorageClass    string            `json:"storageClass"`
+		Metadata        map[string]string `json:"metadata"`
+		MD5Hash         string            `json:"md5Hash"`
+		CRC32C          string            `json:"crc32c"`
+		Generation      int64             `json:"generation,string"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return errors.Wrapf(err, "decode gcs batch response for object %s", name)
+	}
+	md5, err := base64.StdEncoding.DecodeString(obj.MD5Hash)
+	if err != nil {
+		return errors.Wrapf(err, "decode md5 hash of gcs object %s", name)
+	}
+	crc, err := base64.StdEncoding.DecodeString(obj.CRC32C)
+	if err != nil || len(crc) != 4 {
+		return errors.Errorf("invalid crc32c checksum %q of gcs object %s", obj.CRC32C, name)
+	}
+	res[name] = objectAttributes(&storage.ObjectAttrs{
+		Size:            obj.Size,
+		Updated:         obj.Updated,
+		Etag:            obj.Etag,
+		ContentType:     obj.ContentType,
+		ContentEncoding: obj.ContentEncoding,
+		CacheControl:    obj.CacheControl,
+		StorageClass:    obj.StorageClass,
+		Metadata:        obj.Metadata,
+		MD5:             md5,
+		CRC32C:          binary.BigEndian.Uint32(crc),
+		Generation:      obj.Generation,
+	})
+	return nil
+}
+
+// doJSON sends a request for the given path relative to the bucket to the JSON API and decodes the response
+// into v, unless it is nil.
+func (b *Bucket) doJSON(ctx context.Context, method, path string, query url.Values, v interface{}) error {
+	if b.billingProject != "" {
+		query.Set("userProject", b.billingProject)
+	}
+	u := b.jsonEndpoint + "b/" + url.PathEscape(b.name) + "/" + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.jsonClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// CopyWithAttributes copies the object with the src name into a new object with the dst name, setting the given
+// attributes on the new object. Attributes which are not set are taken from the src object.
+func (b *Bucket) CopyWithAttributes(ctx context.Context, src, dst string, attrs objstore.CopyObjectAttributes) error {
+	if err := validateStorageClass(attrs.StorageClass); err != nil {
+		return wrapErr(objstore.OpCopy, src, err)
+	}
+	srcAttrs, err := b.bkt.Object(src).Attrs(ctx)
+	if err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "get attributes of gcs object %s", src))
+	}
+
+	// Setting any attribute on the copier replaces all attributes of the new object, so start from the ones of src.
+	copier := b.bkt.Object(dst).CopierFrom(b.bkt.Object(src))
+	copier.DestinationKMSKeyName = b.kmsKeyName
+	copier.ContentType = srcAttrs.ContentType
+	copier.ContentLanguage = srcAttrs.ContentLanguage
+	copier.ContentEncoding = srcAttrs.ContentEncoding
+	copier.ContentDisposition = srcAttrs.ContentDisposition
+	copier.CacheControl = srcAttrs.CacheControl
+	copier.Metadata = srcAttrs.Metadata
+	copier.StorageClass = srcAttrs.StorageClass
+	if attrs.ContentType != "" {
+		copier.ContentType = attrs.ContentType
+	}
+	if attrs.CacheControl != "" {
+		copier.CacheControl = attrs.CacheControl
+	}
+	if attrs.ContentEncoding != "" {
+		copier.ContentEncoding = attrs.ContentEncoding
+	}
+	if attrs.UserMetadata != nil {
+		copier.Metadata = attrs.UserMetadata
+	}
+	if attrs.StorageClass != "" {
+		copier.StorageClass = attrs.StorageClass
+	}
+
+	if _, err := copier.Run(ctx); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy gcs object %s to %s", src, dst))
+	}
+	return nil
+}
+
+// UpdateMetadata changes the user metadata and the attributes set by the options of the object without uploading
+// it again. The metadata is patched, unless the storage class is changed or metadata keys are removed, which
+// requires the object to be rewritten in place server-side. The tags of the object are kept.
+func (b *Bucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...objstore.ObjectUploadOption) error {
+	if err := objstore.ValidateUserMetadata(md); err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	params := objstore.ApplyObjectUpdateOptions(opts...)
+	if err := validateStorageClass(params.StorageClass); err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+
+	obj := b.bkt.Object(name)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	metadata := attrs.Metadata
+	removesKeys := false
+	if md != nil {
+		metadata = make(map[string]string, len(md)+1)
+		for k, v := range md {
+			metadata[k] = v
+		}
+		for k := range attrs.Metadata {
+			if _, ok := md[k]; !ok && k != tagsMetadataKey {
+				removesKeys = true
+			}
+		}
+		if tags, ok := attrs.Metadata[tagsMetadataKey]; ok {
+			metadata[tagsMetadataKey] = tags
+		}
+	}
+
+	if params.StorageClass == "" && !removesKeys {
+		update := storage.ObjectAttrsToUpdate{}
+		if md != nil {
+			update.Metadata = metadata
+		}
+		if params.ContentType != "" {
+			update.ContentType = params.ContentType
+		}
+		if params.CacheControl != "" {
+			update.CacheControl = params.CacheControl
+		}
+		if params.ContentEncoding != "" {
+			update.ContentEncoding = params.ContentEncoding
+		}
+		_, err := obj.If(storage.Conditions{MetagenerationMatch: attrs.Metageneration}).Update(ctx, update)
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+
+	// Setting any attribute on the copier replaces all attributes of the object, so start from the current ones.
+	copier := obj.If(storage.Conditions{GenerationMatch: attrs.Generation}).CopierFrom(obj.Generation(attrs.Generation))
+	copier.DestinationKMSKeyName = b.kmsKeyName
+	copier.ContentType = attrs.ContentType
+	copier.ContentLanguage = attrs.ContentLanguage
+	copier.ContentEncoding = attrs.ContentEncoding
+	copier.ContentDisposition = attrs.ContentDisposition
+	copier.CacheControl = attrs.CacheControl
+	copier.Metadata = metadata
+	copier.StorageClass = attrs.StorageClass
+	if params.ContentType != "" {
+		copier.ContentType = params.ContentType
+	}
+	if params.CacheControl != "" {
+		copier.CacheControl = params.CacheControl
+	}
+	if params.ContentEncoding != "" {
+		copier.ContentEncoding = params.ContentEncoding
+	}
+	if params.StorageClass != "" {
+		copier.StorageClass = params.StorageClass
+	}
+	if _, err := copier.Run(ctx); err != nil {
+		return wrapErr(objstore.OpUpload, name, errors.Wrapf(err, "rewrite gcs object %s", name))
+	}
+	return nil
+}
+
+// SupportedCopy returns true as GCS copies objects server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
+}
+
+// PresignedGetURL returns a V4 signed URL which can be used to download the object with the given name until expiry passes.
+func (b *Bucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return b.signedURL(ctx, http.MethodGet, name, expiry, nil)
+}
+
+// PresignPut returns a V4 signed URL which can be used to upload the object with the given name until expiry passes.
+func (b *Bucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return b.signedURL(ctx, http.MethodPut, name, expiry, nil)
+}
+
+// PresignWithHeaders returns a V4 signed URL like PresignedGetURL and PresignPut for the given HTTP method, which
+// additionally signs the given headers, e.g. Content-Type or x-goog-meta-* headers of an upload. Requests with
+// the URL are only authorized if they send the headers with the same values.
+func (b *Bucket) PresignWithHeaders(ctx context.Context, method, name string, expiry time.Duration, headers http.Header) (string, error) {
+	return b.signedURL(ctx, method, name, expiry, headers)
+}
+
+func (b *Bucket) signedURL(ctx context.Context, method, name string, expiry time.Duration, headers http.Header) (string, error) {
+	signer, err := b.urlSigner(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := &storage.SignedURLOptions{
+		Scheme:         storage.SigningSchemeV4,
+		Method:         method,
+		GoogleAccessID: signer.email,
+		Expires:        time.Now().Add(expiry),
+	}
+	for key, values := range headers {
+		opts.Headers = append(opts.Headers, key+":"+strings.Join(values, ","))
+	}
+	if len(signer.privateKey) > 0 {
+		opts.PrivateKey = signer.privateKey
+	} else {
+		opts.SignBytes = func(payload []byte) ([]byte, error) {
+			return signer.signBlob(ctx, payload)
+		}
+	}
+
+	u, err := storage.SignedURL(b.name, name, opts)
+	if err != nil {
+		return "", errors.Wrapf(err, "sign GCS URL for %s", name)
+	}
+	return u, nil
+}
+
+// urlSigner returns the signer for URLs, resolving it from the configured or default credentials on first use.
+// Failures are not cached so that transient metadata server errors don't disable signing for good.
+func (b *Bucket) urlSigner(ctx context.Context) (*urlSigner, error) {
+	b.signerMtx.Lock()
+	defer b.signerMtx.Unlock()
+
+	if b.signer != nil {
+		return b.signer, nil
+	}
+	signer, err := newURLSigner(ctx, b.serviceAccount, b.credentialsProvider)
+	if err != nil {
+		return nil, err
+	}
+	b.signer = signer
+	return signer, nil
+}
+
+// urlSigner signs URLs on behalf of a service account, either with its private key or through the IAM Credentials API.
+type urlSigner struct {
+	email      string
+	privateKey []byte
+	iam        *iamcredentials.Service
+}
+
+func newURLSigner(ctx context.Context, serviceAccount []byte, provider CredentialsProvider) (*urlSigner, error) {
+	credsJSON := serviceAccount
+	var creds *google.Credentials
+	customProvider := provider != nil
+	if len(credsJSON) == 0 {
+		if !customProvider {
+			provider = DefaultCredentialsProvider
+		}
+		var err error
+		creds, err = provider.Credentials(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(objstore.ErrPresignNotSupported, "no credentials found to sign GCS URLs: %v", err)
+		}
+		credsJSON = creds.JSON
+	}
+
+	// Credentials files only allow signing if they belong to a service account and hold its private key.
+	if len(credsJSON) > 0 {
+		jwtConf, err := google.JWTConfigFromJSON(credsJSON)
+		if err != nil || len(jwtConf.PrivateKey) == 0 {
+			return nil, errors.Wrap(objstore.ErrPresignNotSupported, "signing GCS URLs requires service account credentials with a private key")
+		}
+		return &urlSigner{email: jwtConf.Email, privateKey: jwtConf.PrivateKey}, nil
+	}
+
+	if customProvider {
+		return nil, errors.Wrap(objstore.ErrPresignNotSupported, "signing GCS URLs requires the credentials provider to return service account credentials with a private key")
+	}
+
+	// Default credentials without JSON come from the GCE metadata server, which doesn't expose a private key.
+	// Signing is delegated to the IAM Credentials API on behalf of the instance's service account instead.
+	email, err := metadata.Email("default")
+	if err != nil {
+		return nil, errors.Wrapf(objstore.ErrPresignNotSupported, "get service account email from metadata server to sign GCS URLs: %v", err)
+	}
+	svc, err := iamcredentials.NewService(ctx, option.WithCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrap(err, "create IAM credentials client to sign GCS URLs")
+	}
+	return &urlSigner{email: email, iam: svc}, nil
+}
+
+// signBlob signs the payload through the IAM Credentials API. The service account needs
+// the iam.serviceAccounts.signBlob permission on itself.
+func (s *urlSigner) signBlob(ctx context.Context, payload []byte) ([]byte, error) {
+	resp, err := s.iam.Projects.ServiceAccounts.SignBlob("projects/-/serviceAccounts/"+s.email, &iamcredentials.SignBlobRequest{
+		Payload: base64.StdEncoding.EncodeToString(payload),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "sign blob as %s", s.email)
+	}
+	return base64.StdEncoding.DecodeString(resp.SignedBlob)
+}
+
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the reason reported by GCS and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if isObjectNotExistErr(err) {
+		return objstore.NewBucketError(op, name, "notFound", objstore.ErrKindNotFound, err)
+	}
+	if isBucketNotExistErr(err) {
+		return objstore.NewBucketError(op, name, "bucketNotFound", objstore.ErrKindNotFound, err)
+	}
+
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	code, kind := strconv.Itoa(gerr.Code), objstore.ErrorKindFromHTTPStatus(gerr.Code)
+	if len(gerr.Errors) > 0 {
+		code = gerr.Errors[0].Reason
+		switch code {
+		case "rateLimitExceeded", "userRateLimitExceeded":
+			kind = objstore.ErrKindRateLimit
+		case "quotaExceeded":
+			kind = objstore.ErrKindQuotaExceeded
+		case "conditionNotMet":
+			kind = objstore.ErrKindPreconditionFailed
+		}
+	}
+	return objstore.NewBucketError(op, name, code, kind, err)
+}
+
+// isObjectNotExistErr returns true if err reports a missing object. Besides storage.ErrObjectNotExist, which the
+// client library returns for most operations, it matches the 404 errors of the requests made without it, like
+// rewrites, by their message, as GCS returns 404 for missing buckets and other resources as well.
+func isObjectNotExistErr(err error) bool {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return true
+	}
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+		return false
+	}
+	return strings.HasPrefix(gerr.Message, "No such object") || strings.Contains(gerr.Body, "<Code>NoSuchKey</Code>")
+}
+
+// isBucketNotExistErr returns true if err reports a missing bucket.
+func isBucketNotExistErr(err error) bool {
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		return true
+	}
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+		return false
+	}
+	return gerr.Message == "The specified bucket does not exist." || strings.Contains(gerr.Body, "<Code>NoSuchBucket</Code>")
+}
+
+// IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
+// Other 404 errors, e.g. for a missing bucket, are not matched.
+func (b *Bucket) IsObjNotFoundErr(err error) bool {
+	return isObjectNotExistErr(err)
+}
+
+// IsCustomerManagedKeyError returns true if the permissions for key used to encrypt the object was revoked.
+func (b *Bucket) IsCustomerManagedKeyError(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || (gerr.Code != http.StatusForbidden && gerr.Code != http.StatusBadRequest) {
+		return false
+	}
+	messages := []string{gerr.Message}
+	for _, item := range gerr.Errors {
+		messages = append(messages, item.Message)
+	}
+	for _, msg := range messages {
+		// GCS reports both missing permissions on the key and disabled or destroyed keys as errors about
+		// the Cloud KMS key.
+		msg = strings.ToLower(msg)
+		if strings.Contains(msg, "cloud kms key") || strings.Contains(msg, "customer-managed encryption key") {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping checks that the bucket exists and the credentials are allowed to access it by reading the bucket metadata.
+func (b *Bucket) Ping(ctx context.Context) error {
+	_, err := b.bkt.Attrs(ctx)
+	return wrapErr(objstore.OpPing, "", err)
+}
+
+func (b *Bucket) Close() error {
+	// Clients passed to NewBucketWithClient are closed by their owner.
+	if b.closer == nil {
+		return nil
+	}
 	return b.closer.Close()
 }
 
@@ -0,0 +1,105 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+//go:build e2e
+
+package gcs_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/efficientgo/e2e"
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/gcs"
+	"github.com/thanos-io/objstore/test/e2e/e2ethanos"
+)
+
+// TestBucket_FakeGCSServer runs against fake-gcs-server configured through the endpoint of the config, without
+// authentication and without STORAGE_EMULATOR_HOST.
+//
+//	$ go test -tags e2e ./providers/gcs/... -run TestBucket_FakeGCSServer
+func TestBucket_FakeGCSServer(t *testing.T) {
+	e, err := e2e.NewDockerEnvironment("e2e_gcs_emulator", e2e.WithLogger(log.NewNopLogger()))
+	testutil.Ok(t, err)
+	t.Cleanup(e2ethanos.CleanScenario(t, e))
+
+	const bucket = "test-bucket"
+	srv := e2ethanos.NewFakeGCSServer(e, "gcs", bucket)
+	testutil.Ok(t, e2e.StartAndWaitReady(srv))
+
+	bkt, err := gcs.NewBucketWithConfig(context.Background(), log.NewNopLogger(), e2ethanos.NewGCSConfig(bucket, srv.Endpoint("https")), "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("@test-data@")))
+
+	attrs, err := bkt.Attributes(ctx, "dir/obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(len("@test-data@")), attrs.Size)
+
+	rc, err := bkt.Get(ctx, "dir/obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "@test-data@", string(content))
+
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		names = append(names, name)
+		return nil
+	}, objstore.WithRecursiveIter))
+	testutil.Equals(t, []string{"dir/obj"}, names)
+
+	testutil.Ok(t, bkt.Delete(ctx, "dir/obj"))
+	_, err = bkt.Get(ctx, "dir/obj")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+}
+
+// BenchmarkBatchAttributes compares requesting the attributes of 100 objects one by one with a single batch request.
+// It runs against a real GCS bucket created in the project given by GCP_PROJECT.
+//
+//	$ GCP_PROJECT=<project> go test -tags e2e ./providers/gcs/... -run '^$' -bench '^BenchmarkBatchAttributes'
+func BenchmarkBatchAttributes(b *testing.B) {
+	project, ok := os.LookupEnv("GCP_PROJECT")
+	if !ok {
+		b.Skip("GCP_PROJECT is not set")
+	}
+	ctx := context.Background()
+
+	bkt, closeFn, err := gcs.NewTestBucket(b, project)
+	testutil.Ok(b, err)
+	b.Cleanup(closeFn)
+
+	names := make([]string, 100)
+	for i := range names {
+		names[i] = fmt.Sprintf("obj-%03d", i)
+		testutil.Ok(b, bkt.Upload(ctx, names[i], strings.NewReader("@test-data@")))
+	}
+	gcsBkt := bkt.(*gcs.Bucket)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, name := range names {
+				_, err := gcsBkt.Attributes(ctx, name)
+				testutil.Ok(b, err)
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			attrs, err := gcsBkt.BatchAttributes(ctx, names)
+			testutil.Ok(b, err)
+			testutil.Equals(b, len(names), len(attrs))
+		}
+	})
+}
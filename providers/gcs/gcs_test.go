@@ -4,15 +4,47 @@
 package gcs
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/efficientgo/core/testutil"
 	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/exthttp"
 )
 
 func TestBucket_Get_ShouldReturnErrorIfServerTruncateResponse(t *testing.T) {
@@ -43,3 +75,1390 @@ func TestBucket_Get_ShouldReturnErrorIfServerTruncateResponse(t *testing.T) {
 	_, err = io.ReadAll(reader)
 	testutil.Equals(t, io.ErrUnexpectedEOF, err)
 }
+
+func TestBucket_GetRange_Suffix(t *testing.T) {
+	var rangeHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Range", "bytes 95-99/100")
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(http.StatusPartialContent)
+		_, err := w.Write([]byte("12345"))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+
+	reader, err := bkt.GetRange(context.Background(), "test", -5, -1)
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(reader)
+	testutil.Ok(t, err)
+	testutil.Ok(t, reader.Close())
+	testutil.Equals(t, "12345", string(content))
+	testutil.Equals(t, "bytes=-5", rangeHeader)
+
+	_, err = bkt.GetRange(context.Background(), "test", -5, 5)
+	testutil.NotOk(t, err)
+}
+
+type countingRoundTripper struct {
+	rt       http.RoundTripper
+	requests int
+}
+
+func (c *countingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.rt.RoundTrip(r)
+}
+
+// uncomparableRoundTripper is a round tripper which can't be compared with ==.
+type uncomparableRoundTripper struct {
+	http.RoundTripper
+	headers []string
+}
+
+func TestBucket_HTTPConfig(t *testing.T) {
+	rt, err := newTransport(exthttp.HTTPConfig{MaxIdleConnsPerHost: 42, IdleConnTimeout: model.Duration(time.Minute)})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 42, rt.(*http.Transport).MaxIdleConnsPerHost)
+	testutil.Equals(t, time.Minute, rt.(*http.Transport).IdleConnTimeout)
+	// The fields which are not set are taken from the defaults.
+	testutil.Equals(t, 100, rt.(*http.Transport).MaxIdleConns)
+	testutil.Equals(t, 2*time.Minute, rt.(*http.Transport).ResponseHeaderTimeout)
+
+	// Transports which are not comparable don't make the config comparison panic.
+	testutil.Assert(t, httpConfigSet(exthttp.HTTPConfig{Transport: uncomparableRoundTripper{}}))
+	testutil.Assert(t, !httpConfigSet(exthttp.HTTPConfig{}))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	// Requests go through the configured transport.
+	counting := &countingRoundTripper{rt: rt}
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{
+		Bucket:     "test-bucket",
+		HTTPConfig: exthttp.HTTPConfig{Transport: counting},
+	}, "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(context.Background(), "obj", strings.NewReader("content")))
+	testutil.Equals(t, 1, counting.requests)
+}
+
+func TestNewBucketWithClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj","size":"7"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	testutil.Ok(t, err)
+
+	_, err = NewBucketWithClient(log.NewNopLogger(), nil, "test-bucket", "test")
+	testutil.NotOk(t, err)
+	_, err = NewBucketWithClient(log.NewNopLogger(), client, "", "test")
+	testutil.NotOk(t, err)
+
+	bkt, err := NewBucketWithClient(log.NewNopLogger(), client, "test-bucket", "test")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "test-bucket", bkt.Name())
+	attrs, err := bkt.Attributes(context.Background(), "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(7), attrs.Size)
+
+	// The client is still usable after the bucket was closed.
+	testutil.Ok(t, bkt.Close())
+	_, err = client.Bucket("test-bucket").Object("obj").Attrs(context.Background())
+	testutil.Ok(t, err)
+	testutil.Ok(t, client.Close())
+}
+
+func TestBucket_Endpoint(t *testing.T) {
+	var paths []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "", r.Header.Get("Authorization"))
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/storage/v1/") {
+			_, err := w.Write([]byte("content"))
+			testutil.Ok(t, err)
+			return
+		}
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj","size":"7"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	// The endpoint is used instead of the emulator host.
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+
+	_, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket", NoAuth: true, ServiceAccount: "{}"}, "test")
+	testutil.NotOk(t, err)
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{
+		Bucket:     "test-bucket",
+		Endpoint:   srv.URL + "/storage/v1/",
+		NoAuth:     true,
+		HTTPConfig: exthttp.HTTPConfig{InsecureSkipVerify: true},
+	}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(7), attrs.Size)
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+	testutil.Equals(t, []string{
+		"POST /upload/storage/v1/b/test-bucket/o",
+		"GET /storage/v1/b/test-bucket/o/obj",
+		"GET /test-bucket/obj",
+	}, paths)
+}
+
+// expiringTokenSource issues tokens which expire after the given TTL and records their expiry.
+type expiringTokenSource struct {
+	mtx    sync.Mutex
+	ttl    time.Duration
+	issued map[string]time.Time
+}
+
+func (s *expiringTokenSource) Token() (*oauth2.Token, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tok := &oauth2.Token{AccessToken: fmt.Sprintf("token-%d", len(s.issued)), TokenType: "Bearer", Expiry: time.Now().Add(s.ttl)}
+	s.issued[tok.AccessToken] = tok.Expiry
+	return tok, nil
+}
+
+func (s *expiringTokenSource) valid(token string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	expiry, ok := s.issued[token]
+	return ok && time.Now().Before(expiry)
+}
+
+type credentialsProviderFunc func(ctx context.Context) (*google.Credentials, error)
+
+func (f credentialsProviderFunc) Credentials(ctx context.Context) (*google.Credentials, error) {
+	return f(ctx)
+}
+
+func TestBucket_CredentialsProvider(t *testing.T) {
+	// Tokens are refreshed 10s before they expire, so these are reused for a few hundred milliseconds only,
+	// which makes the iteration below outlive several of them, like a multi-minute iteration outlives tokens
+	// of Workload Identity.
+	ts := &expiringTokenSource{ttl: 10*time.Second + 200*time.Millisecond, issued: map[string]time.Time{}}
+	const pages = 8
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ts.valid(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		time.Sleep(100 * time.Millisecond)
+		resp := fmt.Sprintf(`{"kind":"storage#objects","items":[{"bucket":"test-bucket","name":"obj-%d"}]`, page)
+		if page+1 < pages {
+			resp += fmt.Sprintf(`,"nextPageToken":"%d"`, page+1)
+		}
+		_, err := w.Write([]byte(resp + "}"))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+
+	cfg := Config{Bucket: "test-bucket", Endpoint: srv.URL + "/storage/v1/"}
+	provider := credentialsProviderFunc(func(ctx context.Context) (*google.Credentials, error) {
+		return &google.Credentials{TokenSource: oauth2.ReuseTokenSource(nil, ts)}, nil
+	})
+	_, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket", NoAuth: true}, "test", WithCredentialsProvider(provider))
+	testutil.NotOk(t, err)
+	_, err = NewBucketWithConfig(context.Background(), log.NewNopLogger(), cfg, "test", WithCredentialsProvider(credentialsProviderFunc(func(ctx context.Context) (*google.Credentials, error) {
+		return nil, errors.New("no credentials")
+	})))
+	testutil.NotOk(t, err)
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), cfg, "test", WithCredentialsProvider(provider))
+	testutil.Ok(t, err)
+
+	var seen int
+	testutil.Ok(t, bkt.Iter(context.Background(), "", func(string) error {
+		seen++
+		return nil
+	}))
+	testutil.Equals(t, pages, seen)
+	testutil.Assert(t, len(ts.issued) > 1, "expected tokens to be refreshed during the iteration, got %d tokens", len(ts.issued))
+}
+
+func TestBucket_GetWithOptions(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte("content"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, zw.Close())
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GCS decompresses objects stored with the gzip content encoding unless the client accepts it.
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			_, err := w.Write([]byte("content"))
+			testutil.Ok(t, err)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		_, err := w.Write(compressed.Bytes())
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{
+		Bucket:     "test-bucket",
+		Endpoint:   srv.URL + "/storage/v1/",
+		NoAuth:     true,
+		HTTPConfig: exthttp.HTTPConfig{InsecureSkipVerify: true},
+	}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	for _, tcase := range []struct {
+		opts     []objstore.ObjectGetOption
+		expected []byte
+	}{
+		{expected: []byte("content")},
+		{opts: []objstore.ObjectGetOption{objstore.WithDecodeContent()}, expected: []byte("content")},
+		{opts: []objstore.ObjectGetOption{objstore.WithReadCompressed()}, expected: compressed.Bytes()},
+	} {
+		rc, err := objstore.GetWithOptions(ctx, bkt, "obj", tcase.opts...)
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, tcase.expected, content)
+	}
+}
+
+func TestBucket_GetRangeWithOptions(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte("content"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, zw.Close())
+
+	var ranges []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		// GCS decompresses objects stored with the gzip content encoding and ignores ranges, unless the client
+		// accepts the encoding.
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			_, err := w.Write([]byte("content"))
+			testutil.Ok(t, err)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-9/%d", compressed.Len()))
+		w.WriteHeader(http.StatusPartialContent)
+		_, err := w.Write(compressed.Bytes()[:10])
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{
+		Bucket:     "test-bucket",
+		Endpoint:   srv.URL + "/storage/v1/",
+		NoAuth:     true,
+		HTTPConfig: exthttp.HTTPConfig{InsecureSkipVerify: true},
+	}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	rc, err := objstore.GetRangeWithOptions(ctx, bkt, "obj", 0, 10, objstore.WithReadCompressed())
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, compressed.Bytes()[:10], content)
+	testutil.Equals(t, []string{"bytes=0-9"}, ranges)
+
+	_, err = objstore.GetRangeWithOptions(ctx, bkt, "obj", 0, 10, objstore.WithDecodeContent())
+	testutil.NotOk(t, err)
+}
+
+func TestBucket_GetWithAttributes(t *testing.T) {
+	var requests int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("X-Goog-Generation", "1445412480000000")
+		_, err := w.Write([]byte("content"))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{
+		Bucket:     "test-bucket",
+		Endpoint:   srv.URL + "/storage/v1/",
+		NoAuth:     true,
+		HTTPConfig: exthttp.HTTPConfig{InsecureSkipVerify: true},
+	}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	rc, attrs, err := objstore.GetWithAttributes(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+	testutil.Equals(t, objstore.ObjectAttributes{
+		Size:         7,
+		LastModified: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		ContentType:  "text/plain",
+		VersionID:    "1445412480000000",
+	}, attrs)
+	// The attributes are taken from the response of the read.
+	testutil.Equals(t, 1, requests)
+
+	_, _, err = objstore.GetWithAttributes(ctx, bkt, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+}
+
+func TestBucket_ChunkSize(t *testing.T) {
+	t.Setenv("STORAGE_EMULATOR_HOST", "localhost:0")
+	ctx := context.Background()
+
+	for _, tcase := range []struct {
+		chunkSize         int
+		expectedChunkSize int
+		expectedErr       string
+	}{
+		{chunkSize: 0, expectedChunkSize: googleapi.DefaultUploadChunkSize},
+		{chunkSize: 512 * 1024, expectedChunkSize: 512 * 1024},
+		{chunkSize: -1, expectedChunkSize: 0},
+		{chunkSize: 1000, expectedErr: "chunk size 1000 is not a multiple of 262144 bytes"},
+	} {
+		t.Run(strconv.Itoa(tcase.chunkSize), func(t *testing.T) {
+			bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", ChunkSizeBytes: tcase.chunkSize}, "test")
+			if tcase.expectedErr != "" {
+				testutil.NotOk(t, err)
+				testutil.Equals(t, tcase.expectedErr, err.Error())
+				return
+			}
+			testutil.Ok(t, err)
+
+			w, err := bkt.newWriter(ctx, bkt.bkt.Object("obj"))
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedChunkSize, w.ChunkSize)
+		})
+	}
+}
+
+func TestBucket_UploadRetries(t *testing.T) {
+	var (
+		attempts int
+		bodies   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, err := io.ReadAll(r.Body)
+		testutil.Ok(t, err)
+		bodies = append(bodies, string(body))
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, err = w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	ctx := context.Background()
+	for _, tcase := range []struct {
+		policy           RetryPolicy
+		expectedAttempts int
+		expectedErr      bool
+	}{
+		{policy: RetryIdempotent, expectedAttempts: 1, expectedErr: true},
+		{policy: RetryAlways, expectedAttempts: 2},
+	} {
+		t.Run(string(tcase.policy), func(t *testing.T) {
+			attempts, bodies = 0, nil
+			bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{
+				Bucket: "test-bucket",
+				// Chunked uploads retry failed chunks on their own.
+				ChunkSizeBytes: -1,
+				Retry:          RetryConfig{MaxRetries: 3, Policy: tcase.policy, InitialBackoff: model.Duration(time.Millisecond)},
+			}, "test")
+			testutil.Ok(t, err)
+
+			err = bkt.Upload(ctx, "obj", strings.NewReader("content"))
+			if tcase.expectedErr {
+				testutil.NotOk(t, err)
+			} else {
+				testutil.Ok(t, err)
+			}
+			testutil.Equals(t, tcase.expectedAttempts, attempts)
+			// The reader is rewound before each retry.
+			for _, body := range bodies {
+				testutil.Assert(t, strings.Contains(body, "content"), "unexpected body %q", body)
+			}
+		})
+	}
+
+	_, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", Retry: RetryConfig{Policy: "sometimes"}}, "test")
+	testutil.NotOk(t, err)
+}
+
+func TestBucket_Upload_AbortsOnReadError(t *testing.T) {
+	aborted := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		aborted <- err != nil
+		if err != nil {
+			return
+		}
+		_, err = w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", ChunkSizeBytes: -1}, "test")
+	testutil.Ok(t, err)
+
+	readErr := errors.New("read failed")
+	err = bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("partial content"), iotest.ErrReader(readErr)))
+	testutil.Assert(t, errors.Is(err, readErr), "unexpected error %v", err)
+
+	// The request is aborted instead of being left pending or completed with the partial content.
+	select {
+	case ok := <-aborted:
+		testutil.Assert(t, ok, "upload was completed")
+	case <-time.After(10 * time.Second):
+		t.Fatal("upload was not aborted")
+	}
+}
+
+func TestBucket_BillingProject(t *testing.T) {
+	var userProject string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userProject = r.URL.Query().Get("userProject")
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", BillingProject: "billed-project"}, "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, "billed-project", userProject)
+
+	// Requests are billed to the project of the bucket by default.
+	bkt, err = NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, "", userProject)
+}
+
+func TestBucket_KMSKeyName(t *testing.T) {
+	var kmsKeyName string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kmsKeyName = r.URL.Query().Get("kmsKeyName")
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	const key = "projects/p/locations/l/keyRings/r/cryptoKeys/k"
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", KMSKeyName: key}, "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, key, kmsKeyName)
+}
+
+func TestBucket_UploadWithPrecondition(t *testing.T) {
+	var conditions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		conditions = append(conditions, fmt.Sprintf("match=%s notMatch=%s", q.Get("ifGenerationMatch"), q.Get("ifGenerationNotMatch")))
+		if q.Get("ifGenerationMatch") == "1" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, err := w.Write([]byte(`{"error":{"code":412,"message":"Precondition Failed","errors":[{"reason":"conditionNotMet"}]}}`))
+			testutil.Ok(t, err)
+			return
+		}
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj","generation":"3"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.UploadWithPrecondition(ctx, "obj", strings.NewReader("content"), IfDoesNotExist))
+	testutil.Ok(t, bkt.UploadWithPrecondition(ctx, "obj", strings.NewReader("content"), IfGenerationMatch(2)))
+	testutil.Ok(t, bkt.UploadWithPrecondition(ctx, "obj", strings.NewReader("content"), IfGenerationNotMatch(2)))
+	err = bkt.UploadWithPrecondition(ctx, "obj", strings.NewReader("content"), IfGenerationMatch(1))
+	testutil.Assert(t, objstore.IsPreconditionFailedErr(err), "expected precondition failed error, got %v", err)
+	testutil.Equals(t, []string{"match=0 notMatch=", "match=2 notMatch=", "match= notMatch=2", "match=1 notMatch="}, conditions)
+}
+
+func TestBucket_IsCustomerManagedKeyError(t *testing.T) {
+	bkt := &Bucket{}
+	for _, tcase := range []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name: "key permission revoked",
+			err: &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Message: "Permission denied on Cloud KMS key. Please ensure that your Cloud Storage service account has been authorized to use this key.",
+			},
+			expected: true,
+		},
+		{
+			name: "key disabled",
+			err: errors.Wrap(&googleapi.Error{
+				Code:   http.StatusBadRequest,
+				Errors: []googleapi.ErrorItem{{Reason: "invalid", Message: "The Cloud KMS key projects/p/locations/l/keyRings/r/cryptoKeys/k is disabled, destroyed, or scheduled to be destroyed."}},
+			}, "get"),
+			expected: true,
+		},
+		{
+			name:     "access denied",
+			err:      &googleapi.Error{Code: http.StatusForbidden, Message: "Access denied."},
+			expected: false,
+		},
+		{
+			name:     "other error",
+			err:      errors.New("Cloud KMS key"),
+			expected: false,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, bkt.IsCustomerManagedKeyError(tcase.err))
+		})
+	}
+}
+
+// newFakeGCSBucket returns a bucket sending all requests to a test server serving them with handler.
+func newFakeGCSBucket(t *testing.T, handler http.HandlerFunc) *Bucket {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+	// The JSON API of the client only honors STORAGE_EMULATOR_HOST for uploads and downloads.
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	testutil.Ok(t, err)
+	bkt.bkt = client.Bucket("test-bucket")
+	return bkt
+}
+
+func TestBucket_Iter_PrefixesOnly(t *testing.T) {
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"kind":"storage#objects","prefixes":["dir/a/","dir/b/"],"items":[{"bucket":"test-bucket","name":"dir/obj"}]}`))
+		testutil.Ok(t, err)
+	})
+
+	var seen []string
+	testutil.Ok(t, bkt.Iter(context.Background(), "dir/", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, objstore.WithPrefixesOnly))
+	testutil.Equals(t, []string{"dir/a/", "dir/b/"}, seen)
+}
+
+func TestBucket_Iter_CreatedAt(t *testing.T) {
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"kind":"storage#objects","prefixes":["dir/sub/"],"items":[
+			{"bucket":"test-bucket","name":"dir/obj","timeCreated":"2015-10-20T07:28:00.000Z","updated":"2015-10-21T07:28:00.000Z"}
+		]}`))
+		testutil.Ok(t, err)
+	})
+
+	var seen []string
+	testutil.Ok(t, bkt.IterWithAttributes(context.Background(), "dir/", func(attrs objstore.IterObjectAttributes) error {
+		createdAt, createdOk := attrs.CreatedAt()
+		updatedAt, updatedOk := attrs.LastModified()
+		seen = append(seen, fmt.Sprintf("%s created=%s(%t) updated=%s(%t)", attrs.Name, createdAt.Format(time.RFC3339), createdOk, updatedAt.Format(time.RFC3339), updatedOk))
+		return nil
+	}, objstore.WithCreatedAt, objstore.WithUpdatedAt))
+	testutil.Equals(t, []string{
+		"dir/obj created=2015-10-20T07:28:00Z(true) updated=2015-10-21T07:28:00Z(true)",
+		"dir/sub/ created=0001-01-01T00:00:00Z(false) updated=0001-01-01T00:00:00Z(false)",
+	}, seen)
+}
+
+func TestBucket_Iter_Size(t *testing.T) {
+	var paths []string
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, err := w.Write([]byte(`{"kind":"storage#objects","prefixes":["dir/sub/"],"items":[
+			{"bucket":"test-bucket","name":"dir/a","size":"7"},
+			{"bucket":"test-bucket","name":"dir/b","size":"1048576"}
+		]}`))
+		testutil.Ok(t, err)
+	})
+
+	var seen []string
+	testutil.Ok(t, bkt.IterWithAttributes(context.Background(), "dir/", func(attrs objstore.IterObjectAttributes) error {
+		size, ok := attrs.Size()
+		seen = append(seen, fmt.Sprintf("%s size=%d(%t)", attrs.Name, size, ok))
+		return nil
+	}, objstore.WithSize))
+	testutil.Equals(t, []string{"dir/a size=7(true)", "dir/b size=1048576(true)", "dir/sub/ size=0(false)"}, seen)
+	// The sizes are taken from the list response, without requesting the attributes of each object.
+	testutil.Equals(t, []string{"/storage/v1/b/test-bucket/o"}, paths)
+}
+
+func TestBucket_Iter_CancelledContext(t *testing.T) {
+	listing := make(chan struct{})
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		close(listing)
+		// Hang until the client gives up on the request.
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-listing
+		cancel()
+	}()
+
+	err := bkt.Iter(ctx, "", func(s string) error {
+		return nil
+	})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.Canceled), "expected context canceled error, got %v", err)
+}
+
+func TestBucket_StorageClass(t *testing.T) {
+	var uploadBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			body, err := io.ReadAll(r.Body)
+			testutil.Ok(t, err)
+			uploadBody = string(body)
+			_, err = w.Write([]byte(`{"bucket":"test-bucket","name":"obj","storageClass":"NEARLINE"}`))
+			testutil.Ok(t, err)
+		case http.MethodGet:
+			_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj","size":"7","storageClass":"NEARLINE"}`))
+			testutil.Ok(t, err)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithStorageClass("NEARLINE")))
+	testutil.Assert(t, strings.Contains(uploadBody, `"storageClass":"NEARLINE"`), "expected storage class in upload request, got %s", uploadBody)
+
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "NEARLINE", attrs.StorageClass)
+
+	uploadBody = ""
+	err = bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithStorageClass("NEARLNE"))
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), `unknown storage class "NEARLNE"`), "unexpected error: %s", err)
+	testutil.Equals(t, "", uploadBody)
+}
+
+func TestBucket_PublicRead(t *testing.T) {
+	var acls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acls = append(acls, r.URL.Query().Get("predefinedAcl"))
+		_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithPublicRead()))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, []string{"publicRead", ""}, acls)
+}
+
+func TestBucket_PublicRead_UniformBucketLevelAccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(`{"error":{"code":400,"message":"Cannot insert legacy ACL for an object when uniform bucket-level access is enabled.","errors":[{"reason":"invalid"}]}}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+
+	err = bkt.Upload(context.Background(), "obj", strings.NewReader("content"), objstore.WithPublicRead())
+	testutil.Assert(t, errors.Is(err, objstore.ErrOptionNotSupported), "expected option not supported error, got %v", err)
+}
+
+func TestBucket_Rename(t *testing.T) {
+	var (
+		rewriteQuery, deleteQuery url.Values
+		srcDeleted                bool
+	)
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"src","generation":"5"}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/rewriteTo/"):
+			rewriteQuery = r.URL.Query()
+			_, err := w.Write([]byte(`{"kind":"storage#rewriteResponse","done":true,"resource":{"bucket":"test-bucket","name":"dst"}}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodDelete:
+			deleteQuery = r.URL.Query()
+			if srcDeleted {
+				// The source was deleted concurrently after it was copied.
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	ctx := context.Background()
+	testutil.Assert(t, objstore.IsRenameSupported(bkt))
+	testutil.Ok(t, objstore.Rename(ctx, bkt, "src", "dst"))
+	testutil.Equals(t, "5", rewriteQuery.Get("ifSourceGenerationMatch"))
+	testutil.Equals(t, "5", deleteQuery.Get("ifGenerationMatch"))
+
+	srcDeleted = true
+	err := objstore.Rename(ctx, bkt, "src", "dst")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %s", err)
+}
+
+func TestBucket_CopyFromBucket(t *testing.T) {
+	var rewritePath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rewritePath = r.URL.Path
+		_, err := w.Write([]byte(`{"kind":"storage#rewriteResponse","done":true,"resource":{"bucket":"dst-bucket","name":"dst"}}`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	testutil.Ok(t, err)
+	newBucket := func(name string) *Bucket {
+		bkt, err := NewBucketWithConfig(context.Background(), log.NewNopLogger(), Config{Bucket: name}, "test")
+		testutil.Ok(t, err)
+		bkt.bkt = client.Bucket(name)
+		return bkt
+	}
+	src, dst := newBucket("src-bucket"), newBucket("dst-bucket")
+
+	ctx := context.Background()
+	testutil.Ok(t, dst.CopyFromBucket(ctx, src, "src", "dst"))
+	testutil.Equals(t, "/storage/v1/b/src-bucket/o/src/rewriteTo/b/dst-bucket/o/dst", rewritePath)
+	// Wrapped buckets are unwrapped, including the prefix of the object names.
+	testutil.Ok(t, objstore.WrapWithMetrics(dst, nil, "dst").CopyFromBucket(ctx, objstore.NewPrefixedBucket(src, "prefix"), "src", "dst"))
+	testutil.Equals(t, "/storage/v1/b/src-bucket/o/prefix/src/rewriteTo/b/dst-bucket/o/dst", rewritePath)
+	testutil.Equals(t, objstore.ErrCrossBucketCopyNotSupported, dst.CopyFromBucket(ctx, objstore.NewInMemBucket(), "src", "dst"))
+}
+
+func TestBucket_CopyWithAttributes(t *testing.T) {
+	var rewriteBody string
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/o/missing"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"src","contentType":"application/json","cacheControl":"no-cache","storageClass":"NEARLINE","metadata":{"owner":"test"}}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/rewriteTo/"):
+			body, err := io.ReadAll(r.Body)
+			testutil.Ok(t, err)
+			rewriteBody = string(body)
+			_, err = w.Write([]byte(`{"kind":"storage#rewriteResponse","done":true,"resource":{"bucket":"test-bucket","name":"dst"}}`))
+			testutil.Ok(t, err)
+		}
+	})
+
+	ctx := context.Background()
+	testutil.Ok(t, objstore.CopyWithAttributes(ctx, bkt, "src", "dst", objstore.CopyObjectAttributes{
+		ContentType:  "text/plain",
+		StorageClass: "COLDLINE",
+	}))
+
+	var obj struct {
+		ContentType  string            `json:"contentType"`
+		CacheControl string            `json:"cacheControl"`
+		StorageClass string            `json:"storageClass"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+	testutil.Ok(t, json.Unmarshal([]byte(rewriteBody), &obj))
+	testutil.Equals(t, "text/plain", obj.ContentType)
+	testutil.Equals(t, "COLDLINE", obj.StorageClass)
+	// Attributes which are not changed are kept.
+	testutil.Equals(t, "no-cache", obj.CacheControl)
+	testutil.Equals(t, map[string]string{"owner": "test"}, obj.Metadata)
+
+	// The storage class of src is kept if none is set.
+	testutil.Ok(t, objstore.CopyWithAttributes(ctx, bkt, "src", "dst", objstore.CopyObjectAttributes{ContentType: "text/plain"}))
+	obj.StorageClass = ""
+	testutil.Ok(t, json.Unmarshal([]byte(rewriteBody), &obj))
+	testutil.Equals(t, "NEARLINE", obj.StorageClass)
+
+	err := objstore.CopyWithAttributes(ctx, bkt, "missing", "dst", objstore.CopyObjectAttributes{ContentType: "text/plain"})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %s", err)
+
+	err = objstore.CopyWithAttributes(ctx, bkt, "src", "dst", objstore.CopyObjectAttributes{StorageClass: "COLD"})
+	testutil.NotOk(t, err)
+}
+
+func TestBucket_Presign(t *testing.T) {
+	// Make sure the client is not created against an emulator, which can't be used with credentials.
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	testutil.Ok(t, err)
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	testutil.Ok(t, err)
+
+	serviceAccount, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": "test-key",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})),
+		"client_email":   "test@test-project.iam.gserviceaccount.com",
+		"client_id":      "123",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", ServiceAccount: string(serviceAccount)}, "test")
+	testutil.Ok(t, err)
+
+	for _, presign := range []func(context.Context, string, time.Duration) (string, error){bkt.PresignedGetURL, bkt.PresignPut} {
+		signed, err := presign(ctx, "dir/obj", 5*time.Minute)
+		testutil.Ok(t, err)
+
+		u, err := url.Parse(signed)
+		testutil.Ok(t, err)
+		testutil.Equals(t, "/test-bucket/dir/obj", u.Path)
+		expires, err := strconv.Atoi(u.Query().Get("X-Goog-Expires"))
+		testutil.Ok(t, err)
+		testutil.Assert(t, expires > 290 && expires <= 300, "unexpected expiry %d", expires)
+		testutil.Assert(t, strings.HasPrefix(u.Query().Get("X-Goog-Credential"), "test@test-project.iam.gserviceaccount.com/"), "unexpected credential %s", u.Query().Get("X-Goog-Credential"))
+		testutil.Assert(t, u.Query().Get("X-Goog-Signature") != "", "expected signature")
+	}
+
+	// Signed headers have to be sent with the requests using the URL.
+	signed, err := bkt.PresignWithHeaders(ctx, http.MethodPut, "dir/obj", 5*time.Minute, http.Header{"Content-Type": {"application/json"}})
+	testutil.Ok(t, err)
+	u, err := url.Parse(signed)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "content-type;host", u.Query().Get("X-Goog-SignedHeaders"))
+
+	// The credentials of a credentials provider are used to sign URLs.
+	provider := credentialsProviderFunc(func(ctx context.Context) (*google.Credentials, error) {
+		return google.CredentialsFromJSON(ctx, serviceAccount, storage.ScopeFullControl)
+	})
+	bkt, err = NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test", WithCredentialsProvider(provider))
+	testutil.Ok(t, err)
+	signed, err = bkt.PresignedGetURL(ctx, "dir/obj", 5*time.Minute)
+	testutil.Ok(t, err)
+	u, err = url.Parse(signed)
+	testutil.Ok(t, err)
+	testutil.Assert(t, strings.HasPrefix(u.Query().Get("X-Goog-Credential"), "test@test-project.iam.gserviceaccount.com/"), "unexpected credential %s", u.Query().Get("X-Goog-Credential"))
+
+	// Tokens without a service account key can't be used to sign URLs.
+	provider = func(ctx context.Context) (*google.Credentials, error) {
+		return &google.Credentials{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})}, nil
+	}
+	bkt, err = NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test", WithCredentialsProvider(provider))
+	testutil.Ok(t, err)
+	_, err = bkt.PresignedGetURL(ctx, "dir/obj", 5*time.Minute)
+	testutil.Assert(t, errors.Is(err, objstore.ErrPresignNotSupported), "expected ErrPresignNotSupported, got %v", err)
+
+	// Without a configured service account, the default credentials are used to sign URLs.
+	credsFile := filepath.Join(t.TempDir(), "credentials.json")
+	testutil.Ok(t, os.WriteFile(credsFile, serviceAccount, 0600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsFile)
+
+	bkt, err = NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+	signed, err = bkt.PresignedGetURL(ctx, "dir/obj", 5*time.Minute)
+	testutil.Ok(t, err)
+	u, err = url.Parse(signed)
+	testutil.Ok(t, err)
+	testutil.Assert(t, strings.HasPrefix(u.Query().Get("X-Goog-Credential"), "test@test-project.iam.gserviceaccount.com/"), "unexpected credential %s", u.Query().Get("X-Goog-Credential"))
+
+	// User credentials don't come with a private key to sign URLs with.
+	userCredentials, err := json.Marshal(map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "123",
+		"client_secret": "secret",
+		"refresh_token": "token",
+	})
+	testutil.Ok(t, err)
+	testutil.Ok(t, os.WriteFile(credsFile, userCredentials, 0600))
+
+	bkt, err = NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket"}, "test")
+	testutil.Ok(t, err)
+	_, err = bkt.PresignedGetURL(ctx, "dir/obj", 5*time.Minute)
+	testutil.Assert(t, errors.Is(err, objstore.ErrPresignNotSupported), "expected ErrPresignNotSupported, got %v", err)
+}
+
+func TestBucket_Ping(t *testing.T) {
+	status := http.StatusOK
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/storage/v1/b/test-bucket", r.URL.Path)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			_, err := w.Write([]byte(`{"error":{"code":` + strconv.Itoa(status) + `,"message":"failed"}}`))
+			testutil.Ok(t, err)
+			return
+		}
+		_, err := w.Write([]byte(`{"kind":"storage#bucket","name":"test-bucket"}`))
+		testutil.Ok(t, err)
+	})
+
+	ctx := context.Background()
+	testutil.Ok(t, objstore.Ping(ctx, bkt))
+
+	status = http.StatusForbidden
+	err := objstore.Ping(ctx, bkt)
+	testutil.Assert(t, objstore.IsPermissionDeniedErr(err), "expected permission denied error, got %v", err)
+
+	status = http.StatusNotFound
+	err = objstore.Ping(ctx, bkt)
+	testutil.Assert(t, objstore.IsNotFoundErr(err), "expected not found error, got %v", err)
+}
+
+func TestWrapErr(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		sentinel error
+	}{
+		{err: storage.ErrObjectNotExist, sentinel: objstore.ErrNotFound},
+		{err: &googleapi.Error{Code: http.StatusForbidden}, sentinel: objstore.ErrPermissionDenied},
+		{err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, sentinel: objstore.ErrThrottled},
+		{err: &googleapi.Error{Code: http.StatusTooManyRequests}, sentinel: objstore.ErrThrottled},
+		{err: &googleapi.Error{Code: http.StatusPreconditionFailed, Errors: []googleapi.ErrorItem{{Reason: "conditionNotMet"}}}, sentinel: objstore.ErrPreconditionFailed},
+	} {
+		err := wrapErr(objstore.OpGet, "obj", tc.err)
+		testutil.Assert(t, errors.Is(err, tc.sentinel), "expected %v to match %v", err, tc.sentinel)
+	}
+}
+
+func TestBucket_IsObjNotFoundErr(t *testing.T) {
+	bkt := &Bucket{}
+	for _, tc := range []struct {
+		err      error
+		notFound bool
+	}{
+		{err: storage.ErrObjectNotExist, notFound: true},
+		{err: &googleapi.Error{Code: http.StatusNotFound, Message: "No such object: test-bucket/obj"}, notFound: true},
+		{err: &googleapi.Error{Code: http.StatusNotFound, Body: "<Error><Code>NoSuchKey</Code></Error>"}, notFound: true},
+		{err: storage.ErrBucketNotExist},
+		{err: &googleapi.Error{Code: http.StatusNotFound, Message: "The specified bucket does not exist."}},
+		{err: &googleapi.Error{Code: http.StatusNotFound}},
+	} {
+		testutil.Equals(t, tc.notFound, bkt.IsObjNotFoundErr(tc.err), "%v", tc.err)
+		testutil.Equals(t, tc.notFound, bkt.IsObjNotFoundErr(wrapErr(objstore.OpGet, "obj", tc.err)), "%v", tc.err)
+	}
+}
+
+func TestBucket_Versions(t *testing.T) {
+	var requests []string
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/test-bucket/o":
+			testutil.Equals(t, "true", r.URL.Query().Get("versions"))
+			_, err := w.Write([]byte(`{"kind":"storage#objects","items":[
+				{"bucket":"test-bucket","name":"obj","generation":"1","updated":"2015-10-20T07:28:00.000Z","size":"3","timeDeleted":"2015-10-21T07:28:00.000Z"},
+				{"bucket":"test-bucket","name":"obj","generation":"2","updated":"2015-10-21T07:28:00.000Z","size":"7"},
+				{"bucket":"test-bucket","name":"obj2","generation":"1","updated":"2015-10-20T07:28:00.000Z","size":"3"}
+			]}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/test-bucket/o/obj":
+			_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj","generation":"2","updated":"2015-10-21T07:28:00.000Z","size":"7"}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodGet:
+			requests = append(requests, "GET "+r.URL.Query().Get("generation"))
+			_, err := w.Write([]byte("content"))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/rewriteTo/"):
+			requests = append(requests, "REWRITE "+r.URL.Query().Get("sourceGeneration"))
+			_, err := w.Write([]byte(`{"kind":"storage#rewriteResponse","done":true,"resource":{"bucket":"test-bucket","name":"obj"}}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodDelete:
+			requests = append(requests, "DELETE "+r.URL.Query().Get("generation"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	ctx := context.Background()
+	testutil.Assert(t, objstore.IsVersionedBucket(bkt))
+	versions, err := objstore.ListVersions(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []objstore.VersionInfo{
+		{VersionID: "2", LastModified: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), Size: 7},
+		{VersionID: "1", LastModified: time.Date(2015, 10, 20, 7, 28, 0, 0, time.UTC), Size: 3},
+	}, versions)
+
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "2", attrs.VersionID)
+
+	var history []string
+	testutil.Ok(t, objstore.IterVersions(ctx, bkt, "obj", func(name, version string, isLatest bool, deleted bool) error {
+		history = append(history, fmt.Sprintf("%s %s latest=%t deleted=%t", name, version, isLatest, deleted))
+		return nil
+	}))
+	testutil.Equals(t, []string{
+		"obj 2 latest=true deleted=false",
+		"obj 1 latest=false deleted=false",
+		"obj2 1 latest=true deleted=false",
+	}, history)
+
+	rc, err := objstore.GetVersion(ctx, bkt, "obj", "1")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	testutil.Ok(t, objstore.RestoreVersion(ctx, bkt, "obj", "1"))
+	testutil.Ok(t, objstore.DeleteVersion(ctx, bkt, "obj", "1"))
+	testutil.Equals(t, []string{"GET 1", "REWRITE 1", "DELETE 1"}, requests)
+
+	testutil.NotOk(t, objstore.DeleteVersion(ctx, bkt, "obj", "not-a-generation"))
+}
+
+func TestBucket_SoftDeleted(t *testing.T) {
+	var restored []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/test-bucket/o":
+			testutil.Equals(t, "true", r.URL.Query().Get("softDeleted"))
+			testutil.Equals(t, "billed-project", r.URL.Query().Get("userProject"))
+			if r.URL.Query().Get("pageToken") == "" {
+				_, err := w.Write([]byte(`{"kind":"storage#objects","nextPageToken":"next","items":[
+					{"bucket":"test-bucket","name":"obj","generation":"1","softDeleteTime":"2015-10-20T07:28:00.000Z","hardDeleteTime":"2015-10-27T07:28:00.000Z"}
+				]}`))
+				testutil.Ok(t, err)
+				return
+			}
+			_, err := w.Write([]byte(`{"kind":"storage#objects","items":[
+				{"bucket":"test-bucket","name":"obj","generation":"2","softDeleteTime":"2015-10-21T07:28:00.000Z","hardDeleteTime":"2015-10-28T07:28:00.000Z"},
+				{"bucket":"test-bucket","name":"obj2","generation":"3","softDeleteTime":"2015-10-22T07:28:00.000Z","hardDeleteTime":"2015-10-29T07:28:00.000Z"}
+			]}`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPost && r.URL.Path == "/storage/v1/b/test-bucket/o/obj/restore":
+			restored = append(restored, r.URL.Query().Get("generation"))
+			_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj"}`))
+			testutil.Ok(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", BillingProject: "billed-project"}, "test")
+	testutil.Ok(t, err)
+
+	var objs []SoftDeletedObject
+	testutil.Ok(t, bkt.IterSoftDeleted(ctx, "obj", func(obj SoftDeletedObject) error {
+		objs = append(objs, obj)
+		return nil
+	}))
+	testutil.Equals(t, []SoftDeletedObject{
+		{Name: "obj", Generation: 1, SoftDeleteTime: time.Date(2015, 10, 20, 7, 28, 0, 0, time.UTC), HardDeleteTime: time.Date(2015, 10, 27, 7, 28, 0, 0, time.UTC)},
+		{Name: "obj", Generation: 2, SoftDeleteTime: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), HardDeleteTime: time.Date(2015, 10, 28, 7, 28, 0, 0, time.UTC)},
+		{Name: "obj2", Generation: 3, SoftDeleteTime: time.Date(2015, 10, 22, 7, 28, 0, 0, time.UTC), HardDeleteTime: time.Date(2015, 10, 29, 7, 28, 0, 0, time.UTC)},
+	}, objs)
+
+	// The most recently deleted generation is restored.
+	testutil.Ok(t, bkt.RestoreSoftDeleted(ctx, "obj"))
+	testutil.Equals(t, []string{"2"}, restored)
+
+	err = bkt.RestoreSoftDeleted(ctx, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+
+	client, err := storage.NewClient(ctx, option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	testutil.Ok(t, err)
+	bkt, err = NewBucketWithClient(log.NewNopLogger(), client, "test-bucket", "test")
+	testutil.Ok(t, err)
+	testutil.NotOk(t, bkt.RestoreSoftDeleted(ctx, "obj"))
+}
+
+func TestBucket_VerifyChecksums(t *testing.T) {
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.Checksum([]byte("content"), crc32cTable))
+
+	served := "content"
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/storage/v1/") {
+			_, err := w.Write([]byte(`{"bucket":"test-bucket","name":"obj","generation":"5","size":"7","crc32c":"` + base64.StdEncoding.EncodeToString(crc) + `"}`))
+			testutil.Ok(t, err)
+			return
+		}
+		testutil.Equals(t, "5", r.URL.Query().Get("generation"))
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/7", start, end))
+			w.WriteHeader(http.StatusPartialContent)
+			_, err := w.Write([]byte(served[start : end+1]))
+			testutil.Ok(t, err)
+			return
+		}
+		_, err := w.Write([]byte(served))
+		testutil.Ok(t, err)
+	})
+	bkt.verifyChecksums = true
+
+	ctx := context.Background()
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	served = "CONTENT"
+	rc, err = bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = io.ReadAll(rc)
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(err), "expected checksum mismatch, got %v", err)
+	testutil.Assert(t, !bkt.IsObjNotFoundErr(err))
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(rc.Close()), "expected Close to report the mismatch again")
+
+	// The checksum is verified on Close if the caller stops reading right after the last byte.
+	rc, err = bkt.GetRange(ctx, "obj", 0, 7)
+	testutil.Ok(t, err)
+	_, err = io.ReadFull(rc, make([]byte, 7))
+	testutil.Ok(t, err)
+	err = rc.Close()
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(err), "expected checksum mismatch, got %v", err)
+
+	// Partial ranges can't be verified.
+	rc, err = bkt.GetRange(ctx, "obj", 1, 3)
+	testutil.Ok(t, err)
+	content, err = io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "ONT", string(content))
+}
+
+func TestBucket_ObjectTags(t *testing.T) {
+	metadata := map[string]string{"user": "value"}
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/o/obj") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			var update struct {
+				Metadata map[string]string `json:"metadata"`
+			}
+			testutil.Ok(t, json.NewDecoder(r.Body).Decode(&update))
+			for k, v := range update.Metadata {
+				metadata[k] = v
+			}
+		}
+		testutil.Ok(t, json.NewEncoder(w).Encode(map[string]interface{}{"bucket": "test-bucket", "name": "obj", "metadata": metadata}))
+	})
+
+	ctx := context.Background()
+	testutil.Ok(t, objstore.SetObjectTags(ctx, bkt, "obj", map[string]string{"env": "prod"}))
+	tags, err := objstore.GetObjectTags(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"env": "prod"}, tags)
+
+	// The tags are not part of the user metadata.
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"user": "value"}, attrs.UserMetadata)
+
+	testutil.Ok(t, objstore.DeleteObjectTags(ctx, bkt, "obj"))
+	tags, err = objstore.GetObjectTags(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{}, tags)
+
+	err = objstore.SetObjectTags(ctx, bkt, "missing", map[string]string{"env": "prod"})
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+}
+
+func TestBucket_UpdateMetadata(t *testing.T) {
+	var (
+		requests []string
+		body     map[string]interface{}
+	)
+	bkt := newFakeGCSBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		if r.Method != http.MethodGet {
+			body = nil
+			testutil.Ok(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+		obj := map[string]interface{}{
+			"bucket":         "test-bucket",
+			"name":           "obj",
+			"generation":     "3",
+			"metageneration": "2",
+			"contentType":    "application/json",
+			"metadata":       map[string]string{"team": "storage", tagsMetadataKey: `{"env":"prod"}`},
+		}
+		if strings.Contains(r.URL.Path, "/rewriteTo/") {
+			testutil.Ok(t, json.NewEncoder(w).Encode(map[string]interface{}{"done": true, "resource": obj}))
+			return
+		}
+		testutil.Ok(t, json.NewEncoder(w).Encode(obj))
+	})
+
+	ctx := context.Background()
+	// Adding metadata keys patches the object.
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, bkt, "obj", map[string]string{"team": "storage", "env": "prod"}, objstore.WithCacheControl("no-cache")))
+	testutil.Equals(t, "PATCH /storage/v1/b/test-bucket/o/obj?alt=json&ifMetagenerationMatch=2&prettyPrint=false&projection=full", requests[len(requests)-1])
+	testutil.Equals(t, map[string]interface{}{"team": "storage", "env": "prod", tagsMetadataKey: `{"env":"prod"}`}, body["metadata"])
+	testutil.Equals(t, "no-cache", body["cacheControl"])
+	testutil.Equals(t, nil, body["contentType"])
+
+	// Removing metadata keys or changing the storage class rewrites the object in place, keeping its tags.
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, bkt, "obj", map[string]string{}, objstore.WithStorageClass("COLDLINE")))
+	testutil.Equals(t, "POST /storage/v1/b/test-bucket/o/obj/rewriteTo/b/test-bucket/o/obj?alt=json&ifGenerationMatch=3&prettyPrint=false&projection=full&sourceGeneration=3", requests[len(requests)-1])
+	testutil.Equals(t, map[string]interface{}{tagsMetadataKey: `{"env":"prod"}`}, body["metadata"])
+	testutil.Equals(t, "COLDLINE", body["storageClass"])
+	testutil.Equals(t, "application/json", body["contentType"])
+
+	testutil.NotOk(t, objstore.UpdateMetadata(ctx, bkt, "obj", nil, objstore.WithStorageClass("UNKNOWN")))
+}
+
+func TestBucket_BatchAttributes(t *testing.T) {
+	var batches []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, http.MethodPost, r.Method)
+		testutil.Equals(t, "/batch/storage/v1", r.URL.Path)
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		testutil.Ok(t, err)
+
+		// The whole request is read before responding, as writing the response may prevent further reads.
+		body, err := io.ReadAll(r.Body)
+		testutil.Ok(t, err)
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		var n int
+		for ; ; n++ {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			testutil.Ok(t, err)
+			req, err := http.ReadRequest(bufio.NewReader(part))
+			testutil.Ok(t, err)
+			testutil.Equals(t, "billed-project", req.URL.Query().Get("userProject"))
+			name := strings.TrimPrefix(req.URL.Path, "/storage/v1/b/test-bucket/o/")
+
+			pw, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type": {"application/http"},
+				"Content-Id":   {"<response-" + strings.Trim(part.Header.Get("Content-Id"), "<>") + ">"},
+			})
+			testutil.Ok(t, err)
+			if strings.HasPrefix(name, "missing") {
+				_, err = io.WriteString(pw, "HTTP/1.1 404 Not Found\r\nContent-Type: application/json\r\n\r\n{\"error\":{\"code\":404}}")
+				testutil.Ok(t, err)
+				continue
+			}
+			obj := fmt.Sprintf(`{"name":%q,"size":"%d","updated":"2015-10-20T07:28:00.000Z","generation":"7","contentType":"text/plain","md5Hash":"AAAAAAAAAAAAAAAAAAAAAA==","crc32c":"AAAAAQ=="}`, name, len(name))
+			_, err = fmt.Fprintf(pw, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(obj), obj)
+			testutil.Ok(t, err)
+		}
+		batches = append(batches, n)
+		testutil.Ok(t, mw.Close())
+	}))
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.Listener.Addr().String())
+
+	ctx := context.Background()
+	bkt, err := NewBucketWithConfig(ctx, log.NewNopLogger(), Config{Bucket: "test-bucket", BillingProject: "billed-project"}, "test")
+	testutil.Ok(t, err)
+
+	var names []string
+	for i := 0; i < 150; i++ {
+		names = append(names, fmt.Sprintf("dir/obj-%03d", i))
+	}
+	names = append(names, "missing", "dir/obj-000")
+
+	attrs, err := bkt.BatchAttributes(ctx, names)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int{maxBatchSize, 51}, batches)
+	testutil.Equals(t, 150, len(attrs))
+	crc := uint32(1)
+	testutil.Equals(t, objstore.ObjectAttributes{
+		Size:         int64(len("dir/obj-042")),
+		LastModified: time.Date(2015, 10, 20, 7, 28, 0, 0, time.UTC),
+		ContentType:  "text/plain",
+		MD5:          make([]byte, 16),
+		CRC32C:       &crc,
+		VersionID:    "7",
+	}, attrs["dir/obj-042"])
+
+	exists, err := bkt.BatchExists(ctx, []string{"dir/obj-001", "missing"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]bool{"dir/obj-001": true, "missing": false}, exists)
+}
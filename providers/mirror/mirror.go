@@ -0,0 +1,277 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package mirror implements a bucket wrapper which writes to two buckets, e.g. to migrate between providers.
+package mirror
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/objstore"
+)
+
+// DefaultDrainCheckInterval is the default minimum time between two checks whether the primary bucket is empty.
+const DefaultDrainCheckInterval = time.Minute
+
+// Config configures a MirrorBucket.
+type Config struct {
+	// StrictWrites makes writes fail if they fail against the secondary bucket. Otherwise, such failures are
+	// only logged and counted.
+	StrictWrites bool
+	// DrainMode switches reads to the secondary bucket once the primary bucket is empty, e.g. because all
+	// objects were migrated and deleted from it. Once switched, reads never go to the primary bucket again.
+	DrainMode bool
+	// DrainCheckInterval is the minimum time between two checks whether the primary bucket is empty in
+	// DrainMode. DefaultDrainCheckInterval is used if not set.
+	DrainCheckInterval time.Duration
+}
+
+func (c Config) validate() error {
+	if c.DrainCheckInterval < 0 {
+		return errors.New("drain check interval must not be negative")
+	}
+	return nil
+}
+
+// MirrorBucket is a bucket wrapper which applies uploads, deletes and copies to a primary and a secondary bucket
+// in parallel, while reads only go to the primary bucket. Objects which only exist in the primary bucket are not
+// copied to the secondary one.
+type MirrorBucket struct {
+	primary   objstore.Bucket
+	secondary objstore.Bucket
+	cfg       Config
+	logger    log.Logger
+
+	drained     atomic.Bool
+	drainMtx    sync.Mutex
+	lastDrainCk time.Time
+
+	secondaryFailures *prometheus.CounterVec
+	drainedGauge      prometheus.Gauge
+}
+
+// NewMirrorBucket returns a new MirrorBucket writing to primary and secondary. Failed writes to the secondary
+// bucket are counted per operation and registered with reg, if not nil.
+func NewMirrorBucket(primary, secondary objstore.Bucket, cfg Config, logger log.Logger, reg prometheus.Registerer) (*MirrorBucket, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate mirror config")
+	}
+	if cfg.DrainCheckInterval == 0 {
+		cfg.DrainCheckInterval = DefaultDrainCheckInterval
+	}
+	b := &MirrorBucket{
+		primary:   primary,
+		secondary: secondary,
+		cfg:       cfg,
+		logger:    logger,
+		secondaryFailures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_mirror_bucket_secondary_write_failures_total",
+			Help:        "Total number of write operations which failed against the secondary bucket of a mirror bucket.",
+			ConstLabels: prometheus.Labels{"bucket": primary.Name(), "secondary_bucket": secondary.Name()},
+		}, []string{"operation"}),
+		drainedGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "objstore_mirror_bucket_drained",
+			Help:        "Whether reads of a mirror bucket in drain mode switched to the secondary bucket.",
+			ConstLabels: prometheus.Labels{"bucket": primary.Name(), "secondary_bucket": secondary.Name()},
+		}),
+	}
+	for _, op := range []string{objstore.OpUpload, objstore.OpDelete, objstore.OpCopy} {
+		b.secondaryFailures.WithLabelValues(op)
+	}
+	return b, nil
+}
+
+// errNotEmpty stops the iteration checking whether the primary bucket is empty.
+var errNotEmpty = errors.New("bucket is not empty")
+
+// reader returns the bucket to read from. In DrainMode, the primary bucket is checked to be empty at most
+// once per DrainCheckInterval.
+func (b *MirrorBucket) reader(ctx context.Context) objstore.Bucket {
+	if !b.cfg.DrainMode {
+		return b.primary
+	}
+	if b.drained.Load() {
+		return b.secondary
+	}
+
+	b.drainMtx.Lock()
+	defer b.drainMtx.Unlock()
+	if b.drained.Load() || time.Since(b.lastDrainCk) < b.cfg.DrainCheckInterval {
+		return b.current()
+	}
+	b.lastDrainCk = time.Now()
+
+	err := b.primary.Iter(ctx, "", func(string) error { return errNotEmpty })
+	if err == nil {
+		level.Info(b.logger).Log("msg", "primary bucket is empty, reading from secondary bucket", "primary", b.primary.Name(), "secondary", b.secondary.Name())
+		b.drained.Store(true)
+		b.drainedGauge.Set(1)
+	} else if !errors.Is(err, errNotEmpty) {
+		level.Warn(b.logger).Log("msg", "failed to check whether primary bucket is empty", "err", err)
+	}
+	return b.current()
+}
+
+// current returns the bucket to read from without checking whether the primary bucket was drained.
+func (b *MirrorBucket) current() objstore.Bucket {
+	if b.drained.Load() {
+		return b.secondary
+	}
+	return b.primary
+}
+
+// write calls f for both buckets in parallel. The error of the primary bucket is returned, errors of the
+// secondary bucket only if Config.StrictWrites is set. ignoreSecondaryErr filters expected secondary errors.
+func (b *MirrorBucket) write(op, name string, f func(bkt objstore.Bucket, primary bool) error, ignoreSecondaryErr func(error) bool) error {
+	var (
+		wg           sync.WaitGroup
+		secondaryErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		secondaryErr = f(b.secondary, false)
+	}()
+	primaryErr := f(b.primary, true)
+	wg.Wait()
+
+	if secondaryErr != nil && (ignoreSecondaryErr == nil || !ignoreSecondaryErr(secondaryErr)) {
+		b.secondaryFailures.WithLabelValues(op).Inc()
+		level.Warn(b.logger).Log("msg", "write to secondary bucket failed", "op", op, "name", name, "err", secondaryErr)
+		if primaryErr == nil && b.cfg.StrictWrites {
+			return errors.Wrapf(secondaryErr, "%s %s in secondary bucket", op, name)
+		}
+	}
+	return primaryErr
+}
+
+func (b *MirrorBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.reader(ctx).Iter(ctx, dir, f, options...)
+}
+
+func (b *MirrorBucket) IterWithAttributes(ctx context.Context, dir string, f func(objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.reader(ctx).IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *MirrorBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.current().SupportedIterOptions()
+}
+
+func (b *MirrorBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.reader(ctx).Get(ctx, name)
+}
+
+func (b *MirrorBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.reader(ctx).GetRange(ctx, name, off, length)
+}
+
+func (b *MirrorBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.reader(ctx).Exists(ctx, name)
+}
+
+func (b *MirrorBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	return b.reader(ctx).Attributes(ctx, name)
+}
+
+// sizedReader reports the size of the original reader to the buckets uploading a copy of its content.
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (r sizedReader) ObjectSize() (int64, error) { return r.size, nil }
+
+// Upload uploads the content of r to both buckets in parallel. The content is streamed to both buckets at
+// once, so the upload is only as fast as the slower bucket.
+func (b *MirrorBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	size, sizeErr := objstore.TryToGetSize(r)
+	withSize := func(r io.Reader) io.Reader {
+		if sizeErr != nil {
+			return r
+		}
+		return sizedReader{Reader: r, size: size}
+	}
+
+	pr, pw := io.Pipe()
+	return b.write(objstore.OpUpload, name, func(bkt objstore.Bucket, primary bool) error {
+		if !primary {
+			err := bkt.Upload(ctx, name, withSize(pr), opts...)
+			// Keep consuming the content, so that the upload to the primary bucket is not blocked if the
+			// secondary one stopped reading early.
+			_, _ = io.Copy(io.Discard, pr)
+			return err
+		}
+		err := bkt.Upload(ctx, name, withSize(io.TeeReader(r, pw)), opts...)
+		if err != nil {
+			// Make the secondary upload fail instead of uploading partial content.
+			_ = pw.CloseWithError(errors.Wrap(err, "upload to primary bucket failed"))
+			return err
+		}
+		return pw.Close()
+	}, nil)
+}
+
+// Delete removes the object from both buckets. Objects which don't exist in the secondary bucket are ignored.
+func (b *MirrorBucket) Delete(ctx context.Context, name string) error {
+	return b.write(objstore.OpDelete, name, func(bkt objstore.Bucket, _ bool) error {
+		return bkt.Delete(ctx, name)
+	}, b.secondary.IsObjNotFoundErr)
+}
+
+// DeleteMany removes the objects from both buckets. Objects which don't exist in the secondary bucket are ignored.
+func (b *MirrorBucket) DeleteMany(ctx context.Context, names []string) error {
+	return b.write(objstore.OpDelete, "", func(bkt objstore.Bucket, _ bool) error {
+		return bkt.DeleteMany(ctx, names)
+	}, func(err error) bool {
+		var res *objstore.BatchDeleteResult
+		if !errors.As(err, &res) {
+			return b.secondary.IsObjNotFoundErr(err)
+		}
+		for _, objErr := range res.Errors {
+			if !b.secondary.IsObjNotFoundErr(objErr) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Copy copies the object within both buckets.
+func (b *MirrorBucket) Copy(ctx context.Context, src, dst string) error {
+	return b.write(objstore.OpCopy, src, func(bkt objstore.Bucket, _ bool) error {
+		return bkt.Copy(ctx, src, dst)
+	}, nil)
+}
+
+// IsObjNotFoundErr returns true if err means that the object was not found in either bucket.
+func (b *MirrorBucket) IsObjNotFoundErr(err error) bool {
+	return b.primary.IsObjNotFoundErr(err) || b.secondary.IsObjNotFoundErr(err)
+}
+
+func (b *MirrorBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.primary.IsCustomerManagedKeyError(err) || b.secondary.IsCustomerManagedKeyError(err)
+}
+
+// Close closes both buckets.
+func (b *MirrorBucket) Close() error {
+	primaryErr := b.primary.Close()
+	if err := b.secondary.Close(); err != nil && primaryErr == nil {
+		return err
+	}
+	return primaryErr
+}
+
+// Name returns the name of the primary bucket.
+func (b *MirrorBucket) Name() string {
+	return b.primary.Name()
+}
@@ -0,0 +1,134 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package mirror
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/objstore"
+)
+
+var errWrite = errors.New("write failed")
+
+// failingBucket fails all uploads after reading a part of the content.
+type failingBucket struct {
+	objstore.Bucket
+}
+
+func (b failingBucket) Upload(_ context.Context, _ string, r io.Reader, _ ...objstore.ObjectUploadOption) error {
+	_, _ = r.Read(make([]byte, 1))
+	return errWrite
+}
+
+func (b failingBucket) Delete(context.Context, string) error {
+	return errWrite
+}
+
+func content(t *testing.T, bkt objstore.Bucket, name string) string {
+	t.Helper()
+
+	rc, err := bkt.Get(context.Background(), name)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rc.Close()) }()
+	b, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	return string(b)
+}
+
+func TestMirrorBucket_Acceptance(t *testing.T) {
+	bkt, err := NewMirrorBucket(objstore.NewInMemBucket(), objstore.NewInMemBucket(), Config{StrictWrites: true}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	objstore.AcceptanceTest(t, bkt)
+}
+
+func TestMirrorBucket(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := objstore.NewInMemBucket(), objstore.NewInMemBucket()
+	bkt, err := NewMirrorBucket(primary, secondary, Config{}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader(strings.Repeat("a", 1<<20))))
+	testutil.Equals(t, strings.Repeat("a", 1<<20), content(t, primary, "a"))
+	testutil.Equals(t, strings.Repeat("a", 1<<20), content(t, secondary, "a"))
+
+	testutil.Ok(t, bkt.Copy(ctx, "a", "b"))
+	ok, err := secondary.Exists(ctx, "b")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected copy in secondary bucket")
+
+	// Reads only go to the primary bucket.
+	testutil.Ok(t, primary.Upload(ctx, "primary-only", strings.NewReader("p")))
+	testutil.Equals(t, "p", content(t, bkt, "primary-only"))
+
+	// Objects missing in the secondary bucket can be deleted.
+	testutil.Ok(t, bkt.Delete(ctx, "primary-only"))
+	testutil.Ok(t, bkt.DeleteMany(ctx, []string{"a", "b"}))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.secondaryFailures.WithLabelValues(objstore.OpDelete)))
+	ok, err = secondary.Exists(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected a to be deleted from secondary bucket")
+}
+
+func TestMirrorBucket_SecondaryFailures(t *testing.T) {
+	ctx := context.Background()
+	primary := objstore.NewInMemBucket()
+	bkt, err := NewMirrorBucket(primary, failingBucket{Bucket: objstore.NewInMemBucket()}, Config{}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+
+	// The upload to the primary bucket succeeds even though the secondary one stopped reading.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader(strings.Repeat("a", 1<<20))))
+	testutil.Equals(t, strings.Repeat("a", 1<<20), content(t, primary, "a"))
+	testutil.Ok(t, bkt.Delete(ctx, "a"))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.secondaryFailures.WithLabelValues(objstore.OpUpload)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.secondaryFailures.WithLabelValues(objstore.OpDelete)))
+
+	bkt, err = NewMirrorBucket(primary, failingBucket{Bucket: objstore.NewInMemBucket()}, Config{StrictWrites: true}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	err = bkt.Upload(ctx, "a", strings.NewReader("a"))
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, errWrite), "unexpected error: %v", err)
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.secondaryFailures.WithLabelValues(objstore.OpUpload)))
+
+	// Primary failures are returned and abort the upload to the secondary bucket.
+	secondary := objstore.NewInMemBucket()
+	bkt, err = NewMirrorBucket(failingBucket{Bucket: objstore.NewInMemBucket()}, secondary, Config{}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	err = bkt.Upload(ctx, "a", strings.NewReader("aaaa"))
+	testutil.Assert(t, errors.Is(err, errWrite), "unexpected error: %v", err)
+	ok, err := secondary.Exists(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected no partial upload to secondary bucket")
+}
+
+func TestMirrorBucket_DrainMode(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := objstore.NewInMemBucket(), objstore.NewInMemBucket()
+	testutil.Ok(t, primary.Upload(ctx, "a", strings.NewReader("primary")))
+	testutil.Ok(t, secondary.Upload(ctx, "a", strings.NewReader("secondary")))
+
+	bkt, err := NewMirrorBucket(primary, secondary, Config{DrainMode: true, DrainCheckInterval: 50 * time.Millisecond}, log.NewNopLogger(), nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "primary", content(t, bkt, "a"))
+
+	// Reads switch to the secondary bucket once the primary one was found empty.
+	testutil.Ok(t, primary.Delete(ctx, "a"))
+	_, err = bkt.Get(ctx, "a")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected primary to be checked at most once per interval, got: %v", err)
+	time.Sleep(100 * time.Millisecond)
+	testutil.Equals(t, "secondary", content(t, bkt, "a"))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.drainedGauge))
+
+	// Reads stay on the secondary bucket.
+	testutil.Ok(t, primary.Upload(ctx, "a", strings.NewReader("primary")))
+	testutil.Equals(t, "secondary", content(t, bkt, "a"))
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/clientutil"
 	"github.com/thanos-io/objstore/exthttp"
 
 	"github.com/go-kit/log"
@@ -124,11 +125,40 @@ func (b *Bucket) Name() string {
 func (b *Bucket) Delete(ctx context.Context, name string) error {
 	input := &obs.DeleteObjectInput{Bucket: b.name, Key: name}
 	_, err := b.client.DeleteObject(input)
-	return err
+	return wrapErr(objstore.OpDelete, name, err)
+}
+
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	input := &obs.CopyObjectInput{
+		ObjectOperationInput: obs.ObjectOperationInput{Bucket: b.name, Key: dst},
+		CopySourceBucket:     b.name,
+		CopySourceKey:        src,
+	}
+	if _, err := b.client.CopyObject(input); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy obs object %s to %s", src, dst))
+	}
+	return nil
+}
+
+// SupportedCopy returns true as OBS copies objects server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
 }
 
 // Upload the contents of the reader as an object into the bucket.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+
 	size, err := objstore.TryToGetSize(r)
 
 	if err != nil {
@@ -234,6 +264,10 @@ func (b *Bucket) Close() error { return nil }
 
 // Iter calls f for each entry in the given directory (not recursive.)
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
@@ -248,7 +282,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	for {
 		output, err := b.client.ListObjects(input)
 		if err != nil {
-			return errors.Wrap(err, "failed to list object")
+			return wrapErr(objstore.OpIter, dir, errors.Wrap(err, "failed to list object"))
 		}
 		for _, content := range output.Contents {
 			if err := f(content.Key); err != nil {
@@ -270,14 +304,30 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	return nil
 }
 
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	return b.Iter(ctx, dir, func(name string) error {
+		return f(objstore.IterObjectAttributes{Name: name})
+	}, options...)
+}
+
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive}
+}
+
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, 0, -1)
+	r, err := b.getRange(ctx, name, 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
 }
 
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, off, length)
+	r, err := b.getRange(ctx, name, off, length)
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
@@ -312,11 +362,30 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "failed to get object metadata")
+		return false, wrapErr(objstore.OpExists, name, errors.Wrap(err, "failed to get object metadata"))
 	}
 	return true, nil
 }
 
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the OBS error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	obsErr, ok := errors.Cause(err).(obs.ObsError)
+	if !ok {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	kind := objstore.ErrorKindFromHTTPStatus(obsErr.StatusCode)
+	switch obsErr.Code {
+	case "NoSuchKey", "NoSuchBucket":
+		kind = objstore.ErrKindNotFound
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		kind = objstore.ErrKindPermissionDenied
+	case "PreconditionFailed":
+		kind = objstore.ErrKindPreconditionFailed
+	}
+	return objstore.NewBucketError(op, name, obsErr.Code, kind, err)
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	if oriErr, ok := errors.Cause(err).(obs.ObsError); ok {
@@ -339,11 +408,12 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 		Key:    name,
 	})
 	if err != nil {
-		return objstore.ObjectAttributes{}, errors.Wrap(err, "failed to get object metadata")
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, errors.Wrap(err, "failed to get object metadata"))
 	}
 	return objstore.ObjectAttributes{
 		Size:         output.ContentLength,
 		LastModified: output.LastModified,
+		ETag:         clientutil.TrimETag(output.ETag),
 	}, nil
 }
 
@@ -21,6 +21,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/clientutil"
 	"gopkg.in/yaml.v2"
 )
 
@@ -100,6 +101,10 @@ func (b *Bucket) Name() string {
 // Iter calls f for each entry in the given directory (not recursive). The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
@@ -108,7 +113,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 
 	objectNames, err := listAllObjects(ctx, *b, dir, options...)
 	if err != nil {
-		return errors.Wrapf(err, "cannot list objects in directory '%s'", dir)
+		return wrapErr(objstore.OpIter, dir, errors.Wrapf(err, "cannot list objects in directory '%s'", dir))
 	}
 
 	level.Debug(b.logger).Log("NumberOfObjects", len(objectNames))
@@ -125,11 +130,25 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	return nil
 }
 
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	return b.Iter(ctx, dir, func(name string) error {
+		return f(objstore.IterObjectAttributes{Name: name})
+	}, options...)
+}
+
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive}
+}
+
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	response, err := getObject(ctx, *b, name, "")
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(objstore.OpGet, name, err)
 	}
 	return response.Content, nil
 }
@@ -151,7 +170,7 @@ func (b *Bucket) GetRange(ctx context.Context, name string, offset, length int64
 		if length > 0 {
 			byteRange = fmt.Sprintf("bytes=-%d", length)
 		} else {
-			return nil, errors.New(fmt.Sprintf("invalid range specified: offset=%d length=%d", offset, length))
+			return nil, wrapErr(objstore.OpGetRange, name, errors.New(fmt.Sprintf("invalid range specified: offset=%d length=%d", offset, length)))
 		}
 	}
 
@@ -159,14 +178,17 @@ func (b *Bucket) GetRange(ctx context.Context, name string, offset, length int64
 
 	response, err := getObject(ctx, *b, name, byteRange)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(objstore.OpGetRange, name, err)
 	}
 	return response.Content, nil
 }
 
 // Upload the contents of the reader as an object into the bucket.
 // Upload should be idempotent.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return wrapErr(objstore.OpUpload, name, objstore.ErrOptionNotSupported)
+	}
 	req := transfer.UploadStreamRequest{
 		UploadRequest: transfer.UploadRequest{
 			NamespaceName:                       common.String(b.namespace),
@@ -185,7 +207,7 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) (err erro
 	uploadManager := transfer.NewUploadManager()
 	_, err = uploadManager.UploadStream(ctx, req)
 
-	return err
+	return wrapErr(objstore.OpUpload, name, err)
 }
 
 // Exists checks if the given object exists in the bucket.
@@ -195,7 +217,7 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrapf(err, "cannot get OCI object '%s'", name)
+		return false, wrapErr(objstore.OpExists, name, errors.Wrapf(err, "cannot get OCI object '%s'", name))
 	}
 	return true, nil
 }
@@ -210,12 +232,44 @@ func (b *Bucket) Delete(ctx context.Context, name string) (err error) {
 		RequestMetadata: b.requestMetadata,
 	}
 	_, err = b.client.DeleteObject(ctx, request)
-	return err
+	return wrapErr(objstore.OpDelete, name, err)
+}
+
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+// OCI copy requests are asynchronous work requests, so the object is downloaded and uploaded again instead.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	return objstore.DefaultCopy(ctx, b, src, dst)
+}
+
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the OCI error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	failure, isServiceError := common.IsServiceError(errors.Cause(err))
+	if !isServiceError {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	kind := objstore.ErrorKindFromHTTPStatus(failure.GetHTTPStatusCode())
+	switch failure.GetCode() {
+	case "ObjectNotFound", "BucketNotFound":
+		kind = objstore.ErrKindNotFound
+	case "NotAuthenticated":
+		kind = objstore.ErrKindPermissionDenied
+	case "TooManyRequests":
+		kind = objstore.ErrKindRateLimit
+	case "QuotaExceeded":
+		kind = objstore.ErrKindQuotaExceeded
+	}
+	return objstore.NewBucketError(op, name, failure.GetCode(), kind, err)
 }
 
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
-	failure, isServiceError := common.IsServiceError(err)
+	failure, isServiceError := common.IsServiceError(errors.Cause(err))
 	if isServiceError {
 		k := failure.GetHTTPStatusCode()
 		match := k == http.StatusNotFound
@@ -248,12 +302,16 @@ func (b *Bucket) Close() error {
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	response, err := getObject(ctx, *b, name, "")
 	if err != nil {
-		return objstore.ObjectAttributes{}, err
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, err)
 	}
-	return objstore.ObjectAttributes{
+	attrs := objstore.ObjectAttributes{
 		Size:         *response.ContentLength,
 		LastModified: response.LastModified.Time,
-	}, nil
+	}
+	if response.ETag != nil {
+		attrs.ETag = clientutil.TrimETag(*response.ETag)
+	}
+	return attrs, nil
 }
 
 // createBucket creates bucket.
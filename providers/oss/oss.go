@@ -68,7 +68,13 @@ func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
 }
 
 // Upload the contents of the reader as an object into the bucket.
-func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) error {
+func (b *Bucket) Upload(_ context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+
 	// TODO(https://github.com/thanos-io/thanos/issues/678): Remove guessing length when minio provider will support multipart upload without this.
 	size, err := objstore.TryToGetSize(r)
 	if err != nil {
@@ -127,13 +133,33 @@ func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) error {
 // Delete removes the object with the given name.
 func (b *Bucket) Delete(ctx context.Context, name string) error {
 	if err := b.bucket.DeleteObject(name); err != nil {
-		return errors.Wrap(err, "delete oss object")
+		return wrapErr(objstore.OpDelete, name, errors.Wrap(err, "delete oss object"))
+	}
+	return nil
+}
+
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	if _, err := b.bucket.CopyObject(src, dst); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "copy oss object %s to %s", src, dst))
 	}
 	return nil
 }
 
+// SupportedCopy returns true as OSS copies objects server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
+}
+
 // Attributes returns information about the specified object.
-func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+func (b *Bucket) Attributes(ctx context.Context, name string) (_ objstore.ObjectAttributes, err error) {
+	defer func() { err = wrapErr(objstore.OpAttributes, name, err) }()
+
 	m, err := b.bucket.GetObjectMeta(name)
 	if err != nil {
 		return objstore.ObjectAttributes{}, err
@@ -154,6 +180,7 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 	return objstore.ObjectAttributes{
 		Size:         size,
 		LastModified: mod,
+		ETag:         clientutil.ParseETag(m),
 	}, nil
 }
 
@@ -207,6 +234,10 @@ func validate(config Config) error {
 // Iter calls f for each entry in the given directory (not recursive). The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, objstore.DirDelim) + objstore.DirDelim
 	}
@@ -223,7 +254,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 		}
 		objects, err := b.bucket.ListObjects(alioss.Prefix(dir), delimiter, marker)
 		if err != nil {
-			return errors.Wrap(err, "listing aliyun oss bucket failed")
+			return wrapErr(objstore.OpIter, dir, errors.Wrap(err, "listing aliyun oss bucket failed"))
 		}
 		marker = alioss.Marker(objects.NextMarker)
 
@@ -246,6 +277,20 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 	return nil
 }
 
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	return b.Iter(ctx, dir, func(name string) error {
+		return f(objstore.IterObjectAttributes{Name: name})
+	}, options...)
+}
+
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive}
+}
+
 func (b *Bucket) Name() string {
 	return b.name
 }
@@ -348,11 +393,13 @@ func (b *Bucket) getRange(_ context.Context, name string, off, length int64) (io
 
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, 0, -1)
+	r, err := b.getRange(ctx, name, 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
 }
 
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, off, length)
+	r, err := b.getRange(ctx, name, off, length)
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 // Exists checks if the given object exists in the bucket.
@@ -362,12 +409,31 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "cloud not check if object exists")
+		return false, wrapErr(objstore.OpExists, name, errors.Wrap(err, "cloud not check if object exists"))
 	}
 
 	return exists, nil
 }
 
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the OSS error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	aliErr, ok := errors.Cause(err).(alioss.ServiceError)
+	if !ok {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	kind := objstore.ErrorKindFromHTTPStatus(aliErr.StatusCode)
+	switch aliErr.Code {
+	case "NoSuchKey", "NoSuchBucket":
+		kind = objstore.ErrKindNotFound
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		kind = objstore.ErrKindPermissionDenied
+	case "PreconditionFailed":
+		kind = objstore.ErrKindPreconditionFailed
+	}
+	return objstore.NewBucketError(op, name, aliErr.Code, kind, err)
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	switch aliErr := errors.Cause(err).(type) {
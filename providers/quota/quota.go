@@ -0,0 +1,370 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package quota implements a bucket wrapper which limits the total size of the objects stored in a bucket.
+package quota
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/objstore"
+)
+
+// usageConcurrency is the number of objects whose size is fetched at once when computing the usage of buckets
+// which can't return it with the listing.
+const usageConcurrency = 16
+
+// QuotaBucket is a bucket wrapper which rejects uploads and copies which would make the total size of the objects
+// in the bucket exceed a quota, e.g. to limit the usage of a tenant. Rejected writes fail with an error for which
+// objstore.IsQuotaExceededErr returns true.
+//
+// The usage is computed lazily by listing the whole bucket on the first write, and then tracked by the writes and
+// deletions going through the wrapper, which are serialized per object. Deletions before the first write don't
+// list the bucket. Writes which bypass the wrapper, e.g. by other processes, are not accounted for. Uploads
+// of readers whose size can't be determined with objstore.TryToGetSize are buffered in memory. Optional
+// interfaces of the wrapped bucket are not exposed, as writes through them couldn't be accounted for.
+type QuotaBucket struct {
+	bkt      objstore.Bucket
+	maxBytes int64
+
+	// mtx is held exclusively while computing the usage, and shared by the writes and deletions accounting for it.
+	mtx         sync.RWMutex
+	initialized atomic.Bool
+	usage       atomic.Int64
+
+	locksMtx sync.Mutex
+	locks    map[string]*objectLock
+}
+
+// objectLock serializes the writes and deletions of an object.
+type objectLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewQuotaBucket returns a new QuotaBucket limiting the total size of the objects in bkt to maxBytes.
+func NewQuotaBucket(bkt objstore.Bucket, maxBytes int64) *QuotaBucket {
+	return &QuotaBucket{bkt: bkt, maxBytes: maxBytes, locks: map[string]*objectLock{}}
+}
+
+// CurrentUsage returns the total size of the objects in the bucket in bytes.
+func (b *QuotaBucket) CurrentUsage(ctx context.Context) (int64, error) {
+	if err := b.init(ctx); err != nil {
+		return 0, err
+	}
+	return b.usage.Load(), nil
+}
+
+// QuotaRemaining returns the number of bytes which can still be stored in the bucket.
+func (b *QuotaBucket) QuotaRemaining(ctx context.Context) (int64, error) {
+	usage, err := b.CurrentUsage(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if usage > b.maxBytes {
+		return 0, nil
+	}
+	return b.maxBytes - usage, nil
+}
+
+// init computes the usage of the bucket by listing it, unless it was already computed.
+func (b *QuotaBucket) init(ctx context.Context) error {
+	if b.initialized.Load() {
+		return nil
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.initialized.Load() {
+		return nil
+	}
+
+	var (
+		usage   int64
+		options = []objstore.IterOption{objstore.WithRecursiveIter, objstore.WithSize}
+	)
+	add := func(attrs objstore.IterObjectAttributes) error {
+		if size, ok := attrs.Size(); ok && !strings.HasSuffix(attrs.Name, objstore.DirDelim) {
+			usage += size
+		}
+		return nil
+	}
+	var err error
+	if objstore.ValidateIterOptions(b.bkt.SupportedIterOptions(), options...) == nil {
+		err = b.bkt.IterWithAttributes(ctx, "", add, options...)
+	} else {
+		err = objstore.IterParallel(ctx, b.bkt, "", add, usageConcurrency, false, options...)
+	}
+	if err != nil {
+		return errors.Wrap(err, "compute bucket usage")
+	}
+	b.usage.Store(usage)
+	b.initialized.Store(true)
+	return nil
+}
+
+// rlockInitialized computes the usage if needed and returns with b.mtx read-locked, so that the usage isn't
+// computed again until the caller is done accounting for its write.
+func (b *QuotaBucket) rlockInitialized(ctx context.Context) error {
+	for {
+		if err := b.init(ctx); err != nil {
+			return err
+		}
+		b.mtx.RLock()
+		if b.initialized.Load() {
+			return nil
+		}
+		// The usage was reset in the meantime.
+		b.mtx.RUnlock()
+	}
+}
+
+// lock locks the objects with the given names, in a consistent order to avoid deadlocks, and returns a function
+// unlocking them.
+func (b *QuotaBucket) lock(names ...string) func() {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	keys := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			keys = append(keys, name)
+		}
+	}
+
+	locks := make([]*objectLock, 0, len(keys))
+	b.locksMtx.Lock()
+	for _, name := range keys {
+		l, ok := b.locks[name]
+		if !ok {
+			l = &objectLock{}
+			b.locks[name] = l
+		}
+		l.refs++
+		locks = append(locks, l)
+	}
+	b.locksMtx.Unlock()
+
+	for _, l := range locks {
+		l.Lock()
+	}
+	return func() {
+		for _, l := range locks {
+			l.Unlock()
+		}
+		b.locksMtx.Lock()
+		defer b.locksMtx.Unlock()
+		for i, l := range locks {
+			if l.refs--; l.refs == 0 {
+				delete(b.locks, keys[i])
+			}
+		}
+	}
+}
+
+// reset makes the next write compute the usage again, after a write failed in a way which leaves the usage unknown.
+func (b *QuotaBucket) reset() {
+	b.initialized.Store(false)
+}
+
+// objectSize returns the size of the given object, or 0 if it doesn't exist.
+func (b *QuotaBucket) objectSize(ctx context.Context, name string) (int64, error) {
+	attrs, err := b.bkt.Attributes(ctx, name)
+	if err != nil {
+		if b.bkt.IsObjNotFoundErr(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+// reserve adds size to the usage, replacing an object of oldSize, if the quota allows it. It returns the change
+// of the usage, which has to be released if the write fails.
+func (b *QuotaBucket) reserve(op, name string, size, oldSize int64) (int64, error) {
+	delta := size - oldSize
+	if usage := b.usage.Add(delta); delta > 0 && usage > b.maxBytes {
+		b.usage.Sub(delta)
+		return 0, b.quotaExceededErr(op, name)
+	}
+	return delta, nil
+}
+
+// Upload uploads the object if the quota allows it.
+func (b *QuotaBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	unlock := b.lock(name)
+	defer unlock()
+	if err := b.rlockInitialized(ctx); err != nil {
+		return err
+	}
+	defer b.mtx.RUnlock()
+
+	oldSize, err := b.objectSize(ctx, name)
+	if err != nil {
+		return err
+	}
+	size, err := objstore.TryToGetSize(r)
+	if err != nil {
+		if size, r, err = b.buffer(name, r, oldSize); err != nil {
+			return err
+		}
+	}
+
+	delta, err := b.reserve(objstore.OpUpload, name, size, oldSize)
+	if err != nil {
+		return err
+	}
+	if err := b.bkt.Upload(ctx, name, r, opts...); err != nil {
+		b.usage.Sub(delta)
+		return err
+	}
+	return nil
+}
+
+// buffer reads the content of an upload of unknown size into memory. Only one byte more than the quota allows
+// for the object is read, so that uploads exceeding it are rejected without reading them fully.
+func (b *QuotaBucket) buffer(name string, r io.Reader, oldSize int64) (int64, io.Reader, error) {
+	limit := b.maxBytes - b.usage.Load() + oldSize
+	if limit < 0 {
+		limit = 0
+	}
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "read content of %s", name)
+	}
+	if int64(len(content)) > limit {
+		return 0, nil, b.quotaExceededErr(objstore.OpUpload, name)
+	}
+	return int64(len(content)), bytes.NewReader(content), nil
+}
+
+func (b *QuotaBucket) quotaExceededErr(op, name string) error {
+	return objstore.NewBucketError(op, name, "", objstore.ErrKindQuotaExceeded, errors.Errorf("quota of %d bytes exceeded", b.maxBytes))
+}
+
+// Copy copies the object if the quota allows it.
+func (b *QuotaBucket) Copy(ctx context.Context, src, dst string) error {
+	unlock := b.lock(src, dst)
+	defer unlock()
+	if err := b.rlockInitialized(ctx); err != nil {
+		return err
+	}
+	defer b.mtx.RUnlock()
+
+	attrs, err := b.bkt.Attributes(ctx, src)
+	if err != nil {
+		return err
+	}
+	oldSize, err := b.objectSize(ctx, dst)
+	if err != nil {
+		return err
+	}
+	delta, err := b.reserve(objstore.OpCopy, dst, attrs.Size, oldSize)
+	if err != nil {
+		return err
+	}
+	if err := b.bkt.Copy(ctx, src, dst); err != nil {
+		b.usage.Sub(delta)
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the object. Its size is only subtracted from the usage if the usage was already computed.
+func (b *QuotaBucket) Delete(ctx context.Context, name string) error {
+	unlock := b.lock(name)
+	defer unlock()
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if !b.initialized.Load() {
+		return b.bkt.Delete(ctx, name)
+	}
+	size, err := b.objectSize(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := b.bkt.Delete(ctx, name); err != nil {
+		return err
+	}
+	b.usage.Sub(size)
+	return nil
+}
+
+// DeleteMany deletes the objects. If it fails, the usage is computed again before the next write, as some of
+// the objects might have been deleted.
+func (b *QuotaBucket) DeleteMany(ctx context.Context, names []string) error {
+	unlock := b.lock(names...)
+	defer unlock()
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if !b.initialized.Load() {
+		return b.bkt.DeleteMany(ctx, names)
+	}
+	var size int64
+	for _, name := range names {
+		s, err := b.objectSize(ctx, name)
+		if err != nil {
+			return err
+		}
+		size += s
+	}
+	if err := b.bkt.DeleteMany(ctx, names); err != nil {
+		b.reset()
+		return err
+	}
+	b.usage.Sub(size)
+	return nil
+}
+
+func (b *QuotaBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *QuotaBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *QuotaBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *QuotaBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.bkt.Get(ctx, name)
+}
+
+func (b *QuotaBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *QuotaBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *QuotaBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *QuotaBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *QuotaBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *QuotaBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *QuotaBucket) Name() string {
+	return b.bkt.Name()
+}
@@ -0,0 +1,116 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package quota
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/objstore"
+)
+
+func TestQuotaBucket_Acceptance(t *testing.T) {
+	objstore.AcceptanceTest(t, NewQuotaBucket(objstore.NewInMemBucket(), 1<<30))
+}
+
+func TestQuotaBucket(t *testing.T) {
+	ctx := context.Background()
+	inner := objstore.NewInMemBucket()
+	testutil.Ok(t, inner.Upload(ctx, "dir/existing", strings.NewReader("0123456789")))
+	bkt := NewQuotaBucket(inner, 20)
+
+	usage, err := bkt.CurrentUsage(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), usage)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaaa")))
+	err = bkt.Upload(ctx, "b", strings.NewReader("bbbbbb"))
+	testutil.Assert(t, objstore.IsQuotaExceededErr(err), "expected quota exceeded error, got %v", err)
+	err = bkt.Copy(ctx, "dir/existing", "copy")
+	testutil.Assert(t, objstore.IsQuotaExceededErr(err), "expected quota exceeded error, got %v", err)
+
+	// Overwriting an object only accounts for the difference in size.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("aaaaaaaaaa")))
+	remaining, err := bkt.QuotaRemaining(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), remaining)
+
+	testutil.Ok(t, bkt.Delete(ctx, "a"))
+	remaining, err = bkt.QuotaRemaining(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), remaining)
+
+	// Uploads of unknown size are buffered up to the remaining quota.
+	err = bkt.Upload(ctx, "b", io.MultiReader(strings.NewReader(strings.Repeat("b", 11))))
+	testutil.Assert(t, objstore.IsQuotaExceededErr(err), "expected quota exceeded error, got %v", err)
+	testutil.Ok(t, bkt.Upload(ctx, "b", io.MultiReader(strings.NewReader(strings.Repeat("b", 10)))))
+	attrs, err := inner.Attributes(ctx, "b")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), attrs.Size)
+
+	testutil.Ok(t, bkt.DeleteMany(ctx, []string{"b", "dir/existing"}))
+	usage, err = bkt.CurrentUsage(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), usage)
+}
+
+type iterCountingBucket struct {
+	objstore.Bucket
+	iters atomic.Int64
+}
+
+func (b *iterCountingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	b.iters.Inc()
+	return b.Bucket.Iter(ctx, dir, f, options...)
+}
+
+func (b *iterCountingBucket) IterWithAttributes(ctx context.Context, dir string, f func(objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	b.iters.Inc()
+	return b.Bucket.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func TestQuotaBucket_UsageComputedLazily(t *testing.T) {
+	ctx := context.Background()
+	inner := &iterCountingBucket{Bucket: objstore.NewInMemBucket()}
+	testutil.Ok(t, inner.Upload(ctx, "a", strings.NewReader("aaaaa")))
+	testutil.Ok(t, inner.Upload(ctx, "b", strings.NewReader("bbbbb")))
+	bkt := NewQuotaBucket(inner, 10)
+
+	testutil.Ok(t, bkt.Delete(ctx, "a"))
+	testutil.Equals(t, int64(0), inner.iters.Load())
+
+	testutil.Ok(t, bkt.Upload(ctx, "c", strings.NewReader("ccccc")))
+	testutil.Equals(t, int64(1), inner.iters.Load())
+	usage, err := bkt.CurrentUsage(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), usage)
+}
+
+func TestQuotaBucket_ConcurrentOverwrites(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewQuotaBucket(objstore.NewInMemBucket(), 10)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = bkt.Upload(ctx, "a", strings.NewReader("aaaaaaaaaa"))
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		testutil.Ok(t, err)
+	}
+	usage, err := bkt.CurrentUsage(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), usage)
+}
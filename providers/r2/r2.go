@@ -0,0 +1,139 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package r2 implements the objstore.Bucket interface against Cloudflare R2 through its S3-compatible API.
+// Requests are sent by the S3 provider of this module with virtual-hosted-style addressing, i.e. without forcing
+// path-style requests, so that R2 shares its client, error handling and instrumentation instead of adding a
+// second S3 SDK.
+package r2
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/exthttp"
+	"github.com/thanos-io/objstore/providers/s3"
+)
+
+// region is the region R2 expects in the signatures of requests, as buckets are not bound to a region.
+const region = "auto"
+
+// noSuchKeyCode is the numeric error code R2 uses in its error envelope for missing objects, which some
+// responses of its S3-compatible API return instead of NoSuchKey.
+const noSuchKeyCode = "10007"
+
+// DefaultConfig is the default config for an R2 client.
+var DefaultConfig = Config{
+	HTTPConfig: s3.DefaultConfig.HTTPConfig,
+}
+
+// Config stores the configuration for an R2 bucket.
+type Config struct {
+	// AccountID is the ID of the Cloudflare account, which determines the endpoint of the S3-compatible API.
+	AccountID string `yaml:"account_id"`
+	// AccessKeyID and AccessKeySecret are the S3 credentials of an R2 API token.
+	AccessKeyID     string             `yaml:"access_key_id"`
+	AccessKeySecret string             `yaml:"access_key_secret"`
+	Bucket          string             `yaml:"bucket"`
+	HTTPConfig      exthttp.HTTPConfig `yaml:"http_config"`
+}
+
+func (conf Config) validate() error {
+	if conf.Bucket == "" {
+		return errors.New("no r2 bucket in config file")
+	}
+	if conf.AccountID == "" {
+		return errors.New("no r2 account_id in config file")
+	}
+	if conf.AccessKeyID == "" || conf.AccessKeySecret == "" {
+		return errors.New("access_key_id and access_key_secret must be set in config file")
+	}
+	return nil
+}
+
+// endpoint returns the S3-compatible endpoint of the account.
+func (conf Config) endpoint() string {
+	return conf.AccountID + ".r2.cloudflarestorage.com"
+}
+
+// s3Config returns the config of the S3 client for the S3-compatible API of R2. Buckets are addressed as
+// virtual hosts of the endpoint of the account.
+func (conf Config) s3Config() s3.Config {
+	c := s3.DefaultConfig
+	c.Bucket = conf.Bucket
+	c.Endpoint = conf.endpoint()
+	c.Region = region
+	c.AccessKey = conf.AccessKeyID
+	c.SecretKey = conf.AccessKeySecret
+	c.HTTPConfig = conf.HTTPConfig
+	c.BucketLookupType = s3.VirtualHostLookup
+	return c
+}
+
+// supportedIterOptions are the options R2 supports with its listing, which includes the ETags, sizes and
+// modification times of the objects. R2 has no storage classes in its listing and doesn't return user metadata
+// with it, so the corresponding options are not supported.
+var supportedIterOptions = []objstore.IterOptionType{objstore.Recursive, objstore.UpdatedAt, objstore.ETag, objstore.Size}
+
+// Bucket implements the objstore.Bucket interface against Cloudflare R2, see s3.CompatibleBucket.
+type Bucket = s3.CompatibleBucket
+
+// NewBucket returns a new Bucket using the provided R2 config.
+func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error) {
+	config := DefaultConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return nil, err
+	}
+	return NewBucketWithConfig(logger, config, component)
+}
+
+// NewBucketWithConfig returns a new Bucket using the provided R2 config values.
+func NewBucketWithConfig(logger log.Logger, config Config, component string) (*Bucket, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	bkt, err := s3.NewBucketWithConfig(logger, config.s3Config(), component)
+	if err != nil {
+		return nil, errors.Wrap(err, "create s3 client for r2")
+	}
+	return s3.NewCompatibleBucket(bkt, noSuchKeyCode, supportedIterOptions...), nil
+}
+
+func configFromEnv() Config {
+	c := DefaultConfig
+	c.AccountID = os.Getenv("R2_ACCOUNT_ID")
+	c.AccessKeyID = os.Getenv("R2_ACCESS_KEY_ID")
+	c.AccessKeySecret = os.Getenv("R2_ACCESS_KEY_SECRET")
+	c.Bucket = os.Getenv("R2_BUCKET")
+	return c
+}
+
+// NewTestBucket creates test bkt client that before returning creates temporary bucket.
+// In a close function it empties and deletes the bucket.
+func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
+	c := configFromEnv()
+	if c.AccountID == "" || c.AccessKeyID == "" || c.AccessKeySecret == "" {
+		return nil, nil, errors.New("insufficient r2 test configuration information, R2_ACCOUNT_ID, R2_ACCESS_KEY_ID and R2_ACCESS_KEY_SECRET have to be set")
+	}
+	if c.Bucket != "" && os.Getenv("THANOS_ALLOW_EXISTING_BUCKET_USE") == "" {
+		return nil, nil, errors.New("R2_BUCKET is defined. Normally this tests will create temporary bucket " +
+			"and delete it after test. Unset R2_BUCKET env variable to use default logic. If you really want to run " +
+			"tests against provided (NOT USED!) bucket, set THANOS_ALLOW_EXISTING_BUCKET_USE=true. WARNING: That bucket " +
+			"needs to be manually cleared. This means that it is only useful to run one test in a time.")
+	}
+
+	reuseBucket := c.Bucket != ""
+	if c.Bucket == "" {
+		c.Bucket = objstore.CreateTemporaryTestBucketName(t)
+	}
+	bkt, closeFn, err := s3.NewTestBucketFromConfig(t, region, c.s3Config(), reuseBucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s3.NewCompatibleBucket(bkt.(*s3.Bucket), noSuchKeyCode, supportedIterOptions...), closeFn, nil
+}
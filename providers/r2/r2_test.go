@@ -0,0 +1,68 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package r2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/s3"
+)
+
+func TestParseConfig(t *testing.T) {
+	bkt, err := NewBucket(log.NewNopLogger(), []byte(`account_id: "account"
+access_key_id: "key-id"
+access_key_secret: "secret"
+bucket: "test-bucket"`), "test")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "test-bucket", bkt.Name())
+
+	cfg := Config{AccountID: "account", AccessKeyID: "key-id", AccessKeySecret: "secret", Bucket: "test-bucket"}.s3Config()
+	testutil.Equals(t, "account.r2.cloudflarestorage.com", cfg.Endpoint)
+	testutil.Equals(t, "auto", cfg.Region)
+	testutil.Equals(t, "key-id", cfg.AccessKey)
+	testutil.Equals(t, "secret", cfg.SecretKey)
+	testutil.Equals(t, s3.VirtualHostLookup, cfg.BucketLookupType)
+	testutil.Assert(t, !cfg.Insecure)
+
+	_, err = NewBucket(log.NewNopLogger(), []byte(`access_key_id: "key-id"
+access_key_secret: "secret"
+bucket: "test-bucket"`), "test")
+	testutil.NotOk(t, err)
+	_, err = NewBucket(log.NewNopLogger(), []byte(`account_id: "account"
+bucket: "test-bucket"`), "test")
+	testutil.NotOk(t, err)
+}
+
+func TestBucket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>` + noSuchKeyCode + `</Code><Message>The specified key does not exist.</Message></Error>`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := Config{AccountID: "account", AccessKeyID: "key-id", AccessKeySecret: "secret", Bucket: "test-bucket"}.s3Config()
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.BucketLookupType = s3.PathLookup
+	s3Bkt, err := s3.NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+	bkt := s3.NewCompatibleBucket(s3Bkt, noSuchKeyCode, supportedIterOptions...)
+
+	ctx := context.Background()
+	_, err = bkt.Get(ctx, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+
+	err = bkt.Iter(ctx, "", func(string) error { return nil }, objstore.WithStorageClassIter)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, !objstore.SupportsTagger(bkt))
+	testutil.Assert(t, !objstore.SupportsTagger(objstore.WrapWithMetrics(bkt, nil, "test")))
+}
@@ -0,0 +1,104 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package readonly implements a bucket wrapper which rejects all operations modifying the bucket.
+package readonly
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+// ErrReadOnly is wrapped by the errors returned for operations which would modify a ReadOnlyBucket.
+var ErrReadOnly = errors.New("bucket is read-only")
+
+// IsReadOnlyErr returns true if the error was returned because an operation would have modified a ReadOnlyBucket.
+func IsReadOnlyErr(err error) bool {
+	return errors.Is(err, ErrReadOnly)
+}
+
+// ReadOnlyBucket is a bucket wrapper which delegates reads to the wrapped bucket and rejects all writes, e.g. to
+// pass a bucket to components which are only supposed to read from it. Writes fail with an error wrapping
+// ErrReadOnly, for which objstore.IsPermissionDeniedErr returns true as well. Optional interfaces of the wrapped
+// bucket, e.g. objstore.ConditionalUploader, are not exposed, so the helpers of the objstore package report them
+// as not supported.
+type ReadOnlyBucket struct {
+	bkt objstore.Bucket
+}
+
+// NewReadOnlyBucket returns a new ReadOnlyBucket reading from bkt.
+func NewReadOnlyBucket(bkt objstore.Bucket) *ReadOnlyBucket {
+	return &ReadOnlyBucket{bkt: bkt}
+}
+
+func errReadOnly(op, name string) error {
+	return objstore.NewBucketError(op, name, "", objstore.ErrKindPermissionDenied, ErrReadOnly)
+}
+
+func (b *ReadOnlyBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *ReadOnlyBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *ReadOnlyBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *ReadOnlyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.bkt.Get(ctx, name)
+}
+
+func (b *ReadOnlyBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *ReadOnlyBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *ReadOnlyBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, name)
+}
+
+// Upload fails with an error wrapping ErrReadOnly, without reading from r.
+func (b *ReadOnlyBucket) Upload(_ context.Context, name string, _ io.Reader, _ ...objstore.ObjectUploadOption) error {
+	return errReadOnly(objstore.OpUpload, name)
+}
+
+// Delete fails with an error wrapping ErrReadOnly.
+func (b *ReadOnlyBucket) Delete(_ context.Context, name string) error {
+	return errReadOnly(objstore.OpDelete, name)
+}
+
+// DeleteMany fails with an error wrapping ErrReadOnly.
+func (b *ReadOnlyBucket) DeleteMany(context.Context, []string) error {
+	return errReadOnly(objstore.OpDelete, "")
+}
+
+// Copy fails with an error wrapping ErrReadOnly.
+func (b *ReadOnlyBucket) Copy(_ context.Context, _, dst string) error {
+	return errReadOnly(objstore.OpCopy, dst)
+}
+
+func (b *ReadOnlyBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *ReadOnlyBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *ReadOnlyBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *ReadOnlyBucket) Name() string {
+	return b.bkt.Name()
+}
@@ -0,0 +1,59 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package readonly
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+
+	"github.com/thanos-io/objstore"
+)
+
+func TestReadOnlyBucket(t *testing.T) {
+	ctx := context.Background()
+	inner := objstore.NewInMemBucket()
+	testutil.Ok(t, inner.Upload(ctx, "dir/obj", strings.NewReader("content")))
+	bkt := NewReadOnlyBucket(inner)
+
+	rc, err := bkt.Get(ctx, "dir/obj")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	ok, err := bkt.Exists(ctx, "dir/obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+
+	var seen []string
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, objstore.WithRecursiveIter))
+	testutil.Equals(t, []string{"dir/obj"}, seen)
+
+	_, err = bkt.Get(ctx, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+
+	for _, err := range []error{
+		bkt.Upload(ctx, "new", strings.NewReader("content")),
+		bkt.Delete(ctx, "dir/obj"),
+		bkt.DeleteMany(ctx, []string{"dir/obj"}),
+		bkt.Copy(ctx, "dir/obj", "copy"),
+	} {
+		testutil.Assert(t, IsReadOnlyErr(err), "expected read-only error, got %v", err)
+		testutil.Assert(t, objstore.IsPermissionDeniedErr(err), "expected permission denied error, got %v", err)
+	}
+	// Optional interfaces of the wrapped bucket are not exposed.
+	testutil.Equals(t, objstore.ErrRenameNotSupported, objstore.Rename(ctx, bkt, "dir/obj", "renamed"))
+	_, err = objstore.UploadIfNotExists(ctx, bkt, "new", strings.NewReader("content"))
+	testutil.Equals(t, objstore.ErrConditionalUploadNotSupported, err)
+
+	testutil.Equals(t, map[string][]byte{"dir/obj": []byte("content")}, inner.Objects())
+}
@@ -0,0 +1,308 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package recording implements a bucket wrapper which writes an audit trail of all operations.
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+type callerIdentityKey struct{}
+
+// WithCallerIdentity returns a context which makes a RecordingBucket record the operations called with it as
+// done by the caller with the given identity, e.g. the name of a user or a service.
+func WithCallerIdentity(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, callerIdentityKey{}, id)
+}
+
+// CallerIdentity returns the identity set with WithCallerIdentity, or an empty string if there is none.
+func CallerIdentity(ctx context.Context) string {
+	id, _ := ctx.Value(callerIdentityKey{}).(string)
+	return id
+}
+
+// AuditRecord describes a single operation against a RecordingBucket.
+type AuditRecord struct {
+	// Timestamp is the time the operation was started.
+	Timestamp time.Time `json:"timestamp"`
+	// Operation is the operation, e.g. objstore.OpGet.
+	Operation string `json:"operation"`
+	// Name is the name of the object, or the listed directory for a failed listing.
+	Name string `json:"name"`
+	// DstName is the name of the destination object of a copy.
+	DstName string `json:"dst_name,omitempty"`
+	Success bool   `json:"success"`
+	// Duration is the duration of the operation. For Get and GetRange it includes reading the returned reader
+	// until it is closed.
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// CallerIdentity is the identity set with WithCallerIdentity on the context of the operation.
+	CallerIdentity string `json:"caller_identity,omitempty"`
+	// UploadSize is the size of the reader passed to Upload, or the number of bytes read from it if its size
+	// can't be determined upfront.
+	UploadSize *int64 `json:"upload_size,omitempty"`
+	// DownloadSize is the number of bytes read from the reader returned by Get or GetRange.
+	DownloadSize *int64 `json:"download_size,omitempty"`
+}
+
+// RecordingBucket is a bucket wrapper which writes an AuditRecord for each operation to a writer, one JSON
+// object per line. Records of Get and GetRange are written once the returned reader is closed. Listings write
+// a record for each object passed to the callback, and one for the listing itself only if it fails. DeleteMany
+// writes a record for each object. Optional interfaces of the wrapped bucket are not exposed, as calls through
+// them couldn't be recorded.
+type RecordingBucket struct {
+	bkt    objstore.Bucket
+	logger log.Logger
+	now    func() time.Time
+
+	mtx sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecordingBucket returns a new RecordingBucket wrapping bkt, which writes the records to w. Writing the
+// records doesn't fail the operations; errors are logged with logger instead.
+func NewRecordingBucket(bkt objstore.Bucket, w io.Writer, logger log.Logger) *RecordingBucket {
+	return &RecordingBucket{bkt: bkt, logger: logger, now: time.Now, enc: json.NewEncoder(w)}
+}
+
+// record writes the record of the operation with the given name which was started at start.
+func (b *RecordingBucket) record(ctx context.Context, op, name string, start time.Time, err error, modify func(*AuditRecord)) {
+	r := AuditRecord{
+		Timestamp:      start,
+		Operation:      op,
+		Name:           name,
+		Success:        err == nil,
+		Duration:       b.now().Sub(start),
+		CallerIdentity: CallerIdentity(ctx),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if modify != nil {
+		modify(&r)
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if err := b.enc.Encode(r); err != nil {
+		level.Warn(b.logger).Log("msg", "failed to write audit record", "op", op, "name", name, "err", err)
+	}
+}
+
+func (b *RecordingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	start := b.now()
+	err := b.bkt.Iter(ctx, dir, func(name string) error {
+		b.record(ctx, objstore.OpIter, name, start, nil, nil)
+		return f(name)
+	}, options...)
+	if err != nil {
+		b.record(ctx, objstore.OpIter, dir, start, err, nil)
+	}
+	return err
+}
+
+func (b *RecordingBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	start := b.now()
+	err := b.bkt.IterWithAttributes(ctx, dir, func(attrs objstore.IterObjectAttributes) error {
+		b.record(ctx, objstore.OpIter, attrs.Name, start, nil, nil)
+		return f(attrs)
+	}, options...)
+	if err != nil {
+		b.record(ctx, objstore.OpIter, dir, start, err, nil)
+	}
+	return err
+}
+
+func (b *RecordingBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *RecordingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	start := b.now()
+	rc, err := b.bkt.Get(ctx, name)
+	return b.recordingReader(ctx, objstore.OpGet, name, start, rc, err)
+}
+
+func (b *RecordingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	start := b.now()
+	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	return b.recordingReader(ctx, objstore.OpGetRange, name, start, rc, err)
+}
+
+// recordingReader records a failed open right away, and wraps the reader of a successful one so that it is
+// recorded once it is closed.
+func (b *RecordingBucket) recordingReader(ctx context.Context, op, name string, start time.Time, rc io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err != nil {
+		b.record(ctx, op, name, start, err, nil)
+		return nil, err
+	}
+	return &recordingReadCloser{ReadCloser: rc, bkt: b, ctx: ctx, op: op, name: name, start: start}, nil
+}
+
+func (b *RecordingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	start := b.now()
+	ok, err := b.bkt.Exists(ctx, name)
+	b.record(ctx, objstore.OpExists, name, start, err, nil)
+	return ok, err
+}
+
+func (b *RecordingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	start := b.now()
+	attrs, err := b.bkt.Attributes(ctx, name)
+	b.record(ctx, objstore.OpAttributes, name, start, err, nil)
+	return attrs, err
+}
+
+func (b *RecordingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	start := b.now()
+	// Readers of a known size are passed on as they are, so that the wrapped bucket can still use their
+	// size, e.g. to upload large files in parallel parts.
+	size, sizeErr := objstore.TryToGetSize(r)
+	var cr *countingReader
+	if sizeErr != nil {
+		cr = &countingReader{r: r}
+		r = cr
+		if s, ok := cr.r.(io.Seeker); ok {
+			// Keep the reader seekable, so that the upload can still be retried.
+			r = &countingReadSeeker{countingReader: cr, Seeker: s}
+		}
+	}
+	err := b.bkt.Upload(ctx, name, r, opts...)
+	b.record(ctx, objstore.OpUpload, name, start, err, func(r *AuditRecord) {
+		if cr != nil {
+			size = cr.n
+		}
+		r.UploadSize = &size
+	})
+	return err
+}
+
+func (b *RecordingBucket) Delete(ctx context.Context, name string) error {
+	start := b.now()
+	err := b.bkt.Delete(ctx, name)
+	b.record(ctx, objstore.OpDelete, name, start, err, nil)
+	return err
+}
+
+func (b *RecordingBucket) DeleteMany(ctx context.Context, names []string) error {
+	start := b.now()
+	err := b.bkt.DeleteMany(ctx, names)
+	var res *objstore.BatchDeleteResult
+	isBatchErr := errors.As(err, &res)
+	for _, name := range names {
+		objErr := err
+		if isBatchErr {
+			objErr = res.Errors[name]
+		}
+		b.record(ctx, objstore.OpDelete, name, start, objErr, nil)
+	}
+	return err
+}
+
+func (b *RecordingBucket) Copy(ctx context.Context, src, dst string) error {
+	start := b.now()
+	err := b.bkt.Copy(ctx, src, dst)
+	b.record(ctx, objstore.OpCopy, src, start, err, func(r *AuditRecord) {
+		r.DstName = dst
+	})
+	return err
+}
+
+func (b *RecordingBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *RecordingBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *RecordingBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RecordingBucket) Name() string {
+	return b.bkt.Name()
+}
+
+// recordingReadCloser counts the bytes read and writes the record of the read once it is closed. Read errors
+// other than io.EOF are recorded as failures.
+type recordingReadCloser struct {
+	io.ReadCloser
+
+	bkt   *RecordingBucket
+	ctx   context.Context
+	op    string
+	name  string
+	start time.Time
+
+	read    int64
+	readErr error
+	closed  bool
+}
+
+func (r *recordingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if err != nil && err != io.EOF && r.readErr == nil {
+		r.readErr = err
+	}
+	return n, err
+}
+
+func (r *recordingReadCloser) ObjectSize() (int64, error) {
+	return objstore.TryToGetSize(r.ReadCloser)
+}
+
+func (r *recordingReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	if r.closed {
+		return err
+	}
+	r.closed = true
+
+	recordErr := r.readErr
+	if recordErr == nil {
+		recordErr = err
+	}
+	r.bkt.record(r.ctx, r.op, r.name, r.start, recordErr, func(rec *AuditRecord) {
+		rec.DownloadSize = &r.read
+	})
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingReadSeeker struct {
+	*countingReader
+	io.Seeker
+}
+
+// Seek resets the count when seeking back to the start, as done before retrying an upload, so that only
+// the bytes of the last attempt are counted.
+func (r *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.Seeker.Seek(offset, whence)
+	if err == nil && pos == 0 {
+		r.n = 0
+	}
+	return pos, err
+}
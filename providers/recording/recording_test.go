@@ -0,0 +1,175 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+func TestRecordingBucket_Acceptance(t *testing.T) {
+	objstore.AcceptanceTest(t, NewRecordingBucket(objstore.NewInMemBucket(), io.Discard, log.NewNopLogger()))
+}
+
+// readRecords decodes the records written to buf and resets it.
+func readRecords(t *testing.T, buf *bytes.Buffer) []AuditRecord {
+	t.Helper()
+
+	var records []AuditRecord
+	s := bufio.NewScanner(buf)
+	for s.Scan() {
+		var r AuditRecord
+		testutil.Ok(t, json.Unmarshal(s.Bytes(), &r))
+		records = append(records, r)
+	}
+	testutil.Ok(t, s.Err())
+	buf.Reset()
+	return records
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+// failingDeleteBucket fails to delete the object with the given name.
+type failingDeleteBucket struct {
+	objstore.Bucket
+
+	name string
+}
+
+func (b failingDeleteBucket) Delete(ctx context.Context, name string) error {
+	if name == b.name {
+		return errors.New("some error")
+	}
+	return b.Bucket.Delete(ctx, name)
+}
+
+func (b failingDeleteBucket) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, b, names)
+}
+
+// retryingUploadBucket reads the uploaded content once, then seeks back to the start and uploads it.
+type retryingUploadBucket struct {
+	objstore.Bucket
+}
+
+func (b retryingUploadBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	if _, err := r.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, r, opts...)
+}
+
+// readSeeker hides the size of the wrapped reader.
+type readSeeker struct {
+	io.ReadSeeker
+}
+
+func TestRecordingBucket_RetriedUpload(t *testing.T) {
+	var buf bytes.Buffer
+	bkt := NewRecordingBucket(retryingUploadBucket{Bucket: objstore.NewInMemBucket()}, &buf, log.NewNopLogger())
+
+	testutil.Ok(t, bkt.Upload(context.Background(), "a", readSeeker{strings.NewReader("content")}))
+	records := readRecords(t, &buf)
+	testutil.Equals(t, 1, len(records))
+	testutil.Equals(t, int64Ptr(7), records[0].UploadSize)
+}
+
+func TestRecordingBucket(t *testing.T) {
+	var buf bytes.Buffer
+	bkt := NewRecordingBucket(failingDeleteBucket{Bucket: objstore.NewInMemBucket(), name: "failing"}, &buf, log.NewNopLogger())
+	// Every call of the clock advances it by a second.
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bkt.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	ctx := WithCallerIdentity(context.Background(), "compactor")
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", strings.NewReader("content")))
+	// Readers of unknown size are counted.
+	testutil.Ok(t, bkt.Upload(context.Background(), "dir/b", io.MultiReader(strings.NewReader("abc"))))
+	testutil.Equals(t, []AuditRecord{
+		{
+			Timestamp:      time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC),
+			Operation:      objstore.OpUpload,
+			Name:           "dir/a",
+			Success:        true,
+			Duration:       time.Second,
+			CallerIdentity: "compactor",
+			UploadSize:     int64Ptr(7),
+		},
+		{
+			Timestamp:  time.Date(2024, 1, 1, 0, 0, 3, 0, time.UTC),
+			Operation:  objstore.OpUpload,
+			Name:       "dir/b",
+			Success:    true,
+			Duration:   time.Second,
+			UploadSize: int64Ptr(3),
+		},
+	}, readRecords(t, &buf))
+
+	// Reads are recorded once the reader is closed.
+	rc, err := bkt.GetRange(ctx, "dir/a", 1, 3)
+	testutil.Ok(t, err)
+	_, err = io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, buf.Len())
+	testutil.Ok(t, rc.Close())
+
+	_, err = bkt.Get(ctx, "missing")
+	testutil.NotOk(t, err)
+	records := readRecords(t, &buf)
+	testutil.Equals(t, 2, len(records))
+	testutil.Equals(t, AuditRecord{
+		Timestamp:      time.Date(2024, 1, 1, 0, 0, 5, 0, time.UTC),
+		Operation:      objstore.OpGetRange,
+		Name:           "dir/a",
+		Success:        true,
+		Duration:       time.Second,
+		CallerIdentity: "compactor",
+		DownloadSize:   int64Ptr(3),
+	}, records[0])
+	testutil.Equals(t, objstore.OpGet, records[1].Operation)
+	testutil.Assert(t, !records[1].Success, "expected failed get")
+	testutil.Equals(t, err.Error(), records[1].Error)
+	testutil.Assert(t, records[1].DownloadSize == nil, "expected no download size for failed get")
+
+	// Listings record each object.
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "dir/", func(objstore.IterObjectAttributes) error { return nil }))
+	records = readRecords(t, &buf)
+	testutil.Equals(t, 2, len(records))
+	for i, name := range []string{"dir/a", "dir/b"} {
+		testutil.Equals(t, objstore.OpIter, records[i].Operation)
+		testutil.Equals(t, name, records[i].Name)
+		testutil.Equals(t, "compactor", records[i].CallerIdentity)
+	}
+
+	testutil.Ok(t, bkt.Copy(ctx, "dir/a", "dir/c"))
+	err = bkt.DeleteMany(ctx, []string{"dir/a", "failing"})
+	testutil.NotOk(t, err)
+	records = readRecords(t, &buf)
+	testutil.Equals(t, 3, len(records))
+	testutil.Equals(t, objstore.OpCopy, records[0].Operation)
+	testutil.Equals(t, "dir/a", records[0].Name)
+	testutil.Equals(t, "dir/c", records[0].DstName)
+	testutil.Equals(t, objstore.OpDelete, records[1].Operation)
+	testutil.Assert(t, records[1].Success, "expected successful delete of dir/a")
+	testutil.Equals(t, "failing", records[2].Name)
+	testutil.Assert(t, !records[2].Success, "expected failed delete of failing object")
+}
@@ -0,0 +1,72 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package retry implements a bucket wrapper which retries failed operations with exponential backoff.
+package retry
+
+import (
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+
+	"github.com/thanos-io/objstore"
+)
+
+// Config configures the retry policy of a RetryBucket, see objstore.RetryConfig.
+type Config = objstore.RetryConfig
+
+// RetryBucket is a bucket wrapper which retries operations failing with a transient error, see objstore.RetryBucket.
+type RetryBucket = objstore.RetryBucket
+
+// DefaultConfig is the default retry policy.
+var DefaultConfig = objstore.DefaultRetryConfig
+
+// NewRetryBucket returns a new RetryBucket wrapping bkt with the given retry policy, like objstore.WrapWithRetry.
+// Unlike the latter, it defaults Config.IsTransientErr to IsTransientErr of this package, which recognizes the
+// errors of the provider SDKs as well.
+func NewRetryBucket(bkt objstore.Bucket, cfg Config, reg prometheus.Registerer) (*RetryBucket, error) {
+	if cfg.IsTransientErr == nil {
+		cfg.IsTransientErr = IsTransientErr
+	}
+	return objstore.WrapWithRetry(bkt, cfg, reg)
+}
+
+// IsTransientErr returns true for errors which are likely to go away when the operation is retried:
+// errors for which objstore.IsTransientErr returns true, and HTTP 429 and 5xx responses of the supported
+// providers which weren't wrapped in an objstore.BucketError.
+func IsTransientErr(err error) bool {
+	if objstore.IsTransientErr(err) {
+		return true
+	}
+
+	var (
+		minioErr  minio.ErrorResponse
+		googleErr *googleapi.Error
+		azureErr  *azcore.ResponseError
+	)
+	switch {
+	case errors.As(err, &minioErr):
+		return isTransientStatusCode(minioErr.StatusCode)
+	case errors.As(err, &googleErr):
+		return isTransientStatusCode(googleErr.Code)
+	case errors.As(err, &azureErr):
+		return isTransientStatusCode(azureErr.StatusCode)
+	}
+	return false
+}
+
+func isTransientStatusCode(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+func TestNewRetryBucket_DefaultsToProviderErrors(t *testing.T) {
+	inner := &failingBucket{Bucket: objstore.NewInMemBucket(), err: minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable}}
+	cfg := DefaultConfig
+	cfg.InitialDelay, cfg.MaxDelay, cfg.MaxAttempts = 0, 0, 3
+	bkt, err := NewRetryBucket(inner, cfg, nil)
+	testutil.Ok(t, err)
+
+	_, err = bkt.Get(context.Background(), "obj")
+	testutil.Equals(t, inner.err, err)
+	testutil.Equals(t, 3, inner.calls)
+}
+
+// failingBucket fails every Get with err.
+type failingBucket struct {
+	objstore.Bucket
+
+	err   error
+	calls int
+}
+
+func (b *failingBucket) Get(context.Context, string) (io.ReadCloser, error) {
+	b.calls++
+	return nil, b.err
+}
+
+func TestIsTransientErr(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: errors.New("some error"), expected: false},
+		{err: context.Canceled, expected: false},
+		{err: errors.Wrap(io.ErrUnexpectedEOF, "read"), expected: true},
+		{err: minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable}, expected: true},
+		{err: errors.Wrap(minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, "get"), expected: true},
+		{err: minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}, expected: false},
+		{err: objstore.NewBucketError(objstore.OpGet, "obj", "rateLimitExceeded", objstore.ErrKindRateLimit, errors.New("rate limit exceeded")), expected: true},
+		{err: objstore.NewBucketError(objstore.OpGet, "obj", "403", objstore.ErrKindPermissionDenied, errors.New("forbidden")), expected: false},
+	} {
+		testutil.Equals(t, tc.expected, IsTransientErr(tc.err), "error: %v", tc.err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package s3
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+// CompatibleBucket implements the objstore.Bucket interface against a provider which implements a subset of
+// the S3 API, e.g. Cloudflare R2 or Backblaze B2. Requests are sent by a Bucket of this package. Optional
+// interfaces relying on S3 features which such providers commonly don't implement, e.g. object tagging,
+// versioning and conditional uploads, are not exposed, and object ACLs are rejected.
+type CompatibleBucket struct {
+	bkt *Bucket
+
+	notFoundCode string
+	iterOptions  []objstore.IterOptionType
+}
+
+// NewCompatibleBucket returns a new CompatibleBucket sending requests with bkt. Besides the S3 error codes,
+// errors with notFoundCode are treated as not found, for providers returning their own code for missing objects
+// in some responses. iterOptions are the listing options the provider supports.
+func NewCompatibleBucket(bkt *Bucket, notFoundCode string, iterOptions ...objstore.IterOptionType) *CompatibleBucket {
+	return &CompatibleBucket{bkt: bkt, notFoundCode: notFoundCode, iterOptions: iterOptions}
+}
+
+// Name returns the bucket name.
+func (b *CompatibleBucket) Name() string {
+	return b.bkt.Name()
+}
+
+func (b *CompatibleBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *CompatibleBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+// SupportedIterOptions returns the listing options the provider supports.
+func (b *CompatibleBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return b.iterOptions
+}
+
+func (b *CompatibleBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.bkt.Get(ctx, name)
+}
+
+func (b *CompatibleBucket) GetWithOptions(ctx context.Context, name string, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	return b.bkt.GetWithOptions(ctx, name, opts...)
+}
+
+func (b *CompatibleBucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, objstore.ObjectAttributes, error) {
+	return b.bkt.GetWithAttributes(ctx, name)
+}
+
+func (b *CompatibleBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *CompatibleBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *CompatibleBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, name)
+}
+
+// Upload uploads the object. Object ACLs are not supported, public access is only configured for whole buckets.
+func (b *CompatibleBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) error {
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *CompatibleBucket) NewMultipartUpload(ctx context.Context, name string, opts ...objstore.ObjectUploadOption) (objstore.MultipartWriter, error) {
+	if objstore.ApplyObjectUploadOptions(opts...).PublicRead {
+		return nil, objstore.ErrOptionNotSupported
+	}
+	return b.bkt.NewMultipartUpload(ctx, name, opts...)
+}
+
+func (b *CompatibleBucket) Delete(ctx context.Context, name string) error {
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *CompatibleBucket) DeleteMany(ctx context.Context, names []string) error {
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *CompatibleBucket) Copy(ctx context.Context, src, dst string) error {
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+// SupportedCopy returns true as objects are copied server-side.
+func (b *CompatibleBucket) SupportedCopy() bool {
+	return true
+}
+
+func (b *CompatibleBucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return b.bkt.PresignedGetURL(ctx, name, expiry)
+}
+
+func (b *CompatibleBucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return b.bkt.PresignPut(ctx, name, expiry)
+}
+
+// IsObjNotFoundErr returns true if error means that object is not found. Besides the S3 error codes, the
+// not found code of the provider is recognized.
+func (b *CompatibleBucket) IsObjNotFoundErr(err error) bool {
+	if b.bkt.IsObjNotFoundErr(err) {
+		return true
+	}
+	return b.notFoundCode != "" && minio.ToErrorResponse(errors.Cause(err)).Code == b.notFoundCode
+}
+
+func (b *CompatibleBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *CompatibleBucket) Ping(ctx context.Context) error {
+	return b.bkt.Ping(ctx)
+}
+
+func (b *CompatibleBucket) Close() error {
+	return b.bkt.Close()
+}
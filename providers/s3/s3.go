@@ -5,7 +5,10 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,6 +25,7 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/tags"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
@@ -89,6 +93,9 @@ const (
 	// SSES3 is the name of the SSE-S3 method for objstore encryption.
 	SSES3 = "SSE-S3"
 
+	// maxKeysPerPage is the maximum number of keys S3 returns in a single list objects response.
+	maxKeysPerPage = 1000
+
 	// sseConfigKey is the context key to override SSE config. This feature is used by downstream
 	// projects (eg. Cortex) to inject custom SSE config on a per-request basis. Future work or
 	// refactoring can introduce breaking changes as far as the functionality is preserved.
@@ -96,9 +103,33 @@ const (
 	// be available to wider set of backends we should probably add a variadic option to Get() and Upload().
 	sseConfigKey = ctxKey(0)
 
+	// ifNoneMatchKey is the context key used to request an If-None-Match: * precondition on the
+	// upload requests issued by UploadIfNotExists.
+	ifNoneMatchKey = ctxKey(1)
+
+	// ifMatchKey is the context key used to request an If-Match precondition with the given ETag on the
+	// upload requests issued by UploadIfMatch.
+	ifMatchKey = ctxKey(2)
+
+	// contentMD5Key is the context key used to send the Content-MD5 header with the given checksum on the
+	// single PUT requests issued by Upload.
+	contentMD5Key = ctxKey(3)
+
 	// Storage class header.
 	amzStorageClass = "X-Amz-Storage-Class"
 
+	// Canned ACL header.
+	amzACL = "X-Amz-Acl"
+
+	// maxCopyObjectSize is the size of the largest object which can be copied with a single CopyObject request.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+	// maxPutObjectSize is the size of the largest object which can be uploaded with a single PutObject request.
+	maxPutObjectSize = 5 * 1024 * 1024 * 1024
+
+	// minPartSize is the size which all parts of a multipart upload except the last one need to have at least.
+	minPartSize = 5 * 1024 * 1024
+
 	// amzKmsKeyAccessDeniedErrorMessage is the error message returned by s3 when the permissions to the KMS key is revoked.
 	amzKmsKeyAccessDeniedErrorMessage = "The ciphertext refers to a customer master key that does not exist, does not exist in this region, or you are not allowed to access."
 )
@@ -266,7 +297,7 @@ func NewBucketWithConfig(logger log.Logger, config Config, component string) (*B
 		Creds:        credentials.NewChainCredentials(chain),
 		Secure:       !config.Insecure,
 		Region:       config.Region,
-		Transport:    rt,
+		Transport:    &conditionalRoundTripper{rt: rt},
 		BucketLookup: config.BucketLookupType.MinioType(),
 	})
 	if err != nil {
@@ -388,22 +419,45 @@ func ValidateForTests(conf Config) error {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(attrs objstore.IterObjectAttributes) error {
+		return f(attrs.Name)
+	}, options...)
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter.
+// In addition to Name, it also includes requested object attributes in the argument to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(b.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
 
+	params := objstore.ApplyIterOptions(options...)
 	opts := minio.ListObjectsOptions{
-		Prefix:    dir,
-		Recursive: objstore.ApplyIterOptions(options...).Recursive,
-		UseV1:     b.listObjectsV1,
+		Prefix:     dir,
+		Recursive:  params.Recursive,
+		UseV1:      b.listObjectsV1,
+		StartAfter: params.StartAfter,
 	}
+	if params.MaxResults > 0 && params.MaxResults < maxKeysPerPage {
+		// Don't list more keys than needed. This only limits the page size, so we still stop listing below.
+		opts.MaxKeys = params.MaxResults
+	}
+
+	// Cancel the listing if we stop consuming it early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	count := 0
 	for object := range b.client.ListObjects(ctx, b.name, opts) {
 		// Catch the error when failed to list objects.
 		if object.Err != nil {
-			return object.Err
+			return wrapErr(objstore.OpIter, dir, object.Err)
 		}
 		// This sometimes happens with empty buckets.
 		if object.Key == "" {
@@ -413,22 +467,70 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, opt
 		if object.Key == dir {
 			continue
 		}
-		if err := f(object.Key); err != nil {
+
+		isDir := strings.HasSuffix(object.Key, objstore.DirDelim)
+		if !isDir && (params.PrefixesOnly || params.SkipStorageClass(object.StorageClass)) {
+			continue
+		}
+
+		attrs := objstore.IterObjectAttributes{Name: object.Key}
+		if params.ETag {
+			attrs.SetETag(object.ETag)
+		}
+		if params.StorageClass && !isDir {
+			attrs.SetStorageClass(object.StorageClass)
+		}
+		if params.Size && !isDir {
+			attrs.SetSize(object.Size)
+		}
+		if params.LastModified && !isDir {
+			attrs.SetLastModified(object.LastModified)
+		}
+		if err := f(attrs); err != nil {
 			return err
 		}
+		if count++; params.MaxResults > 0 && count >= params.MaxResults {
+			return nil
+		}
 	}
 
 	return ctx.Err()
 }
 
-func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+// SupportedIterOptions returns the list of IterOptions supported by S3. CreatedAt is accepted, but never set
+// since S3 does not track the creation time separately from the last modification time.
+func (b *Bucket) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive, objstore.ETag, objstore.MaxResults, objstore.Size, objstore.StorageClass, objstore.StartAfter, objstore.PrefixesOnly, objstore.UpdatedAt, objstore.CreatedAt}
+}
+
+func (b *Bucket) getRange(ctx context.Context, name, versionID string, off, length int64) (io.ReadCloser, error) {
+	opts, err := b.getObjectOptions(ctx, versionID, off, length)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.getObject(ctx, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *Bucket) getObjectOptions(ctx context.Context, versionID string, off, length int64) (*minio.GetObjectOptions, error) {
 	sse, err := b.getServerSideEncryption(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	opts := &minio.GetObjectOptions{ServerSideEncryption: sse}
-	if length != -1 {
+	opts := &minio.GetObjectOptions{ServerSideEncryption: sse, VersionID: versionID}
+	if off < 0 {
+		if length != -1 {
+			return nil, errors.Errorf("suffix range requires length -1, got %d", length)
+		}
+		// Read the last -off bytes, `bytes=-N`.
+		if err := opts.SetRange(0, off); err != nil {
+			return nil, err
+		}
+	} else if length != -1 {
 		if err := opts.SetRange(off, off+length-1); err != nil {
 			return nil, err
 		}
@@ -437,6 +539,10 @@ func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (
 			return nil, err
 		}
 	}
+	return opts, nil
+}
+
+func (b *Bucket) getObject(ctx context.Context, name string, opts *minio.GetObjectOptions) (*minio.Object, error) {
 	r, err := b.client.GetObject(ctx, b.name, name, *opts)
 	if err != nil {
 		return nil, err
@@ -456,12 +562,66 @@ func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (
 
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, 0, -1)
+	r, err := b.getRange(ctx, name, "", 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
+}
+
+// GetWithAttributes returns a reader for the given object name and the attributes of the object, which are
+// taken from the headers of the GetObject response.
+func (b *Bucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, objstore.ObjectAttributes, error) {
+	opts, err := b.getObjectOptions(ctx, "", 0, -1)
+	if err != nil {
+		return nil, objstore.ObjectAttributes{}, wrapErr(objstore.OpGet, name, err)
+	}
+	r, err := b.getObject(ctx, name, opts)
+	if err != nil {
+		return nil, objstore.ObjectAttributes{}, wrapErr(objstore.OpGet, name, err)
+	}
+	// The object info was read from the response of the first request by getObject, so Stat doesn't send
+	// another one.
+	info, err := r.Stat()
+	if err != nil {
+		logerrcapture.Do(b.logger, r.Close, "s3 get obj close")
+		return nil, objstore.ObjectAttributes{}, wrapErr(objstore.OpGet, name, err)
+	}
+	return r, objectAttributes(info), nil
+}
+
+// GetWithOptions returns a reader for the given object name. S3 returns objects as they are stored, but the HTTP
+// transport transparently decompresses objects uploaded with the gzip content encoding if it requested
+// compression itself. The encoding is therefore always requested explicitly, and the content is decoded
+// according to the content encoding of the object if WithDecodeContent is given.
+func (b *Bucket) GetWithOptions(ctx context.Context, name string, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	params := objstore.ApplyObjectGetOptions(opts...)
+	if !params.ReadCompressed && !params.DecodeContent {
+		return b.Get(ctx, name)
+	}
+
+	getOpts, err := b.getObjectOptions(ctx, "", 0, -1)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	getOpts.Set("Accept-Encoding", "gzip")
+	r, err := b.getObject(ctx, name, getOpts)
+	if err != nil {
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	if !params.DecodeContent {
+		return r, nil
+	}
+	info, err := r.Stat()
+	if err != nil {
+		logerrcapture.Do(b.logger, r.Close, "s3 get obj close")
+		return nil, wrapErr(objstore.OpGet, name, err)
+	}
+	rc, err := objstore.NewContentDecodingReader(r, info.Metadata.Get("Content-Encoding"))
+	return rc, wrapErr(objstore.OpGet, name, err)
 }
 
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	return b.getRange(ctx, name, off, length)
+	r, err := b.getRange(ctx, name, "", off, length)
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 // Exists checks if the given object exists.
@@ -471,14 +631,21 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
 		}
-		return false, errors.Wrap(err, "stat s3 object")
+		return false, wrapErr(objstore.OpExists, name, errors.Wrap(err, "stat s3 object"))
 	}
 
 	return true, nil
 }
 
 // Upload the contents of the reader as an object into the bucket.
-func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	params := objstore.ApplyObjectUploadOptions(opts...)
+	if err := objstore.ValidateUserMetadata(params.UserMetadata); err != nil {
+		return err
+	}
+
 	sse, err := b.getServerSideEncryption(ctx)
 	if err != nil {
 		return err
@@ -495,6 +662,16 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	if size < int64(partSize) {
 		partSize = 0
 	}
+
+	// Content-MD5 is only valid for single PUT requests, so uploads with an MD5 checksum are sent in a single
+	// request if their size allows it.
+	if params.MD5 != nil {
+		if size < 0 || size > maxPutObjectSize {
+			return b.uploadPartsWithMD5(ctx, name, r, params.MD5, opts...)
+		}
+		ctx = context.WithValue(ctx, contentMD5Key, params.MD5)
+	}
+
 	if _, err := b.client.PutObject(
 		ctx,
 		b.name,
@@ -504,8 +681,13 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 		minio.PutObjectOptions{
 			PartSize:             partSize,
 			ServerSideEncryption: sse,
-			UserMetadata:         b.putUserMetadata,
-			StorageClass:         b.storageClass,
+			UserMetadata:         b.userMetadata(params),
+			StorageClass:         b.objectStorageClass(params),
+			ContentType:          params.ContentType,
+			CacheControl:         params.CacheControl,
+			ContentEncoding:      params.ContentEncoding,
+			SendContentMd5:       params.MD5 != nil,
+			DisableMultipart:     params.MD5 != nil,
 			// 4 is what minio-go have as the default. To be certain we do micro benchmark before any changes we
 			// ensure we pin this number to four.
 			// TODO(bwplotka): Consider adjusting this number to GOMAXPROCS or to expose this in config if it becomes bottleneck.
@@ -518,22 +700,555 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	return nil
 }
 
+// uploadPartsWithMD5 uploads the content of r through a multipart upload, which is only completed if the MD5
+// checksum of the whole content matches sum. Otherwise, the upload is aborted and a ChecksumMismatchError is
+// returned.
+func (b *Bucket) uploadPartsWithMD5(ctx context.Context, name string, r io.Reader, sum []byte, opts ...objstore.ObjectUploadOption) (err error) {
+	w, err := b.NewMultipartUpload(ctx, name, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if abortErr := w.Abort(ctx); abortErr != nil {
+			level.Warn(b.logger).Log("msg", "failed to abort multipart upload", "name", name, "err", abortErr)
+		}
+	}()
+
+	partSize := b.partSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	var (
+		buf   = make([]byte, partSize)
+		hash  = md5.New()
+		parts int
+	)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return errors.Wrap(readErr, "read content")
+		}
+		// Empty objects are uploaded as a single empty part.
+		if n > 0 || parts == 0 {
+			_, _ = hash.Write(buf[:n])
+			if err := w.WritePart(ctx, bytes.NewReader(buf[:n]), int64(n)); err != nil {
+				return err
+			}
+			parts++
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	if actual := hash.Sum(nil); !bytes.Equal(actual, sum) {
+		return &objstore.ChecksumMismatchError{Algorithm: "MD5", Expected: sum, Actual: actual}
+	}
+	return w.Complete(ctx)
+}
+
+// userMetadata returns the configured user metadata merged with the one of the upload. The canned ACL of public
+// uploads is added as well, as minio-go sends the x-amz-acl key of the user metadata as a header.
+func (b *Bucket) userMetadata(params objstore.UploadObjectParams) map[string]string {
+	if len(params.UserMetadata) == 0 && !params.PublicRead {
+		return b.putUserMetadata
+	}
+	userMetadata := make(map[string]string, len(b.putUserMetadata)+len(params.UserMetadata)+1)
+	for k, v := range b.putUserMetadata {
+		userMetadata[k] = v
+	}
+	for k, v := range params.UserMetadata {
+		userMetadata[k] = v
+	}
+	if params.PublicRead {
+		userMetadata[amzACL] = "public-read"
+	}
+	return userMetadata
+}
+
+// objectStorageClass returns the storage class of the upload, falling back to the configured one.
+func (b *Bucket) objectStorageClass(params objstore.UploadObjectParams) string {
+	if params.StorageClass != "" {
+		return params.StorageClass
+	}
+	return b.storageClass
+}
+
+// UploadIfNotExists uploads the contents of the reader as an object into the bucket only if it does not
+// exist yet. It relies on the If-None-Match: * precondition, which has to be supported by the S3 implementation.
+func (b *Bucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	if err := b.Upload(context.WithValue(ctx, ifNoneMatchKey, true), name, r); err != nil {
+		if objstore.IsPreconditionFailedErr(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UploadIfMatch uploads the contents of the reader as an object into the bucket only if the ETag of the existing
+// object equals etag. It relies on the If-Match precondition, which has to be supported by the S3 implementation.
+func (b *Bucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...objstore.ObjectUploadOption) error {
+	return b.Upload(context.WithValue(ctx, ifMatchKey, etag), name, r, opts...)
+}
+
+// NewMultipartUpload starts a new S3 multipart upload of the object with the given name.
+// Parts have to be at least 5MiB in size, except for the last one.
+func (b *Bucket) NewMultipartUpload(ctx context.Context, name string, opts ...objstore.ObjectUploadOption) (objstore.MultipartWriter, error) {
+	params := objstore.ApplyObjectUploadOptions(opts...)
+
+	sse, err := b.getServerSideEncryption(ctx)
+	if err != nil {
+		return nil, wrapErr(objstore.OpUpload, name, err)
+	}
+
+	core := minio.Core{Client: b.client}
+	uploadID, err := core.NewMultipartUpload(ctx, b.name, name, minio.PutObjectOptions{
+		ServerSideEncryption: sse,
+		UserMetadata:         b.userMetadata(params),
+		StorageClass:         b.objectStorageClass(params),
+		ContentType:          params.ContentType,
+		CacheControl:         params.CacheControl,
+		ContentEncoding:      params.ContentEncoding,
+	})
+	if err != nil {
+		return nil, wrapErr(objstore.OpUpload, name, errors.Wrap(err, "initiate s3 multipart upload"))
+	}
+
+	w := &multipartWriter{core: core, bucket: b.name, name: name, uploadID: uploadID}
+	// The customer provided key has to be sent with every part as well.
+	if sse != nil && sse.Type() == encrypt.SSEC {
+		w.sse = sse
+	}
+	return w, nil
+}
+
+// multipartWriter uploads an object in parts using the S3 multipart upload API.
+type multipartWriter struct {
+	core     minio.Core
+	bucket   string
+	name     string
+	uploadID string
+	sse      encrypt.ServerSide
+	parts    []minio.CompletePart
+}
+
+// WritePart uploads the next part of the object. If it fails, the same part can be retried by calling
+// WritePart again, as the part number only advances once a part was uploaded successfully.
+func (w *multipartWriter) WritePart(ctx context.Context, r io.Reader, size int64) error {
+	partNumber := len(w.parts) + 1
+	part, err := w.core.PutObjectPart(ctx, w.bucket, w.name, w.uploadID, partNumber, r, size, "", "", w.sse)
+	if err != nil {
+		return wrapErr(objstore.OpUpload, w.name, errors.Wrapf(err, "upload part %d", partNumber))
+	}
+	w.parts = append(w.parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	return nil
+}
+
+// Complete finishes the upload by assembling the uploaded parts into the object.
+func (w *multipartWriter) Complete(ctx context.Context) error {
+	if _, err := w.core.CompleteMultipartUpload(ctx, w.bucket, w.name, w.uploadID, w.parts, minio.PutObjectOptions{}); err != nil {
+		return wrapErr(objstore.OpUpload, w.name, errors.Wrap(err, "complete s3 multipart upload"))
+	}
+	return nil
+}
+
+// Abort cancels the upload. S3 frees the storage of the parts uploaded so far.
+func (w *multipartWriter) Abort(ctx context.Context) error {
+	if err := w.core.AbortMultipartUpload(ctx, w.bucket, w.name, w.uploadID); err != nil {
+		return wrapErr(objstore.OpUpload, w.name, errors.Wrap(err, "abort s3 multipart upload"))
+	}
+	return nil
+}
+
+// conditionalRoundTripper sets the If-None-Match, If-Match and Content-MD5 headers on the requests which create an
+// object, if requested through the context. minio-go does not allow to set them through PutObjectOptions.
+type conditionalRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (c *conditionalRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if v, ok := req.Context().Value(ifNoneMatchKey).(bool); ok && v && isObjectCreateRequest(req) {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", "*")
+	}
+	if etag, ok := req.Context().Value(ifMatchKey).(string); ok && etag != "" && isObjectCreateRequest(req) {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-Match", `"`+etag+`"`)
+	}
+	if sum, ok := req.Context().Value(contentMD5Key).([]byte); ok && isSinglePutRequest(req) {
+		req = req.Clone(req.Context())
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum))
+	}
+	return c.rt.RoundTrip(req)
+}
+
+// isObjectCreateRequest returns true for single PUT object requests and for requests completing a multipart upload.
+func isObjectCreateRequest(req *http.Request) bool {
+	if req.Method == http.MethodPost {
+		return req.URL.Query().Has("uploadId")
+	}
+	return isSinglePutRequest(req)
+}
+
+// isSinglePutRequest returns true for PUT object requests which aren't part of a multipart upload.
+func isSinglePutRequest(req *http.Request) bool {
+	q := req.URL.Query()
+	return req.Method == http.MethodPut && !q.Has("partNumber") && !q.Has("uploadId")
+}
+
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	objInfo, err := b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{})
 	if err != nil {
-		return objstore.ObjectAttributes{}, err
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, err)
 	}
+	return objectAttributes(objInfo), nil
+}
 
+func objectAttributes(objInfo minio.ObjectInfo) objstore.ObjectAttributes {
 	return objstore.ObjectAttributes{
 		Size:         objInfo.Size,
 		LastModified: objInfo.LastModified,
-	}, nil
+		ETag:         objInfo.ETag,
+		ContentType:  objInfo.ContentType,
+		// The storage class is only reported in the response headers.
+		StorageClass:    objInfo.Metadata.Get(amzStorageClass),
+		UserMetadata:    userMetadata(objInfo.UserMetadata),
+		VersionID:       objInfo.VersionID,
+		ContentEncoding: objInfo.Metadata.Get("Content-Encoding"),
+		CacheControl:    objInfo.Metadata.Get("Cache-Control"),
+	}
+}
+
+// userMetadata returns the user metadata of an object with lowercase keys, as S3 stores them, instead of
+// the canonical header keys returned by minio.
+func userMetadata(metadata minio.StringMap) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		m[strings.ToLower(k)] = v
+	}
+	return m
 }
 
 // Delete removes the object with the given name.
 func (b *Bucket) Delete(ctx context.Context, name string) error {
-	return b.client.RemoveObject(ctx, b.name, name, minio.RemoveObjectOptions{})
+	return wrapErr(objstore.OpDelete, name, b.client.RemoveObject(ctx, b.name, name, minio.RemoveObjectOptions{}))
+}
+
+// DeleteMany removes the objects with the given names using the S3 DeleteObjects API. minio-go sends the
+// names in requests of up to 1000 objects each. Unlike Delete, objects which don't exist are not reported as failures.
+func (b *Bucket) DeleteMany(ctx context.Context, names []string) error {
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, name := range names {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: name}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	res := &objstore.BatchDeleteResult{Errors: map[string]error{}}
+	for removeErr := range b.client.RemoveObjects(ctx, b.name, objectsCh, minio.RemoveObjectsOptions{}) {
+		res.Errors[removeErr.ObjectName] = wrapErr(objstore.OpDelete, removeErr.ObjectName, removeErr.Err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+// The copy is done server-side using the S3 CopyObject API.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	return wrapErr(objstore.OpCopy, src, b.copy(ctx, minio.CopySrcOptions{Object: src}, dst, -1))
+}
+
+// copy copies the object described by srcOpts to dst. The bucket of srcOpts is set by copy.
+func (b *Bucket) copy(ctx context.Context, srcOpts minio.CopySrcOptions, dst string, size int64) error {
+	return b.copyFrom(ctx, b, srcOpts, minio.CopyDestOptions{Object: dst}, size)
+}
+
+// copyFrom copies the object described by srcOpts in the src bucket to the object described by dstOpts. The
+// buckets of both options and the encryption of the destination are set by copyFrom. Size is the size of the
+// source object, or -1 if it is not known. Objects larger than 5 GiB, which S3 doesn't copy with a single
+// request, are copied in parts.
+func (b *Bucket) copyFrom(ctx context.Context, src *Bucket, srcOpts minio.CopySrcOptions, dstOpts minio.CopyDestOptions, size int64) error {
+	sse, err := b.getServerSideEncryption(ctx)
+	if err != nil {
+		return err
+	}
+	srcSSE, err := src.getServerSideEncryption(ctx)
+	if err != nil {
+		return err
+	}
+
+	srcOpts.Bucket = src.name
+	if srcSSE != nil && srcSSE.Type() == encrypt.SSEC {
+		// The source object has to be decrypted with the customer provided key of its bucket.
+		srcOpts.Encryption = encrypt.SSECopy(srcSSE)
+	}
+	dstOpts.Bucket = b.name
+	dstOpts.Encryption = sse
+	if size > maxCopyObjectSize {
+		if _, err := b.client.ComposeObject(ctx, dstOpts, srcOpts); err != nil {
+			return errors.Wrapf(err, "copy s3 object %s to %s in parts", srcOpts.Object, dstOpts.Object)
+		}
+		return nil
+	}
+	if _, err := b.client.CopyObject(ctx, dstOpts, srcOpts); err != nil {
+		return errors.Wrapf(err, "copy s3 object %s to %s", srcOpts.Object, dstOpts.Object)
+	}
+	return nil
+}
+
+// CopyFromBucket copies the object with the src name in the src bucket into a new object with the dst name
+// server-side. It returns objstore.ErrCrossBucketCopyNotSupported unless src is an S3 bucket of the same
+// endpoint, which can be wrapped. The credentials of this bucket have to allow reading from src.
+func (b *Bucket) CopyFromBucket(ctx context.Context, src objstore.Bucket, srcName, dstName string) error {
+	inner, srcName := objstore.UnwrapObject(src, srcName)
+	s, ok := inner.(*Bucket)
+	if !ok || s.client.EndpointURL().String() != b.client.EndpointURL().String() {
+		return objstore.ErrCrossBucketCopyNotSupported
+	}
+	return wrapErr(objstore.OpCopy, srcName, b.copyFrom(ctx, s, minio.CopySrcOptions{Object: srcName}, minio.CopyDestOptions{Object: dstName}, -1))
+}
+
+// UpdateMetadata changes the user metadata and the attributes set by the options of the object by copying it onto
+// itself server-side, which replaces all of its metadata. The copy only succeeds if the object is unchanged since
+// its current attributes were read. The tags and the ACL of the object are kept.
+func (b *Bucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...objstore.ObjectUploadOption) error {
+	if err := objstore.ValidateUserMetadata(md); err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	params := objstore.ApplyObjectUpdateOptions(opts...)
+
+	info, err := b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{})
+	if err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	// Replacing the metadata replaces the content headers and the storage class as well, so start from the
+	// current ones.
+	headers := map[string]string{
+		"Content-Type":     info.ContentType,
+		"Cache-Control":    info.Metadata.Get("Cache-Control"),
+		"Content-Encoding": info.Metadata.Get("Content-Encoding"),
+		amzStorageClass:    info.Metadata.Get(amzStorageClass),
+	}
+	if params.ContentType != "" {
+		headers["Content-Type"] = params.ContentType
+	}
+	if params.CacheControl != "" {
+		headers["Cache-Control"] = params.CacheControl
+	}
+	if params.ContentEncoding != "" {
+		headers["Content-Encoding"] = params.ContentEncoding
+	}
+	if params.StorageClass != "" {
+		headers[amzStorageClass] = params.StorageClass
+	}
+	for k, v := range headers {
+		if v == "" {
+			delete(headers, k)
+		}
+	}
+	userMetadata := map[string]string(info.UserMetadata)
+	if md != nil {
+		userMetadata = b.userMetadata(objstore.UploadObjectParams{UserMetadata: md})
+	}
+	for k, v := range userMetadata {
+		headers[k] = v
+	}
+	// S3 resets the ACL of the copy unless it is set explicitly.
+	acl, err := b.objectACL(ctx, name)
+	if err != nil {
+		return wrapErr(objstore.OpUpload, name, err)
+	}
+	for k, v := range acl {
+		headers[k] = v
+	}
+
+	err = b.copyFrom(ctx, b, minio.CopySrcOptions{Object: name, MatchETag: info.ETag}, minio.CopyDestOptions{Object: name, UserMetadata: headers, ReplaceMetadata: true}, info.Size)
+	return wrapErr(objstore.OpUpload, name, err)
+}
+
+// objectACL returns the headers which grant the ACL of the object to a new object. It returns no headers for the
+// default private ACL and for buckets which don't support ACLs, e.g. because they enforce the bucket owner as the
+// owner of all objects.
+func (b *Bucket) objectACL(ctx context.Context, name string) (map[string]string, error) {
+	info, err := b.client.GetObjectACL(ctx, b.name, name)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "AccessControlListNotSupported", "NotImplemented":
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "get object ACL")
+	}
+
+	headers := map[string]string{}
+	for k, v := range info.Metadata {
+		if (k == amzACL && v[0] != "private") || strings.HasPrefix(k, "X-Amz-Grant-") {
+			headers[k] = strings.Join(v, ", ")
+		}
+	}
+	return headers, nil
+}
+
+// Rename moves the object with the src name to the dst name by copying it and deleting src afterwards.
+// S3 doesn't support conditional deletes, so src is checked to be unchanged after the copy, which leaves
+// a short window in which a concurrent change of src is lost.
+func (b *Bucket) Rename(ctx context.Context, src, dst string) error {
+	info, err := b.client.StatObject(ctx, b.name, src, minio.StatObjectOptions{})
+	if err != nil {
+		return wrapErr(objstore.OpCopy, src, err)
+	}
+	if err := b.copy(ctx, minio.CopySrcOptions{Object: src, MatchETag: info.ETag}, dst, info.Size); err != nil {
+		return wrapErr(objstore.OpCopy, src, err)
+	}
+
+	opts := minio.StatObjectOptions{}
+	if err := opts.SetMatchETag(info.ETag); err != nil {
+		return wrapErr(objstore.OpCopy, src, err)
+	}
+	if _, err := b.client.StatObject(ctx, b.name, src, opts); err != nil {
+		return wrapErr(objstore.OpCopy, src, errors.Wrapf(err, "s3 object %s changed while renaming it to %s", src, dst))
+	}
+	if err := b.client.RemoveObject(ctx, b.name, src, minio.RemoveObjectOptions{}); err != nil {
+		return wrapErr(objstore.OpDelete, src, errors.Wrapf(err, "delete s3 object %s after copying it to %s", src, dst))
+	}
+	return nil
+}
+
+// ListVersions returns all versions of the object with the given name, including delete markers. In buckets
+// without versioning, the only version of an object has the version ID "null".
+func (b *Bucket) ListVersions(ctx context.Context, name string) ([]objstore.VersionInfo, error) {
+	var versions []objstore.VersionInfo
+	for obj := range b.client.ListObjects(ctx, b.name, minio.ListObjectsOptions{Prefix: name, WithVersions: true}) {
+		if obj.Err != nil {
+			return nil, wrapErr(objstore.OpIter, name, errors.Wrapf(obj.Err, "list versions of s3 object %s", name))
+		}
+		if obj.Key != name {
+			continue
+		}
+		versions = append(versions, objstore.VersionInfo{
+			VersionID:      obj.VersionID,
+			LastModified:   obj.LastModified,
+			Size:           obj.Size,
+			IsDeleteMarker: obj.IsDeleteMarker,
+		})
+	}
+	return versions, nil
+}
+
+// SetObjectTags replaces the tags of the object. S3 allows up to 10 tags per object.
+func (b *Bucket) SetObjectTags(ctx context.Context, name string, tagMap map[string]string) error {
+	t, err := tags.NewTags(tagMap, true)
+	if err != nil {
+		return wrapErr(objstore.OpUpload, name, errors.Wrap(err, "invalid tags"))
+	}
+	return wrapErr(objstore.OpUpload, name, b.client.PutObjectTagging(ctx, b.name, name, t, minio.PutObjectTaggingOptions{}))
+}
+
+// GetObjectTags returns the tags of the object.
+func (b *Bucket) GetObjectTags(ctx context.Context, name string) (map[string]string, error) {
+	t, err := b.client.GetObjectTagging(ctx, b.name, name, minio.GetObjectTaggingOptions{})
+	if err != nil {
+		return nil, wrapErr(objstore.OpAttributes, name, err)
+	}
+	return t.ToMap(), nil
+}
+
+// DeleteObjectTags removes all tags of the object.
+func (b *Bucket) DeleteObjectTags(ctx context.Context, name string) error {
+	return wrapErr(objstore.OpUpload, name, b.client.RemoveObjectTagging(ctx, b.name, name, minio.RemoveObjectTaggingOptions{}))
+}
+
+// IterVersions calls f for each version of the objects whose names start with prefix, including delete markers.
+func (b *Bucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	// Cancel the listing if we stop consuming it early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for obj := range b.client.ListObjects(ctx, b.name, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithVersions: true}) {
+		if obj.Err != nil {
+			return wrapErr(objstore.OpIter, prefix, errors.Wrapf(obj.Err, "list versions of s3 objects with prefix %s", prefix))
+		}
+		if err := f(obj.Key, obj.VersionID, obj.IsLatest, obj.IsDeleteMarker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVersion returns a reader for the given version of the object.
+func (b *Bucket) GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
+	r, err := b.getRange(ctx, name, versionID, 0, -1)
+	return r, wrapErr(objstore.OpGet, name, err)
+}
+
+// DeleteVersion permanently deletes the given version of the object.
+func (b *Bucket) DeleteVersion(ctx context.Context, name, versionID string) error {
+	return wrapErr(objstore.OpDelete, name, b.client.RemoveObject(ctx, b.name, name, minio.RemoveObjectOptions{VersionID: versionID}))
+}
+
+// RestoreVersion copies the given version of the object over its current version.
+func (b *Bucket) RestoreVersion(ctx context.Context, name, versionID string) error {
+	return wrapErr(objstore.OpCopy, name, b.copy(ctx, minio.CopySrcOptions{Object: name, VersionID: versionID}, name, -1))
+}
+
+// SupportedCopy returns true as S3 copies objects server-side.
+func (b *Bucket) SupportedCopy() bool {
+	return true
+}
+
+// PresignedGetURL returns a presigned URL which can be used to download the object with the given name until expiry passes.
+func (b *Bucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	u, err := b.client.PresignedGetObject(ctx, b.name, name, expiry, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "presign get %s", name)
+	}
+	return u.String(), nil
+}
+
+// PresignPut returns a presigned URL which can be used to upload the object with the given name until expiry passes.
+func (b *Bucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	u, err := b.client.PresignedPutObject(ctx, b.name, name, expiry)
+	if err != nil {
+		return "", errors.Wrapf(err, "presign put %s", name)
+	}
+	return u.String(), nil
+}
+
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the S3 error code and falling back to the HTTP status code.
+func wrapErr(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	errResp := minio.ToErrorResponse(errors.Cause(err))
+	kind := objstore.ErrorKindFromHTTPStatus(errResp.StatusCode)
+	switch errResp.Code {
+	case "NoSuchKey", "NoSuchBucket":
+		kind = objstore.ErrKindNotFound
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+		kind = objstore.ErrKindPermissionDenied
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded":
+		kind = objstore.ErrKindRateLimit
+	case "PreconditionFailed":
+		kind = objstore.ErrKindPreconditionFailed
+	case "XMinioAdminBucketQuotaExceeded", "XMinioStorageFull":
+		kind = objstore.ErrKindQuotaExceeded
+	}
+	return objstore.NewBucketError(op, name, errResp.Code, kind, err)
 }
 
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
@@ -547,6 +1262,18 @@ func (b *Bucket) IsCustomerManagedKeyError(err error) bool {
 	return errResponse.Code == "AccessDenied" && errResponse.Message == amzKmsKeyAccessDeniedErrorMessage
 }
 
+// Ping checks that the bucket exists and the credentials are allowed to access it with a HeadBucket request.
+func (b *Bucket) Ping(ctx context.Context) error {
+	ok, err := b.client.BucketExists(ctx, b.name)
+	if err != nil {
+		return wrapErr(objstore.OpPing, "", err)
+	}
+	if !ok {
+		return objstore.NewBucketError(objstore.OpPing, "", "NoSuchBucket", objstore.ErrKindNotFound, errors.Errorf("bucket %s does not exist", b.name))
+	}
+	return nil
+}
+
 func (b *Bucket) Close() error { return nil }
 
 // getServerSideEncryption returns the SSE to use.
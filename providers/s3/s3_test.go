@@ -4,19 +4,28 @@
 package s3
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/efficientgo/core/testutil"
 	"github.com/go-kit/log"
 	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/pkg/errors"
 
+	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/exthttp"
 )
 
@@ -434,6 +443,810 @@ func TestBucket_Get_ShouldReturnErrorIfServerTruncateResponse(t *testing.T) {
 	testutil.Equals(t, io.ErrUnexpectedEOF, err)
 }
 
+func TestBucket_GetRange_Suffix(t *testing.T) {
+	var rangeHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(http.StatusPartialContent)
+		_, err := w.Write([]byte("12345"))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	reader, err := bkt.GetRange(context.Background(), "test", -5, -1)
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(reader)
+	testutil.Ok(t, err)
+	testutil.Ok(t, reader.Close())
+	testutil.Equals(t, "12345", string(content))
+	testutil.Equals(t, "bytes=-5", rangeHeader)
+
+	_, err = bkt.GetRange(context.Background(), "test", -5, 5)
+	testutil.NotOk(t, err)
+}
+
+func TestBucket_GetWithOptions(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte("content"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, zw.Close())
+
+	var acceptEncodings []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, err := w.Write(compressed.Bytes())
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	attrs, err := bkt.Attributes(ctx, "test")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "gzip", attrs.ContentEncoding)
+
+	reader, err := objstore.GetWithOptions(ctx, bkt, "test", objstore.WithReadCompressed())
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(reader)
+	testutil.Ok(t, err)
+	testutil.Ok(t, reader.Close())
+	testutil.Equals(t, compressed.Bytes(), content)
+
+	reader, err = objstore.GetWithOptions(ctx, bkt, "test", objstore.WithDecodeContent())
+	testutil.Ok(t, err)
+	content, err = io.ReadAll(reader)
+	testutil.Ok(t, err)
+	testutil.Ok(t, reader.Close())
+	testutil.Equals(t, "content", string(content))
+	testutil.Equals(t, "gzip", acceptEncodings[len(acceptEncodings)-1])
+
+	_, err = objstore.GetWithOptions(ctx, bkt, "test", objstore.WithReadCompressed(), objstore.WithDecodeContent())
+	testutil.NotOk(t, err)
+}
+
+func TestBucket_GetWithAttributes(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "7")
+		w.Header().Set("X-Amz-Meta-Owner", "team")
+		w.Header().Set("X-Amz-Storage-Class", "STANDARD_IA")
+		w.Header().Set("X-Amz-Version-Id", "v1")
+		_, err := w.Write([]byte("content"))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	reader, attrs, err := objstore.GetWithAttributes(context.Background(), bkt, "test")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(reader)
+	testutil.Ok(t, err)
+	testutil.Ok(t, reader.Close())
+	testutil.Equals(t, "content", string(content))
+	testutil.Equals(t, objstore.ObjectAttributes{
+		Size:         7,
+		LastModified: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		ETag:         "etag",
+		ContentType:  "text/plain",
+		StorageClass: "STANDARD_IA",
+		UserMetadata: map[string]string{"owner": "team"},
+		VersionID:    "v1",
+	}, attrs)
+	// The attributes are taken from the headers of the GetObject response.
+	testutil.Equals(t, []string{http.MethodGet}, methods)
+}
+
+func TestBucket_DeleteMany(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, http.MethodPost, r.Method)
+		_, ok := r.URL.Query()["delete"]
+		testutil.Assert(t, ok, "expected DeleteObjects request")
+		requests++
+
+		_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult>` +
+			`<Deleted><Key>obj1</Key></Deleted>` +
+			`<Error><Key>obj2</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>` +
+			`</DeleteResult>`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	err = bkt.DeleteMany(context.Background(), []string{"obj1", "obj2"})
+	testutil.Assert(t, objstore.IsBatchDeletePartialErr(err), "expected partial error, got %v", err)
+	testutil.Equals(t, "failed to delete 1 objects: delete obj2: Access Denied", err.Error())
+	testutil.Equals(t, 1, requests)
+}
+
+func TestBucket_BucketError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.URL.Path {
+		case "/test-bucket/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	_, err = bkt.Get(ctx, "missing")
+	testutil.Assert(t, objstore.IsNotFoundErr(err), "expected not found error, got %v", err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+	testutil.Assert(t, errors.Is(err, objstore.ErrNotFound), "expected not found error, got %v", err)
+
+	var bErr *objstore.BucketError
+	testutil.Assert(t, errors.As(err, &bErr))
+	testutil.Equals(t, objstore.OpGet, bErr.Op)
+	testutil.Equals(t, "missing", bErr.Name)
+	testutil.Equals(t, "NoSuchKey", bErr.ProviderCode)
+
+	err = bkt.Upload(ctx, "denied", strings.NewReader("content"))
+	testutil.Assert(t, objstore.IsPermissionDeniedErr(err), "expected permission denied error, got %v", err)
+	testutil.Assert(t, errors.Is(err, objstore.ErrPermissionDenied), "expected permission denied error, got %v", err)
+	testutil.Assert(t, errors.As(err, &bErr))
+	testutil.Equals(t, objstore.OpUpload, bErr.Op)
+	testutil.Equals(t, "AccessDenied", bErr.ProviderCode)
+}
+
+func TestBucket_MultipartUpload(t *testing.T) {
+	var (
+		parts     []string
+		completed string
+		aborted   bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && q.Has("uploads"):
+			_, err := w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPut && q.Get("uploadId") == "upload-1":
+			body, err := io.ReadAll(r.Body)
+			testutil.Ok(t, err)
+			// The body is sent with chunked signatures, so only check it contains the part.
+			testutil.Assert(t, strings.Contains(string(body), "part"+q.Get("partNumber")), "unexpected body %q", body)
+			parts = append(parts, q.Get("partNumber"))
+			w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+		case r.Method == http.MethodPost && q.Get("uploadId") == "upload-1":
+			body, err := io.ReadAll(r.Body)
+			testutil.Ok(t, err)
+			completed = string(body)
+			_, err = w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodDelete && q.Get("uploadId") == "upload-1":
+			aborted = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	w, err := objstore.NewMultipartUpload(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Ok(t, w.WritePart(ctx, strings.NewReader("part1"), 5))
+	testutil.Ok(t, w.WritePart(ctx, strings.NewReader("part2"), 5))
+	testutil.Ok(t, w.Complete(ctx))
+	testutil.Equals(t, []string{"1", "2"}, parts)
+	testutil.Assert(t, strings.Contains(completed, "<PartNumber>1</PartNumber>"), "unexpected complete request %s", completed)
+	testutil.Assert(t, strings.Contains(completed, "<PartNumber>2</PartNumber>"), "unexpected complete request %s", completed)
+
+	w, err = objstore.NewMultipartUpload(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Ok(t, w.Abort(ctx))
+	testutil.Assert(t, aborted, "expected upload to be aborted")
+}
+
+func TestBucket_Iter_MaxResults(t *testing.T) {
+	var maxKeys string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxKeys = r.URL.Query().Get("max-keys")
+		_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>` +
+			`<Name>test-bucket</Name><IsTruncated>false</IsTruncated>` +
+			`<Contents><Key>obj1</Key></Contents><Contents><Key>obj2</Key></Contents><Contents><Key>obj3</Key></Contents>` +
+			`</ListBucketResult>`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	var seen []string
+	testutil.Ok(t, bkt.Iter(context.Background(), "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}, objstore.WithMaxResults(2)))
+	testutil.Equals(t, []string{"obj1", "obj2"}, seen)
+	testutil.Equals(t, "2", maxKeys)
+}
+
+func TestBucket_Iter_CreatedAt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>` +
+			`<Name>test-bucket</Name><IsTruncated>false</IsTruncated>` +
+			`<Contents><Key>obj</Key><LastModified>2015-10-21T07:28:00.000Z</LastModified></Contents>` +
+			`</ListBucketResult>`))
+		testutil.Ok(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	// S3 only reports the last modification time of objects, the creation time is accepted but never set.
+	testutil.Ok(t, bkt.IterWithAttributes(context.Background(), "", func(attrs objstore.IterObjectAttributes) error {
+		updatedAt, ok := attrs.LastModified()
+		testutil.Assert(t, ok, "expected last modification time")
+		testutil.Equals(t, time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), updatedAt)
+		createdAt, ok := attrs.CreatedAt()
+		testutil.Assert(t, !ok, "unexpected creation time")
+		testutil.Equals(t, time.Time{}, createdAt)
+		return nil
+	}, objstore.WithUpdatedAt, objstore.WithCreatedAt))
+}
+
+func TestBucket_UploadIfNotExists(t *testing.T) {
+	var ifNoneMatch []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == "*" && r.URL.Path == "/test-bucket/existing" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`))
+			testutil.Ok(t, err)
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	created, err := bkt.UploadIfNotExists(ctx, "new", strings.NewReader("content"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, created, "expected object to be created")
+
+	created, err = bkt.UploadIfNotExists(ctx, "existing", strings.NewReader("content"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !created, "expected object to not be created")
+
+	// Plain uploads should not send the precondition.
+	testutil.Ok(t, bkt.Upload(ctx, "new", strings.NewReader("content")))
+	testutil.Equals(t, []string{"*", "*", ""}, ifNoneMatch)
+}
+
+func TestBucket_UploadIfMatch(t *testing.T) {
+	var ifMatch []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+		if r.Header.Get("If-Match") != `"current"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`))
+			testutil.Ok(t, err)
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.UploadIfMatch(ctx, "obj", strings.NewReader("content"), "current"))
+
+	err = bkt.UploadIfMatch(ctx, "obj", strings.NewReader("content"), "outdated")
+	testutil.Assert(t, objstore.IsPreconditionFailedErr(err), "expected precondition failed error, got %v", err)
+	testutil.Equals(t, []string{`"current"`, `"outdated"`}, ifMatch)
+}
+
+func TestBucket_Upload_WithMD5(t *testing.T) {
+	var (
+		contentMD5 []string
+		requests   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && q.Has("uploads"):
+			requests = append(requests, "initiate")
+			_, err := w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPut && q.Has("uploadId"):
+			requests = append(requests, "part "+q.Get("partNumber"))
+			w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+		case r.Method == http.MethodPost && q.Has("uploadId"):
+			requests = append(requests, "complete")
+			_, err := w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodDelete && q.Has("uploadId"):
+			requests = append(requests, "abort")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			contentMD5 = append(contentMD5, r.Header.Get("Content-MD5"))
+			w.Header().Set("ETag", `"9a0364b9e99bb480dd25e1f0284c8555"`)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	sum := md5.Sum([]byte("content"))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithMD5(sum[:])))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, []string{"mgNkuembtIDdJeHwKEyFVQ==", ""}, contentMD5)
+
+	// Uploads of unknown size need multiple parts, so the checksum is verified before completing the upload.
+	testutil.Ok(t, bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("content")), objstore.WithMD5(sum[:])))
+	testutil.Equals(t, []string{"initiate", "part 1", "complete"}, requests)
+
+	requests = nil
+	err = bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("corrupted")), objstore.WithMD5(sum[:]))
+	testutil.Assert(t, objstore.IsChecksumMismatchErr(err), "expected checksum mismatch error, got %v", err)
+	testutil.Equals(t, []string{"initiate", "part 1", "abort"}, requests)
+}
+
+func TestBucket_ObjectTags(t *testing.T) {
+	var tagging []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Assert(t, r.URL.Query().Has("tagging"), "expected tagging request, got %s", r.URL)
+		switch r.Method {
+		case http.MethodPut:
+			var err error
+			tagging, err = io.ReadAll(r.Body)
+			testutil.Ok(t, err)
+		case http.MethodGet:
+			if tagging == nil {
+				tagging = []byte(`<Tagging><TagSet></TagSet></Tagging>`)
+			}
+			_, err := w.Write(tagging)
+			testutil.Ok(t, err)
+		case http.MethodDelete:
+			tagging = nil
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, objstore.SetObjectTags(ctx, bkt, "obj", map[string]string{"env": "prod"}))
+	tags, err := objstore.GetObjectTags(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"env": "prod"}, tags)
+
+	testutil.Ok(t, objstore.DeleteObjectTags(ctx, bkt, "obj"))
+	tags, err = objstore.GetObjectTags(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(tags))
+}
+
+func TestBucket_UpdateMetadata(t *testing.T) {
+	const publicReadACL = `<AccessControlPolicy><Owner><ID>owner</ID></Owner><AccessControlList>` +
+		`<Grant><Grantee><ID>owner</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>` +
+		`<Grant><Grantee><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>` +
+		`</AccessControlList></AccessControlPolicy>`
+	var (
+		size        = "7"
+		acl         = publicReadACL
+		requests    []string
+		copyHeaders http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RawQuery)
+		switch {
+		case r.Method == http.MethodHead:
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Content-Length", size)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Amz-Meta-Team", "storage")
+		case r.Method == http.MethodGet && r.URL.Query().Has("acl"):
+			_, err := w.Write([]byte(acl))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			copyHeaders = r.Header
+			_, err := w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><UploadId>id</UploadId></InitiateMultipartUploadResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPost:
+			_, err := w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><ETag>"abc"</ETag></CompleteMultipartUploadResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPut && r.URL.Query().Has("partNumber"):
+			testutil.Equals(t, "abc", r.Header.Get("X-Amz-Copy-Source-If-Match"))
+			_, err := w.Write([]byte(`<CopyPartResult><ETag>"part"</ETag><LastModified>2015-10-21T07:28:00.000Z</LastModified></CopyPartResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPut:
+			copyHeaders = r.Header
+			_, err := w.Write([]byte(`<CopyObjectResult><ETag>"abc"</ETag><LastModified>2015-10-21T07:28:00.000Z</LastModified></CopyObjectResult>`))
+			testutil.Ok(t, err)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, bkt, "obj", map[string]string{"env": "prod"}, objstore.WithStorageClass("STANDARD_IA")))
+	testutil.Equals(t, "test-bucket/obj", copyHeaders.Get("X-Amz-Copy-Source"))
+	testutil.Equals(t, "abc", copyHeaders.Get("X-Amz-Copy-Source-If-Match"))
+	testutil.Equals(t, "REPLACE", copyHeaders.Get("X-Amz-Metadata-Directive"))
+	// The attributes which are not changed are kept.
+	testutil.Equals(t, "application/json", copyHeaders.Get("Content-Type"))
+	testutil.Equals(t, "no-cache", copyHeaders.Get("Cache-Control"))
+	testutil.Equals(t, "STANDARD_IA", copyHeaders.Get("X-Amz-Storage-Class"))
+	testutil.Equals(t, "prod", copyHeaders.Get("X-Amz-Meta-Env"))
+	testutil.Equals(t, "", copyHeaders.Get("X-Amz-Meta-Team"))
+	testutil.Equals(t, "public-read", copyHeaders.Get("X-Amz-Acl"))
+
+	// Without metadata, the current one is kept. The default private ACL is not set explicitly.
+	acl = `<AccessControlPolicy><Owner><ID>owner</ID></Owner><AccessControlList>` +
+		`<Grant><Grantee><ID>owner</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>` +
+		`</AccessControlList></AccessControlPolicy>`
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, bkt, "obj", nil, objstore.WithContentType("text/plain")))
+	testutil.Equals(t, "text/plain", copyHeaders.Get("Content-Type"))
+	testutil.Equals(t, "storage", copyHeaders.Get("X-Amz-Meta-Team"))
+	testutil.Equals(t, "", copyHeaders.Get("X-Amz-Acl"))
+
+	// Objects larger than 5 GiB are copied in parts.
+	size, acl, requests = strconv.Itoa(6*1024*1024*1024), publicReadACL, nil
+	testutil.Ok(t, objstore.UpdateMetadata(ctx, bkt, "obj", map[string]string{"env": "prod"}))
+	testutil.Equals(t, "POST uploads=", requests[4])
+	testutil.Equals(t, "POST uploadId=id", requests[len(requests)-1])
+	testutil.Equals(t, "prod", copyHeaders.Get("X-Amz-Meta-Env"))
+	testutil.Equals(t, "public-read", copyHeaders.Get("X-Amz-Acl"))
+}
+
+func TestBucket_Rename(t *testing.T) {
+	const etag = `"d41d8cd98f00b204e9800998ecf8427e"`
+	var (
+		requests   []string
+		srcDeleted bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case http.MethodHead:
+			// The source is deleted concurrently after it was copied.
+			if srcDeleted && r.Header.Get("If-Match") != "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		case http.MethodPut:
+			testutil.Equals(t, strings.Trim(etag, `"`), r.Header.Get("X-Amz-Copy-Source-If-Match"))
+			_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><CopyObjectResult><ETag>` + etag + `</ETag><LastModified>2015-10-21T07:28:00.000Z</LastModified></CopyObjectResult>`))
+			testutil.Ok(t, err)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, objstore.Rename(ctx, bkt, "src", "dst"))
+	testutil.Equals(t, []string{"HEAD /test-bucket/src", "PUT /test-bucket/dst", "HEAD /test-bucket/src", "DELETE /test-bucket/src"}, requests)
+
+	// The source is not deleted if it disappeared after the copy.
+	requests, srcDeleted = nil, true
+	err = objstore.Rename(ctx, bkt, "src", "dst")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error, got %s", err)
+	testutil.Equals(t, []string{"HEAD /test-bucket/src", "PUT /test-bucket/dst", "HEAD /test-bucket/src"}, requests)
+}
+
+func TestBucket_ContentType(t *testing.T) {
+	var contentType, cacheControl, meta string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			contentType = r.Header.Get("Content-Type")
+			cacheControl = r.Header.Get("Cache-Control")
+			meta = r.Header.Get("X-Amz-Meta-Owner")
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		case http.MethodHead:
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.Header().Set("Content-Length", "7")
+			w.Header().Set("Content-Type", contentType)
+			if meta != "" {
+				w.Header().Set("X-Amz-Meta-Owner", meta)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithContentType("application/json")))
+	testutil.Equals(t, "application/json", contentType)
+
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "application/json", attrs.ContentType)
+
+	testutil.Ok(t, objstore.UploadWithAttributes(ctx, bkt, "obj", strings.NewReader("content"), objstore.UploadObjectAttributes{
+		CacheControl: "no-cache",
+		UserMetadata: map[string]string{"owner": "test"},
+	}))
+	testutil.Equals(t, objstore.DefaultContentType, contentType)
+	testutil.Equals(t, "no-cache", cacheControl)
+	testutil.Equals(t, "test", meta)
+
+	attrs, err = bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"owner": "test"}, attrs.UserMetadata)
+}
+
+func TestBucket_StorageClass(t *testing.T) {
+	var storageClass string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			storageClass = r.Header.Get(amzStorageClass)
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		case http.MethodHead:
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.Header().Set("Content-Length", "7")
+			w.Header().Set(amzStorageClass, storageClass)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+	cfg.PutUserMetadata = map[string]string{amzStorageClass: "STANDARD_IA"}
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, "STANDARD_IA", storageClass)
+
+	// The storage class of the upload takes precedence over the configured one.
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithStorageClass("GLACIER")))
+	testutil.Equals(t, "GLACIER", storageClass)
+
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "GLACIER", attrs.StorageClass)
+}
+
+func TestBucket_PublicRead(t *testing.T) {
+	var acls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acls = append(acls, r.Header.Get(amzACL))
+		if r.Method == http.MethodPost {
+			_, err := w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>test-bucket</Bucket><Key>obj</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+			testutil.Ok(t, err)
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+	cfg.PutUserMetadata = map[string]string{"team": "storage"}
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content"), objstore.WithPublicRead()))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	_, err = objstore.NewMultipartUpload(ctx, bkt, "obj", objstore.WithPublicRead())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"public-read", "", "public-read"}, acls)
+	// The configured metadata is not changed by public uploads.
+	testutil.Equals(t, map[string]string{"team": "storage"}, bkt.putUserMetadata)
+}
+
+func TestBucket_Presign(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = endpoint
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	for _, presign := range []func(context.Context, string, time.Duration) (string, error){bkt.PresignedGetURL, bkt.PresignPut} {
+		signed, err := presign(ctx, "dir/obj", 5*time.Minute)
+		testutil.Ok(t, err)
+
+		u, err := url.Parse(signed)
+		testutil.Ok(t, err)
+		testutil.Equals(t, "/test-bucket/dir/obj", u.Path)
+		testutil.Equals(t, "300", u.Query().Get("X-Amz-Expires"))
+		testutil.Assert(t, strings.HasPrefix(u.Query().Get("X-Amz-Credential"), "test/"), "unexpected credential %s", u.Query().Get("X-Amz-Credential"))
+		testutil.Assert(t, u.Query().Get("X-Amz-Signature") != "", "expected signature")
+	}
+}
+
 func TestParseConfig_CustomStorageClass(t *testing.T) {
 	for _, testCase := range []struct {
 		name, storageClassKey string
@@ -462,3 +1275,116 @@ func TestParseConfig_DefaultStorageClassIsZero(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, "", bkt.storageClass)
 }
+
+func TestBucket_Ping(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, http.MethodHead, r.Method)
+		testutil.Equals(t, "/test-bucket/", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	status = http.StatusOK
+	testutil.Ok(t, objstore.Ping(ctx, bkt))
+
+	status = http.StatusForbidden
+	err = objstore.Ping(ctx, bkt)
+	testutil.Assert(t, objstore.IsPermissionDeniedErr(err), "expected permission denied error, got %v", err)
+
+	status = http.StatusNotFound
+	err = objstore.Ping(ctx, bkt)
+	testutil.Assert(t, objstore.IsNotFoundErr(err), "expected not found error, got %v", err)
+}
+
+func TestBucket_Versions(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.URL.Query().Get("versionId"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Has("versions"):
+			_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>test-bucket</Name><Prefix>obj</Prefix><IsTruncated>false</IsTruncated>
+<DeleteMarker><Key>obj</Key><VersionId>v3</VersionId><IsLatest>true</IsLatest><LastModified>2015-10-21T07:28:00.000Z</LastModified></DeleteMarker>
+<Version><Key>obj</Key><VersionId>v2</VersionId><IsLatest>false</IsLatest><LastModified>2015-10-20T07:28:00.000Z</LastModified><ETag>"d41d8cd98f00b204e9800998ecf8427e"</ETag><Size>7</Size></Version>
+<Version><Key>obj2</Key><VersionId>v1</VersionId><IsLatest>true</IsLatest><LastModified>2015-10-20T07:28:00.000Z</LastModified><ETag>"d41d8cd98f00b204e9800998ecf8427e"</ETag><Size>7</Size></Version>
+</ListVersionsResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodHead:
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.Header().Set("X-Amz-Version-Id", "v2")
+		case r.Method == http.MethodGet:
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Header().Set("Content-Length", "7")
+			_, err := w.Write([]byte("content"))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodPut:
+			testutil.Equals(t, "test-bucket/obj?versionId=v2", r.Header.Get("X-Amz-Copy-Source"))
+			_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><CopyObjectResult><ETag>"d41d8cd98f00b204e9800998ecf8427e"</ETag><LastModified>2015-10-21T07:28:00.000Z</LastModified></CopyObjectResult>`))
+			testutil.Ok(t, err)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.Insecure = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+	testutil.Assert(t, objstore.IsVersionedBucket(bkt))
+
+	ctx := context.Background()
+	versions, err := objstore.ListVersions(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []objstore.VersionInfo{
+		{VersionID: "v3", LastModified: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), IsDeleteMarker: true},
+		{VersionID: "v2", LastModified: time.Date(2015, 10, 20, 7, 28, 0, 0, time.UTC), Size: 7},
+	}, versions)
+
+	attrs, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "v2", attrs.VersionID)
+
+	var history []string
+	testutil.Ok(t, objstore.IterVersions(ctx, bkt, "obj", func(name, version string, isLatest bool, deleted bool) error {
+		history = append(history, fmt.Sprintf("%s %s latest=%t deleted=%t", name, version, isLatest, deleted))
+		return nil
+	}))
+	testutil.Equals(t, []string{
+		"obj v3 latest=true deleted=true",
+		"obj v2 latest=false deleted=false",
+		"obj2 v1 latest=true deleted=false",
+	}, history)
+
+	requests = nil
+	rc, err := objstore.GetVersion(ctx, bkt, "obj", "v2")
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	testutil.Ok(t, objstore.RestoreVersion(ctx, bkt, "obj", "v2"))
+	testutil.Ok(t, objstore.DeleteVersion(ctx, bkt, "obj", "v2"))
+	testutil.Equals(t, []string{"GET /test-bucket/obj v2", "PUT /test-bucket/obj ", "DELETE /test-bucket/obj v2"}, requests)
+}
@@ -205,6 +205,10 @@ func (c *Container) Name() string {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (c *Container) Iter(_ context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(c.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, string(DirDelim)) + string(DirDelim)
 	}
@@ -220,7 +224,7 @@ func (c *Container) Iter(_ context.Context, dir string, f func(string) error, op
 	return c.connection.ObjectsWalk(c.name, listOptions, func(opts *swift.ObjectsOpts) (interface{}, error) {
 		objects, err := c.connection.ObjectNames(c.name, opts)
 		if err != nil {
-			return objects, errors.Wrap(err, "list object names")
+			return objects, wrapErr(objstore.OpIter, dir, errors.Wrap(err, "list object names"))
 		}
 		for _, object := range objects {
 			if object == SegmentsDir {
@@ -234,6 +238,20 @@ func (c *Container) Iter(_ context.Context, dir string, f func(string) error, op
 	})
 }
 
+func (c *Container) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := objstore.ValidateIterOptions(c.SupportedIterOptions(), options...); err != nil {
+		return err
+	}
+
+	return c.Iter(ctx, dir, func(name string) error {
+		return f(objstore.IterObjectAttributes{Name: name})
+	}, options...)
+}
+
+func (c *Container) SupportedIterOptions() []objstore.IterOptionType {
+	return []objstore.IterOptionType{objstore.Recursive}
+}
+
 func (c *Container) get(name string, headers swift.Headers, checkHash bool) (io.ReadCloser, error) {
 	if name == "" {
 		return nil, errors.New("object name cannot be empty")
@@ -247,7 +265,8 @@ func (c *Container) get(name string, headers swift.Headers, checkHash bool) (io.
 
 // Get returns a reader for the given object name.
 func (c *Container) Get(_ context.Context, name string) (io.ReadCloser, error) {
-	return c.get(name, swift.Headers{}, true)
+	r, err := c.get(name, swift.Headers{}, true)
+	return r, wrapErr(objstore.OpGet, name, err)
 }
 
 func (c *Container) GetRange(_ context.Context, name string, off, length int64) (io.ReadCloser, error) {
@@ -256,21 +275,25 @@ func (c *Container) GetRange(_ context.Context, name string, off, length int64)
 	if length != -1 {
 		bytesRange = fmt.Sprintf("%s%d", bytesRange, off+length-1)
 	}
-	return c.get(name, swift.Headers{"Range": bytesRange}, false)
+	r, err := c.get(name, swift.Headers{"Range": bytesRange}, false)
+	return r, wrapErr(objstore.OpGetRange, name, err)
 }
 
 // Attributes returns information about the specified object.
 func (c *Container) Attributes(_ context.Context, name string) (objstore.ObjectAttributes, error) {
 	if name == "" {
-		return objstore.ObjectAttributes{}, errors.New("object name cannot be empty")
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, errors.New("object name cannot be empty"))
 	}
 	info, _, err := c.connection.Object(c.name, name)
 	if err != nil {
-		return objstore.ObjectAttributes{}, errors.Wrap(err, "get object attributes")
+		return objstore.ObjectAttributes{}, wrapErr(objstore.OpAttributes, name, errors.Wrap(err, "get object attributes"))
 	}
 	return objstore.ObjectAttributes{
 		Size:         info.Bytes,
 		LastModified: info.LastModified,
+		// Swift uses the MD5 checksum of the object content as its ETag.
+		ETag:        info.Hash,
+		ContentType: info.ContentType,
 	}, nil
 }
 
@@ -282,7 +305,17 @@ func (c *Container) Exists(_ context.Context, name string) (bool, error) {
 		err = nil
 		found = false
 	}
-	return found, err
+	return found, wrapErr(objstore.OpExists, name, err)
+}
+
+// wrapErr wraps err in an objstore.BucketError for the given operation and object name, classifying it
+// by the HTTP status code returned by Swift.
+func wrapErr(op, name string, err error) error {
+	var swiftErr *swift.Error
+	if err == nil || !errors.As(err, &swiftErr) {
+		return objstore.NewBucketError(op, name, "", objstore.ErrKindUnknown, err)
+	}
+	return objstore.NewBucketError(op, name, strconv.Itoa(swiftErr.StatusCode), objstore.ErrorKindFromHTTPStatus(swiftErr.StatusCode), err)
 }
 
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
@@ -296,7 +329,28 @@ func (b *Container) IsCustomerManagedKeyError(_ error) bool {
 }
 
 // Upload writes the contents of the reader as an object into the container.
-func (c *Container) Upload(_ context.Context, name string, r io.Reader) (err error) {
+func (c *Container) Upload(_ context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	defer func() { err = wrapErr(objstore.OpUpload, name, err) }()
+
+	params := objstore.ApplyObjectUploadOptions(opts...)
+	if err := objstore.ValidateUserMetadata(params.UserMetadata); err != nil {
+		return err
+	}
+	// Swift only supports ACLs for whole containers.
+	if params.PublicRead {
+		return objstore.ErrOptionNotSupported
+	}
+	headers := swift.Headers{}
+	if params.CacheControl != "" {
+		headers["Cache-Control"] = params.CacheControl
+	}
+	if params.ContentEncoding != "" {
+		headers["Content-Encoding"] = params.ContentEncoding
+	}
+	for k, v := range params.UserMetadata {
+		headers["X-Object-Meta-"+k] = v
+	}
+
 	size, err := objstore.TryToGetSize(r)
 	if err != nil {
 		level.Warn(c.logger).Log("msg", "could not guess file size, using large object to avoid issues if the file is larger than limit", "name", name, "err", err)
@@ -311,6 +365,8 @@ func (c *Container) Upload(_ context.Context, name string, r io.Reader) (err err
 			ChunkSize:        c.chunkSize,
 			SegmentContainer: c.segmentsContainer,
 			CheckHash:        true,
+			ContentType:      params.ContentType,
+			Headers:          headers,
 		}
 		if c.useDynamicLargeObjects {
 			if file, err = c.connection.DynamicLargeObjectCreateFile(&opts); err != nil {
@@ -322,7 +378,7 @@ func (c *Container) Upload(_ context.Context, name string, r io.Reader) (err err
 			}
 		}
 	} else {
-		if file, err = c.connection.ObjectCreate(c.name, name, true, "", "", swift.Headers{}); err != nil {
+		if file, err = c.connection.ObjectCreate(c.name, name, true, "", params.ContentType, headers); err != nil {
 			return errors.Wrap(err, "create file")
 		}
 	}
@@ -335,7 +391,23 @@ func (c *Container) Upload(_ context.Context, name string, r io.Reader) (err err
 
 // Delete removes the object with the given name.
 func (c *Container) Delete(_ context.Context, name string) error {
-	return errors.Wrap(c.connection.LargeObjectDelete(c.name, name), "delete object")
+	return wrapErr(objstore.OpDelete, name, errors.Wrap(c.connection.LargeObjectDelete(c.name, name), "delete object"))
+}
+
+// DeleteMany removes the objects with the given names by deleting them one by one.
+func (c *Container) DeleteMany(ctx context.Context, names []string) error {
+	return objstore.DefaultDeleteMany(ctx, c, names)
+}
+
+// Copy copies the object with the src name into a new object with the dst name.
+func (c *Container) Copy(_ context.Context, src, dst string) error {
+	_, err := c.connection.ObjectCopy(c.name, src, c.name, dst, nil)
+	return wrapErr(objstore.OpCopy, src, errors.Wrap(err, "copy object"))
+}
+
+// SupportedCopy returns true as Swift copies objects server-side.
+func (c *Container) SupportedCopy() bool {
+	return true
 }
 
 func (*Container) Close() error {
@@ -0,0 +1,42 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package throttle implements a bucket wrapper which limits the rate of operations against a bucket on the client side.
+package throttle
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/objstore"
+)
+
+// Config configures the rates of a ThrottlingBucket. A non-positive rate disables the limit of its class.
+type Config struct {
+	// ReadRPS is the maximum number of Get, GetRange, Exists and Attributes calls per second.
+	ReadRPS float64
+	// WriteRPS is the maximum number of Upload, Delete, DeleteMany and Copy calls per second.
+	WriteRPS float64
+	// ListRPS is the maximum number of Iter and IterWithAttributes calls per second.
+	ListRPS float64
+	// Burst is the number of calls of each class which can be made at once before the rate applies.
+	// Values lower than 1 are treated as 1.
+	Burst int
+}
+
+// ThrottlingBucket is a bucket wrapper which limits the rate of read, write and list operations separately, see
+// objstore.RateLimitedBucket.
+type ThrottlingBucket = objstore.RateLimitedBucket
+
+// ThrottleStats describes the limits of all classes of operations of a ThrottlingBucket, as returned by its
+// CurrentRates method.
+type ThrottleStats = objstore.RateLimitStats
+
+// NewThrottlingBucket returns a new ThrottlingBucket limiting the calls against bkt to the rates of cfg, like
+// objstore.WrapWithRateLimit with a separate limit for each class of operations.
+func NewThrottlingBucket(bkt objstore.Bucket, cfg Config, reg prometheus.Registerer) *ThrottlingBucket {
+	return objstore.WrapWithRateLimit(bkt, 0, cfg.Burst, reg,
+		objstore.WithReadRateLimit(cfg.ReadRPS, cfg.Burst),
+		objstore.WithWriteRateLimit(cfg.WriteRPS, cfg.Burst),
+		objstore.WithListRateLimit(cfg.ListRPS, cfg.Burst),
+	)
+}
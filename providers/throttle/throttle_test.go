@@ -0,0 +1,49 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package throttle
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/objstore"
+)
+
+func TestThrottlingBucket_Acceptance(t *testing.T) {
+	objstore.AcceptanceTest(t, NewThrottlingBucket(objstore.NewInMemBucket(), Config{ReadRPS: 1000, WriteRPS: 1000, ListRPS: 1000, Burst: 100}, nil))
+}
+
+func TestThrottlingBucket_CurrentRates(t *testing.T) {
+	bkt := NewThrottlingBucket(objstore.NewInMemBucket(), Config{ReadRPS: 2, ListRPS: 0.5, Burst: 0}, nil)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("data")))
+	_, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+
+	stats := bkt.CurrentRates()
+	testutil.Equals(t, objstore.RateLimitClassStats{Limit: 2, Burst: 1, Admitted: 1}, stats.Read)
+	testutil.Equals(t, objstore.RateLimitClassStats{Limit: math.Inf(1), Burst: 0, Admitted: 1}, stats.Write)
+	testutil.Equals(t, objstore.RateLimitClassStats{Limit: 0.5, Burst: 1, Admitted: 1}, stats.List)
+}
+
+func TestThrottlingBucket_ContextCanceled(t *testing.T) {
+	bkt := NewThrottlingBucket(objstore.NewInMemBucket(), Config{ListRPS: 0.001, Burst: 1}, nil)
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+
+	// The next listing would wait for more than 15 minutes.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := bkt.Iter(ctx, "", func(string) error { return nil })
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	testutil.Equals(t, int64(0), bkt.CurrentRates().List.Waiting)
+}
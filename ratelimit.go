@@ -0,0 +1,297 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitOption configures a bucket returned by WrapWithRateLimit.
+type RateLimitOption func(b *RateLimitedBucket)
+
+// WithReadRateLimit overrides the limit of read operations (Get, GetRange, Exists and Attributes, and Iter and
+// IterWithAttributes unless limited with WithListRateLimit).
+func WithReadRateLimit(opsPerSec float64, burst int) RateLimitOption {
+	return func(b *RateLimitedBucket) {
+		b.read = newLimiter(opsPerSec, burst)
+	}
+}
+
+// WithWriteRateLimit overrides the limit of write operations (Upload, UploadIfNotExists, UploadIfMatch, Delete,
+// DeleteMany and Copy).
+func WithWriteRateLimit(opsPerSec float64, burst int) RateLimitOption {
+	return func(b *RateLimitedBucket) {
+		b.write = newLimiter(opsPerSec, burst)
+	}
+}
+
+// WithListRateLimit limits listings (Iter and IterWithAttributes) separately from the other read operations.
+// Otherwise, they share the limit of read operations.
+func WithListRateLimit(opsPerSec float64, burst int) RateLimitOption {
+	return func(b *RateLimitedBucket) {
+		b.list = newLimiter(opsPerSec, burst)
+	}
+}
+
+// RateLimitClassStats describes the limit of one class of operations of a RateLimitedBucket.
+type RateLimitClassStats struct {
+	// Limit is the configured number of operations per second, +Inf if the class is not limited.
+	Limit float64
+	Burst int
+	// Waiting is the number of operations currently waiting for the limiter.
+	Waiting int64
+	// Admitted is the total number of operations which were let through.
+	Admitted int64
+}
+
+// RateLimitStats describes the limits of all classes of operations of a RateLimitedBucket. Read and List are the
+// same if listings are not limited separately.
+type RateLimitStats struct {
+	Read  RateLimitClassStats
+	Write RateLimitClassStats
+	List  RateLimitClassStats
+}
+
+// clock allows tests to control the time the limiters are based on.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// limiter limits the rate of one class of operations.
+type limiter struct {
+	*rate.Limiter
+
+	waiting  atomic.Int64
+	admitted atomic.Int64
+}
+
+// newLimiter returns a limiter of opsPerSec operations per second with bursts of up to burst operations. A burst
+// lower than 1 would never let any operation through, so it is treated as 1.
+func newLimiter(opsPerSec float64, burst int) *limiter {
+	if opsPerSec <= 0 {
+		return &limiter{Limiter: rate.NewLimiter(rate.Inf, burst)}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{Limiter: rate.NewLimiter(rate.Limit(opsPerSec), burst)}
+}
+
+func (l *limiter) stats() RateLimitClassStats {
+	limit := float64(l.Limit())
+	if l.Limit() == rate.Inf {
+		limit = math.Inf(1)
+	}
+	return RateLimitClassStats{Limit: limit, Burst: l.Burst(), Waiting: l.waiting.Load(), Admitted: l.admitted.Load()}
+}
+
+// WrapWithRateLimit returns a bucket which limits the rate of operations against bkt on the client side, e.g.
+// to keep concurrent compactors from running into the rate limits of the provider. Read and write operations
+// are limited separately, both to opsPerSec operations per second with bursts of up to burst operations, unless
+// overridden with WithReadRateLimit or WithWriteRateLimit. Listings can be limited separately from the other
+// reads with WithListRateLimit. A non-positive rate disables the limit, a burst lower than 1 is treated as 1.
+// Each call takes one token, regardless of how many requests the wrapped bucket sends to serve it. Calls block
+// until a token is available or the context is canceled, in which case the token is given back.
+// The time spent waiting is counted per operation and registered with reg, if not nil.
+func WrapWithRateLimit(bkt Bucket, opsPerSec float64, burst int, reg prometheus.Registerer, opts ...RateLimitOption) *RateLimitedBucket {
+	return wrapWithRateLimit(bkt, opsPerSec, burst, reg, realClock{}, opts...)
+}
+
+func wrapWithRateLimit(bkt Bucket, opsPerSec float64, burst int, reg prometheus.Registerer, c clock, opts ...RateLimitOption) *RateLimitedBucket {
+	b := &RateLimitedBucket{
+		bkt:   bkt,
+		clock: c,
+		read:  newLimiter(opsPerSec, burst),
+		write: newLimiter(opsPerSec, burst),
+		waitSeconds: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_bucket_operation_rate_limit_wait_seconds_total",
+			Help:        "Total time in seconds operations against a bucket waited for the client-side rate limiter.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}, []string{"operation"}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.list == nil {
+		b.list = b.read
+	}
+	for _, op := range []string{
+		OpIter,
+		OpGet,
+		OpGetRange,
+		OpExists,
+		OpUpload,
+		OpDelete,
+		OpAttributes,
+		OpCopy,
+	} {
+		b.waitSeconds.WithLabelValues(op)
+	}
+	return b
+}
+
+// RateLimitedBucket is a bucket wrapper which limits the rate of read, write and list operations, see
+// WrapWithRateLimit.
+type RateLimitedBucket struct {
+	bkt   Bucket
+	clock clock
+
+	read  *limiter
+	write *limiter
+	list  *limiter
+
+	waitSeconds *prometheus.CounterVec
+}
+
+// CurrentRates returns the limits of the bucket and the number of waiting and admitted operations of each class.
+func (b *RateLimitedBucket) CurrentRates() RateLimitStats {
+	return RateLimitStats{Read: b.read.stats(), Write: b.write.stats(), List: b.list.stats()}
+}
+
+// wait blocks until l allows one operation. If ctx is canceled first, its error is returned and the token is
+// given back.
+func (b *RateLimitedBucket) wait(ctx context.Context, l *limiter, op string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "wait for rate limiter")
+	}
+	now := b.clock.Now()
+	r := l.ReserveN(now, 1)
+	if !r.OK() {
+		return errors.New("rate limiter doesn't allow any operation")
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		l.waiting.Inc()
+		defer l.waiting.Dec()
+		select {
+		case <-ctx.Done():
+			end := b.clock.Now()
+			r.CancelAt(end)
+			b.waitSeconds.WithLabelValues(op).Add(end.Sub(now).Seconds())
+			return errors.Wrap(ctx.Err(), "wait for rate limiter")
+		case <-b.clock.After(delay):
+		}
+		b.waitSeconds.WithLabelValues(op).Add(delay.Seconds())
+	}
+	l.admitted.Inc()
+	return nil
+}
+
+func (b *RateLimitedBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	if err := b.wait(ctx, b.list, OpIter); err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *RateLimitedBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	if err := b.wait(ctx, b.list, OpIter); err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *RateLimitedBucket) SupportedIterOptions() []IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *RateLimitedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.wait(ctx, b.read, OpGet); err != nil {
+		return nil, err
+	}
+	return b.bkt.Get(ctx, name)
+}
+
+func (b *RateLimitedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.wait(ctx, b.read, OpGetRange); err != nil {
+		return nil, err
+	}
+	return b.bkt.GetRange(ctx, name, off, length)
+}
+
+func (b *RateLimitedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.wait(ctx, b.read, OpExists); err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *RateLimitedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	if err := b.wait(ctx, b.read, OpAttributes); err != nil {
+		return ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *RateLimitedBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	if err := b.wait(ctx, b.write, OpUpload); err != nil {
+		return err
+	}
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *RateLimitedBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	if err := b.wait(ctx, b.write, OpUpload); err != nil {
+		return false, err
+	}
+	return UploadIfNotExists(ctx, b.bkt, name, r)
+}
+
+func (b *RateLimitedBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	if err := b.wait(ctx, b.write, OpUpload); err != nil {
+		return err
+	}
+	return UploadIfMatch(ctx, b.bkt, name, r, etag, opts...)
+}
+
+func (b *RateLimitedBucket) Delete(ctx context.Context, name string) error {
+	if err := b.wait(ctx, b.write, OpDelete); err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *RateLimitedBucket) DeleteMany(ctx context.Context, names []string) error {
+	if err := b.wait(ctx, b.write, OpDelete); err != nil {
+		return err
+	}
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *RateLimitedBucket) Copy(ctx context.Context, src, dst string) error {
+	if err := b.wait(ctx, b.write, OpCopy); err != nil {
+		return err
+	}
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+func (b *RateLimitedBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *RateLimitedBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *RateLimitedBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RateLimitedBucket) Name() string {
+	return b.bkt.Name()
+}
@@ -0,0 +1,187 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestRateLimitedBucket_Acceptance(t *testing.T) {
+	AcceptanceTest(t, WrapWithRateLimit(NewInMemBucket(), 0, 0, nil))
+}
+
+func TestRateLimitedBucket(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithRateLimit(NewInMemBucket(), 1, 1, nil, WithWriteRateLimit(0, 0))
+
+	// Writes are not limited.
+	for i := 0; i < 3; i++ {
+		testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	}
+
+	// The first read uses up the burst, the second one has to wait for a new token.
+	_, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = bkt.Attributes(waitCtx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "would exceed context deadline"), "unexpected error: %v", err)
+
+	start := time.Now()
+	_, err = bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, time.Since(start) > 500*time.Millisecond, "expected read to wait for the rate limiter")
+	testutil.Assert(t, promtest.ToFloat64(bkt.waitSeconds.WithLabelValues(OpAttributes)) > 0.5)
+	testutil.Assert(t, promtest.ToFloat64(bkt.waitSeconds.WithLabelValues(OpUpload)) < 0.5)
+}
+
+func TestRateLimitedBucket_ZeroBurst(t *testing.T) {
+	ctx := context.Background()
+	bkt := WrapWithRateLimit(NewInMemBucket(), 100, 0, nil)
+
+	// A zero burst doesn't block all operations.
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	_, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+}
+
+// fakeClock is a clock which only moves forward when advanced.
+type fakeClock struct {
+	mtx     sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// delays returns the delays of the pending waiters, in increasing order.
+func (c *fakeClock) delays() []time.Duration {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var delays []time.Duration
+	for _, w := range c.waiters {
+		delays = append(delays, w.at.Sub(c.now))
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	return delays
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+func TestRateLimitedBucket_SpreadsCalls(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	bkt := wrapWithRateLimit(NewInMemBucket(), 0, 1, nil, clk, WithReadRateLimit(10, 1), WithListRateLimit(1, 1))
+
+	// Five calls submitted at once are spread over 400ms: the first one is let through right away,
+	// the others are admitted one every 100ms.
+	var g errgroup.Group
+	for i := 0; i < 5; i++ {
+		g.Go(func() error {
+			_, err := bkt.Exists(context.Background(), "obj")
+			return err
+		})
+	}
+	for len(clk.delays()) < 4 || bkt.CurrentRates().Read.Admitted < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	testutil.Equals(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 400 * time.Millisecond}, clk.delays())
+	testutil.Equals(t, RateLimitClassStats{Limit: 10, Burst: 1, Waiting: 4, Admitted: 1}, bkt.CurrentRates().Read)
+
+	clk.advance(250 * time.Millisecond)
+	testutil.Equals(t, []time.Duration{50 * time.Millisecond, 150 * time.Millisecond}, clk.delays())
+	clk.advance(150 * time.Millisecond)
+	testutil.Ok(t, g.Wait())
+	testutil.Equals(t, RateLimitClassStats{Limit: 10, Burst: 1, Waiting: 0, Admitted: 5}, bkt.CurrentRates().Read)
+	testutil.Assert(t, math.Abs(promtest.ToFloat64(bkt.waitSeconds.WithLabelValues(OpExists))-1) < 1e-9, "expected the calls to wait 1s in total")
+
+	// Classes are limited independently, writes are not limited at all.
+	testutil.Ok(t, bkt.Iter(context.Background(), "", func(string) error { return nil }))
+	testutil.Ok(t, bkt.Upload(context.Background(), "obj", strings.NewReader("content")))
+	testutil.Ok(t, bkt.Delete(context.Background(), "obj"))
+	stats := bkt.CurrentRates()
+	testutil.Equals(t, RateLimitClassStats{Limit: 1, Burst: 1, Admitted: 1}, stats.List)
+	testutil.Equals(t, RateLimitClassStats{Limit: math.Inf(1), Burst: 1, Admitted: 2}, stats.Write)
+}
+
+func TestRateLimitedBucket_ContextCanceled(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	bkt := wrapWithRateLimit(NewInMemBucket(), 0, 1, nil, clk, WithReadRateLimit(1, 1))
+
+	_, err := bkt.Exists(context.Background(), "obj")
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := bkt.Exists(ctx, "obj")
+		errc <- err
+	}()
+	for len(clk.delays()) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	err = <-errc
+	testutil.Assert(t, errors.Is(err, context.Canceled), "expected context canceled error, got %v", err)
+	testutil.Equals(t, int64(0), bkt.CurrentRates().Read.Waiting)
+
+	// The token of the canceled call is given back, so the next call waits for the same time.
+	clk.mtx.Lock()
+	clk.waiters = nil
+	clk.mtx.Unlock()
+	go func() {
+		_, err := bkt.Exists(context.Background(), "obj")
+		errc <- err
+	}()
+	for len(clk.delays()) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	testutil.Equals(t, []time.Duration{time.Second}, clk.delays())
+	clk.advance(time.Second)
+	testutil.Ok(t, <-errc)
+}
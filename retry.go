@@ -0,0 +1,569 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+)
+
+// RetryConfig configures the retry policy of a RetryBucket.
+type RetryConfig struct {
+	// InitialDelay is the time to wait before the first retry.
+	InitialDelay time.Duration
+	// Multiplier is the factor the delay is multiplied with after each retry.
+	Multiplier float64
+	// MaxDelay caps the time to wait between two attempts.
+	MaxDelay time.Duration
+	// MaxAttempts is the maximum number of attempts of an operation, including the first one.
+	MaxAttempts int
+	// Jitter randomizes each delay between half and the full computed delay, so that concurrent
+	// callers don't retry in lockstep.
+	Jitter bool
+	// IsTransientErr decides whether a failed operation should be retried. IsTransientErr is used if not set.
+	// Errors for which the wrapped bucket's IsObjNotFoundErr returns true are never retried.
+	IsTransientErr func(err error) bool
+	// MaxUploadBufferSize is the maximum number of bytes buffered in memory to be able to retry uploads
+	// from readers which don't implement io.Seeker. Larger uploads from such readers are attempted only once,
+	// as their content can't be read again. Zero disables buffering, so that all of them are attempted once.
+	MaxUploadBufferSize int64
+	// MaxReadResumes is the maximum number of times a reader returned by GetRange requests the rest of the range
+	// again after reading failed mid-stream, see NewResilientRangeReader. Zero disables resuming.
+	MaxReadResumes int
+}
+
+// DefaultRetryConfig is the default retry policy.
+var DefaultRetryConfig = RetryConfig{
+	InitialDelay: 100 * time.Millisecond,
+	Multiplier:   2,
+	MaxDelay:     10 * time.Second,
+	MaxAttempts:  5,
+	Jitter:       true,
+
+	MaxUploadBufferSize: 8 * 1024 * 1024,
+	MaxReadResumes:      3,
+}
+
+func (c RetryConfig) validate() error {
+	if c.InitialDelay < 0 {
+		return errors.New("initial delay must not be negative")
+	}
+	if c.Multiplier < 1 {
+		return errors.New("multiplier must be at least 1")
+	}
+	if c.MaxDelay < c.InitialDelay {
+		return errors.New("max delay must not be lower than initial delay")
+	}
+	if c.MaxAttempts < 1 {
+		return errors.New("max attempts must be at least 1")
+	}
+	if c.MaxUploadBufferSize < 0 {
+		return errors.New("max upload buffer size must not be negative")
+	}
+	if c.MaxReadResumes < 0 {
+		return errors.New("max read resumes must not be negative")
+	}
+	return nil
+}
+
+// IsTransientErr returns true for errors which are likely to go away when the operation is retried:
+// network timeouts, dropped connections and BucketErrors matching ErrThrottled or ErrUnavailable. It doesn't
+// inspect the errors of the provider SDKs, see the providers/retry package for a check which does.
+func IsTransientErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// Providers report throttling with other status codes as well, e.g. GCS with 403 and the rateLimitExceeded reason.
+	if errors.Is(err, ErrThrottled) || errors.Is(err, ErrUnavailable) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RetryBucket is a bucket wrapper which retries operations failing with a transient error.
+type RetryBucket struct {
+	bkt Bucket
+	cfg RetryConfig
+
+	retries *prometheus.CounterVec
+}
+
+// WrapWithRetry returns a new RetryBucket wrapping bkt with the given retry policy.
+// Retry attempts are counted per operation and registered with reg, if not nil.
+func WrapWithRetry(bkt Bucket, cfg RetryConfig, reg prometheus.Registerer) (*RetryBucket, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate retry config")
+	}
+	if cfg.IsTransientErr == nil {
+		cfg.IsTransientErr = IsTransientErr
+	}
+
+	b := &RetryBucket{
+		bkt: bkt,
+		cfg: cfg,
+		retries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "objstore_bucket_operation_retries_total",
+			Help:        "Total number of retried operations against a bucket.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}, []string{"operation"}),
+	}
+	for _, op := range []string{
+		OpIter,
+		OpGet,
+		OpGetRange,
+		OpExists,
+		OpUpload,
+		OpDelete,
+		OpAttributes,
+		OpCopy,
+	} {
+		b.retries.WithLabelValues(op)
+	}
+	return b, nil
+}
+
+// do calls f until it succeeds, fails with an error which is not transient, or the maximum number of attempts
+// is reached. Not found errors are never retried. Before each retry, canRetry is consulted, if not nil.
+func (b *RetryBucket) do(ctx context.Context, op string, canRetry func() bool, f func() error) error {
+	delay := b.cfg.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= b.cfg.MaxAttempts || !b.cfg.IsTransientErr(err) || b.bkt.IsObjNotFoundErr(err) {
+			return err
+		}
+		if canRetry != nil && !canRetry() {
+			return err
+		}
+
+		wait := delay
+		if b.cfg.Jitter && wait > 0 {
+			wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		delay = time.Duration(math.Min(float64(delay)*b.cfg.Multiplier, float64(b.cfg.MaxDelay)))
+		b.retries.WithLabelValues(op).Inc()
+	}
+}
+
+// Iter calls f for each entry in the given directory. Iteration is only retried if f was not called yet,
+// so that entries are never passed to f twice.
+func (b *RetryBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	called := false
+	return b.do(ctx, OpIter, func() bool { return !called }, func() error {
+		return b.bkt.Iter(ctx, dir, func(name string) error {
+			called = true
+			return f(name)
+		}, options...)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter.
+// Iteration is only retried if f was not called yet, so that entries are never passed to f twice.
+func (b *RetryBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs IterObjectAttributes) error, options ...IterOption) error {
+	called := false
+	return b.do(ctx, OpIter, func() bool { return !called }, func() error {
+		return b.bkt.IterWithAttributes(ctx, dir, func(attrs IterObjectAttributes) error {
+			called = true
+			return f(attrs)
+		}, options...)
+	})
+}
+
+func (b *RetryBucket) SupportedIterOptions() []IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+// Get returns a reader for the given object name. Only opening the reader is retried.
+func (b *RetryBucket) Get(ctx context.Context, name string) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, OpGet, nil, func() error {
+		rc, err = b.bkt.Get(ctx, name)
+		return err
+	})
+	return rc, err
+}
+
+// GetRange returns a new range reader for the given object name and range. Opening the reader is retried, and
+// reading is resumed at the first unread offset if it fails mid-stream, up to MaxReadResumes times. Suffix
+// ranges are not resumed.
+func (b *RetryBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if b.cfg.MaxReadResumes == 0 || off < 0 {
+		return b.getRange(ctx, name, off, length)
+	}
+	return NewResilientRangeReader(ctx, &resumingBucket{RetryBucket: b}, name, off, length, b.cfg.MaxReadResumes)
+}
+
+func (b *RetryBucket) getRange(ctx context.Context, name string, off, length int64) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, OpGetRange, nil, func() error {
+		rc, err = b.bkt.GetRange(ctx, name, off, length)
+		return err
+	})
+	return rc, err
+}
+
+// resumingBucket opens the ranges of a resilient range reader, counting each range opened after the first one
+// as a retry.
+type resumingBucket struct {
+	*RetryBucket
+	opened bool
+}
+
+func (b *resumingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if b.opened {
+		b.retries.WithLabelValues(OpGetRange).Inc()
+	}
+	b.opened = true
+	return b.getRange(ctx, name, off, length)
+}
+
+func (b *RetryBucket) Exists(ctx context.Context, name string) (exists bool, err error) {
+	err = b.do(ctx, OpExists, nil, func() error {
+		exists, err = b.bkt.Exists(ctx, name)
+		return err
+	})
+	return exists, err
+}
+
+func (b *RetryBucket) Attributes(ctx context.Context, name string) (attrs ObjectAttributes, err error) {
+	err = b.do(ctx, OpAttributes, nil, func() error {
+		attrs, err = b.bkt.Attributes(ctx, name)
+		return err
+	})
+	return attrs, err
+}
+
+// Upload the contents of the reader as an object into the bucket. The upload is only retried if r
+// implements io.Seeker, so that it can be rewound to where the first attempt started reading, or if
+// it is small enough to be buffered in memory according to RetryConfig.MaxUploadBufferSize. Uploads from
+// readers which are neither seekable nor small enough are attempted exactly once, and the error of that
+// attempt is returned even if it is transient; pass an io.ReadSeeker to have such uploads retried.
+func (b *RetryBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		buffered, err := b.bufferUpload(r)
+		if err != nil {
+			return err
+		}
+		if seeker, ok = buffered.(io.Seeker); !ok {
+			return b.bkt.Upload(ctx, name, buffered, opts...)
+		}
+		r = buffered
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return b.bkt.Upload(ctx, name, r, opts...)
+	}
+
+	first := true
+	return b.do(ctx, OpUpload, nil, func() error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return errors.Wrap(err, "rewind reader")
+			}
+		}
+		first = false
+		return b.bkt.Upload(ctx, name, r, opts...)
+	})
+}
+
+// bufferUpload reads r into memory if it is not larger than RetryConfig.MaxUploadBufferSize, so that the upload
+// can be retried. Otherwise, it returns a reader which yields the entire content of r.
+func (b *RetryBucket) bufferUpload(r io.Reader) (io.Reader, error) {
+	if b.cfg.MaxUploadBufferSize == 0 {
+		return r, nil
+	}
+	if size, err := TryToGetSize(r); err == nil && size > b.cfg.MaxUploadBufferSize {
+		return r, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r, b.cfg.MaxUploadBufferSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "buffer upload")
+	}
+	if int64(len(buf)) > b.cfg.MaxUploadBufferSize {
+		return io.MultiReader(bytes.NewReader(buf), r), nil
+	}
+	return bytes.NewReader(buf), nil
+}
+
+func (b *RetryBucket) Delete(ctx context.Context, name string) error {
+	return b.do(ctx, OpDelete, nil, func() error {
+		return b.bkt.Delete(ctx, name)
+	})
+}
+
+// DeleteMany removes the objects with the given names. After a partial failure, only the objects which
+// failed with a transient error are retried.
+func (b *RetryBucket) DeleteMany(ctx context.Context, names []string) error {
+	var (
+		pending     = names
+		objErrs     = map[string]error{}
+		lastPartial bool
+	)
+	err := b.do(ctx, OpDelete, nil, func() error {
+		err := b.bkt.DeleteMany(ctx, pending)
+		var res *BatchDeleteResult
+		if lastPartial = errors.As(err, &res); !lastPartial {
+			return err
+		}
+
+		var retry []string
+		var transientErr error
+		for name, objErr := range res.Errors {
+			objErrs[name] = objErr
+			if b.cfg.IsTransientErr(objErr) {
+				retry = append(retry, name)
+				transientErr = objErr
+			}
+		}
+		pending = retry
+		return transientErr
+	})
+	if len(objErrs) == 0 {
+		return err
+	}
+
+	res := &BatchDeleteResult{Errors: map[string]error{}}
+	for name, objErr := range objErrs {
+		if !b.cfg.IsTransientErr(objErr) {
+			res.Errors[name] = objErr
+		}
+	}
+	if err != nil {
+		for _, name := range pending {
+			if lastPartial {
+				res.Errors[name] = objErrs[name]
+			} else {
+				res.Errors[name] = err
+			}
+		}
+	}
+	return res.Err()
+}
+
+func (b *RetryBucket) Copy(ctx context.Context, src, dst string) error {
+	return b.do(ctx, OpCopy, nil, func() error {
+		return b.bkt.Copy(ctx, src, dst)
+	})
+}
+
+func (b *RetryBucket) CopyFromBucket(ctx context.Context, src Bucket, srcName, dstName string) error {
+	return b.do(ctx, OpCopy, nil, func() error {
+		return CopyFromBucket(ctx, src, b.bkt, srcName, dstName)
+	})
+}
+
+// CopyWithAttributes copies the object like Copy and replaces its attributes, retrying like Copy.
+func (b *RetryBucket) CopyWithAttributes(ctx context.Context, src, dst string, attrs CopyObjectAttributes) error {
+	return b.do(ctx, OpCopy, nil, func() error {
+		return CopyWithAttributes(ctx, b.bkt, src, dst, attrs)
+	})
+}
+
+// SupportedCopy returns true if the wrapped bucket copies objects server-side.
+func (b *RetryBucket) SupportedCopy() bool {
+	if c, ok := b.bkt.(ServerSideCopier); ok {
+		return c.SupportedCopy()
+	}
+	return false
+}
+
+// Rename is not retried, as the source object may be gone after an attempt which failed once the object
+// was moved.
+func (b *RetryBucket) Rename(ctx context.Context, src, dst string) error {
+	return Rename(ctx, b.bkt, src, dst)
+}
+
+// UploadIfNotExists is not retried, as a retry can't tell whether the object was uploaded by a failed
+// attempt or by another client.
+func (b *RetryBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	return UploadIfNotExists(ctx, b.bkt, name, r)
+}
+
+// UploadIfMatch is not retried, as the ETag of the object changes once an attempt uploaded it, even if
+// the attempt failed afterwards.
+func (b *RetryBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	return UploadIfMatch(ctx, b.bkt, name, r, etag, opts...)
+}
+
+func (b *RetryBucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...ObjectUploadOption) error {
+	return b.do(ctx, OpUpload, nil, func() error {
+		return UpdateMetadata(ctx, b.bkt, name, md, opts...)
+	})
+}
+
+func (b *RetryBucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) error {
+	return b.do(ctx, OpUpload, nil, func() error {
+		return SetObjectTags(ctx, b.bkt, name, tags)
+	})
+}
+
+func (b *RetryBucket) GetObjectTags(ctx context.Context, name string) (tags map[string]string, err error) {
+	err = b.do(ctx, OpAttributes, nil, func() error {
+		tags, err = GetObjectTags(ctx, b.bkt, name)
+		return err
+	})
+	return tags, err
+}
+
+func (b *RetryBucket) DeleteObjectTags(ctx context.Context, name string) error {
+	return b.do(ctx, OpUpload, nil, func() error {
+		return DeleteObjectTags(ctx, b.bkt, name)
+	})
+}
+
+func (b *RetryBucket) ListVersions(ctx context.Context, name string) (versions []VersionInfo, err error) {
+	err = b.do(ctx, OpIter, nil, func() error {
+		versions, err = ListVersions(ctx, b.bkt, name)
+		return err
+	})
+	return versions, err
+}
+
+// IterVersions calls f for each version of the objects with the given prefix. Iteration is only retried if f
+// was not called yet, so that versions are never passed to f twice.
+func (b *RetryBucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) error {
+	called := false
+	return b.do(ctx, OpIter, func() bool { return !called }, func() error {
+		return IterVersions(ctx, b.bkt, prefix, func(name, version string, isLatest bool, deleted bool) error {
+			called = true
+			return f(name, version, isLatest, deleted)
+		})
+	})
+}
+
+// GetVersion returns a reader for the given version of the object. Only opening the reader is retried.
+func (b *RetryBucket) GetVersion(ctx context.Context, name, versionID string) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, OpGet, nil, func() error {
+		rc, err = GetVersion(ctx, b.bkt, name, versionID)
+		return err
+	})
+	return rc, err
+}
+
+func (b *RetryBucket) DeleteVersion(ctx context.Context, name, versionID string) error {
+	return b.do(ctx, OpDelete, nil, func() error {
+		return DeleteVersion(ctx, b.bkt, name, versionID)
+	})
+}
+
+// RestoreVersion is not retried, as each attempt which reached the provider may create a new version.
+func (b *RetryBucket) RestoreVersion(ctx context.Context, name, versionID string) error {
+	return RestoreVersion(ctx, b.bkt, name, versionID)
+}
+
+// GetWithOptions returns a reader for the given object name. Only opening the reader is retried.
+func (b *RetryBucket) GetWithOptions(ctx context.Context, name string, opts ...ObjectGetOption) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, OpGet, nil, func() error {
+		rc, err = GetWithOptions(ctx, b.bkt, name, opts...)
+		return err
+	})
+	return rc, err
+}
+
+// GetRangeWithOptions returns a new range reader for the given object name and range. Unlike GetRange, only
+// opening the reader is retried.
+func (b *RetryBucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...ObjectGetOption) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, OpGetRange, nil, func() error {
+		rc, err = GetRangeWithOptions(ctx, b.bkt, name, off, length, opts...)
+		return err
+	})
+	return rc, err
+}
+
+// GetWithAttributes returns a reader for the given object name and its attributes. Only opening the reader
+// is retried.
+func (b *RetryBucket) GetWithAttributes(ctx context.Context, name string) (rc io.ReadCloser, attrs ObjectAttributes, err error) {
+	err = b.do(ctx, OpGet, nil, func() error {
+		rc, attrs, err = GetWithAttributes(ctx, b.bkt, name)
+		return err
+	})
+	return rc, attrs, err
+}
+
+func (b *RetryBucket) Stat(ctx context.Context, name string) (attrs ObjectAttributes, exists bool, err error) {
+	err = b.do(ctx, OpAttributes, nil, func() error {
+		attrs, exists, err = Stat(ctx, b.bkt, name)
+		return err
+	})
+	return attrs, exists, err
+}
+
+// IterParallel calls f for each entry in the given directory like IterWithAttributes. If the wrapped bucket
+// doesn't implement ParallelIterator, the listing and the requests of the attributes are retried separately.
+func (b *RetryBucket) IterParallel(ctx context.Context, dir string, f func(IterObjectAttributes) error, concurrency int, ordered bool, options ...IterOption) error {
+	p, ok := b.bkt.(ParallelIterator)
+	if !ok {
+		return iterParallel(ctx, b, dir, f, concurrency, ordered, options...)
+	}
+	var called atomic.Bool
+	return b.do(ctx, OpIter, func() bool { return !called.Load() }, func() error {
+		return p.IterParallel(ctx, dir, func(attrs IterObjectAttributes) error {
+			called.Store(true)
+			return f(attrs)
+		}, concurrency, ordered, options...)
+	})
+}
+
+func (b *RetryBucket) Ping(ctx context.Context) error {
+	return b.do(ctx, OpAttributes, nil, func() error {
+		return Ping(ctx, b.bkt)
+	})
+}
+
+func (b *RetryBucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return PresignedGetURL(ctx, b.bkt, name, expiry)
+}
+
+func (b *RetryBucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return PresignPut(ctx, b.bkt, name, expiry)
+}
+
+// NewMultipartUpload starts a multipart upload through the wrapped bucket. Its parts are not retried.
+func (b *RetryBucket) NewMultipartUpload(ctx context.Context, name string, opts ...ObjectUploadOption) (MultipartWriter, error) {
+	return NewMultipartUpload(ctx, b.bkt, name, opts...)
+}
+
+func (b *RetryBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *RetryBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *RetryBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RetryBucket) Name() string {
+	return b.bkt.Name()
+}
+
+func (b *RetryBucket) WrappedBucket() Bucket {
+	return b.bkt
+}
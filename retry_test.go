@@ -0,0 +1,426 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var errTransient = errors.New("transient error")
+
+// flakyBucket fails the first failures calls of each operation with err.
+type flakyBucket struct {
+	Bucket
+
+	failures int
+	err      error
+	calls    map[string]int
+}
+
+func newFlakyBucket(failures int, err error) *flakyBucket {
+	return &flakyBucket{Bucket: NewInMemBucket(), failures: failures, err: err, calls: map[string]int{}}
+}
+
+func (b *flakyBucket) fail(op string) error {
+	b.calls[op]++
+	if b.calls[op] <= b.failures {
+		return b.err
+	}
+	return nil
+}
+
+func (b *flakyBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	if err := b.Bucket.Iter(ctx, dir, f, options...); err != nil {
+		return err
+	}
+	return b.fail(OpIter)
+}
+
+func (b *flakyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.fail(OpGet); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b *flakyBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	// Consume the reader before failing, like a failed request would.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := b.fail(OpUpload); err != nil {
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, bytes.NewReader(body), opts...)
+}
+
+func testRetryConfig() RetryConfig {
+	return RetryConfig{
+		InitialDelay:   time.Millisecond,
+		Multiplier:     2,
+		MaxDelay:       5 * time.Millisecond,
+		MaxAttempts:    3,
+		Jitter:         true,
+		IsTransientErr: func(err error) bool { return err == errTransient },
+	}
+}
+
+func TestRetryBucket_Get(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		inner := newFlakyBucket(2, errTransient)
+		testutil.Ok(t, inner.Bucket.Upload(ctx, "obj", strings.NewReader("content")))
+
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		rc, err := bkt.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, "content", string(content))
+		testutil.Equals(t, 3, inner.calls[OpGet])
+		testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.retries.WithLabelValues(OpGet)))
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		inner := newFlakyBucket(5, errTransient)
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		_, err = bkt.Get(ctx, "obj")
+		testutil.Equals(t, errTransient, err)
+		testutil.Equals(t, 3, inner.calls[OpGet])
+	})
+
+	t.Run("does not retry not found errors", func(t *testing.T) {
+		inner := newFlakyBucket(0, nil)
+		cfg := testRetryConfig()
+		cfg.IsTransientErr = func(error) bool { return true }
+		bkt, err := WrapWithRetry(inner, cfg, nil)
+		testutil.Ok(t, err)
+
+		_, err = bkt.Get(ctx, "missing")
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+		testutil.Equals(t, 1, inner.calls[OpGet])
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		permanent := errors.New("permanent error")
+		inner := newFlakyBucket(5, permanent)
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		_, err = bkt.Get(ctx, "obj")
+		testutil.Equals(t, permanent, err)
+		testutil.Equals(t, 1, inner.calls[OpGet])
+	})
+}
+
+// droppingBucket returns range readers which fail with errTransient after reading n bytes.
+type droppingBucket struct {
+	Bucket
+
+	n int64
+}
+
+func (b droppingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(rc, b.n), iotest.ErrReader(errTransient)), rc}, nil
+}
+
+func TestRetryBucket_GetRange(t *testing.T) {
+	ctx := context.Background()
+	inner := droppingBucket{Bucket: NewInMemBucket(), n: 3}
+	testutil.Ok(t, inner.Upload(ctx, "obj", strings.NewReader("0123456789")))
+
+	cfg := testRetryConfig()
+	cfg.MaxReadResumes = 2
+	bkt, err := WrapWithRetry(inner, cfg, nil)
+	testutil.Ok(t, err)
+
+	rc, err := bkt.GetRange(ctx, "obj", 1, 8)
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "12345678", string(content))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.retries.WithLabelValues(OpGetRange)))
+
+	// Reading fails once the range was resumed MaxReadResumes times.
+	rc, err = bkt.GetRange(ctx, "obj", 0, -1)
+	testutil.Ok(t, err)
+	content, err = io.ReadAll(rc)
+	testutil.Equals(t, errTransient, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "012345678", string(content))
+}
+
+func TestRetryBucket_GetRange_PastEnd(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	testutil.Ok(t, inner.Upload(ctx, "obj", strings.NewReader("0123456789")))
+
+	bkt, err := WrapWithRetry(inner, DefaultRetryConfig, nil)
+	testutil.Ok(t, err)
+
+	rc, err := bkt.GetRange(ctx, "obj", 5, 100)
+	testutil.Ok(t, err)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "56789", string(content))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.retries.WithLabelValues(OpGetRange)))
+}
+
+func TestRetryBucket_Upload(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rewinds seekable reader", func(t *testing.T) {
+		inner := newFlakyBucket(2, errTransient)
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+		testutil.Equals(t, 3, inner.calls[OpUpload])
+
+		rc, err := inner.Bucket.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, "content", string(content))
+	})
+
+	t.Run("does not retry non seekable reader", func(t *testing.T) {
+		inner := newFlakyBucket(2, errTransient)
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, errTransient, bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("content"))))
+		testutil.Equals(t, 1, inner.calls[OpUpload])
+	})
+
+	t.Run("buffers small non seekable reader", func(t *testing.T) {
+		inner := newFlakyBucket(2, errTransient)
+		cfg := testRetryConfig()
+		cfg.MaxUploadBufferSize = 7
+		bkt, err := WrapWithRetry(inner, cfg, nil)
+		testutil.Ok(t, err)
+
+		testutil.Ok(t, bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("content"))))
+		testutil.Equals(t, 3, inner.calls[OpUpload])
+
+		rc, err := inner.Bucket.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, "content", string(content))
+	})
+
+	t.Run("does not retry large non seekable reader", func(t *testing.T) {
+		inner := newFlakyBucket(1, errTransient)
+		cfg := testRetryConfig()
+		cfg.MaxUploadBufferSize = 6
+		bkt, err := WrapWithRetry(inner, cfg, nil)
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, errTransient, bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("content"))))
+		testutil.Equals(t, 1, inner.calls[OpUpload])
+
+		// The whole content is passed on, including the part read while trying to buffer it.
+		testutil.Ok(t, bkt.Upload(ctx, "obj", io.MultiReader(strings.NewReader("content"))))
+		rc, err := inner.Bucket.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, "content", string(content))
+	})
+}
+
+func TestRetryBucket_Iter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries if no entries were passed", func(t *testing.T) {
+		inner := newFlakyBucket(2, errTransient)
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+		testutil.Equals(t, 3, inner.calls[OpIter])
+	})
+
+	t.Run("does not retry once entries were passed", func(t *testing.T) {
+		inner := newFlakyBucket(2, errTransient)
+		testutil.Ok(t, inner.Bucket.Upload(ctx, "obj", strings.NewReader("content")))
+		bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+		testutil.Ok(t, err)
+
+		var seen []string
+		testutil.Equals(t, errTransient, bkt.Iter(ctx, "", func(name string) error {
+			seen = append(seen, name)
+			return nil
+		}))
+		testutil.Equals(t, []string{"obj"}, seen)
+		testutil.Equals(t, 1, inner.calls[OpIter])
+	})
+}
+
+// flakyBatchDeleter fails to delete the objects in transient once with errTransient and never deletes
+// the objects in permanent.
+type flakyBatchDeleter struct {
+	Bucket
+
+	transient, permanent map[string]bool
+	batches              [][]string
+}
+
+func (b *flakyBatchDeleter) DeleteMany(_ context.Context, names []string) error {
+	b.batches = append(b.batches, names)
+	res := &BatchDeleteResult{Errors: map[string]error{}}
+	for _, name := range names {
+		switch {
+		case b.transient[name]:
+			b.transient[name] = false
+			res.Errors[name] = errTransient
+		case b.permanent[name]:
+			res.Errors[name] = errors.New("permanent error")
+		}
+	}
+	return res.Err()
+}
+
+func TestRetryBucket_DeleteMany(t *testing.T) {
+	inner := &flakyBatchDeleter{
+		Bucket:    NewInMemBucket(),
+		transient: map[string]bool{"obj1": true},
+		permanent: map[string]bool{"obj2": true},
+	}
+	bkt, err := WrapWithRetry(inner, testRetryConfig(), nil)
+	testutil.Ok(t, err)
+
+	err = bkt.DeleteMany(context.Background(), []string{"obj1", "obj2", "obj3"})
+	testutil.Assert(t, IsBatchDeletePartialErr(err), "expected partial error, got %v", err)
+	testutil.Equals(t, "failed to delete 1 objects: obj2: permanent error", err.Error())
+
+	// Only the object which failed with a transient error is retried.
+	testutil.Equals(t, [][]string{{"obj1", "obj2", "obj3"}, {"obj1"}}, inner.batches)
+}
+
+// flakyTagger fails the first failures requests of object tags like flakyBucket.
+type flakyTagger struct {
+	*flakyBucket
+}
+
+func (b flakyTagger) SetObjectTags(ctx context.Context, name string, tags map[string]string) error {
+	return SetObjectTags(ctx, b.Bucket, name, tags)
+}
+
+func (b flakyTagger) GetObjectTags(ctx context.Context, name string) (map[string]string, error) {
+	if err := b.fail("tags"); err != nil {
+		return nil, err
+	}
+	return GetObjectTags(ctx, b.Bucket, name)
+}
+
+func (b flakyTagger) DeleteObjectTags(ctx context.Context, name string) error {
+	return DeleteObjectTags(ctx, b.Bucket, name)
+}
+
+func TestRetryBucket_Acceptance(t *testing.T) {
+	bkt, err := WrapWithRetry(NewInMemBucket(), testRetryConfig(), nil)
+	testutil.Ok(t, err)
+	AcceptanceTest(t, bkt)
+}
+
+func TestRetryBucket_OptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyBucket(2, errTransient)
+	bkt, err := WrapWithRetry(flakyTagger{flakyBucket: inner}, testRetryConfig(), nil)
+	testutil.Ok(t, err)
+
+	// The optional interfaces of the wrapped bucket are forwarded and retried.
+	testutil.Assert(t, SupportsTagger(bkt))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Ok(t, SetObjectTags(ctx, bkt, "obj", map[string]string{"k": "v"}))
+	tags, err := GetObjectTags(ctx, bkt, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"k": "v"}, tags)
+	testutil.Equals(t, 3, inner.calls["tags"])
+
+	// Optional interfaces which the wrapped bucket doesn't implement are reported as not supported.
+	testutil.Assert(t, !IsRenameSupported(bkt))
+	testutil.Assert(t, !IsVersionedBucket(bkt))
+	testutil.Equals(t, ErrRenameNotSupported, Rename(ctx, bkt, "obj", "renamed"))
+	_, err = ListVersions(ctx, bkt, "obj")
+	testutil.Equals(t, ErrVersioningNotSupported, err)
+}
+
+func TestRetryBucket_CanceledContext(t *testing.T) {
+	inner := newFlakyBucket(2, errTransient)
+	cfg := testRetryConfig()
+	cfg.InitialDelay, cfg.MaxDelay = time.Hour, time.Hour
+	bkt, err := WrapWithRetry(inner, cfg, nil)
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = bkt.Get(ctx, "obj")
+	testutil.Equals(t, errTransient, err)
+	testutil.Equals(t, 1, inner.calls[OpGet])
+}
+
+func TestWrapWithRetry_InvalidConfig(t *testing.T) {
+	for _, cfg := range []RetryConfig{
+		{InitialDelay: -time.Second, Multiplier: 2, MaxDelay: time.Second, MaxAttempts: 1},
+		{InitialDelay: time.Second, Multiplier: 0.5, MaxDelay: time.Second, MaxAttempts: 1},
+		{InitialDelay: time.Second, Multiplier: 2, MaxDelay: time.Millisecond, MaxAttempts: 1},
+		{InitialDelay: time.Second, Multiplier: 2, MaxDelay: time.Second, MaxAttempts: 0},
+		{InitialDelay: time.Second, Multiplier: 2, MaxDelay: time.Second, MaxAttempts: 1, MaxUploadBufferSize: -1},
+		{InitialDelay: time.Second, Multiplier: 2, MaxDelay: time.Second, MaxAttempts: 1, MaxReadResumes: -1},
+	} {
+		_, err := WrapWithRetry(NewInMemBucket(), cfg, nil)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestIsTransientErr(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: errors.New("some error"), expected: false},
+		{err: context.Canceled, expected: false},
+		{err: errors.Wrap(io.ErrUnexpectedEOF, "read"), expected: true},
+		{err: NewBucketError(OpGet, "obj", "503", ErrorKindFromHTTPStatus(http.StatusServiceUnavailable), errors.New("unavailable")), expected: true},
+		{err: NewBucketError(OpGet, "obj", "NoSuchKey", ErrKindNotFound, errors.New("not found")), expected: false},
+		{err: NewBucketError(OpGet, "obj", "rateLimitExceeded", ErrKindRateLimit, errors.New("rate limit exceeded")), expected: true},
+		{err: NewBucketError(OpGet, "obj", "403", ErrKindPermissionDenied, errors.New("forbidden")), expected: false},
+	} {
+		testutil.Equals(t, tc.expected, IsTransientErr(tc.err), "error: %v", tc.err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/thanos-io/objstore/client"
 	"github.com/thanos-io/objstore/providers/azure"
+	"github.com/thanos-io/objstore/providers/b2"
 	"github.com/thanos-io/objstore/providers/bos"
 	"github.com/thanos-io/objstore/providers/cos"
 	"github.com/thanos-io/objstore/providers/filesystem"
@@ -20,6 +21,7 @@ import (
 	"github.com/thanos-io/objstore/providers/obs"
 	"github.com/thanos-io/objstore/providers/oci"
 	"github.com/thanos-io/objstore/providers/oss"
+	"github.com/thanos-io/objstore/providers/r2"
 	"github.com/thanos-io/objstore/providers/s3"
 	"github.com/thanos-io/objstore/providers/swift"
 
@@ -46,6 +48,8 @@ var (
 		client.BOS:        bos.Config{},
 		client.OCI:        oci.Config{},
 		client.OBS:        obs.DefaultConfig,
+		client.B2:         b2.DefaultConfig,
+		client.R2:         r2.DefaultConfig,
 	}
 )
 
@@ -28,6 +28,7 @@ import (
 
 	"github.com/thanos-io/objstore/client"
 	"github.com/thanos-io/objstore/exthttp"
+	"github.com/thanos-io/objstore/providers/gcs"
 	"github.com/thanos-io/objstore/providers/s3"
 )
 
@@ -438,6 +439,33 @@ func NewMinio(e e2e.Environment, name, bktName string) *e2emon.InstrumentedRunna
 	return minio
 }
 
+// NewFakeGCSServer returns a fake-gcs-server, used as a local replacement for GCS. It serves HTTPS with a
+// self-signed certificate and does not authenticate requests.
+func NewFakeGCSServer(e e2e.Environment, name, bktName string) *e2emon.InstrumentedRunnable {
+	httpsPort := 4443
+	f := e.Runnable(fmt.Sprintf("fake-gcs-server-%s", name)).
+		WithPorts(map[string]int{"https": httpsPort}).
+		Future()
+
+	return e2emon.AsInstrumented(f.Init(e2e.StartOptions{
+		Image: "docker.io/fsouza/fake-gcs-server:1.47.4",
+		// Create the required bucket before starting the server.
+		Command:   e2e.NewCommandWithoutEntrypoint("sh", "-c", fmt.Sprintf("mkdir -p /data/%s && /bin/fake-gcs-server -data /data -scheme https -port %d", bktName, httpsPort)),
+		Readiness: e2e.NewHTTPSReadinessProbe("https", "/storage/v1/b", 200, 200),
+	}), "https")
+}
+
+// NewGCSConfig returns the config of a bucket of a fake-gcs-server listening on the given endpoint.
+func NewGCSConfig(bucket, endpoint string) gcs.Config {
+	return gcs.Config{
+		Bucket:         bucket,
+		Endpoint:       "https://" + endpoint + "/storage/v1/",
+		NoAuth:         true,
+		ChunkSizeBytes: -1,
+		HTTPConfig:     exthttp.HTTPConfig{InsecureSkipVerify: true},
+	}
+}
+
 func NewMemcached(e e2e.Environment, name string) *e2emon.InstrumentedRunnable {
 	return e2emon.AsInstrumented(e.Runnable(fmt.Sprintf("memcached-%s", name)).
 		WithPorts(map[string]int{"memcached": 11211}).
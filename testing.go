@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
 )
 
 func CreateTemporaryTestBucketName(t testing.TB) string {
@@ -30,6 +32,7 @@ func CreateTemporaryTestBucketName(t testing.TB) string {
 }
 
 // EmptyBucket deletes all objects from bucket. This operation is required to properly delete bucket as a whole.
+// In versioned buckets, all versions of the objects are deleted as well.
 // It is used for testing only.
 // TODO(bplotka): Add retries.
 func EmptyBucket(t testing.TB, ctx context.Context, bkt Bucket) {
@@ -62,6 +65,40 @@ func EmptyBucket(t testing.TB, ctx context.Context, bkt Bucket) {
 		}
 	}
 	wg.Wait()
+
+	deleteVersions(t, ctx, bkt)
+}
+
+// deleteVersions deletes all versions of all objects in a versioned bucket, including the delete markers left by
+// deleting the current versions and the versions of objects which were deleted before, which Iter doesn't list.
+func deleteVersions(t testing.TB, ctx context.Context, bkt Bucket) {
+	type version struct{ name, id string }
+
+	var versions []version
+	err := IterVersions(ctx, bkt, "", func(name, id string, _, _ bool) error {
+		versions = append(versions, version{name: name, id: id})
+		return nil
+	})
+	if errors.Is(err, ErrVersioningNotSupported) {
+		return
+	}
+	if err != nil {
+		t.Logf("iterating over bucket object versions failed: %s", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, v := range versions {
+		v := v
+		wg.Add(1)
+		go func() {
+			if err := DeleteVersion(ctx, bkt, v.name, v.id); err != nil {
+				t.Logf("deleting version %s of object %s failed: %s", v.id, v.name, err)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
 }
 
 func WithNoopInstr(bkt Bucket) InstrumentedBucket {
@@ -99,6 +136,10 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	testutil.NotOk(t, err)
 	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
 
+	_, ok, err = Stat(ctx, bkt, "id1/obj_1.some")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected not exits")
+
 	// Upload first object.
 	testutil.Ok(t, bkt.Upload(ctx, "id1/obj_1.some", strings.NewReader("@test-data@")))
 
@@ -115,6 +156,14 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	testutil.Ok(t, err)
 	testutil.Assert(t, attrs.Size == 11, "expected size to be equal to 11")
 
+	// Stat returns the same attributes.
+	statAttrs, ok, err := Stat(ctx, bkt, "id1/obj_1.some")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected exists")
+	testutil.Equals(t, attrs.Size, statAttrs.Size)
+	testutil.Equals(t, attrs.ETag, statAttrs.ETag)
+	testutil.Assert(t, attrs.LastModified.Equal(statAttrs.LastModified), "expected last modification time %v, got %v", attrs.LastModified, statAttrs.LastModified)
+
 	rc2, err := bkt.GetRange(ctx, "id1/obj_1.some", 1, 3)
 	testutil.Ok(t, err)
 	defer func() { testutil.Ok(t, rc2.Close()) }()
@@ -213,6 +262,236 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	}, WithRecursiveIter))
 	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some", "id1/sub/subobj_1.some", "id1/sub/subobj_2.some"}, seen)
 
+	// Can we iter over items from id1 dir with attributes?
+	var (
+		etagSupported         bool
+		sizeSupported         bool
+		lastModifiedSupported bool
+		createdAtSupported    bool
+		options               []IterOption
+	)
+	for _, opt := range bkt.SupportedIterOptions() {
+		switch opt {
+		case ETag:
+			etagSupported = true
+			options = append(options, WithETag)
+		case Size:
+			sizeSupported = true
+			options = append(options, WithSize)
+		case UpdatedAt:
+			lastModifiedSupported = true
+			options = append(options, WithUpdatedAt)
+		case CreatedAt:
+			createdAtSupported = true
+			options = append(options, WithCreatedAt)
+		}
+	}
+	seen = []string{}
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+		seen = append(seen, attrs.Name)
+		if etagSupported && !strings.HasSuffix(attrs.Name, DirDelim) {
+			testutil.Assert(t, attrs.ETag() != "", "expected ETag for %s", attrs.Name)
+		}
+		size, ok := attrs.Size()
+		if sizeSupported && !strings.HasSuffix(attrs.Name, DirDelim) {
+			testutil.Assert(t, ok, "expected size for %s", attrs.Name)
+			objAttrs, err := bkt.Attributes(ctx, attrs.Name)
+			testutil.Ok(t, err)
+			testutil.Equals(t, objAttrs.Size, size)
+		} else {
+			testutil.Assert(t, !ok, "unexpected size for %s", attrs.Name)
+		}
+		lastModified, ok := attrs.LastModified()
+		if lastModifiedSupported && !strings.HasSuffix(attrs.Name, DirDelim) {
+			testutil.Assert(t, ok, "expected last modification time for %s", attrs.Name)
+			testutil.Assert(t, time.Since(lastModified) < time.Hour, "unexpected last modification time %v for %s", lastModified, attrs.Name)
+		} else {
+			testutil.Assert(t, !ok, "unexpected last modification time for %s", attrs.Name)
+		}
+		createdAt, ok := attrs.CreatedAt()
+		if createdAtSupported && !strings.HasSuffix(attrs.Name, DirDelim) {
+			testutil.Assert(t, ok, "expected creation time for %s", attrs.Name)
+			testutil.Assert(t, time.Since(createdAt) < time.Hour, "unexpected creation time %v for %s", createdAt, attrs.Name)
+		} else {
+			testutil.Assert(t, !ok, "unexpected creation time for %s", attrs.Name)
+		}
+		return nil
+	}, options...))
+	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some", "id1/sub/"}, seen)
+
+	if !etagSupported {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			return nil
+		}, WithETag))
+	}
+	if !sizeSupported {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			return nil
+		}, WithSize))
+	}
+
+	storageClassSupported := false
+	for _, opt := range bkt.SupportedIterOptions() {
+		storageClassSupported = storageClassSupported || opt == StorageClass
+	}
+	if storageClassSupported {
+		classes := map[string]string{}
+		testutil.Ok(t, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			classes[attrs.Name] = attrs.StorageClass()
+			return nil
+		}, WithStorageClassIter))
+		testutil.Equals(t, "", classes["id1/sub/"])
+
+		// All objects were uploaded with the same default storage class, directories are not filtered.
+		seen = []string{}
+		testutil.Ok(t, bkt.Iter(ctx, "id1/", func(fn string) error {
+			seen = append(seen, fn)
+			return nil
+		}, FilterStorageClass(classes["id1/obj_1.some"])))
+		testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some", "id1/sub/"}, seen)
+
+		seen = []string{}
+		testutil.Ok(t, bkt.Iter(ctx, "id1/", func(fn string) error {
+			seen = append(seen, fn)
+			return nil
+		}, FilterStorageClass("NONEXISTENT")))
+		testutil.Equals(t, []string{"id1/sub/"}, seen)
+	} else {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			return nil
+		}, WithStorageClassIter))
+		testutil.Equals(t, ErrOptionNotSupported, bkt.Iter(ctx, "id1/", func(string) error {
+			return nil
+		}, FilterStorageClass("STANDARD")))
+	}
+
+	startAfterSupported := false
+	for _, opt := range bkt.SupportedIterOptions() {
+		startAfterSupported = startAfterSupported || opt == StartAfter
+	}
+	if startAfterSupported {
+		seen = []string{}
+		testutil.Ok(t, bkt.Iter(ctx, "id1/", func(fn string) error {
+			seen = append(seen, fn)
+			return nil
+		}, WithStartAfter("id1/obj_1.some")))
+		testutil.Equals(t, []string{"id1/obj_2.some", "id1/obj_3.some", "id1/sub/"}, seen)
+
+		// Paginating resumes the iteration after the last object of the previous page.
+		seen = []string{}
+		var (
+			page  []IterObjectAttributes
+			token string
+			err   error
+		)
+		for i := 0; i == 0 || token != ""; i++ {
+			page, token, err = IterCollectPage(ctx, bkt, "id1/", 2, token, WithRecursiveIter)
+			testutil.Ok(t, err)
+			for _, attrs := range page {
+				seen = append(seen, attrs.Name)
+			}
+		}
+		testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some", "id1/sub/subobj_1.some", "id1/sub/subobj_2.some"}, seen)
+	} else {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			return nil
+		}, WithStartAfter("id1/obj_1.some")))
+	}
+
+	prefixesOnlySupported := false
+	for _, opt := range bkt.SupportedIterOptions() {
+		prefixesOnlySupported = prefixesOnlySupported || opt == PrefixesOnly
+	}
+	if prefixesOnlySupported {
+		seen = []string{}
+		testutil.Ok(t, bkt.Iter(ctx, "id1/", func(fn string) error {
+			seen = append(seen, fn)
+			return nil
+		}, WithPrefixesOnly))
+		testutil.Equals(t, []string{"id1/sub/"}, seen)
+	} else {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			return nil
+		}, WithPrefixesOnly))
+	}
+
+	// The filter is applied client-side, so it is supported by every bucket.
+	filter := WithFilter(func(name string) bool {
+		return strings.HasSuffix(name, "_2.some") || strings.HasSuffix(name, DirDelim)
+	})
+	seen = []string{}
+	testutil.Ok(t, Iter(ctx, bkt, "id1/", func(fn string) error {
+		seen = append(seen, fn)
+		return nil
+	}, filter))
+	testutil.Equals(t, []string{"id1/obj_2.some", "id1/sub/"}, seen)
+
+	userMetadataSupported := false
+	for _, opt := range bkt.SupportedIterOptions() {
+		userMetadataSupported = userMetadataSupported || opt == UserMetadata
+	}
+	if userMetadataSupported {
+		metadata := map[string]string{"owner": "acceptance"}
+		testutil.Ok(t, bkt.Upload(ctx, "meta/obj_1.some", strings.NewReader("@test-data@"), WithUserMetadata(metadata)))
+
+		attrs, err := bkt.Attributes(ctx, "meta/obj_1.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, metadata, attrs.UserMetadata)
+
+		found := map[string]map[string]string{}
+		testutil.Ok(t, bkt.IterWithAttributes(ctx, "", func(attrs IterObjectAttributes) error {
+			found[attrs.Name] = attrs.UserMetadata()
+			return nil
+		}, WithRecursiveIter, WithUserMetadataIter))
+		testutil.Equals(t, metadata, found["meta/obj_1.some"])
+		testutil.Equals(t, 0, len(found["id1/obj_1.some"]))
+		testutil.Ok(t, bkt.Delete(ctx, "meta/obj_1.some"))
+
+		// Metadata which can't be stored by all providers is rejected.
+		testutil.NotOk(t, bkt.Upload(ctx, "meta/obj_2.some", strings.NewReader("@test-data@"), WithUserMetadata(map[string]string{"in valid": "acceptance"})))
+		ok, err := bkt.Exists(ctx, "meta/obj_2.some")
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok, "expected upload with invalid metadata to fail")
+	} else {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.IterWithAttributes(ctx, "id1/", func(attrs IterObjectAttributes) error {
+			return nil
+		}, WithUserMetadataIter))
+	}
+
+	maxResultsSupported := false
+	for _, opt := range bkt.SupportedIterOptions() {
+		maxResultsSupported = maxResultsSupported || opt == MaxResults
+	}
+	if maxResultsSupported {
+		// The limit applies to each call separately, so concurrent iterations must not affect each other.
+		var (
+			wg      sync.WaitGroup
+			results = make([][]string, 4)
+			errs    = make([]error, 4)
+		)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = bkt.Iter(ctx, "id1/", func(fn string) error {
+					results[i] = append(results[i], fn)
+					return nil
+				}, WithMaxResults(i+1))
+			}(i)
+		}
+		wg.Wait()
+
+		expected := []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some", "id1/sub/"}
+		for i := range results {
+			testutil.Ok(t, errs[i])
+			testutil.Equals(t, expected[:i+1], results[i])
+		}
+	} else {
+		testutil.Equals(t, ErrOptionNotSupported, bkt.Iter(ctx, "id1/", func(fn string) error {
+			return nil
+		}, WithMaxResults(1)))
+	}
+
 	// Can we iter over items from not existing dir?
 	testutil.Ok(t, bkt.Iter(ctx, "id0", func(fn string) error {
 		t.Error("Not expected to loop through not existing directory")
@@ -227,6 +506,9 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	// NOTE: Don't rely on this. S3 is not complying with this as GCS is.
 	// testutil.NotOk(t, bkt.Delete(ctx, "id1/obj_2.some"))
 
+	// DeleteMany skips objects which don't exist on all providers.
+	testutil.Ok(t, bkt.DeleteMany(ctx, []string{"id1/obj_2.some"}))
+
 	// Can we iter over items from id1/ dir and see obj2 being deleted?
 	seen = []string{}
 	testutil.Ok(t, bkt.Iter(ctx, "id1/", func(fn string) error {
@@ -247,10 +529,261 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	sort.Strings(seen)
 	testutil.Equals(t, expected, seen)
 
+	// Can we copy an object and read its content under the new name?
+	testutil.Ok(t, bkt.Copy(ctx, "obj_5.some", "id3/obj_5_copy.some"))
+	rcCopy, err := bkt.Get(ctx, "id3/obj_5_copy.some")
+	testutil.Ok(t, err)
+	content, err = io.ReadAll(rcCopy)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rcCopy.Close())
+	testutil.Equals(t, "@test-data7@", string(content))
+	testutil.Ok(t, bkt.Delete(ctx, "id3/obj_5_copy.some"))
+
+	// Can we change the attributes of an object while copying it?
+	err = CopyWithAttributes(ctx, bkt, "obj_5.some", "id3/obj_5_copy.some", CopyObjectAttributes{ContentType: "text/plain"})
+	if err != ErrCopyWithAttributesNotSupported {
+		testutil.Ok(t, err)
+		attrs, err := bkt.Attributes(ctx, "id3/obj_5_copy.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, "text/plain", attrs.ContentType)
+
+		rcCopy, err := bkt.Get(ctx, "id3/obj_5_copy.some")
+		testutil.Ok(t, err)
+		content, err = io.ReadAll(rcCopy)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rcCopy.Close())
+		testutil.Equals(t, "@test-data7@", string(content))
+		testutil.Ok(t, bkt.Delete(ctx, "id3/obj_5_copy.some"))
+
+		err = CopyWithAttributes(ctx, bkt, "id3/obj_not_existing.some", "id3/obj_not_existing_copy.some", CopyObjectAttributes{ContentType: "text/plain"})
+		testutil.NotOk(t, err)
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+	}
+
+	// Can we move an object to a new name?
+	if IsRenameSupported(bkt) {
+		testutil.Ok(t, bkt.Upload(ctx, "id3/obj_rename.some", strings.NewReader("@rename@")))
+		testutil.Ok(t, Rename(ctx, bkt, "id3/obj_rename.some", "id3/renamed/obj_rename.some"))
+		ok, err := bkt.Exists(ctx, "id3/obj_rename.some")
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok, "expected renamed object to not exist anymore")
+
+		rcRenamed, err := bkt.Get(ctx, "id3/renamed/obj_rename.some")
+		testutil.Ok(t, err)
+		content, err = io.ReadAll(rcRenamed)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rcRenamed.Close())
+		testutil.Equals(t, "@rename@", string(content))
+		testutil.Ok(t, bkt.Delete(ctx, "id3/renamed/obj_rename.some"))
+
+		err = Rename(ctx, bkt, "id3/obj_not_existing.some", "id3/obj_not_existing_renamed.some")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+	} else {
+		testutil.Equals(t, ErrRenameNotSupported, Rename(ctx, bkt, "id3/obj_rename.some", "id3/renamed/obj_rename.some"))
+	}
+
+	// Can we upload an object only if it does not exist yet?
+	created, err := UploadIfNotExists(ctx, bkt, "id3/obj_lock.some", strings.NewReader("@lock1@"))
+	if err != ErrConditionalUploadNotSupported {
+		testutil.Ok(t, err)
+		testutil.Assert(t, created, "expected object to be created")
+
+		created, err = UploadIfNotExists(ctx, bkt, "id3/obj_lock.some", strings.NewReader("@lock2@"))
+		testutil.Ok(t, err)
+		testutil.Assert(t, !created, "expected existing object to not be overwritten")
+
+		rcLock, err := bkt.Get(ctx, "id3/obj_lock.some")
+		testutil.Ok(t, err)
+		content, err = io.ReadAll(rcLock)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rcLock.Close())
+		testutil.Equals(t, "@lock1@", string(content))
+		testutil.Ok(t, bkt.Delete(ctx, "id3/obj_lock.some"))
+	}
+
+	// Can we update an object only if it was not modified concurrently?
+	err = UpdateObject(ctx, bkt, "id3/obj_update.some", func(old []byte) ([]byte, error) {
+		testutil.Assert(t, old == nil, "expected no content for a missing object")
+		return []byte("@update1@"), nil
+	})
+	if err != ErrConditionalUploadNotSupported {
+		testutil.Ok(t, err)
+		testutil.Ok(t, UpdateObject(ctx, bkt, "id3/obj_update.some", func(old []byte) ([]byte, error) {
+			testutil.Equals(t, "@update1@", string(old))
+			return append(old, "@update2@"...), nil
+		}))
+
+		err = UpdateObject(ctx, bkt, "id3/obj_update.some", func(old []byte) ([]byte, error) {
+			testutil.Ok(t, bkt.Upload(ctx, "id3/obj_update.some", strings.NewReader("@concurrent@")))
+			return []byte("@update3@"), nil
+		})
+		testutil.Assert(t, IsPreconditionFailedErr(err), "expected precondition failed error but got %v", err)
+
+		rcUpdate, err := bkt.Get(ctx, "id3/obj_update.some")
+		testutil.Ok(t, err)
+		content, err = io.ReadAll(rcUpdate)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rcUpdate.Close())
+		testutil.Equals(t, "@concurrent@", string(content))
+		testutil.Ok(t, bkt.Delete(ctx, "id3/obj_update.some"))
+
+		// Updates keep the content type and user metadata of the object.
+		testutil.Ok(t, bkt.Upload(ctx, "id3/obj_update_md.some", strings.NewReader("@update1@"), WithContentType("text/plain"), WithUserMetadata(map[string]string{"team": "storage"})))
+		before, err := bkt.Attributes(ctx, "id3/obj_update_md.some")
+		testutil.Ok(t, err)
+		testutil.Ok(t, UpdateObject(ctx, bkt, "id3/obj_update_md.some", func(old []byte) ([]byte, error) {
+			return append(old, "@update2@"...), nil
+		}))
+		after, err := bkt.Attributes(ctx, "id3/obj_update_md.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, before.ContentType, after.ContentType)
+		testutil.Equals(t, before.UserMetadata, after.UserMetadata)
+		testutil.Ok(t, bkt.Delete(ctx, "id3/obj_update_md.some"))
+	}
+
+	// Can we tag an object and change its tags without uploading it again?
+	testutil.Ok(t, bkt.Upload(ctx, "id3/obj_tags.some", strings.NewReader("@tags@")))
+	err = SetObjectTags(ctx, bkt, "id3/obj_tags.some", map[string]string{"team": "storage", "env": "test"})
+	if err != ErrTaggingNotSupported {
+		testutil.Ok(t, err)
+		tags, err := GetObjectTags(ctx, bkt, "id3/obj_tags.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"team": "storage", "env": "test"}, tags)
+
+		testutil.Ok(t, SetObjectTags(ctx, bkt, "id3/obj_tags.some", map[string]string{"env": "prod"}))
+		tags, err = GetObjectTags(ctx, bkt, "id3/obj_tags.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"env": "prod"}, tags)
+
+		testutil.Ok(t, DeleteObjectTags(ctx, bkt, "id3/obj_tags.some"))
+		tags, err = GetObjectTags(ctx, bkt, "id3/obj_tags.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(tags))
+
+		// Overwriting an object removes its tags.
+		testutil.Ok(t, SetObjectTags(ctx, bkt, "id3/obj_tags.some", map[string]string{"env": "prod"}))
+		testutil.Ok(t, bkt.Upload(ctx, "id3/obj_tags.some", strings.NewReader("@tags2@")))
+		tags, err = GetObjectTags(ctx, bkt, "id3/obj_tags.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(tags))
+
+		err = SetObjectTags(ctx, bkt, "id3/obj_not_existing.some", map[string]string{"env": "prod"})
+		testutil.NotOk(t, err)
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+	}
+	testutil.Ok(t, bkt.Delete(ctx, "id3/obj_tags.some"))
+
+	// Can we change the metadata of an object without uploading it again?
+	testutil.Ok(t, bkt.Upload(ctx, "id3/obj_metadata.some", strings.NewReader("@metadata@"), WithUserMetadata(map[string]string{"team": "storage", "env": "test"})))
+	err = UpdateMetadata(ctx, bkt, "id3/obj_metadata.some", map[string]string{"env": "prod"})
+	if err != ErrUpdateMetadataNotSupported {
+		testutil.Ok(t, err)
+		attrs, err := bkt.Attributes(ctx, "id3/obj_metadata.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"env": "prod"}, attrs.UserMetadata)
+
+		// Without metadata, only the attributes set by the options are changed.
+		testutil.Ok(t, UpdateMetadata(ctx, bkt, "id3/obj_metadata.some", nil, WithContentType("text/plain"), WithCacheControl("no-cache")))
+		attrs, err = bkt.Attributes(ctx, "id3/obj_metadata.some")
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"env": "prod"}, attrs.UserMetadata)
+		testutil.Equals(t, "text/plain", attrs.ContentType)
+		testutil.Equals(t, "no-cache", attrs.CacheControl)
+
+		rc, err := bkt.Get(ctx, "id3/obj_metadata.some")
+		testutil.Ok(t, err)
+		content, err := io.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, "@metadata@", string(content))
+
+		err = UpdateMetadata(ctx, bkt, "id3/obj_not_existing.some", map[string]string{"env": "prod"})
+		testutil.NotOk(t, err)
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+	}
+	testutil.Ok(t, bkt.Delete(ctx, "id3/obj_metadata.some"))
+
+	// Copying a non existing object should return an object not found error.
+	err = bkt.Copy(ctx, "id3/obj_not_existing.some", "id3/obj_not_existing_copy.some")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+
 	testutil.Ok(t, bkt.Upload(ctx, "obj_6.som", bytes.NewReader(make([]byte, 1024*1024*200))))
 	testutil.Ok(t, bkt.Delete(ctx, "obj_6.som"))
 }
 
+// PresignAcceptanceTest tests the Presigner contract of the given bucket by uploading and downloading
+// an object through presigned URLs. The test is skipped if the bucket does not support presigning.
+func PresignAcceptanceTest(t *testing.T, bkt Bucket) {
+	ctx := context.Background()
+
+	putURL, err := PresignPut(ctx, bkt, "id1/presigned.some", 5*time.Minute)
+	if errors.Is(err, ErrPresignNotSupported) {
+		t.Skipf("presigned URLs are not supported by %s", bkt.Name())
+	}
+	testutil.Ok(t, err)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, putURL, strings.NewReader("@test-presigned@"))
+	testutil.Ok(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	testutil.Ok(t, err)
+	testutil.Ok(t, resp.Body.Close())
+	testutil.Equals(t, http.StatusOK, resp.StatusCode)
+	defer func() { testutil.Ok(t, bkt.Delete(ctx, "id1/presigned.some")) }()
+
+	getURL, err := PresignedGetURL(ctx, bkt, "id1/presigned.some", 5*time.Minute)
+	testutil.Ok(t, err)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, getURL, nil)
+	testutil.Ok(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, resp.Body.Close()) }()
+	testutil.Equals(t, http.StatusOK, resp.StatusCode)
+
+	content, err := io.ReadAll(resp.Body)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "@test-presigned@", string(content))
+}
+
+// MultipartUploadAcceptanceTest tests the MultipartUploader contract of the given bucket by completing one
+// upload and aborting another. The test is skipped if the bucket does not support multipart uploads.
+func MultipartUploadAcceptanceTest(t *testing.T, bkt Bucket) {
+	ctx := context.Background()
+
+	w, err := NewMultipartUpload(ctx, bkt, "id1/multipart.some")
+	if errors.Is(err, ErrMultipartUploadNotSupported) {
+		t.Skipf("multipart uploads are not supported by %s", bkt.Name())
+	}
+	testutil.Ok(t, err)
+
+	// All parts but the last one have to be at least 5MiB for S3.
+	first := bytes.Repeat([]byte("a"), 5*1024*1024)
+	testutil.Ok(t, w.WritePart(ctx, bytes.NewReader(first), int64(len(first))))
+	testutil.Ok(t, w.WritePart(ctx, strings.NewReader("@test-multipart@"), int64(len("@test-multipart@"))))
+	testutil.Ok(t, w.Complete(ctx))
+	defer func() { testutil.Ok(t, bkt.Delete(ctx, "id1/multipart.some")) }()
+
+	rc, err := bkt.Get(ctx, "id1/multipart.some")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rc.Close()) }()
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, len(first)+len("@test-multipart@"), len(content))
+	testutil.Equals(t, "@test-multipart@", string(content[len(first):]))
+
+	// Aborted uploads must not create the object.
+	w, err = NewMultipartUpload(ctx, bkt, "id1/aborted.some")
+	testutil.Ok(t, err)
+	testutil.Ok(t, w.WritePart(ctx, bytes.NewReader(first), int64(len(first))))
+	testutil.Ok(t, w.Abort(ctx))
+
+	exists, err := bkt.Exists(ctx, "id1/aborted.some")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "expected aborted upload to not create an object")
+}
+
 type delayingBucket struct {
 	bkt   Bucket
 	delay time.Duration
@@ -285,9 +818,18 @@ func (d *delayingBucket) Exists(ctx context.Context, name string) (bool, error)
 	return d.bkt.Exists(ctx, name)
 }
 
-func (d *delayingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+func (d *delayingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	time.Sleep(d.delay)
+	return d.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (d *delayingBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
 	time.Sleep(d.delay)
-	return d.bkt.Upload(ctx, name, r)
+	return d.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (d *delayingBucket) SupportedIterOptions() []IterOptionType {
+	return d.bkt.SupportedIterOptions()
 }
 
 func (d *delayingBucket) Delete(ctx context.Context, name string) error {
@@ -295,6 +837,16 @@ func (d *delayingBucket) Delete(ctx context.Context, name string) error {
 	return d.bkt.Delete(ctx, name)
 }
 
+func (d *delayingBucket) DeleteMany(ctx context.Context, names []string) error {
+	time.Sleep(d.delay)
+	return d.bkt.DeleteMany(ctx, names)
+}
+
+func (d *delayingBucket) Copy(ctx context.Context, src, dst string) error {
+	time.Sleep(d.delay)
+	return d.bkt.Copy(ctx, src, dst)
+}
+
 func (d *delayingBucket) Name() string {
 	time.Sleep(d.delay)
 	return d.bkt.Name()
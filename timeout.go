@@ -0,0 +1,191 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimeoutConfig configures the timeouts of a bucket returned by WrapWithTimeout. A zero or negative
+// timeout disables the timeout of the operation.
+type TimeoutConfig struct {
+	// Iter is the timeout of a whole Iter or IterWithAttributes call, including the calls to the callback.
+	Iter time.Duration
+	// Get is the timeout of opening the stream returned by Get.
+	Get time.Duration
+	// GetRange is the timeout of opening the stream returned by GetRange.
+	GetRange time.Duration
+	// Read is the timeout of reading the streams returned by Get and GetRange, starting when the stream
+	// is opened. By default, the returned streams are only canceled with the context passed by the caller.
+	Read       time.Duration
+	Exists     time.Duration
+	Attributes time.Duration
+	// Upload is the timeout of Upload, UploadIfNotExists and UploadIfMatch, including reading from the passed reader.
+	Upload time.Duration
+	// Delete is the timeout of Delete and DeleteMany.
+	Delete time.Duration
+	Copy   time.Duration
+}
+
+// WrapWithTimeout returns a bucket which cancels operations against bkt that take longer than the
+// timeout configured for them, so that calls with a context without deadline can't block forever.
+// For Get and GetRange, the timeout only applies to opening the stream: the returned reader stays usable
+// after it passed, unless TimeoutConfig.Read is set. Operations which time out return an error wrapping
+// context.DeadlineExceeded.
+func WrapWithTimeout(bkt Bucket, timeouts TimeoutConfig) Bucket {
+	return &timeoutBucket{bkt: bkt, timeouts: timeouts}
+}
+
+type timeoutBucket struct {
+	bkt      Bucket
+	timeouts TimeoutConfig
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (b *timeoutBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Iter)
+	defer cancel()
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *timeoutBucket) IterWithAttributes(ctx context.Context, dir string, f func(IterObjectAttributes) error, options ...IterOption) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Iter)
+	defer cancel()
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *timeoutBucket) SupportedIterOptions() []IterOptionType {
+	return b.bkt.SupportedIterOptions()
+}
+
+func (b *timeoutBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.open(ctx, name, b.timeouts.Get, func(ctx context.Context) (io.ReadCloser, error) {
+		return b.bkt.Get(ctx, name)
+	})
+}
+
+func (b *timeoutBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.open(ctx, name, b.timeouts.GetRange, func(ctx context.Context) (io.ReadCloser, error) {
+		return b.bkt.GetRange(ctx, name, off, length)
+	})
+}
+
+// open calls get with a context which is canceled if the stream isn't opened within the timeout d.
+// The stream is tied to the context, so it is only canceled once it is closed or the read timeout passed.
+func (b *timeoutBucket) open(ctx context.Context, name string, d time.Duration, get func(context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	readCtx, cancel := withTimeout(ctx, b.timeouts.Read)
+	readCtx, cancelRead := context.WithCancel(readCtx)
+	cancelAll := func() {
+		cancelRead()
+		cancel()
+	}
+
+	var timer *time.Timer
+	if d > 0 {
+		timer = time.AfterFunc(d, cancelRead)
+	}
+	rc, err := get(readCtx)
+	if timer != nil && !timer.Stop() {
+		// The timeout passed before the stream was returned, so it is already canceled.
+		if err == nil {
+			_ = rc.Close()
+		}
+		cancelAll()
+		return nil, errors.Wrapf(context.DeadlineExceeded, "open %s: timeout of %s exceeded", name, d)
+	}
+	if err != nil {
+		cancelAll()
+		return nil, err
+	}
+	return &timeoutReadCloser{ReadCloser: rc, cancel: cancelAll}, nil
+}
+
+// timeoutReadCloser releases the context of the stream once it is closed.
+type timeoutReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (rc *timeoutReadCloser) ObjectSize() (int64, error) {
+	return TryToGetSize(rc.ReadCloser)
+}
+
+func (rc *timeoutReadCloser) Close() error {
+	defer rc.cancel()
+	return rc.ReadCloser.Close()
+}
+
+func (b *timeoutBucket) Exists(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Exists)
+	defer cancel()
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *timeoutBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Attributes)
+	defer cancel()
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *timeoutBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...ObjectUploadOption) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Upload)
+	defer cancel()
+	return b.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (b *timeoutBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (bool, error) {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Upload)
+	defer cancel()
+	return UploadIfNotExists(ctx, b.bkt, name, r)
+}
+
+func (b *timeoutBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...ObjectUploadOption) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Upload)
+	defer cancel()
+	return UploadIfMatch(ctx, b.bkt, name, r, etag, opts...)
+}
+
+func (b *timeoutBucket) Delete(ctx context.Context, name string) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Delete)
+	defer cancel()
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *timeoutBucket) DeleteMany(ctx context.Context, names []string) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Delete)
+	defer cancel()
+	return b.bkt.DeleteMany(ctx, names)
+}
+
+func (b *timeoutBucket) Copy(ctx context.Context, src, dst string) error {
+	ctx, cancel := withTimeout(ctx, b.timeouts.Copy)
+	defer cancel()
+	return b.bkt.Copy(ctx, src, dst)
+}
+
+func (b *timeoutBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *timeoutBucket) IsCustomerManagedKeyError(err error) bool {
+	return b.bkt.IsCustomerManagedKeyError(err)
+}
+
+func (b *timeoutBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *timeoutBucket) Name() string {
+	return b.bkt.Name()
+}
@@ -0,0 +1,112 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+)
+
+// slowBucket delays opening streams and checking for objects until the delay passed or the context is
+// canceled. The returned streams fail once their context is canceled.
+type slowBucket struct {
+	Bucket
+	delay time.Duration
+}
+
+func (b slowBucket) wait(ctx context.Context) error {
+	select {
+	case <-time.After(b.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b slowBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.wait(ctx); err != nil {
+		return false, err
+	}
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b slowBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ctxReadCloser{ReadCloser: rc, ctx: ctx}, nil
+}
+
+type ctxReadCloser struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (rc ctxReadCloser) Read(p []byte) (int, error) {
+	if err := rc.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return rc.ReadCloser.Read(p)
+}
+
+func TestTimeoutBucket_Acceptance(t *testing.T) {
+	AcceptanceTest(t, WrapWithTimeout(NewInMemBucket(), TimeoutConfig{
+		Iter:       time.Minute,
+		Get:        time.Minute,
+		GetRange:   time.Minute,
+		Read:       time.Minute,
+		Exists:     time.Minute,
+		Attributes: time.Minute,
+		Upload:     time.Minute,
+		Delete:     time.Minute,
+		Copy:       time.Minute,
+	}))
+}
+
+func TestTimeoutBucket(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemBucket()
+	testutil.Ok(t, inner.Upload(ctx, "obj", strings.NewReader("content")))
+
+	bkt := WrapWithTimeout(slowBucket{Bucket: inner, delay: time.Second}, TimeoutConfig{Exists: 10 * time.Millisecond, Get: 10 * time.Millisecond})
+	_, err := bkt.Exists(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+
+	start := time.Now()
+	_, err = bkt.Get(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	testutil.Assert(t, time.Since(start) < 500*time.Millisecond, "expected Get to be canceled after the timeout")
+
+	// The timeout only applies to opening the stream, it can still be read afterwards.
+	bkt = WrapWithTimeout(slowBucket{Bucket: inner, delay: 10 * time.Millisecond}, TimeoutConfig{Get: 50 * time.Millisecond})
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	time.Sleep(100 * time.Millisecond)
+	content, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "content", string(content))
+
+	// Unless a read timeout is configured.
+	bkt = WrapWithTimeout(slowBucket{Bucket: inner, delay: 10 * time.Millisecond}, TimeoutConfig{Get: 50 * time.Millisecond, Read: 50 * time.Millisecond})
+	rc, err = bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	time.Sleep(100 * time.Millisecond)
+	_, err = io.ReadAll(rc)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	testutil.Ok(t, rc.Close())
+}
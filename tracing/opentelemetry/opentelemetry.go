@@ -6,14 +6,21 @@ package opentelemetry
 import (
 	"context"
 	"io"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/thanos-io/objstore"
 )
 
 // TracingBucket is a wrapper around objstore.Bucket that adds tracing to all operations using OpenTelemetry.
+// Every span carries the bucket.name and operation attributes, and object.name for operations on a single object.
+// Spans of uploads, attribute requests and reads carry object.size as well, if the size is known. Spans of Get
+// and GetRange end when the returned reader is closed, so they cover reading the object as well.
 type TracingBucket struct {
 	tracer trace.Tracer
 	bkt    objstore.Bucket
@@ -23,41 +30,127 @@ func WrapWithTraces(bkt objstore.Bucket, tracer trace.Tracer) objstore.Instrumen
 	return TracingBucket{tracer: tracer, bkt: bkt}
 }
 
+// start starts a span for the given operation with the attributes common to all operations.
+func (t TracingBucket) start(ctx context.Context, spanName, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, spanName)
+	span.SetAttributes(attribute.String("bucket.name", t.bkt.Name()), attribute.String("operation", op))
+	span.SetAttributes(attrs...)
+	return ctx, span
+}
+
+// setSize sets the object.size attribute to the size of r, if it can be determined with objstore.TryToGetSize.
+func setSize(span trace.Span, r io.Reader) {
+	if size, err := objstore.TryToGetSize(r); err == nil {
+		span.SetAttributes(attribute.Int64("object.size", size))
+	}
+}
+
+// recordError records err on the span. If err is an objstore.BucketError, its provider code is attached
+// as well, as http.status_code if it is an HTTP status code and as provider.code otherwise.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	var bErr *objstore.BucketError
+	if !errors.As(err, &bErr) || bErr.ProviderCode == "" {
+		return
+	}
+	if status, convErr := strconv.Atoi(bErr.ProviderCode); convErr == nil {
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		return
+	}
+	span.SetAttributes(attribute.String("provider.code", bErr.ProviderCode))
+}
+
 func (t TracingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) (err error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_iter")
+	ctx, span := t.start(ctx, "bucket_iter", objstore.OpIter, attribute.String("dir", dir))
 	defer span.End()
-	span.SetAttributes(attribute.String("dir", dir))
 
 	defer func() {
 		if err != nil {
-			span.RecordError(err)
+			recordError(span, err)
 		}
 	}()
 	return t.bkt.Iter(ctx, dir, f, options...)
 }
 
-func (t TracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_get")
+func (t TracingBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) (err error) {
+	ctx, span := t.start(ctx, "bucket_iter_with_attributes", objstore.OpIter, attribute.String("dir", dir))
 	defer span.End()
-	span.SetAttributes(attribute.String("name", name))
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return t.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (t TracingBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return t.bkt.SupportedIterOptions()
+}
+
+func (t TracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	ctx, span := t.start(ctx, "bucket_get", objstore.OpGet, attribute.String("object.name", name))
 
 	r, err := t.bkt.Get(ctx, name)
 	if err != nil {
-		span.RecordError(err)
+		recordError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	return newTracingReadCloser(r, span), nil
+}
+
+func (t TracingBucket) GetWithOptions(ctx context.Context, name string, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	params := objstore.ApplyObjectGetOptions(opts...)
+	ctx, span := t.start(ctx, "bucket_get", objstore.OpGet, attribute.String("object.name", name), attribute.Bool("decode_content", params.DecodeContent), attribute.Bool("read_compressed", params.ReadCompressed))
+
+	r, err := objstore.GetWithOptions(ctx, t.bkt, name, opts...)
+	if err != nil {
+		recordError(span, err)
+		span.End()
 		return nil, err
 	}
 
 	return newTracingReadCloser(r, span), nil
 }
 
+func (t TracingBucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, objstore.ObjectAttributes, error) {
+	ctx, span := t.start(ctx, "bucket_get", objstore.OpGet, attribute.String("object.name", name))
+
+	r, attrs, err := objstore.GetWithAttributes(ctx, t.bkt, name)
+	if err != nil {
+		recordError(span, err)
+		span.End()
+		return nil, objstore.ObjectAttributes{}, err
+	}
+
+	return newTracingReadCloser(r, span), attrs, nil
+}
+
 func (t TracingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_getrange")
-	defer span.End()
-	span.SetAttributes(attribute.String("name", name), attribute.Int64("offset", off), attribute.Int64("length", length))
+	ctx, span := t.start(ctx, "bucket_getrange", objstore.OpGetRange, attribute.String("object.name", name), attribute.Int64("offset", off), attribute.Int64("length", length))
 
 	r, err := t.bkt.GetRange(ctx, name, off, length)
 	if err != nil {
-		span.RecordError(err)
+		recordError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	return newTracingReadCloser(r, span), nil
+}
+
+func (t TracingBucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	params := objstore.ApplyObjectGetOptions(opts...)
+	ctx, span := t.start(ctx, "bucket_getrange", objstore.OpGetRange, attribute.String("object.name", name), attribute.Int64("offset", off), attribute.Int64("length", length), attribute.Bool("read_compressed", params.ReadCompressed))
+
+	r, err := objstore.GetRangeWithOptions(ctx, t.bkt, name, off, length, opts...)
+	if err != nil {
+		recordError(span, err)
+		span.End()
 		return nil, err
 	}
 
@@ -65,61 +158,308 @@ func (t TracingBucket) GetRange(ctx context.Context, name string, off, length in
 }
 
 func (t TracingBucket) Exists(ctx context.Context, name string) (_ bool, err error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_exists")
+	ctx, span := t.start(ctx, "bucket_exists", objstore.OpExists, attribute.String("object.name", name))
 	defer span.End()
-	span.SetAttributes(attribute.String("name", name))
 
 	defer func() {
 		if err != nil {
-			span.RecordError(err)
+			recordError(span, err)
 		}
 	}()
 	return t.bkt.Exists(ctx, name)
 }
 
-func (t TracingBucket) Attributes(ctx context.Context, name string) (_ objstore.ObjectAttributes, err error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_attributes")
+func (t TracingBucket) Attributes(ctx context.Context, name string) (attrs objstore.ObjectAttributes, err error) {
+	ctx, span := t.start(ctx, "bucket_attributes", objstore.OpAttributes, attribute.String("object.name", name))
 	defer span.End()
-	span.SetAttributes(attribute.String("name", name))
 
 	defer func() {
 		if err != nil {
-			span.RecordError(err)
+			recordError(span, err)
+			return
 		}
+		span.SetAttributes(attribute.Int64("object.size", attrs.Size))
 	}()
 	return t.bkt.Attributes(ctx, name)
 }
 
-func (t TracingBucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_upload")
+func (t TracingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
+	ctx, span := t.start(ctx, "bucket_upload", objstore.OpUpload, attribute.String("object.name", name))
+	defer span.End()
+	setSize(span, r)
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return t.bkt.Upload(ctx, name, r, opts...)
+}
+
+func (t TracingBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (created bool, err error) {
+	ctx, span := t.start(ctx, "bucket_upload_if_not_exists", objstore.OpUpload, attribute.String("object.name", name))
 	defer span.End()
-	span.SetAttributes(attribute.String("name", name))
+	setSize(span, r)
 
 	defer func() {
+		span.SetAttributes(attribute.Bool("created", created))
 		if err != nil {
-			span.RecordError(err)
+			recordError(span, err)
 		}
 	}()
-	return t.bkt.Upload(ctx, name, r)
+	return objstore.UploadIfNotExists(ctx, t.bkt, name, r)
+}
+
+func (t TracingBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...objstore.ObjectUploadOption) (err error) {
+	ctx, span := t.start(ctx, "bucket_upload_if_match", objstore.OpUpload, attribute.String("object.name", name), attribute.String("etag", etag))
+	defer span.End()
+	setSize(span, r)
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.UploadIfMatch(ctx, t.bkt, name, r, etag, opts...)
 }
 
 func (t TracingBucket) Delete(ctx context.Context, name string) (err error) {
-	ctx, span := t.tracer.Start(ctx, "bucket_delete")
+	ctx, span := t.start(ctx, "bucket_delete", objstore.OpDelete, attribute.String("object.name", name))
 	defer span.End()
-	span.SetAttributes(attribute.String("name", name))
 
 	defer func() {
 		if err != nil {
-			span.RecordError(err)
+			recordError(span, err)
 		}
 	}()
 	return t.bkt.Delete(ctx, name)
 }
 
+func (t TracingBucket) DeleteMany(ctx context.Context, names []string) (err error) {
+	ctx, span := t.start(ctx, "bucket_delete_many", "delete_many", attribute.Int("count", len(names)))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return t.bkt.DeleteMany(ctx, names)
+}
+
+func (t TracingBucket) Copy(ctx context.Context, src, dst string) (err error) {
+	ctx, span := t.start(ctx, "bucket_copy", objstore.OpCopy, attribute.String("src", src), attribute.String("dst", dst))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return t.bkt.Copy(ctx, src, dst)
+}
+
+func (t TracingBucket) CopyFromBucket(ctx context.Context, src objstore.Bucket, srcName, dstName string) (err error) {
+	ctx, span := t.start(ctx, "bucket_copy_from_bucket", objstore.OpCopy, attribute.String("src_bucket", src.Name()), attribute.String("src", srcName), attribute.String("dst", dstName))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.CopyFromBucket(ctx, src, t.bkt, srcName, dstName)
+}
+
+func (t TracingBucket) CopyWithAttributes(ctx context.Context, src, dst string, attrs objstore.CopyObjectAttributes) (err error) {
+	ctx, span := t.start(ctx, "bucket_copy_with_attributes", objstore.OpCopy, attribute.String("src", src), attribute.String("dst", dst))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.CopyWithAttributes(ctx, t.bkt, src, dst, attrs)
+}
+
+func (t TracingBucket) Rename(ctx context.Context, src, dst string) (err error) {
+	ctx, span := t.start(ctx, "bucket_rename", "rename", attribute.String("src", src), attribute.String("dst", dst))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.Rename(ctx, t.bkt, src, dst)
+}
+
+func (t TracingBucket) ListVersions(ctx context.Context, name string) (_ []objstore.VersionInfo, err error) {
+	ctx, span := t.start(ctx, "bucket_list_versions", "list_versions", attribute.String("object.name", name))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.ListVersions(ctx, t.bkt, name)
+}
+
+func (t TracingBucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...objstore.ObjectUploadOption) (err error) {
+	ctx, span := t.start(ctx, "bucket_update_metadata", "update_metadata", attribute.String("object.name", name))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.UpdateMetadata(ctx, t.bkt, name, md, opts...)
+}
+
+func (t TracingBucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) (err error) {
+	ctx, span := t.start(ctx, "bucket_set_object_tags", "set_object_tags", attribute.String("object.name", name))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.SetObjectTags(ctx, t.bkt, name, tags)
+}
+
+func (t TracingBucket) GetObjectTags(ctx context.Context, name string) (_ map[string]string, err error) {
+	ctx, span := t.start(ctx, "bucket_get_object_tags", "get_object_tags", attribute.String("object.name", name))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.GetObjectTags(ctx, t.bkt, name)
+}
+
+func (t TracingBucket) DeleteObjectTags(ctx context.Context, name string) (err error) {
+	ctx, span := t.start(ctx, "bucket_delete_object_tags", "delete_object_tags", attribute.String("object.name", name))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.DeleteObjectTags(ctx, t.bkt, name)
+}
+
+func (t TracingBucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) (err error) {
+	ctx, span := t.start(ctx, "bucket_iter_versions", "iter_versions", attribute.String("prefix", prefix))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.IterVersions(ctx, t.bkt, prefix, f)
+}
+
+func (t TracingBucket) GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
+	ctx, span := t.start(ctx, "bucket_get_version", "get_version", attribute.String("object.name", name), attribute.String("version_id", versionID))
+
+	r, err := objstore.GetVersion(ctx, t.bkt, name, versionID)
+	if err != nil {
+		recordError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	return newTracingReadCloser(r, span), nil
+}
+
+func (t TracingBucket) DeleteVersion(ctx context.Context, name, versionID string) (err error) {
+	ctx, span := t.start(ctx, "bucket_delete_version", "delete_version", attribute.String("object.name", name), attribute.String("version_id", versionID))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.DeleteVersion(ctx, t.bkt, name, versionID)
+}
+
+func (t TracingBucket) RestoreVersion(ctx context.Context, name, versionID string) (err error) {
+	ctx, span := t.start(ctx, "bucket_restore_version", "restore_version", attribute.String("object.name", name), attribute.String("version_id", versionID))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.RestoreVersion(ctx, t.bkt, name, versionID)
+}
+
+func (t TracingBucket) Ping(ctx context.Context) (err error) {
+	ctx, span := t.start(ctx, "bucket_ping", objstore.OpPing)
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.Ping(ctx, t.bkt)
+}
+
+func (t TracingBucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (_ string, err error) {
+	ctx, span := t.start(ctx, "bucket_presign_get", "presign_get", attribute.String("object.name", name), attribute.String("expiry", expiry.String()))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.PresignedGetURL(ctx, t.bkt, name, expiry)
+}
+
+func (t TracingBucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (_ string, err error) {
+	ctx, span := t.start(ctx, "bucket_presign_put", "presign_put", attribute.String("object.name", name), attribute.String("expiry", expiry.String()))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.PresignPut(ctx, t.bkt, name, expiry)
+}
+
+func (t TracingBucket) NewMultipartUpload(ctx context.Context, name string, opts ...objstore.ObjectUploadOption) (_ objstore.MultipartWriter, err error) {
+	ctx, span := t.start(ctx, "bucket_new_multipart_upload", "new_multipart_upload", attribute.String("object.name", name))
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+	}()
+	return objstore.NewMultipartUpload(ctx, t.bkt, name, opts...)
+}
+
 func (t TracingBucket) Name() string {
 	return "tracing: " + t.bkt.Name()
 }
 
+func (t TracingBucket) WrappedBucket() objstore.Bucket {
+	return t.bkt
+}
+
 func (t TracingBucket) Close() error {
 	return t.bkt.Close()
 }
@@ -171,7 +511,7 @@ func (t *tracingReadCloser) Read(p []byte) (int, error) {
 		t.read += n
 	}
 	if err != nil && err != io.EOF && t.s != nil {
-		t.s.RecordError(err)
+		recordError(t.s, err)
 	}
 	return n, err
 }
@@ -180,6 +520,9 @@ func (t *tracingReadCloser) Close() error {
 	err := t.r.Close()
 	if t.s != nil {
 		t.s.SetAttributes(attribute.Int64("read", int64(t.read)))
+		if t.objSizeErr == nil {
+			t.s.SetAttributes(attribute.Int64("object.size", t.objSize))
+		}
 		if err != nil {
 			t.s.SetAttributes(attribute.String("close_err", err.Error()))
 		}
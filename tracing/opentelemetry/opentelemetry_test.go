@@ -0,0 +1,132 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thanos-io/objstore"
+)
+
+type recordingSpan struct {
+	trace.Span
+
+	attrs map[attribute.Key]attribute.Value
+	errs  []error
+	ended bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+
+func (s *recordingSpan) End(_ ...trace.SpanEndOption) { s.ended = true }
+
+type recordingTracer struct {
+	spans map[string]*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordingSpan{Span: trace.SpanFromContext(ctx), attrs: map[attribute.Key]attribute.Value{}}
+	t.spans[name] = s
+	return ctx, s
+}
+
+type errBucket struct {
+	objstore.Bucket
+	err error
+}
+
+func (b errBucket) Exists(context.Context, string) (bool, error) { return false, b.err }
+
+func TestTracingBucket(t *testing.T) {
+	ctx := context.Background()
+	tracer := &recordingTracer{spans: map[string]*recordingSpan{}}
+	bkt := WrapWithTraces(objstore.NewInMemBucket(), tracer)
+
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader([]byte("hello world"))))
+	span := tracer.spans["bucket_upload"]
+	testutil.Assert(t, span.ended)
+	testutil.Equals(t, "inmem", span.attrs["bucket.name"].AsString())
+	testutil.Equals(t, objstore.OpUpload, span.attrs["operation"].AsString())
+	testutil.Equals(t, "obj", span.attrs["object.name"].AsString())
+	testutil.Equals(t, int64(11), span.attrs["object.size"].AsInt64())
+
+	_, err := bkt.Attributes(ctx, "obj")
+	testutil.Ok(t, err)
+	span = tracer.spans["bucket_attributes"]
+	testutil.Assert(t, span.ended)
+	testutil.Equals(t, int64(11), span.attrs["object.size"].AsInt64())
+
+	_, err = objstore.UploadIfNotExists(ctx, bkt, "other", strings.NewReader("hello"))
+	testutil.Ok(t, err)
+	span = tracer.spans["bucket_upload_if_not_exists"]
+	testutil.Equals(t, int64(5), span.attrs["object.size"].AsInt64())
+	testutil.Equals(t, true, span.attrs["created"].AsBool())
+
+	r, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	span = tracer.spans["bucket_get"]
+	testutil.Assert(t, !span.ended, "span of Get should only end once the reader is closed")
+
+	_, err = io.ReadAll(r)
+	testutil.Ok(t, err)
+	testutil.Ok(t, r.Close())
+	testutil.Assert(t, span.ended)
+	testutil.Equals(t, int64(11), span.attrs["read"].AsInt64())
+
+	_, err = bkt.GetRange(ctx, "missing", 0, 1)
+	testutil.NotOk(t, err)
+	span = tracer.spans["bucket_getrange"]
+	testutil.Assert(t, span.ended, "span of GetRange should end if it fails")
+	testutil.Equals(t, 1, len(span.errs))
+}
+
+func TestTracingBucket_ProviderCode(t *testing.T) {
+	for _, tcase := range []struct {
+		name string
+		err  error
+
+		expectedAttr  attribute.Key
+		expectedValue string
+	}{
+		{
+			name:          "http status code",
+			err:           objstore.NewBucketError(objstore.OpExists, "obj", "403", objstore.ErrKindPermissionDenied, errors.New("forbidden")),
+			expectedAttr:  "http.status_code",
+			expectedValue: "403",
+		},
+		{
+			name:          "provider code",
+			err:           errors.Wrap(objstore.NewBucketError(objstore.OpExists, "obj", "SlowDown", objstore.ErrKindRateLimit, errors.New("slow down")), "wrapped"),
+			expectedAttr:  "provider.code",
+			expectedValue: "SlowDown",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			tracer := &recordingTracer{spans: map[string]*recordingSpan{}}
+			bkt := WrapWithTraces(errBucket{Bucket: objstore.NewInMemBucket(), err: tcase.err}, tracer)
+
+			_, err := bkt.Exists(context.Background(), "obj")
+			testutil.NotOk(t, err)
+
+			span := tracer.spans["bucket_exists"]
+			testutil.Equals(t, tcase.expectedValue, span.attrs[tcase.expectedAttr].Emit())
+			testutil.Assert(t, strings.Contains(span.errs[0].Error(), "obj"))
+		})
+	}
+}
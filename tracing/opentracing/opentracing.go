@@ -6,6 +6,7 @@ package opentracing
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 
@@ -52,6 +53,18 @@ func (t TracingBucket) Iter(ctx context.Context, dir string, f func(string) erro
 	return
 }
 
+func (t TracingBucket) IterWithAttributes(ctx context.Context, dir string, f func(attrs objstore.IterObjectAttributes) error, options ...objstore.IterOption) (err error) {
+	doWithSpan(ctx, "bucket_iter_with_attributes", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("dir", dir)
+		err = t.bkt.IterWithAttributes(spanCtx, dir, f, options...)
+	})
+	return
+}
+
+func (t TracingBucket) SupportedIterOptions() []objstore.IterOptionType {
+	return t.bkt.SupportedIterOptions()
+}
+
 func (t TracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	span, spanCtx := startSpan(ctx, "bucket_get")
 	span.LogKV("name", name)
@@ -66,6 +79,35 @@ func (t TracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, err
 	return newTracingReadCloser(r, span), nil
 }
 
+func (t TracingBucket) GetWithOptions(ctx context.Context, name string, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	span, spanCtx := startSpan(ctx, "bucket_get")
+	params := objstore.ApplyObjectGetOptions(opts...)
+	span.LogKV("name", name, "decode_content", params.DecodeContent, "read_compressed", params.ReadCompressed)
+
+	r, err := objstore.GetWithOptions(spanCtx, t.bkt, name, opts...)
+	if err != nil {
+		span.LogKV("err", err)
+		span.Finish()
+		return nil, err
+	}
+
+	return newTracingReadCloser(r, span), nil
+}
+
+func (t TracingBucket) GetWithAttributes(ctx context.Context, name string) (io.ReadCloser, objstore.ObjectAttributes, error) {
+	span, spanCtx := startSpan(ctx, "bucket_get")
+	span.LogKV("name", name)
+
+	r, attrs, err := objstore.GetWithAttributes(spanCtx, t.bkt, name)
+	if err != nil {
+		span.LogKV("err", err)
+		span.Finish()
+		return nil, objstore.ObjectAttributes{}, err
+	}
+
+	return newTracingReadCloser(r, span), attrs, nil
+}
+
 func (t TracingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	span, spanCtx := startSpan(ctx, "bucket_getrange")
 	span.LogKV("name", name, "offset", off, "length", length)
@@ -80,6 +122,21 @@ func (t TracingBucket) GetRange(ctx context.Context, name string, off, length in
 	return newTracingReadCloser(r, span), nil
 }
 
+func (t TracingBucket) GetRangeWithOptions(ctx context.Context, name string, off, length int64, opts ...objstore.ObjectGetOption) (io.ReadCloser, error) {
+	span, spanCtx := startSpan(ctx, "bucket_getrange")
+	params := objstore.ApplyObjectGetOptions(opts...)
+	span.LogKV("name", name, "offset", off, "length", length, "read_compressed", params.ReadCompressed)
+
+	r, err := objstore.GetRangeWithOptions(spanCtx, t.bkt, name, off, length, opts...)
+	if err != nil {
+		span.LogKV("err", err)
+		span.Finish()
+		return nil, err
+	}
+
+	return newTracingReadCloser(r, span), nil
+}
+
 func (t TracingBucket) Exists(ctx context.Context, name string) (exists bool, err error) {
 	doWithSpan(ctx, "bucket_exists", func(spanCtx context.Context, span opentracing.Span) {
 		span.LogKV("name", name)
@@ -96,10 +153,27 @@ func (t TracingBucket) Attributes(ctx context.Context, name string) (attrs objst
 	return
 }
 
-func (t TracingBucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
+func (t TracingBucket) Upload(ctx context.Context, name string, r io.Reader, opts ...objstore.ObjectUploadOption) (err error) {
 	doWithSpan(ctx, "bucket_upload", func(spanCtx context.Context, span opentracing.Span) {
 		span.LogKV("name", name)
-		err = t.bkt.Upload(spanCtx, name, r)
+		err = t.bkt.Upload(spanCtx, name, r, opts...)
+	})
+	return
+}
+
+func (t TracingBucket) UploadIfNotExists(ctx context.Context, name string, r io.Reader) (created bool, err error) {
+	doWithSpan(ctx, "bucket_upload_if_not_exists", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		created, err = objstore.UploadIfNotExists(spanCtx, t.bkt, name, r)
+		span.LogKV("created", created)
+	})
+	return
+}
+
+func (t TracingBucket) UploadIfMatch(ctx context.Context, name string, r io.Reader, etag string, opts ...objstore.ObjectUploadOption) (err error) {
+	doWithSpan(ctx, "bucket_upload_if_match", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name, "etag", etag)
+		err = objstore.UploadIfMatch(spanCtx, t.bkt, name, r, etag, opts...)
 	})
 	return
 }
@@ -112,10 +186,163 @@ func (t TracingBucket) Delete(ctx context.Context, name string) (err error) {
 	return
 }
 
+func (t TracingBucket) DeleteMany(ctx context.Context, names []string) (err error) {
+	doWithSpan(ctx, "bucket_delete_many", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("count", len(names))
+		err = t.bkt.DeleteMany(spanCtx, names)
+	})
+	return
+}
+
+func (t TracingBucket) Copy(ctx context.Context, src, dst string) (err error) {
+	doWithSpan(ctx, "bucket_copy", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("src", src, "dst", dst)
+		err = t.bkt.Copy(spanCtx, src, dst)
+	})
+	return
+}
+
+func (t TracingBucket) CopyFromBucket(ctx context.Context, src objstore.Bucket, srcName, dstName string) (err error) {
+	doWithSpan(ctx, "bucket_copy_from_bucket", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("src_bucket", src.Name(), "src", srcName, "dst", dstName)
+		err = objstore.CopyFromBucket(spanCtx, src, t.bkt, srcName, dstName)
+	})
+	return
+}
+
+func (t TracingBucket) CopyWithAttributes(ctx context.Context, src, dst string, attrs objstore.CopyObjectAttributes) (err error) {
+	doWithSpan(ctx, "bucket_copy_with_attributes", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("src", src, "dst", dst)
+		err = objstore.CopyWithAttributes(spanCtx, t.bkt, src, dst, attrs)
+	})
+	return
+}
+
+func (t TracingBucket) Rename(ctx context.Context, src, dst string) (err error) {
+	doWithSpan(ctx, "bucket_rename", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("src", src, "dst", dst)
+		err = objstore.Rename(spanCtx, t.bkt, src, dst)
+	})
+	return
+}
+
+func (t TracingBucket) ListVersions(ctx context.Context, name string) (versions []objstore.VersionInfo, err error) {
+	doWithSpan(ctx, "bucket_list_versions", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		versions, err = objstore.ListVersions(spanCtx, t.bkt, name)
+	})
+	return
+}
+
+func (t TracingBucket) UpdateMetadata(ctx context.Context, name string, md map[string]string, opts ...objstore.ObjectUploadOption) (err error) {
+	doWithSpan(ctx, "bucket_update_metadata", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		err = objstore.UpdateMetadata(spanCtx, t.bkt, name, md, opts...)
+	})
+	return
+}
+
+func (t TracingBucket) SetObjectTags(ctx context.Context, name string, tags map[string]string) (err error) {
+	doWithSpan(ctx, "bucket_set_object_tags", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		err = objstore.SetObjectTags(spanCtx, t.bkt, name, tags)
+	})
+	return
+}
+
+func (t TracingBucket) GetObjectTags(ctx context.Context, name string) (tags map[string]string, err error) {
+	doWithSpan(ctx, "bucket_get_object_tags", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		tags, err = objstore.GetObjectTags(spanCtx, t.bkt, name)
+	})
+	return
+}
+
+func (t TracingBucket) DeleteObjectTags(ctx context.Context, name string) (err error) {
+	doWithSpan(ctx, "bucket_delete_object_tags", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		err = objstore.DeleteObjectTags(spanCtx, t.bkt, name)
+	})
+	return
+}
+
+func (t TracingBucket) IterVersions(ctx context.Context, prefix string, f func(name, version string, isLatest bool, deleted bool) error) (err error) {
+	doWithSpan(ctx, "bucket_iter_versions", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("prefix", prefix)
+		err = objstore.IterVersions(spanCtx, t.bkt, prefix, f)
+	})
+	return
+}
+
+func (t TracingBucket) GetVersion(ctx context.Context, name, versionID string) (io.ReadCloser, error) {
+	span, spanCtx := startSpan(ctx, "bucket_get_version")
+	span.LogKV("name", name, "version_id", versionID)
+
+	r, err := objstore.GetVersion(spanCtx, t.bkt, name, versionID)
+	if err != nil {
+		span.LogKV("err", err)
+		span.Finish()
+		return nil, err
+	}
+
+	return newTracingReadCloser(r, span), nil
+}
+
+func (t TracingBucket) DeleteVersion(ctx context.Context, name, versionID string) (err error) {
+	doWithSpan(ctx, "bucket_delete_version", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name, "version_id", versionID)
+		err = objstore.DeleteVersion(spanCtx, t.bkt, name, versionID)
+	})
+	return
+}
+
+func (t TracingBucket) RestoreVersion(ctx context.Context, name, versionID string) (err error) {
+	doWithSpan(ctx, "bucket_restore_version", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name, "version_id", versionID)
+		err = objstore.RestoreVersion(spanCtx, t.bkt, name, versionID)
+	})
+	return
+}
+
+func (t TracingBucket) Ping(ctx context.Context) (err error) {
+	doWithSpan(ctx, "bucket_ping", func(spanCtx context.Context, span opentracing.Span) {
+		err = objstore.Ping(spanCtx, t.bkt)
+	})
+	return
+}
+
+func (t TracingBucket) PresignedGetURL(ctx context.Context, name string, expiry time.Duration) (url string, err error) {
+	doWithSpan(ctx, "bucket_presign_get", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name, "expiry", expiry)
+		url, err = objstore.PresignedGetURL(spanCtx, t.bkt, name, expiry)
+	})
+	return
+}
+
+func (t TracingBucket) PresignPut(ctx context.Context, name string, expiry time.Duration) (url string, err error) {
+	doWithSpan(ctx, "bucket_presign_put", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name, "expiry", expiry)
+		url, err = objstore.PresignPut(spanCtx, t.bkt, name, expiry)
+	})
+	return
+}
+
+func (t TracingBucket) NewMultipartUpload(ctx context.Context, name string, opts ...objstore.ObjectUploadOption) (w objstore.MultipartWriter, err error) {
+	doWithSpan(ctx, "bucket_new_multipart_upload", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name)
+		w, err = objstore.NewMultipartUpload(spanCtx, t.bkt, name, opts...)
+	})
+	return
+}
+
 func (t TracingBucket) Name() string {
 	return "tracing: " + t.bkt.Name()
 }
 
+func (t TracingBucket) WrappedBucket() objstore.Bucket {
+	return t.bkt
+}
+
 func (t TracingBucket) Close() error {
 	return t.bkt.Close()
 }